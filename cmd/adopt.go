@@ -0,0 +1,41 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// adoptCmd represents the adopt command
+var adoptCmd = &cobra.Command{
+	Use:   "adopt <wg-interface>",
+	Args:  cobra.ExactArgs(1),
+	Short: "take an existing wireguard interface under netclient management",
+	Long: `join a network keeping the keys, listen port and addresses of an existing wireguard interface,
+the interface is replaced by the netmaker interface
+For example:
+
+netclient adopt wg0 -t <token>`,
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := getToken(cmd)
+		if err != nil || token == "" {
+			fmt.Println("\nan enrollment token is required")
+			cmd.Usage()
+			return
+		}
+		if err := functions.Adopt(args[0], token); err != nil {
+			fmt.Println("\nadopt failed:", err)
+			return
+		}
+		fmt.Println("\nadopted interface", args[0])
+	},
+}
+
+func init() {
+	adoptCmd.Flags().StringP(registerFlags.Token, "t", "", "enrollment token for the network, - reads it from stdin (default $NETCLIENT_TOKEN)")
+	rootCmd.AddCommand(adoptCmd)
+}
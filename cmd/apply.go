@@ -0,0 +1,96 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply -f <file>",
+	Args:  cobra.NoArgs,
+	Short: "apply a desired state of networks and settings",
+	Long: `declare the networks and local settings this host should have in a yaml file, the daemon
+computes the difference to the current state and applies it; applying the same file again changes nothing
+For example:
+
+netclient apply -f changes.yaml
+netclient apply -f changes.yaml --dry-run
+cat changes.yaml | netclient apply -f -
+
+networks:
+  office:
+    token: <enrollment token, used if not joined yet>
+  lab:
+    connected: false
+prune: true  # leave networks not listed
+settings:    # keys as in netclient.yml
+  wolrelay: true
+  blockedpeers: []`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if file == "" {
+			cmd.Usage()
+			return
+		}
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Println("\nfailed to read desired state:", err)
+			return
+		}
+		var state functions.DesiredState
+		if err := yaml.Unmarshal(data, &state); err != nil {
+			fmt.Println("\ninvalid desired state:", err)
+			return
+		}
+		changes, err := functions.ApplyDesiredState(state, dryRun)
+		if err != nil {
+			fmt.Println("\napply failed:", err)
+			return
+		}
+		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+			out, _ := json.MarshalIndent(changes, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		if len(changes) == 0 {
+			fmt.Println("\nNo Changes")
+			return
+		}
+		if dryRun {
+			fmt.Println("\nChanges To Apply:")
+		} else {
+			fmt.Println("\nChanges:")
+		}
+		for _, change := range changes {
+			if change.Error != "" {
+				fmt.Printf("%s %s: failed: %s\n", change.Action, change.Target, change.Error)
+				continue
+			}
+			fmt.Println(change.Action, change.Target)
+		}
+	},
+}
+
+func init() {
+	applyCmd.Flags().StringP("file", "f", "", "yaml file with the desired state, - reads it from stdin")
+	applyCmd.Flags().Bool("dry-run", false, "only show the changes")
+	applyCmd.Flags().Bool("json", false, "output the changes as json")
+	rootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/spf13/cobra"
+)
+
+// approveCmd represents the approve command
+var approveCmd = &cobra.Command{
+	Use:   "approve [change-id]",
+	Args:  cobra.RangeArgs(0, 1),
+	Short: "approve a pending server change",
+	Long: `approve a disruptive server change held back by sign-off mode (requireapproval)
+For example:
+
+netclient approve           //list changes waiting for approval
+netclient approve 4fGh9kLm  //approve change 4fGh9kLm`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			changes, err := functions.ListPendingChanges()
+			if err != nil {
+				fmt.Println("\nfailed to list pending changes:", err)
+				return
+			}
+			if len(changes) == 0 {
+				fmt.Println("\nNo Pending Changes")
+				return
+			}
+			utc, _ := cmd.Flags().GetBool("utc")
+			fmt.Println("\nPending Changes:")
+			for _, change := range changes {
+				fmt.Printf("%s\t%s\t%s\texpires %s\n", change.ID, change.Server, change.Description,
+					ncutils.FormatTime(change.Expires, utc))
+			}
+			return
+		}
+		if err := functions.Approve(args[0]); err != nil {
+			fmt.Println("\napprove failed:", err)
+			return
+		}
+		fmt.Println("\napproved change", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(approveCmd)
+}
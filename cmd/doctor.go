@@ -0,0 +1,60 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Args:  cobra.NoArgs,
+	Short: "check the host for common problems",
+	Long: `run local checks of wireguard support, iptables, ip forwarding, port reachability,
+dns integration and clock skew, and print hints for the problems found
+exits with 1 if a check failed
+For example:
+
+netclient doctor
+netclient doctor --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checks := functions.Doctor()
+		failed := false
+		for _, check := range checks {
+			if check.Result == functions.CheckFail {
+				failed = true
+			}
+		}
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			data, err := json.MarshalIndent(checks, "", "  ")
+			if err != nil {
+				fmt.Println("\nfailed to encode checks:", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+		} else {
+			fmt.Println()
+			for _, check := range checks {
+				fmt.Printf("[%s] %s: %s\n", check.Result, check.Name, check.Detail)
+				if check.Hint != "" {
+					fmt.Printf("       hint: %s\n", check.Hint)
+				}
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	doctorCmd.Flags().Bool("json", false, "print the checks as json")
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,39 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// exit codes of join and leave, for provisioning tools (terraform remote-exec, ansible)
+const (
+	// exitFailed - the command failed
+	exitFailed = 1
+	// exitChanged - the command changed the host, only with --detailed-exitcode, otherwise 0
+	exitChanged = 2
+	// exitTimeout - the change was requested but not completed within --timeout
+	exitTimeout = 3
+)
+
+// defaultProvisioningTimeout - default of --timeout
+const defaultProvisioningTimeout = time.Minute * 2
+
+// addProvisioningFlags - adds the flags controlling waiting and exit codes of join and leave
+func addProvisioningFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("wait", false, "wait until the change is applied to the interface")
+	cmd.Flags().Duration("timeout", defaultProvisioningTimeout, "how long --wait waits")
+	cmd.Flags().Bool("detailed-exitcode", false, "exit with 0 when nothing changed and with 2 when the host changed")
+}
+
+// exitProvisioning - exits with the code for a successful command which changed the host or not
+func exitProvisioning(cmd *cobra.Command, changed bool) {
+	if detailed, _ := cmd.Flags().GetBool("detailed-exitcode"); detailed && changed {
+		os.Exit(exitChanged)
+	}
+	os.Exit(0)
+}
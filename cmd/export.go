@@ -0,0 +1,43 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export configuration [wgquick]",
+	Long:  `export the host configuration in other formats`,
+}
+
+// exportWgQuickCmd represents the export wgquick command
+var exportWgQuickCmd = &cobra.Command{
+	Use:   "wgquick <network>",
+	Args:  cobra.ExactArgs(1),
+	Short: "export a network as a wg-quick config",
+	Long: `export the configuration of a network as a standalone wg-quick config, for emergency use
+when the daemon can not run, the config contains the host's private key
+For example:
+
+netclient export wgquick mynet > /etc/wireguard/netmaker.conf && wg-quick up netmaker`,
+	Run: func(cmd *cobra.Command, args []string) {
+		conf, err := functions.ExportWgQuick(args[0])
+		if err != nil {
+			fmt.Println("\nexport failed:", err)
+			return
+		}
+		fmt.Print(conf)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportWgQuickCmd)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// exposeCmd represents the expose command
+var exposeCmd = &cobra.Command{
+	Use:   "expose [local-address]",
+	Args:  cobra.RangeArgs(0, 1),
+	Short: "expose a local service to the peers",
+	Long: `forward connections from peers on the mesh addresses to a local service, e.g. one listening on
+loopback only, without reconfiguring the service; only current peers of this host may connect
+For example:
+
+netclient expose                                 // list exposed services
+netclient expose 127.0.0.1:8080                  // expose on port 8080 of all mesh addresses
+netclient expose 127.0.0.1:8080 --as :9090       // expose on port 9090 of all mesh addresses
+netclient expose 127.0.0.1:8080 --as 10.0.0.5:80 // expose on one mesh address
+netclient expose --remove :9090                  // stop exposing`,
+	Run: func(cmd *cobra.Command, args []string) {
+		listen, _ := cmd.Flags().GetString("as")
+		if remove, _ := cmd.Flags().GetString("remove"); remove != "" {
+			if err := functions.Unexpose(remove); err != nil {
+				fmt.Println("\nfailed to remove exposed service:", err)
+				return
+			}
+			fmt.Println("\nstopped exposing", remove)
+			return
+		}
+		if len(args) == 0 {
+			exposed, err := functions.ListExposed()
+			if err != nil {
+				fmt.Println("\nfailed to list exposed services:", err)
+				return
+			}
+			if len(exposed) == 0 {
+				fmt.Println("\nNo Exposed Services")
+				return
+			}
+			fmt.Println("\nExposed Services:")
+			for _, e := range exposed {
+				fmt.Printf("%s\t-> %s\n", e.Listen, e.Target)
+			}
+			return
+		}
+		if err := functions.Expose(args[0], listen); err != nil {
+			fmt.Println("\nexpose failed:", err)
+			return
+		}
+		fmt.Println("\nexposed", args[0])
+	},
+}
+
+func init() {
+	exposeCmd.Flags().String("as", "", "mesh address and port to expose the service on, [address]:port")
+	exposeCmd.Flags().String("remove", "", "stop exposing the service on [address]:port")
+	rootCmd.AddCommand(exposeCmd)
+}
@@ -0,0 +1,44 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// factsCmd represents the facts command
+var factsCmd = &cobra.Command{
+	Use:   "facts",
+	Args:  cobra.NoArgs,
+	Short: "print facts about this host as json for configuration management tools",
+	Long: `print the identity, networks, addresses, versions and capabilities of this host as a json document,
+read from the configuration so it works when the daemon is down
+For example:
+
+netclient facts                  // as ansible local fact (ansible_local.netclient) from an executable
+                                 // /etc/ansible/facts.d/netclient.fact running it
+netclient facts --root netclient // as puppet external fact or chef ohai input, under a single netclient key`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var document any = functions.GetFacts()
+		if root, _ := cmd.Flags().GetString("root"); root != "" {
+			document = map[string]any{root: document}
+		}
+		data, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to encode facts:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	},
+}
+
+func init() {
+	factsCmd.Flags().String("root", "", "nest the facts under this key")
+	rootCmd.AddCommand(factsCmd)
+}
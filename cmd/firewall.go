@@ -0,0 +1,140 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// firewallCmd represents the firewall command
+var firewallCmd = &cobra.Command{
+	Use:   "firewall",
+	Short: "inspect the netmaker firewall rules [list, preview]",
+	Long:  `inspect the firewall rules managed by netclient`,
+}
+
+// firewallPreviewCmd represents the firewall preview command
+var firewallPreviewCmd = &cobra.Command{
+	Use:   "preview",
+	Args:  cobra.NoArgs,
+	Short: "show the rules the daemon would install",
+	Long: `show the full rule set (table, chain, rule) the daemon would have installed, when it runs with
+firewalldryrun set in netclient.yml it logs the rules instead of applying them (linux only)
+For example:
+
+netclient firewall preview
+netclient firewall preview --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		rules, err := functions.FirewallPreview()
+		if err != nil {
+			fmt.Println("\npreview failed:", err)
+			return
+		}
+		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+			out, _ := json.MarshalIndent(rules, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		if len(rules) == 0 {
+			fmt.Println("\nNo Firewall Rules")
+			return
+		}
+		fmt.Println("\nFirewall Rules:")
+		for _, rule := range rules {
+			fmt.Printf("%s %s %s: %s\n", rule.Family, rule.Table, rule.Chain, rule.Rule)
+		}
+	},
+}
+
+// firewallListCmd represents the firewall list command
+var firewallListCmd = &cobra.Command{
+	Use:   "list",
+	Args:  cobra.NoArgs,
+	Short: "list the rules managed by the daemon",
+	Long: `list the rules of the rule tables the daemon maintains, by server and table (ingress, egress),
+followed by the rules of blocked peers and the static nat of ext clients
+For example:
+
+netclient firewall list
+netclient firewall list --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		rules, err := functions.FirewallRules()
+		if err != nil {
+			fmt.Println("\nlist failed:", err)
+			return
+		}
+		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+			out, _ := json.MarshalIndent(rules, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		if len(rules) == 0 {
+			fmt.Println("\nNo Managed Firewall Rules")
+			return
+		}
+		group := ""
+		for _, rule := range rules {
+			current := rule.RuleTable
+			if rule.Server != "" {
+				current = rule.Server + " " + rule.RuleTable
+			}
+			if current != group {
+				fmt.Printf("\n%s:\n", current)
+				group = current
+			}
+			key := rule.Key
+			if rule.Peer != "" && rule.Peer != rule.Key {
+				key += " -> " + rule.Peer
+			}
+			if rule.Network != "" {
+				key += " (" + rule.Network + ")"
+			}
+			fmt.Printf("  %s [%s] %s %s: %s\n", key, rule.Family, rule.Table, rule.Chain, rule.Rule)
+		}
+	},
+}
+
+// firewallDropLogCmd represents the firewall droplog command
+var firewallDropLogCmd = &cobra.Command{
+	Use:       "droplog [on|off]",
+	Args:      cobra.MatchAll(cobra.RangeArgs(0, 1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"on", "off"},
+	Short:     "log the packets dropped by the netmaker rules",
+	Long: `logs the packets dropped by the netmaker rules (blocked peers, inter-network routing, default-deny
+networks) to the kernel log with the netmaker-drop: prefix, rate limited to 10 packets per minute per rule
+For example:
+
+netclient firewall droplog      // show whether drop logging is enabled
+netclient firewall droplog on   // enable drop logging
+netclient firewall droplog off  // disable drop logging`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			if config.Netclient().LogDrops {
+				fmt.Println("\ndrop logging is enabled")
+			} else {
+				fmt.Println("\ndrop logging is disabled")
+			}
+			return
+		}
+		if err := functions.SetDropLogging(args[0] == "on"); err != nil {
+			fmt.Println("\nfailed to switch drop logging:", err)
+			return
+		}
+		fmt.Println("\ndrop logging", args[0])
+	},
+}
+
+func init() {
+	firewallPreviewCmd.Flags().Bool("json", false, "output the rules as json")
+	firewallListCmd.Flags().Bool("json", false, "output the rules as json")
+	rootCmd.AddCommand(firewallCmd)
+	firewallCmd.AddCommand(firewallPreviewCmd)
+	firewallCmd.AddCommand(firewallListCmd)
+	firewallCmd.AddCommand(firewallDropLogCmd)
+}
@@ -4,6 +4,11 @@ Copyright © 2022 Netmaker Team <info@netmaker.io>
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netclient/functions"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/spf13/cobra"
@@ -16,31 +21,58 @@ var joinCmd = &cobra.Command{
 	Long: `join a netmaker network using: 
 
 token: netclient join -t <token> // join using token
+stdin: echo <token> | netclient join -t - // join using token read from stdin, or set NETCLIENT_TOKEN
 server: netclient join -s <server> // join a specific server via SSO if Oauth configured
 net: netclient join -s <server> -n <net> // attempt to join specified network via auth
 all-networks: netclient join -s <server> -A // attempt to register to all allowed networks on given server via auth
-user: netclient join -s <server> -u <user_name> // attempt to join/register via basic auth`,
+user: netclient join -s <server> -u <user_name> // attempt to join/register via basic auth
+cloud: netclient join --cloud-metadata // join using the token in the netmaker-token tag/attribute of the cloud instance
+
+joining a network given with -n the host is already part of changes nothing and succeeds, for provisioning:
+netclient join -t <token> -n <net> --wait --timeout 5m --detailed-exitcode
+exit codes: 0 success (with --detailed-exitcode: nothing changed), 1 failure, 2 joined (with --detailed-exitcode),
+3 not ready within --timeout`,
 
 	Run: func(cmd *cobra.Command, args []string) {
+		network, _ := cmd.Flags().GetString(registerFlags.Network)
+		if network != "" && functions.IsJoined(network) {
+			fmt.Println("\nalready joined network", network)
+			exitProvisioning(cmd, false)
+		}
+		known := config.GetNodes()
 		setHostFields(cmd)
 		functions.Push(false)
-		token, err := cmd.Flags().GetString(registerFlags.Token)
+		token, err := getToken(cmd)
 		if err != nil || len(token) == 0 {
 			if regErr := checkUserRegistration(cmd); regErr != nil {
 				cmd.Usage()
-				return
+				os.Exit(exitFailed)
 			}
 		} else {
 			if err := functions.Register(token, false); err != nil {
 				logger.Log(0, "registration failed", err.Error())
+				os.Exit(exitFailed)
+			}
+		}
+		if wait, _ := cmd.Flags().GetBool("wait"); wait {
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			joined, err := functions.WaitForJoin(ctx, network, known)
+			cancel()
+			if err != nil {
+				fmt.Println("\njoin not completed within", timeout)
+				os.Exit(exitTimeout)
 			}
+			fmt.Println("\njoined network", joined)
 		}
+		exitProvisioning(cmd, true)
 	},
 }
 
 func init() {
 	joinCmd.Flags().StringP(registerFlags.Server, "s", "", "server for attempting SSO/Auth registration")
-	joinCmd.Flags().StringP(registerFlags.Token, "t", "", "enrollment token for joining/registering")
+	joinCmd.Flags().StringP(registerFlags.Token, "t", "", "enrollment token for joining/registering, - reads it from stdin (default $NETCLIENT_TOKEN)")
+	joinCmd.Flags().Bool(registerFlags.Cloud, false, "read the enrollment token from cloud instance metadata (aws, gcp, azure)")
 	joinCmd.Flags().StringP(registerFlags.User, "u", "", "user name for attempting Basic Auth join/registration")
 	joinCmd.Flags().StringP(registerFlags.Network, "n", "", "network to attempt to join/register to")
 	joinCmd.Flags().BoolP(registerFlags.AllNetworks, "A", false, "attempts to join/register to all available networks to user")
@@ -50,5 +82,6 @@ func init() {
 	joinCmd.Flags().BoolP(registerFlags.Static, "i", false, "flag to set host as static")
 	joinCmd.Flags().StringP(registerFlags.Name, "o", "", "sets host name")
 	joinCmd.Flags().StringP(registerFlags.Interface, "I", "", "sets netmaker interface to use on host")
+	addProvisioningFlags(joinCmd)
 	rootCmd.AddCommand(joinCmd)
 }
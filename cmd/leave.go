@@ -4,8 +4,11 @@ Copyright © 2022 Netmaker Team <info@netmaker.io>
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
 
+	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netclient/functions"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/spf13/cobra"
@@ -16,25 +19,46 @@ var leaveCmd = &cobra.Command{
 	Use:   "leave <network>",
 	Args:  cobra.ExactArgs(1),
 	Short: "leave a network",
-	Long: `leave the specified network 
+	Long: `leave the specified network, leaving a network the host is not part of changes nothing and succeeds
 For example:
 
-netclient leave my-network`,
+netclient leave my-network
+netclient leave my-network --wait --detailed-exitcode
+
+exit codes: 0 success (with --detailed-exitcode: nothing changed), 1 failure, 2 left (with --detailed-exitcode),
+3 addresses still on the interface after --timeout`,
 	Run: func(cmd *cobra.Command, args []string) {
 		logger.Log(0, "leave called")
+		if !functions.IsJoined(args[0]) {
+			fmt.Println("\nnot part of network", args[0])
+			exitProvisioning(cmd, false)
+		}
+		node := config.GetNode(args[0])
 		faults, err := functions.LeaveNetwork(args[0], false)
 		if err != nil {
 			fmt.Println(err.Error())
 			for _, fault := range faults {
 				fmt.Println(fault.Error())
 			}
-		} else {
-			fmt.Println("successfully left network ", args[0])
+			os.Exit(exitFailed)
+		}
+		fmt.Println("successfully left network ", args[0])
+		if wait, _ := cmd.Flags().GetBool("wait"); wait {
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := functions.WaitForLeave(ctx, node)
+			cancel()
+			if err != nil {
+				fmt.Println("\nleave not completed within", timeout)
+				os.Exit(exitTimeout)
+			}
 		}
+		exitProvisioning(cmd, true)
 	},
 }
 
 func init() {
+	addProvisioningFlags(leaveCmd)
 	rootCmd.AddCommand(leaveCmd)
 	// Here you will define your flags and configuration settings.
 
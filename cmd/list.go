@@ -27,10 +27,11 @@ netclient list  -l      //display extented details of all networks
 		if err != nil {
 			logger.Log(0, "error getting flags", err.Error())
 		}
+		utc, _ := cmd.Flags().GetBool("utc")
 		if len(args) > 0 {
-			functions.List(args[0], long)
+			functions.List(args[0], long, utc)
 		} else {
-			functions.List("", long)
+			functions.List("", long, utc)
 		}
 	},
 }
@@ -0,0 +1,47 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// lockdownCmd represents the lockdown command
+var lockdownCmd = &cobra.Command{
+	Use:       "lockdown [on|off]",
+	Args:      cobra.MatchAll(cobra.RangeArgs(0, 1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"on", "off"},
+	Short:     "refuse remote configuration changes except peer updates",
+	Long: `in lockdown mode the daemon only applies peer updates from the servers and refuses upgrades, host,
+node, egress and dns changes; it can only be switched locally
+For example:
+
+netclient lockdown      // show whether lockdown mode is enabled
+netclient lockdown on   // enable lockdown mode
+netclient lockdown off  // disable lockdown mode`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			if config.Netclient().Lockdown {
+				fmt.Println("\nlockdown mode is enabled")
+			} else {
+				fmt.Println("\nlockdown mode is disabled")
+			}
+			return
+		}
+		enabled := args[0] == "on"
+		if err := functions.SetLockdown(enabled); err != nil {
+			fmt.Println("\nfailed to switch lockdown mode:", err)
+			return
+		}
+		fmt.Println("\nlockdown mode", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lockdownCmd)
+}
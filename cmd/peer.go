@@ -0,0 +1,246 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/spf13/cobra"
+)
+
+// peerCmd represents the peer command
+var peerCmd = &cobra.Command{
+	Use:     "peer",
+	Aliases: []string{"peers"},
+	Short:   "manage peers locally [block|unblock|blocked|schedule|schedules|pin|pins|history]",
+	Long:    `manage peers of this host locally, independently of the server`,
+}
+
+// peerBlockCmd represents the peer block command
+var peerBlockCmd = &cobra.Command{
+	Use:   "block <public-key>",
+	Args:  cobra.ExactArgs(1),
+	Short: "isolate a peer",
+	Long: `remove a peer from the interface and drop traffic from and to its addresses until it is
+unblocked, the block survives updates from the server and restarts
+For example:
+
+netclient peer block kfz0u5yZc0JEzRqGxH0bXFXt3ZlJ0c/Q9IPbXZ3Cr2o=`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := functions.BlockPeer(args[0]); err != nil {
+			fmt.Println("\nblock failed:", err)
+			return
+		}
+		fmt.Println("\nblocked peer", args[0])
+	},
+}
+
+// peerUnblockCmd represents the peer unblock command
+var peerUnblockCmd = &cobra.Command{
+	Use:   "unblock <public-key>",
+	Args:  cobra.ExactArgs(1),
+	Short: "restore a blocked peer",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := functions.UnblockPeer(args[0]); err != nil {
+			fmt.Println("\nunblock failed:", err)
+			return
+		}
+		fmt.Println("\nunblocked peer", args[0])
+	},
+}
+
+// peerBlockedCmd represents the peer blocked command
+var peerBlockedCmd = &cobra.Command{
+	Use:   "blocked",
+	Args:  cobra.NoArgs,
+	Short: "list the blocked peers",
+	Run: func(cmd *cobra.Command, args []string) {
+		blocked := config.Netclient().BlockedPeers
+		if len(blocked) == 0 {
+			fmt.Println("\nNo Blocked Peers")
+			return
+		}
+		fmt.Println("\nBlocked Peers:")
+		for _, key := range blocked {
+			fmt.Println(key)
+		}
+	},
+}
+
+// peerScheduleCmd represents the peer schedule command
+var peerScheduleCmd = &cobra.Command{
+	Use:   "schedule <public-key>",
+	Args:  cobra.ExactArgs(1),
+	Short: "restrict a peer to a time window",
+	Long: `allow a peer only within a time window, outside of all windows of a peer it is blocked,
+a peer may have several windows, --remove drops all windows of the peer
+For example:
+
+netclient peer schedule kfz0u5yZc0JEzRqGxH0bXFXt3ZlJ0c/Q9IPbXZ3Cr2o= --days mon-fri --from 09:00 --to 17:00
+netclient peer schedule kfz0u5yZc0JEzRqGxH0bXFXt3ZlJ0c/Q9IPbXZ3Cr2o= --from 22:00 --to 06:00 --timezone Europe/Berlin
+netclient peer schedule kfz0u5yZc0JEzRqGxH0bXFXt3ZlJ0c/Q9IPbXZ3Cr2o= --remove`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if remove, _ := cmd.Flags().GetBool("remove"); remove {
+			if err := functions.RemoveAccessSchedules(args[0]); err != nil {
+				fmt.Println("\nremoving schedules failed:", err)
+				return
+			}
+			fmt.Println("\nremoved schedules of peer", args[0])
+			return
+		}
+		schedule := config.AccessSchedule{Peer: args[0]}
+		schedule.Days, _ = cmd.Flags().GetStringSlice("days")
+		schedule.Start, _ = cmd.Flags().GetString("from")
+		schedule.End, _ = cmd.Flags().GetString("to")
+		schedule.Timezone, _ = cmd.Flags().GetString("timezone")
+		if err := schedule.Validate(); err != nil {
+			fmt.Println("\ninvalid schedule:", err)
+			return
+		}
+		if err := functions.SetAccessSchedule(schedule); err != nil {
+			fmt.Println("\nschedule failed:", err)
+			return
+		}
+		fmt.Println("\nscheduled peer", args[0])
+	},
+}
+
+// peerSchedulesCmd represents the peer schedules command
+var peerSchedulesCmd = &cobra.Command{
+	Use:   "schedules",
+	Args:  cobra.NoArgs,
+	Short: "list the access schedules of peers",
+	Run: func(cmd *cobra.Command, args []string) {
+		schedules := config.Netclient().AccessSchedules
+		if len(schedules) == 0 {
+			fmt.Println("\nNo Access Schedules")
+			return
+		}
+		fmt.Println("\nAccess Schedules:")
+		now := time.Now()
+		for _, schedule := range schedules {
+			days := "every day"
+			if len(schedule.Days) > 0 {
+				days = strings.Join(schedule.Days, ",")
+			}
+			timezone := schedule.Timezone
+			if timezone == "" {
+				timezone = "local"
+			}
+			state := "denied"
+			if schedule.Allows(now) {
+				state = "allowed"
+			}
+			fmt.Printf("%s %s %s-%s (%s) %s\n", schedule.Peer, days, schedule.Start, schedule.End, timezone, state)
+		}
+	},
+}
+
+// peerPinCmd represents the peer pin command
+var peerPinCmd = &cobra.Command{
+	Use:       "pin <public-key> <direct|lan|relay|auto>",
+	Args:      cobra.ExactArgs(2),
+	ValidArgs: []string{config.PeerPathDirect, config.PeerPathLAN, config.PeerPathRelay, config.PeerPathAuto},
+	Short:     "pin the path to a peer",
+	Long: `override the automatic path selection for a peer: direct always uses the endpoint advertised
+by the server, lan the endpoint detected on a shared lan without failing over, relay reaches the peer
+through the failover node; auto restores the automatic selection, the pin survives restarts
+For example:
+
+netclient peer pin kfz0u5yZc0JEzRqGxH0bXFXt3ZlJ0c/Q9IPbXZ3Cr2o= relay
+netclient peer pin kfz0u5yZc0JEzRqGxH0bXFXt3ZlJ0c/Q9IPbXZ3Cr2o= auto`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := config.ValidatePeerPath(args[1]); err != nil {
+			fmt.Println("\npin failed:", err)
+			return
+		}
+		if err := functions.PinPeerPath(args[0], args[1]); err != nil {
+			fmt.Println("\npin failed:", err)
+			return
+		}
+		fmt.Println("\npinned peer", args[0], "to", args[1])
+	},
+}
+
+// peerPinsCmd represents the peer pins command
+var peerPinsCmd = &cobra.Command{
+	Use:   "pins",
+	Args:  cobra.NoArgs,
+	Short: "list the pinned peer paths",
+	Run: func(cmd *cobra.Command, args []string) {
+		pins := map[string]string{}
+		for key, path := range config.Netclient().PeerPaths {
+			if path != config.PeerPathAuto {
+				pins[key] = path
+			}
+		}
+		if len(pins) == 0 {
+			fmt.Println("\nNo Pinned Peers")
+			return
+		}
+		keys := make([]string, 0, len(pins))
+		for key := range pins {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Println("\nPinned Peers:")
+		for _, key := range keys {
+			fmt.Println(key, pins[key])
+		}
+	},
+}
+
+// peerHistoryCmd represents the peer history command
+var peerHistoryCmd = &cobra.Command{
+	Use:   "history <public-key>",
+	Args:  cobra.ExactArgs(1),
+	Short: "show the connectivity history of a peer",
+	Long: `show the transitions of a peer between up and down and between a direct and a relayed path,
+as recorded by the daemon
+For example:
+
+netclient peers history kfz0u5yZc0JEzRqGxH0bXFXt3ZlJ0c/Q9IPbXZ3Cr2o=`,
+	Run: func(cmd *cobra.Command, args []string) {
+		events, err := functions.GetPeerHistory(args[0])
+		if err != nil {
+			fmt.Println("\nhistory failed:", err)
+			return
+		}
+		utc, _ := cmd.Flags().GetBool("utc")
+		fmt.Println("\nConnectivity History:")
+		for _, event := range events {
+			line := ncutils.FormatTime(event.Time, utc) + " " + event.State
+			if event.Path != "" {
+				line += " " + event.Path
+			}
+			if event.Via != "" {
+				line += " via " + event.Via
+			}
+			fmt.Println(line)
+		}
+	},
+}
+
+func init() {
+	peerScheduleCmd.Flags().StringSlice("days", nil, "days the window starts on, as mon..sun or ranges like mon-fri, every day if unset")
+	peerScheduleCmd.Flags().String("from", "", "start of the window as HH:MM")
+	peerScheduleCmd.Flags().String("to", "", "end of the window as HH:MM, before the start for windows over midnight")
+	peerScheduleCmd.Flags().String("timezone", "", "timezone of the window, e.g. Europe/Berlin, the local timezone if unset")
+	peerScheduleCmd.Flags().Bool("remove", false, "remove all windows of the peer")
+	rootCmd.AddCommand(peerCmd)
+	peerCmd.AddCommand(peerBlockCmd)
+	peerCmd.AddCommand(peerUnblockCmd)
+	peerCmd.AddCommand(peerBlockedCmd)
+	peerCmd.AddCommand(peerScheduleCmd)
+	peerCmd.AddCommand(peerSchedulesCmd)
+	peerCmd.AddCommand(peerPinCmd)
+	peerCmd.AddCommand(peerPinsCmd)
+	peerCmd.AddCommand(peerHistoryCmd)
+}
@@ -27,5 +27,6 @@ func init() {
 	pushCmd.Flags().BoolP(registerFlags.Static, "i", false, "flag to set host as static")
 	pushCmd.Flags().StringP(registerFlags.Name, "o", "", "sets host name")
 	pushCmd.Flags().StringP(registerFlags.Interface, "I", "", "sets netmaker interface to use on host")
+	pushCmd.Flags().String(registerFlags.PortRange, "", "restricts udp ports used by netclient to a range, e.g 51821-51900")
 	rootCmd.AddCommand(pushCmd)
 }
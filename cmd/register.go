@@ -4,7 +4,10 @@ Copyright © 2022 Netmaker Team <info@netmaker.io>
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"runtime"
@@ -19,6 +22,13 @@ import (
 	"golang.org/x/term"
 )
 
+const (
+	// tokenEnv - environment variable holding the enrollment token
+	tokenEnv = "NETCLIENT_TOKEN"
+	// passwordEnv - environment variable holding the password for basic auth registration
+	passwordEnv = "NETCLIENT_PASSWORD"
+)
+
 var registerFlags = struct {
 	Server      string
 	User        string
@@ -31,6 +41,8 @@ var registerFlags = struct {
 	Static      string
 	Interface   string
 	Name        string
+	PortRange   string
+	Cloud       string
 }{
 	Server:      "server",
 	User:        "user",
@@ -43,6 +55,8 @@ var registerFlags = struct {
 	Static:      "static",
 	Name:        "name",
 	Interface:   "interface",
+	PortRange:   "port-range",
+	Cloud:       "cloud-metadata",
 }
 
 // registerCmd represents the register command
@@ -58,7 +72,7 @@ user: netclient register -s <server> -u <user_name> // attempt to join/register
 	Run: func(cmd *cobra.Command, args []string) {
 		setHostFields(cmd)
 		functions.Push(false)
-		token, err := cmd.Flags().GetString(registerFlags.Token)
+		token, err := getToken(cmd)
 		if err != nil || len(token) == 0 {
 			if regErr := checkUserRegistration(cmd); regErr != nil {
 				cmd.Usage()
@@ -67,19 +81,78 @@ user: netclient register -s <server> -u <user_name> // attempt to join/register
 		} else {
 			if err := functions.Register(token, false); err != nil {
 				logger.Log(0, "registration failed", err.Error())
+				os.Exit(1)
 			}
 		}
 	},
 }
 
+// getToken - returns the enrollment token given on the command line (- reads it from stdin),
+// in the NETCLIENT_TOKEN environment variable or read from cloud instance metadata
+func getToken(cmd *cobra.Command) (string, error) {
+	token, err := cmd.Flags().GetString(registerFlags.Token)
+	if err != nil {
+		return "", err
+	}
+	if token == "-" {
+		return readSecret()
+	}
+	if token != "" {
+		return token, nil
+	}
+	if token = os.Getenv(tokenEnv); token != "" {
+		// keep the token out of the environment of child processes
+		os.Unsetenv(tokenEnv)
+		return token, nil
+	}
+	if cloud, _ := cmd.Flags().GetBool(registerFlags.Cloud); cloud {
+		token, err = functions.GetCloudEnrollmentToken()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	return token, nil
+}
+
+// readSecret - reads a secret from the first line of stdin
+func readSecret() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
 func setHostFields(cmd *cobra.Command) {
 	fmt.Println("setting host fields")
+	if portRange, err := cmd.Flags().GetString(registerFlags.PortRange); err == nil && portRange != "" {
+		start, end, err := config.ParsePortRange(portRange)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		config.Netclient().PortRangeStart = start
+		config.Netclient().PortRangeEnd = end
+		if !config.InPortRange(config.Netclient().ListenPort) {
+			port, err := config.GetFreeListenPort(start)
+			if err != nil {
+				fmt.Println("no free port available in range", portRange, err)
+				os.Exit(1)
+			}
+			config.Netclient().ListenPort = port
+		}
+	}
 	if port, err := cmd.Flags().GetInt(registerFlags.Port); err == nil && port != 0 {
 		// check if port is available
 		if !ncutils.IsPortFree(port) {
 			fmt.Printf("port %d is not free\n", port)
 			os.Exit(1)
 		}
+		if !config.InPortRange(port) {
+			fmt.Printf("port %d is outside of the configured port range\n", port)
+			os.Exit(1)
+		}
 		config.Netclient().ListenPort = port
 	}
 	if endpointIP, err := cmd.Flags().GetString(registerFlags.EndpointIP); err == nil && endpointIP != "" {
@@ -153,14 +226,22 @@ func checkUserRegistration(cmd *cobra.Command) error {
 
 	userName, err := cmd.Flags().GetString(registerFlags.User)
 	if err == nil && len(userName) > 0 {
-		fmt.Printf("Continuing with user, %s.\nPlease input password:\n", userName)
-		pass, err := term.ReadPassword(int(syscall.Stdin))
-		if err != nil || len(pass) == 0 {
+		pass := os.Getenv(passwordEnv)
+		os.Unsetenv(passwordEnv)
+		if pass == "" && term.IsTerminal(int(syscall.Stdin)) {
+			fmt.Printf("Continuing with user, %s.\nPlease input password:\n", userName)
+			input, err := term.ReadPassword(int(syscall.Stdin))
+			if err == nil {
+				pass = string(input)
+			}
+		} else if pass == "" {
+			pass, _ = readSecret()
+		}
+		if len(pass) == 0 {
 			logger.FatalLog("no password provided, exiting")
 		}
 		regData.User = userName
-		regData.Pass = string(pass)
-		pass = nil
+		regData.Pass = pass
 		regData.UsingSSO = false
 	}
 
@@ -169,7 +250,8 @@ func checkUserRegistration(cmd *cobra.Command) error {
 
 func init() {
 	registerCmd.Flags().StringP(registerFlags.Server, "s", "", "server for attempting SSO/Auth registration")
-	registerCmd.Flags().StringP(registerFlags.Token, "t", "", "enrollment token for registering to a Netmaker instance")
+	registerCmd.Flags().StringP(registerFlags.Token, "t", "", "enrollment token for registering to a Netmaker instance, - reads it from stdin (default $NETCLIENT_TOKEN)")
+	registerCmd.Flags().Bool(registerFlags.Cloud, false, "read the enrollment token from cloud instance metadata (aws, gcp, azure)")
 	registerCmd.Flags().StringP(registerFlags.User, "u", "", "user name for attempting Basic Auth registration")
 	registerCmd.Flags().StringP(registerFlags.Network, "n", "", "network to attempt to register to")
 	registerCmd.Flags().BoolP(registerFlags.AllNetworks, "A", false, "attempts to register to all available networks to user")
@@ -179,5 +261,6 @@ func init() {
 	registerCmd.Flags().BoolP(registerFlags.Static, "i", false, "flag to set host as static")
 	registerCmd.Flags().StringP(registerFlags.Name, "o", "", "sets host name")
 	registerCmd.Flags().StringP(registerFlags.Interface, "I", "", "sets netmaker interface to use on host")
+	registerCmd.Flags().String(registerFlags.PortRange, "", "restricts udp ports used by netclient to a range, e.g 51821-51900")
 	rootCmd.AddCommand(registerCmd)
 }
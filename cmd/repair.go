@@ -0,0 +1,68 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// repairCmd represents the repair command
+var repairCmd = &cobra.Command{
+	Use:   "repair <network>",
+	Args:  cobra.ExactArgs(1),
+	Short: "verify and repair the addresses, routes and sysctls of a network",
+	Long: `compare the interface addresses, the routes to the network and to the allowed ips of its peers,
+the routing rules, the peers and the rp_filter/forwarding sysctls with the desired state and fix the
+discrepancies in place, without a reconnect; exits with 1 if a discrepancy could not be repaired
+For example:
+
+netclient repair office
+netclient repair office --dry-run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		discrepancies, err := functions.Repair(args[0], dryRun)
+		if err != nil {
+			fmt.Println("\nrepair failed:", err)
+			os.Exit(1)
+		}
+		failed := false
+		for _, d := range discrepancies {
+			if d.Error != "" {
+				failed = true
+			}
+		}
+		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+			out, _ := json.MarshalIndent(discrepancies, "", "  ")
+			fmt.Println(string(out))
+		} else if len(discrepancies) == 0 {
+			fmt.Println("\nNo Discrepancies")
+		} else {
+			fmt.Println("\nDiscrepancies:")
+			for _, d := range discrepancies {
+				switch {
+				case d.Error != "":
+					fmt.Printf("%s: %s: repair failed: %s\n", d.Kind, d.Detail, d.Error)
+				case d.Repaired:
+					fmt.Printf("%s: %s: repaired\n", d.Kind, d.Detail)
+				default:
+					fmt.Printf("%s: %s\n", d.Kind, d.Detail)
+				}
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	repairCmd.Flags().Bool("dry-run", false, "only report the discrepancies")
+	repairCmd.Flags().Bool("json", false, "output the discrepancies as json")
+	rootCmd.AddCommand(repairCmd)
+}
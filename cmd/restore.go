@@ -0,0 +1,95 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/gravitl/netclient/daemon"
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore --from-server -s <server> -u <user> --host <host id>",
+	Args:  cobra.NoArgs,
+	Short: "restore the config of a destroyed host from its backup on the server",
+	Long: `download the encrypted config backup a host uploaded to its server (see backupinterval and
+backuppassphrasefile), decrypt it with the backup passphrase and restore the identity and local settings
+of the host; the password is read from $NETCLIENT_PASSWORD or prompted for; the server must run
+netmaker v0.22.0 or newer, older servers do not store backups
+For example:
+
+netclient restore --from-server -s api.example.com -u admin --host 3b1c...
+netclient restore --from-server -s api.example.com -u admin --host 3b1c... --passphrase-file /root/backup.key`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fromServer, _ := cmd.Flags().GetBool("from-server")
+		api, _ := cmd.Flags().GetString(registerFlags.Server)
+		user, _ := cmd.Flags().GetString(registerFlags.User)
+		hostID, _ := cmd.Flags().GetString("host")
+		if !fromServer || api == "" || user == "" || hostID == "" {
+			cmd.Usage()
+			return
+		}
+		pass := os.Getenv(passwordEnv)
+		os.Unsetenv(passwordEnv)
+		if pass == "" {
+			pass = promptSecret("password of user " + user)
+		}
+		passphrase := ""
+		if file, _ := cmd.Flags().GetString("passphrase-file"); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Println("\nfailed to read passphrase:", err)
+				os.Exit(1)
+			}
+			passphrase = strings.TrimSpace(string(data))
+		} else {
+			passphrase = promptSecret("backup passphrase")
+		}
+		if pass == "" || passphrase == "" {
+			fmt.Println("\npassword and backup passphrase are required")
+			os.Exit(1)
+		}
+		force, _ := cmd.Flags().GetBool("force")
+		backup, err := functions.RestoreFromServer(api, user, pass, hostID, passphrase, force)
+		if err != nil {
+			fmt.Println("\nrestore failed:", err)
+			os.Exit(1)
+		}
+		fmt.Println("\nrestored config of host", backup.HostID, "backed up", backup.Created.Format("2006-01-02 15:04:05"))
+		if err := daemon.Restart(); err != nil {
+			fmt.Println("could not restart daemon, run netclient install to start it:", err)
+		}
+	},
+}
+
+// promptSecret - reads a secret from the terminal, or from the first line of stdin
+func promptSecret(name string) string {
+	if term.IsTerminal(int(syscall.Stdin)) {
+		fmt.Printf("Please input %s:\n", name)
+		input, err := term.ReadPassword(int(syscall.Stdin))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(input))
+	}
+	secret, _ := readSecret()
+	return secret
+}
+
+func init() {
+	restoreCmd.Flags().Bool("from-server", false, "restore the backup stored on the server")
+	restoreCmd.Flags().StringP(registerFlags.Server, "s", "", "api address of the server holding the backup")
+	restoreCmd.Flags().StringP(registerFlags.User, "u", "", "user name to log in to the server with")
+	restoreCmd.Flags().String("host", "", "id of the host to restore")
+	restoreCmd.Flags().String("passphrase-file", "", "file holding the backup passphrase, prompted for if not set")
+	restoreCmd.Flags().Bool("force", false, "replace the config of another host")
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -6,6 +6,7 @@ package cmd
 
 import (
 	"crypto/rand"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -52,6 +53,7 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().IntP("verbosity", "v", 0, "set logging verbosity 0-4")
+	rootCmd.PersistentFlags().Bool("utc", false, "display timestamps in utc instead of the local timezone")
 	viper.BindPFlags(rootCmd.Flags())
 
 	// Cobra also supports local flags, which will only run
@@ -102,7 +104,7 @@ func InitConfig(viper *viper.Viper) {
 }
 
 func setupLogging(flags *viper.Viper) {
-	logLevel := &slog.LevelVar{}
+	logLevel := ncutils.LogLevel
 	replace := func(groups []string, a slog.Attr) slog.Attr {
 		if a.Key == slog.SourceKey {
 			a.Value = slog.StringValue(filepath.Base(a.Value.String()))
@@ -111,11 +113,12 @@ func setupLogging(flags *viper.Viper) {
 	}
 
 	// Detect if OS is windows to push slog on Stdout instead of Stderr
+	// recent log lines are kept for crash reports
 	if ncutils.IsWindows() {
-		logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{AddSource: true, ReplaceAttr: replace, Level: logLevel}))
+		logger := slog.New(slog.NewJSONHandler(io.MultiWriter(os.Stdout, ncutils.RecentLogs), &slog.HandlerOptions{AddSource: true, ReplaceAttr: replace, Level: logLevel}))
 		slog.SetDefault(logger)
 	} else {
-		logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{AddSource: true, ReplaceAttr: replace, Level: logLevel}))
+		logger := slog.New(slog.NewJSONHandler(io.MultiWriter(os.Stderr, ncutils.RecentLogs), &slog.HandlerOptions{AddSource: true, ReplaceAttr: replace, Level: logLevel}))
 		slog.SetDefault(logger)
 	}
 
@@ -206,9 +209,9 @@ func checkConfig() {
 		netclient.Interface = ncutils.GetInterfaceName()
 		saveRequired = true
 	}
-	if netclient.ListenPort == 0 {
+	if netclient.ListenPort == 0 || !config.InPortRange(netclient.ListenPort) {
 		logger.Log(0, "setting listenport")
-		port, err := ncutils.GetFreePort(config.DefaultListenPort)
+		port, err := config.GetFreeListenPort(config.DefaultListenPort)
 		if err != nil {
 			logger.Log(0, "error getting free port", err.Error())
 		} else {
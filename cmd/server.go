@@ -25,8 +25,8 @@ import (
 // serverCmd represents the server command
 var serverCmd = &cobra.Command{
 	Use:   "server",
-	Short: "server commands [list, switch, leave]",
-	Long:  `list, switch or leave server`,
+	Short: "server commands [list, switch, leave, set-checkin]",
+	Long:  `list, switch or leave server, or change its checkin interval`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("server called")
 	},
@@ -37,6 +37,9 @@ func init() {
 	serverCmd.AddCommand(leaveServerCmd)
 	serverCmd.AddCommand(listServersCmd)
 	serverCmd.AddCommand(switchServerCmd)
+	serverCmd.AddCommand(setCheckinCmd)
+	setCheckinCmd.Flags().Int("interval", 0, "seconds between checkins, 0 uses the default (60)")
+	setCheckinCmd.Flags().Int("jitter", 0, "maximum random seconds added to the interval, 0 uses a tenth of the interval, -1 disables")
 
 	// Here you will define your flags and configuration settings.
 
@@ -86,3 +89,21 @@ var switchServerCmd = &cobra.Command{
 		}
 	},
 }
+
+// setCheckinCmd represents the server set-checkin command
+var setCheckinCmd = &cobra.Command{
+	Use:   "set-checkin [servername]",
+	Short: "set checkin interval",
+	Long: `set the checkin interval and jitter for the specified server, applied by reloading the daemon
+For example:
+
+netclient server set-checkin netmaker --interval 300 --jitter 60`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		interval, _ := cmd.Flags().GetInt("interval")
+		jitter, _ := cmd.Flags().GetInt("jitter")
+		if err := functions.SetCheckin(args[0], interval, jitter); err != nil {
+			fmt.Println(err.Error())
+		}
+	},
+}
@@ -0,0 +1,69 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/spf13/cobra"
+)
+
+// servicesCmd represents the services command
+var servicesCmd = &cobra.Command{
+	Use:   "services [network]",
+	Args:  cobra.RangeArgs(0, 1),
+	Short: "list the services advertised in the networks",
+	Long: `list the services advertised by the hosts of the networks with their mesh addresses,
+services are advertised with the services list of the host config
+For example:
+
+netclient services         // services of all networks
+netclient services mynet   // services of mynet
+netclient services --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		services, err := functions.ListServices()
+		if err != nil {
+			fmt.Println("\nfailed to list services:", err)
+			return
+		}
+		filtered := []functions.DiscoveredService{}
+		for _, service := range services {
+			if len(args) == 0 || service.Network == args[0] {
+				filtered = append(filtered, service)
+			}
+		}
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			data, err := json.MarshalIndent(filtered, "", "  ")
+			if err != nil {
+				fmt.Println("\nfailed to encode services:", err)
+				return
+			}
+			fmt.Println(string(data))
+			return
+		}
+		if len(filtered) == 0 {
+			fmt.Println("\nNo Services")
+			return
+		}
+		utc, _ := cmd.Flags().GetBool("utc")
+		fmt.Println()
+		for _, service := range filtered {
+			endpoints := []string{}
+			for _, addr := range service.Addresses {
+				endpoints = append(endpoints, service.Endpoint(addr))
+			}
+			fmt.Printf("%s\t%s\t%s\t%s/%s\tadvertised %s\n", service.Network, service.Name, service.Host,
+				strings.Join(endpoints, ","), service.Protocol, ncutils.FormatTime(service.Updated, utc))
+		}
+	},
+}
+
+func init() {
+	servicesCmd.Flags().Bool("json", false, "print the services as json")
+	rootCmd.AddCommand(servicesCmd)
+}
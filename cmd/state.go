@@ -0,0 +1,59 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/spf13/cobra"
+)
+
+// stateCmd represents the state command
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Args:  cobra.NoArgs,
+	Short: "display the state last applied by the daemon",
+	Long: `display the state snapshot the daemon writes after applying updates,
+works when the daemon is down
+For example:
+
+netclient state         // summary
+netclient state --json  // full state, as written by the daemon`,
+	Run: func(cmd *cobra.Command, args []string) {
+		state, err := functions.ReadState()
+		if err != nil {
+			fmt.Println("\nfailed to read state:", err)
+			os.Exit(1)
+		}
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			data, err := json.MarshalIndent(state, "", "  ")
+			if err != nil {
+				fmt.Println("\nfailed to encode state:", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+			return
+		}
+		utc, _ := cmd.Flags().GetBool("utc")
+		fmt.Printf("\nstate of %s (%s), updated %s\n", state.Host.Name, state.Host.ID, ncutils.FormatTime(state.UpdatedAt, utc))
+		result := "succeeded"
+		if !state.LastApply.Success {
+			result = "failed: " + state.LastApply.Error
+		}
+		fmt.Printf("last apply from %s at %s %s\n", state.LastApply.Server, ncutils.FormatTime(state.LastApply.Time, utc), result)
+		for _, network := range state.Networks {
+			fmt.Printf("network %s on %s: %s %s connected=%t\n", network.Network, network.Server, network.Address, network.Address6, network.Connected)
+		}
+		fmt.Printf("%d peers, %d firewall rules\n", len(state.Peers), len(state.Rules))
+	},
+}
+
+func init() {
+	stateCmd.Flags().Bool("json", false, "print the state as json")
+	rootCmd.AddCommand(stateCmd)
+}
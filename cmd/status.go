@@ -0,0 +1,71 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Args:  cobra.NoArgs,
+	Short: "display the state of the daemon goroutines",
+	Long: `display the supervised goroutine groups of the running daemon, the daemon subsystems and
+the connection of each server, with the restarts and panics of every member
+For example:
+
+netclient status
+netclient status --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		groups, err := functions.SupervisorStatus()
+		if err != nil {
+			fmt.Println("\nfailed to get status:", err)
+			return
+		}
+		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+			out, _ := json.MarshalIndent(groups, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		utc, _ := cmd.Flags().GetBool("utc")
+		for _, group := range groups {
+			restarts, panics := 0, 0
+			names := make([]string, 0, len(group.Members))
+			for name, member := range group.Members {
+				names = append(names, name)
+				restarts += member.Restarts
+				panics += member.Panics
+			}
+			sort.Strings(names)
+			fmt.Printf("\n%s: %d restarts, %d panics\n", group.Name, restarts, panics)
+			for _, name := range names {
+				member := group.Members[name]
+				state := "running"
+				if !member.Running {
+					state = "stopped"
+				}
+				fmt.Printf("  %s %s, %d restarts, %d panics", name, state, member.Restarts, member.Panics)
+				if member.Restarts > 0 {
+					fmt.Printf(", last restart %s: %s", ncutils.FormatTime(member.LastRestart, utc), member.LastError)
+				}
+				if member.Backoff != "" {
+					fmt.Printf(", restarting in %s", member.Backoff)
+				}
+				fmt.Println()
+			}
+		}
+	},
+}
+
+func init() {
+	statusCmd.Flags().Bool("json", false, "print the status as json")
+	rootCmd.AddCommand(statusCmd)
+}
@@ -26,6 +26,7 @@ var versionCmd = &cobra.Command{
 			pretty.Println(info.Settings)
 		}
 		fmt.Println(config.Version)
+		fmt.Println("crypto:", config.CryptoMode())
 	},
 }
 
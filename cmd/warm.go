@@ -0,0 +1,63 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// warmCmd represents the warm command
+var warmCmd = &cobra.Command{
+	Use:   "warm <peer|network>",
+	Args:  cobra.ExactArgs(1),
+	Short: "prime the connections to a peer or the peers of a network",
+	Long: `perform the nat traversal and handshakes with a peer, by public key, or with all peers of a
+network now instead of on the first traffic, e.g. before a live migration; exits with 1 if a peer
+could not be reached
+For example:
+
+netclient warm office
+netclient warm kfz0u5yZc0JEzRqGxH0bXFXt3ZlJ0c/Q9IPbXZ3Cr2o= --timeout 30`,
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		warmed, err := functions.Warm(args[0], timeout)
+		if err != nil {
+			fmt.Println("\nwarm failed:", err)
+			os.Exit(1)
+		}
+		failed := false
+		for _, peer := range warmed {
+			if !peer.Connected {
+				failed = true
+			}
+		}
+		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+			out, _ := json.MarshalIndent(warmed, "", "  ")
+			fmt.Println(string(out))
+		} else {
+			fmt.Println("\nWarmed Peers:")
+			for _, peer := range warmed {
+				if peer.Connected {
+					fmt.Printf("%s %s: connected via %s, rtt %s\n", peer.PublicKey, peer.Address, peer.Endpoint, peer.RTT)
+				} else {
+					fmt.Printf("%s %s: %s\n", peer.PublicKey, peer.Address, peer.Error)
+				}
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	warmCmd.Flags().Duration("timeout", functions.DefaultWarmTimeout, "time to wait for each peer to answer")
+	warmCmd.Flags().Bool("json", false, "output the result as json")
+	rootCmd.AddCommand(warmCmd)
+}
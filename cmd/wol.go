@@ -0,0 +1,37 @@
+/*
+Copyright © 2022 Netmaker Team <info@netmaker.io>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gravitl/netclient/functions"
+	"github.com/spf13/cobra"
+)
+
+// wolCmd represents the wol command
+var wolCmd = &cobra.Command{
+	Use:   "wol <mac> [flags]",
+	Args:  cobra.ExactArgs(1),
+	Short: "send a wake-on-lan packet",
+	Long: `send a wake-on-lan magic packet to a machine
+the packet is relayed over the mesh by the gateway given with --gateway (mesh address of
+a netclient with wolrelay enabled on the target's lan), or broadcast locally without it
+For example:
+
+netclient wol 52:54:00:12:34:56 --gateway 10.101.0.3`,
+	Run: func(cmd *cobra.Command, args []string) {
+		gateway, _ := cmd.Flags().GetString("gateway")
+		if err := functions.WakeOnLan(args[0], gateway); err != nil {
+			fmt.Println("\nwake-on-lan failed:", err)
+			return
+		}
+		fmt.Println("\nwake-on-lan packet sent to", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(wolCmd)
+	wolCmd.Flags().StringP("gateway", "g", "", "mesh address of the host relaying the packet")
+}
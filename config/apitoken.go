@@ -0,0 +1,96 @@
+package config
+
+import (
+	"crypto/subtle"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/gravitl/netclient/ncutils"
+)
+
+const (
+	// AdminTokenFile - file holding the token granting full access to the local api
+	AdminTokenFile = "api-admin.token"
+	// ReadOnlyTokenFile - file holding the token granting read-only access to the local api
+	ReadOnlyTokenFile = "api-readonly.token"
+	// APITokenLength - length of generated local api tokens
+	APITokenLength = 32
+)
+
+// APIRole - access level granted by a local api token
+type APIRole int
+
+const (
+	// APIRoleNone - no access
+	APIRoleNone APIRole = iota
+	// APIRoleReadOnly - access to read-only endpoints
+	APIRoleReadOnly
+	// APIRoleAdmin - access to all endpoints
+	APIRoleAdmin
+)
+
+// String - returns the string representation of the api role
+func (r APIRole) String() string {
+	return [...]string{"none", "readonly", "admin"}[r]
+}
+
+var apiTokens = struct {
+	admin    string
+	readOnly string
+}{}
+
+// GenerateAPITokens - creates new local api tokens and writes them to disk
+// access is bootstrapped by file permissions: the admin token is only readable by root,
+// the read-only token is additionally readable by the group owning the file, so an
+// administrator can grant a non-root user access by changing the group of the token file
+func GenerateAPITokens() error {
+	admin := ncutils.RandomString(APITokenLength)
+	readOnly := ncutils.RandomString(APITokenLength)
+	if admin == "" || readOnly == "" {
+		return errors.New("failed to generate api tokens")
+	}
+	if err := writeTokenFile(AdminTokenFile, admin, 0600); err != nil {
+		return err
+	}
+	if err := writeTokenFile(ReadOnlyTokenFile, readOnly, 0640); err != nil {
+		return err
+	}
+	apiTokens.admin = admin
+	apiTokens.readOnly = readOnly
+	return nil
+}
+
+// ReadAPIToken - returns the most privileged local api token readable by the calling user
+func ReadAPIToken() (string, error) {
+	for _, file := range []string{AdminTokenFile, ReadOnlyTokenFile} {
+		data, err := os.ReadFile(GetNetclientPath() + file)
+		if err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	return "", errors.New("no readable api token found")
+}
+
+// GetAPIRole - returns the role granted by the given token
+func GetAPIRole(token string) APIRole {
+	if token == "" {
+		return APIRoleNone
+	}
+	if apiTokens.admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiTokens.admin)) == 1 {
+		return APIRoleAdmin
+	}
+	if apiTokens.readOnly != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiTokens.readOnly)) == 1 {
+		return APIRoleReadOnly
+	}
+	return APIRoleNone
+}
+
+func writeTokenFile(name, token string, perm os.FileMode) error {
+	file := GetNetclientPath() + name
+	// the file is rewritten in place so that a group granted by an administrator is kept
+	if err := os.WriteFile(file, []byte(token), perm); err != nil {
+		return err
+	}
+	return os.Chmod(file, perm)
+}
@@ -0,0 +1,23 @@
+package config
+
+const (
+	// AppRoutingInclude - only the traffic of the selected applications uses the netmaker routing tables
+	AppRoutingInclude = "include"
+	// AppRoutingExclude - the traffic of the selected applications bypasses the netmaker routing tables
+	AppRoutingExclude = "exclude"
+)
+
+// AppRouting - experimental per application routing (linux only): the processes of the applications
+// are moved to a cgroup whose traffic is marked, the mark selects the routing tables of the networks,
+// so it applies to networks with a routing table (routetables)
+type AppRouting struct {
+	// Mode include or exclude
+	Mode string `json:"mode" yaml:"mode"`
+	// Applications process names (as in /proc/<pid>/comm) of the selected applications
+	Applications []string `json:"applications" yaml:"applications"`
+}
+
+// Enabled - checks if application routing is configured
+func (a AppRouting) Enabled() bool {
+	return (a.Mode == AppRoutingInclude || a.Mode == AppRoutingExclude) && len(a.Applications) > 0
+}
@@ -4,8 +4,10 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -38,6 +40,27 @@ const (
 	DefaultListenPort = 51821
 	// DefaultMTU default MTU for wireguard
 	DefaultMTU = 1420
+	// DefaultSessionGracePeriod time to wait for a lost broker connection to resume before re-negotiating
+	DefaultSessionGracePeriod = time.Second * 30
+	// DefaultApprovalTimeout time a disruptive server change waits for local approval before being discarded
+	DefaultApprovalTimeout = time.Minute * 5
+	// DefaultNetworkWaitTimeout time to wait for network connectivity before endpoint detection on startup
+	DefaultNetworkWaitTimeout = time.Minute
+	// DefaultPeerUpdateWindow time to wait for further peer updates before applying a burst as one
+	DefaultPeerUpdateWindow = time.Second * 2
+	// DefaultFirewallCheckInterval time between checks of the netmaker firewall rules
+	DefaultFirewallCheckInterval = time.Minute
+)
+
+// firewalls of freebsd hosts, the netmaker models only name the linux ones
+const (
+	// FirewallPF - pf, the netmaker rules are kept in an anchor
+	FirewallPF = "pf"
+	// FirewallIPFW - ipfw, the netmaker rules are kept in a rule set
+	FirewallIPFW = "ipfw"
+	// FirewallFirewalld - iptables on a host run by firewalld, the netmaker rules are also kept as
+	// permanent firewalld direct rules which survive reloads
+	FirewallFirewalld = "firewalld"
 )
 
 const (
@@ -47,6 +70,7 @@ const (
 	Runit
 	OpenRC
 	Initd
+	WSL
 )
 
 // Initype - the type of init system in use
@@ -54,7 +78,7 @@ type InitType int
 
 // String - returns the string representation of the init type
 func (i InitType) String() string {
-	return [...]string{"unknown", "systemd", "sysvinit", "runit", "openrc", "initd"}[i]
+	return [...]string{"unknown", "systemd", "sysvinit", "runit", "openrc", "initd", "wsl"}[i]
 }
 
 var (
@@ -80,6 +104,135 @@ type Config struct {
 	HostPeers         []wgtypes.PeerConfig `json:"host_peers" yaml:"host_peers"`
 	DisableGUIServer  bool                 `json:"disableguiserver" yaml:"disableguiserver"`
 	InitType          InitType             `json:"inittype" yaml:"inittype"`
+	// SessionGracePeriod seconds to keep NAT/session state across a connectivity loss, negative disables
+	SessionGracePeriod int `json:"sessiongraceperiod" yaml:"sessiongraceperiod"`
+	// PortRangeStart/PortRangeEnd restrict the udp ports netclient may listen on, zero values mean unrestricted
+	PortRangeStart int `json:"portrangestart" yaml:"portrangestart"`
+	PortRangeEnd   int `json:"portrangeend" yaml:"portrangeend"`
+	// RequireApproval holds back disruptive server changes until approved locally with `netclient approve`
+	RequireApproval bool `json:"requireapproval" yaml:"requireapproval"`
+	// ApprovalTimeout seconds a disruptive change waits for approval, zero means the default
+	ApprovalTimeout int `json:"approvaltimeout" yaml:"approvaltimeout"`
+	// Lockdown refuses remote configuration changes from the servers except peer updates: no upgrades,
+	// host, node or egress changes; only set locally with `netclient lockdown`
+	Lockdown bool `json:"lockdown" yaml:"lockdown"`
+	// RequireFIPS refuses to start the daemon unless the binary uses FIPS validated crypto
+	RequireFIPS bool `json:"requirefips" yaml:"requirefips"`
+	// PeerPaths paths pinned per peer public key with `netclient peer pin`: direct, lan or relay,
+	// overriding the automatic selection
+	PeerPaths map[string]string `json:"peerpaths" yaml:"peerpaths"`
+	// PeerTags tags assigned to peers, keyed by peer public key
+	PeerTags map[string][]string `json:"peertags" yaml:"peertags"`
+	// TagPolicies behaviour applied to peers carrying a tag, keyed by tag
+	TagPolicies map[string]TagPolicy `json:"tagpolicies" yaml:"tagpolicies"`
+	// ExtClientDNS adds /etc/hosts entries for ext clients on ingress gateways
+	ExtClientDNS bool `json:"extclientdns" yaml:"extclientdns"`
+	// StatsFile path of a prometheus textfile the interface statistics are written to, empty disables
+	StatsFile string `json:"statsfile" yaml:"statsfile"`
+	// FlowAccounting summarizes tracked connections per peer on gateway nodes (linux only)
+	FlowAccounting bool `json:"flowaccounting" yaml:"flowaccounting"`
+	// RouteTables routing table per network for netmaker routes (linux only), networks not listed use the main table
+	RouteTables map[string]int `json:"routetables" yaml:"routetables"`
+	// RoutingDaemon local routing daemon (bird or frr) mesh routes are exported to, empty disables
+	RoutingDaemon string `json:"routingdaemon" yaml:"routingdaemon"`
+	// RoutingDaemonConfig include file written for the routing daemon (bird only)
+	RoutingDaemonConfig string `json:"routingdaemonconfig" yaml:"routingdaemonconfig"`
+	// EgressHealthChecks health checks keyed by egress range, failing checks fail the range over to its next gateway
+	EgressHealthChecks map[string]HealthCheck `json:"egresshealthchecks" yaml:"egresshealthchecks"`
+	// WoLRelay rebroadcasts wake-on-lan packets received on the mesh addresses to the local lans
+	WoLRelay bool `json:"wolrelay" yaml:"wolrelay"`
+	// RelaySelection measures the round trip time to each relay peer and moves the relayed peers to the
+	// fastest relay instead of the one designated by the server
+	RelaySelection bool `json:"relayselection" yaml:"relayselection"`
+	// CrashReportURL endpoint redacted crash reports are uploaded to, empty keeps them local only
+	CrashReportURL string `json:"crashreporturl" yaml:"crashreporturl"`
+	// NetworkWaitTimeout seconds to wait for network connectivity on startup, negative disables
+	NetworkWaitTimeout int `json:"networkwaittimeout" yaml:"networkwaittimeout"`
+	// PeerUpdateWindow seconds to coalesce bursts of peer updates before applying them, negative disables
+	PeerUpdateWindow int `json:"peerupdatewindow" yaml:"peerupdatewindow"`
+	// DNSSecurity dns over tls and dnssec modes per network for the netmaker dns, the strictest mode
+	// of the networks sharing the interface applies
+	DNSSecurity map[string]DNSSecurity `json:"dnssecurity" yaml:"dnssecurity"`
+	// SearchDomains dns search domains per network replacing the ones pushed by the server, an empty list
+	// disables them for the network
+	SearchDomains map[string][]string `json:"searchdomains" yaml:"searchdomains"`
+	// ServerSearchDomains dns search domains per network as pushed by the servers
+	ServerSearchDomains map[string][]string `json:"serversearchdomains" yaml:"serversearchdomains"`
+	// BackupInterval seconds between checks for changes of the local config, changed configs are uploaded
+	// encrypted to the servers for `netclient restore --from-server`, zero or negative disables; servers
+	// older than netmaker v0.22.0 do not store backups and are skipped
+	BackupInterval int `json:"backupinterval" yaml:"backupinterval"`
+	// BackupPassphraseFile file holding the passphrase the config backup is encrypted with, it is never uploaded
+	BackupPassphraseFile string `json:"backuppassphrasefile" yaml:"backuppassphrasefile"`
+	// FirewallBackend firewall managing the netmaker rules, iptables, nftables or firewalld on linux and pf
+	// or ipfw on freebsd, empty selects firewalld when it is running, then nftables when nft is available
+	// unless a legacy iptables is installed, and pf unless only ipfw is loaded
+	FirewallBackend string `json:"firewallbackend" yaml:"firewallbackend"`
+	// FirewallCheckInterval seconds between checks of the netmaker firewall rules against changes by other tools, negative disables
+	FirewallCheckInterval int `json:"firewallcheckinterval" yaml:"firewallcheckinterval"`
+	// FirewallDryRun logs the firewall rules netclient would install instead of applying them, see
+	// `netclient firewall preview`; linux only, other platforms do not touch the firewall
+	FirewallDryRun bool `json:"firewalldryrun" yaml:"firewalldryrun"`
+	// FirewallChains overrides the names of the netmaker firewall chains and of the chains hooking them
+	FirewallChains FirewallChains `json:"firewallchains" yaml:"firewallchains"`
+	// BlockedPeers public keys of peers blocked locally with `netclient peer block`, kept off the interface
+	// and firewalled regardless of server updates
+	BlockedPeers []string `json:"blockedpeers" yaml:"blockedpeers"`
+	// AccessSchedules time windows restricting when peers are allowed, see `netclient peer schedule`
+	AccessSchedules []AccessSchedule `json:"accessschedules" yaml:"accessschedules"`
+	// ExtClientExpiry expiry of the ext clients attached to this host as announced by the servers,
+	// by server and ext client public key
+	ExtClientExpiry map[string]map[string]time.Time `json:"extclientexpiry" yaml:"extclientexpiry"`
+	// RemovedNetworks networks this host was removed from by their servers, with the reason
+	RemovedNetworks map[string]RemovedNetwork `json:"removednetworks" yaml:"removednetworks"`
+	// UserNetworks desired connection state of the networks os users control through their config
+	// overlays, layered over the machine config when it is read and never written to it
+	UserNetworks map[string]bool `json:"usernetworks,omitempty" yaml:"-"`
+	// EgressNat nat mode per egress range of the egress gateways of this host: masquerade, routed or
+	// snat:<source ip>; ranges not listed are masqueraded when the server enables nat
+	EgressNat map[string]string `json:"egressnat" yaml:"egressnat"`
+	// SNATSources source addresses replacing masquerade in the egress nat rules of this host, at most
+	// one per address family, for hosts with several addresses or VIPs; EgressNat entries take precedence
+	SNATSources []string `json:"snatsources" yaml:"snatsources"`
+	// ExtClientNat one-to-one nat on ingress gateways from public secondary addresses of this host to the
+	// mesh addresses of ext clients, by public address; the public addresses are added to and announced
+	// on the interface of their network
+	ExtClientNat map[string]string `json:"extclientnat" yaml:"extclientnat"`
+	// OutboundOnly rejects inbound traffic from the mesh that does not belong to a connection initiated
+	// by this host, for hosts consuming services without serving any
+	OutboundOnly bool `json:"outboundonly" yaml:"outboundonly"`
+	// InboundPorts ports still reachable from the mesh in outbound only mode, as port[/tcp|udp]
+	InboundPorts []string `json:"inboundports" yaml:"inboundports"`
+	// Services services of this host advertised to the peers of its networks over the broker
+	Services []Service `json:"services" yaml:"services"`
+	// OpenServicePorts adds the ports of the advertised services to the inbound ports of outbound only mode
+	OpenServicePorts bool `json:"openserviceports" yaml:"openserviceports"`
+	// Exposed local services forwarded from the mesh addresses, managed with `netclient expose`
+	Exposed []ExposedService `json:"exposed" yaml:"exposed"`
+	// AppRouting routes the traffic of selected applications only into, or around, the netmaker routing tables
+	AppRouting AppRouting `json:"approuting" yaml:"approuting"`
+	// MinimalRoutes routes only the peers communicated with instead of the network ranges
+	MinimalRoutes MinimalRoutes `json:"minimalroutes" yaml:"minimalroutes"`
+	// PolicyHook hands new connections from the mesh not covered by the static rules to a local policy engine
+	PolicyHook PolicyHook `json:"policyhook" yaml:"policyhook"`
+	// PeerHook filters the peer updates of the servers before they are applied
+	PeerHook PeerHook `json:"peerhook" yaml:"peerhook"`
+	// InterNetwork routes traffic between the networks of the host for the allowed pairs
+	InterNetwork InterNetworkRouting `json:"internetwork" yaml:"internetwork"`
+	// MSSClamp clamps the MSS of tcp connections forwarded to the ranges of the servers and networks
+	MSSClamp MSSClamp `json:"mssclamp" yaml:"mssclamp"`
+	// EgressPolicies route the traffic of sources to egress ranges via a chosen gateway with fwmarks and ip rules
+	EgressPolicies []EgressPolicy `json:"egresspolicies" yaml:"egresspolicies"`
+	// ExtClientRateLimit limits the traffic each ext client forwards through an ingress gateway
+	ExtClientRateLimit ExtClientRateLimit `json:"extclientratelimit" yaml:"extclientratelimit"`
+	// DefaultPolicy default-allow or default-deny policy of the traffic the host forwards out of the mesh, by network
+	DefaultPolicy DefaultPolicy `json:"defaultpolicy" yaml:"defaultpolicy"`
+	// LogDrops logs the packets dropped by the netmaker rules, rate limited, with the netmaker-drop: prefix
+	LogDrops bool `json:"logdrops" yaml:"logdrops"`
+	// FastPath experimental: offloads the established flows forwarded by a gateway to a kernel flowtable,
+	// bypassing the netfilter chains for bulk traffic (linux only), kernels without flowtables keep the
+	// regular path
+	FastPath bool `json:"fastpath" yaml:"fastpath"`
 }
 
 func init() {
@@ -104,8 +257,8 @@ func UpdateHost(host *models.Host) (resetInterface, restart, sendHostUpdate bool
 		return
 	}
 	if host.ListenPort != 0 && hostCfg.ListenPort != host.ListenPort {
-		// check if new port is free, otherwise don't update
-		if !ncutils.IsPortFree(host.ListenPort) {
+		// check if new port is free and in range, otherwise don't update
+		if !ncutils.IsPortFree(host.ListenPort) || !InPortRange(host.ListenPort) {
 			// send the host update to server with actual port on the interface
 			host.ListenPort = hostCfg.ListenPort
 			sendHostUpdate = true
@@ -173,6 +326,136 @@ func RemoveServerHostPeerCfg() {
 	_ = WriteNetclientConfig()
 }
 
+// GetSessionGracePeriod - returns the configured session grace period or the default if unset
+func GetSessionGracePeriod() time.Duration {
+	period := Netclient().SessionGracePeriod
+	if period == 0 {
+		return DefaultSessionGracePeriod
+	}
+	if period < 0 {
+		return 0
+	}
+	return time.Second * time.Duration(period)
+}
+
+// GetNetworkWaitTimeout - returns the configured network wait timeout or the default if unset
+func GetNetworkWaitTimeout() time.Duration {
+	timeout := Netclient().NetworkWaitTimeout
+	if timeout == 0 {
+		return DefaultNetworkWaitTimeout
+	}
+	if timeout < 0 {
+		return 0
+	}
+	return time.Second * time.Duration(timeout)
+}
+
+// GetPeerUpdateWindow - returns the configured peer update coalescing window or the default if unset
+func GetPeerUpdateWindow() time.Duration {
+	window := Netclient().PeerUpdateWindow
+	if window == 0 {
+		return DefaultPeerUpdateWindow
+	}
+	if window < 0 {
+		return 0
+	}
+	return time.Second * time.Duration(window)
+}
+
+// GetBackupInterval - returns the interval of the config backup, 0 when disabled
+func GetBackupInterval() time.Duration {
+	interval := Netclient().BackupInterval
+	if interval <= 0 || Netclient().BackupPassphraseFile == "" {
+		return 0
+	}
+	return time.Second * time.Duration(interval)
+}
+
+// GetFirewallCheckInterval - returns the configured firewall check interval or the default if unset
+func GetFirewallCheckInterval() time.Duration {
+	interval := Netclient().FirewallCheckInterval
+	if interval == 0 {
+		return DefaultFirewallCheckInterval
+	}
+	if interval < 0 {
+		return 0
+	}
+	return time.Second * time.Duration(interval)
+}
+
+// GetApprovalTimeout - returns the configured approval timeout or the default if unset
+func GetApprovalTimeout() time.Duration {
+	if Netclient().ApprovalTimeout <= 0 {
+		return DefaultApprovalTimeout
+	}
+	return time.Second * time.Duration(Netclient().ApprovalTimeout)
+}
+
+// IsBlockedPeer - checks if the peer is blocked locally
+func IsBlockedPeer(peerPubKey string) bool {
+	for _, key := range Netclient().BlockedPeers {
+		if key == peerPubKey {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRouteTable - returns the routing table configured for the network, 0 means the main table
+func GetRouteTable(network string) int {
+	return Netclient().RouteTables[network]
+}
+
+// GetRouteTableForAddr - returns the routing table of the network the address belongs to
+func GetRouteTableForAddr(ip net.IP) int {
+	for _, node := range GetNodes() {
+		if node.NetworkRange.Contains(ip) || node.NetworkRange6.Contains(ip) {
+			return GetRouteTable(node.Network)
+		}
+	}
+	return 0
+}
+
+// ParsePortRange - parses a port range of the form <start>-<end>
+func ParsePortRange(portRange string) (start, end int, err error) {
+	parts := strings.Split(portRange, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid port range %s, expected <start>-<end>", portRange)
+	}
+	if start, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return 0, 0, fmt.Errorf("invalid port range start %w", err)
+	}
+	if end, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+		return 0, 0, fmt.Errorf("invalid port range end %w", err)
+	}
+	if start <= 0 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("invalid port range %d-%d", start, end)
+	}
+	return start, end, nil
+}
+
+// InPortRange - checks if the port is allowed by the configured port range
+func InPortRange(port int) bool {
+	start, end := Netclient().PortRangeStart, Netclient().PortRangeEnd
+	if start == 0 || end == 0 {
+		return true
+	}
+	return port >= start && port <= end
+}
+
+// GetFreeListenPort - returns a free listen port honouring the configured port range
+func GetFreeListenPort(preferred int) (int, error) {
+	start, end := Netclient().PortRangeStart, Netclient().PortRangeEnd
+	if start == 0 || end == 0 {
+		return ncutils.GetFreePort(preferred)
+	}
+	port, err := ncutils.GetFreePortInRange(preferred, start, end)
+	if errors.Is(err, ncutils.ErrPortRangeExhausted) {
+		logger.Log(0, "all ports in configured range are in use", strconv.Itoa(start)+"-"+strconv.Itoa(end))
+	}
+	return port, err
+}
+
 // SetVersion - sets version for use by other packages
 func SetVersion(ver string) {
 	Version = ver
@@ -195,15 +478,20 @@ func ReadNetclientConfig() (*Config, error) {
 		return nil, err
 	}
 	defer Unlock(lockfile)
-	f, ferr := os.Open(file)
+	data, ferr := os.ReadFile(file)
 	if ferr != nil {
 		err = ferr
 		return nil, err
 	}
-	defer f.Close()
-	if err = yaml.NewDecoder(f).Decode(&netclientl); err != nil {
+	if err = yaml.Unmarshal(data, &netclientl); err != nil {
 		return nil, err
 	}
+	migrateDirectPeers(&netclientl, data)
+	if policy, perr := ReadPolicy(); perr == nil {
+		applyUserOverlays(&netclientl, policy, filepath.Join(GetNetclientPath(), UserOverlayDir))
+	} else if !errors.Is(perr, os.ErrNotExist) {
+		logger.Log(0, "failed to read the policy, user config overlays are not applied:", perr.Error())
+	}
 	return &netclientl, nil
 }
 
@@ -436,29 +724,79 @@ func Convert(h *Config, n *Node) (models.Host, models.Node) {
 
 // setFirewall - determine and record firewall in use
 func SetFirewall() {
-	if ncutils.IsLinux() {
-		if ncutils.IsIPTablesPresent() {
-			netclient.FirewallInUse = models.FIREWALL_IPTABLES
-		} else if ncutils.IsNFTablesPresent() {
-			netclient.FirewallInUse = models.FIREWALL_NFTABLES
-		} else {
-			netclient.FirewallInUse = models.FIREWALL_NONE
+	netclient.FirewallInUse = SelectFirewall()
+}
+
+// SelectFirewall - returns the configured firewall backend if available, otherwise nftables when nft
+// is available and iptables is missing or only the iptables-nft shim, whose rules nftables manages
+// consistently; a legacy iptables keeps iptables as its rules are evaluated apart from nftables, as does
+// application routing which needs the iptables cgroup match
+func SelectFirewall() string {
+	if ncutils.IsFreeBSD() {
+		return selectFreeBSDFirewall()
+	}
+	if !ncutils.IsLinux() {
+		return models.FIREWALL_NONE
+	}
+	iptablesOk, nftablesOk := ncutils.IsIPTablesPresent(), ncutils.IsNFTablesPresent()
+	switch netclient.FirewallBackend {
+	case models.FIREWALL_IPTABLES:
+		if iptablesOk {
+			return models.FIREWALL_IPTABLES
 		}
-	} else {
-		netclient.FirewallInUse = models.FIREWALL_NONE
+		logger.Log(0, "iptables is configured as firewall but not found")
+	case models.FIREWALL_NFTABLES:
+		if nftablesOk {
+			return models.FIREWALL_NFTABLES
+		}
+		logger.Log(0, "nftables is configured as firewall but not found")
+	case FirewallFirewalld:
+		if iptablesOk && ncutils.IsFirewalldRunning() {
+			return FirewallFirewalld
+		}
+		logger.Log(0, "firewalld is configured as firewall but not running")
+	}
+	switch {
+	case netclient.FirewallBackend == "" && iptablesOk && ncutils.IsFirewalldRunning():
+		return FirewallFirewalld
+	case nftablesOk && (!iptablesOk || (ncutils.IsIPTablesNft() && !netclient.AppRouting.Enabled())):
+		return models.FIREWALL_NFTABLES
+	case iptablesOk:
+		return models.FIREWALL_IPTABLES
 	}
+	return models.FIREWALL_NONE
 }
 
-// FirewallHasChanged - checks if the firewall has changed
-func FirewallHasChanged() bool {
-	if netclient.FirewallInUse == models.FIREWALL_NONE && !ncutils.IsLinux() {
-		return false
-	}
-	if netclient.FirewallInUse == models.FIREWALL_IPTABLES && ncutils.IsIPTablesPresent() {
-		return false
+// selectFreeBSDFirewall - returns the configured firewall if available, otherwise ipfw when it is loaded
+// and pf is not, as the host already filters with ipfw, then pf whose anchors are preferred, then ipfw
+func selectFreeBSDFirewall() string {
+	_, pfErr := exec.LookPath("pfctl")
+	_, ipfwErr := exec.LookPath("ipfw")
+	pfOk, ipfwOk := pfErr == nil, ipfwErr == nil
+	switch netclient.FirewallBackend {
+	case FirewallPF:
+		if pfOk {
+			return FirewallPF
+		}
+		logger.Log(0, "pf is configured as firewall but not found")
+	case FirewallIPFW:
+		if ipfwOk {
+			return FirewallIPFW
+		}
+		logger.Log(0, "ipfw is configured as firewall but not found")
 	}
-	if netclient.FirewallInUse == models.FIREWALL_NFTABLES && ncutils.IsNFTablesPresent() {
-		return false
+	switch {
+	case ipfwOk && ncutils.IsKernelModuleLoaded("ipfw") && !ncutils.IsKernelModuleLoaded("pf"):
+		return FirewallIPFW
+	case pfOk:
+		return FirewallPF
+	case ipfwOk:
+		return FirewallIPFW
 	}
-	return true
+	return models.FIREWALL_NONE
+}
+
+// FirewallHasChanged - checks if the firewall has changed
+func FirewallHasChanged() bool {
+	return netclient.FirewallInUse != SelectFirewall()
 }
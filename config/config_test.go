@@ -3,8 +3,10 @@ package config
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"gopkg.in/yaml.v3"
 )
 
@@ -39,3 +41,42 @@ func TestReadNetclientConfig(t *testing.T) {
 	assert.NotEmpty(t, existing.HostPeers["foo1"], "foo1 exists after Decode")
 	assert.NotEmpty(t, existing.HostPeers["foo2"])
 }
+
+func TestParsePortRange(t *testing.T) {
+	start, end, err := ParsePortRange("51821-51900")
+	assert.NoError(t, err)
+	assert.Equal(t, 51821, start)
+	assert.Equal(t, 51900, end)
+
+	_, _, err = ParsePortRange("51900-51821")
+	assert.Error(t, err)
+	_, _, err = ParsePortRange("51821")
+	assert.Error(t, err)
+	_, _, err = ParsePortRange("0-70000")
+	assert.Error(t, err)
+}
+
+func TestApplyTagPolicies(t *testing.T) {
+	key, err := wgtypes.GeneratePrivateKey()
+	assert.NoError(t, err)
+	peer := wgtypes.PeerConfig{PublicKey: key.PublicKey()}
+	nc := Netclient()
+	nc.PeerTags = map[string][]string{key.PublicKey().String(): {"mobile", "prod"}}
+	nc.TagPolicies = map[string]TagPolicy{
+		"mobile": {PersistentKeepalive: 15},
+		"prod":   {PersistentKeepalive: 25},
+	}
+	defer func() {
+		nc.PeerTags = nil
+		nc.TagPolicies = nil
+	}()
+	ApplyTagPolicies(&peer)
+	assert.NotNil(t, peer.PersistentKeepaliveInterval)
+	assert.Equal(t, time.Second*15, *peer.PersistentKeepaliveInterval)
+}
+
+func TestMigrateDirectPeers(t *testing.T) {
+	cfg := Config{PeerPaths: map[string]string{"b": PeerPathRelay}}
+	migrateDirectPeers(&cfg, []byte("directpeers:\n  - a\n  - b\n"))
+	assert.Equal(t, map[string]string{"a": PeerPathDirect, "b": PeerPathRelay}, cfg.PeerPaths)
+}
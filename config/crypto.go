@@ -0,0 +1,21 @@
+package config
+
+import "errors"
+
+const (
+	// CryptoModeStandard - crypto provided by the go standard library
+	CryptoModeStandard = "standard"
+	// CryptoModeFIPS - crypto restricted to the FIPS 140-2 validated BoringCrypto module
+	CryptoModeFIPS = "fips (boringcrypto)"
+)
+
+// ErrFIPSRequired - returned when FIPS mode is required but the binary was not built with boringcrypto
+var ErrFIPSRequired = errors.New("fips mode is required but netclient was not built with GOEXPERIMENT=boringcrypto")
+
+// CheckCryptoMode - verifies that the running binary satisfies the configured crypto requirements
+func CheckCryptoMode() error {
+	if Netclient().RequireFIPS && CryptoMode() != CryptoModeFIPS {
+		return ErrFIPSRequired
+	}
+	return nil
+}
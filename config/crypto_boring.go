@@ -0,0 +1,18 @@
+//go:build boringcrypto
+// +build boringcrypto
+
+package config
+
+import (
+	"crypto/boring"
+	// restricts all tls configurations (mqtt broker, api server) to FIPS approved settings
+	_ "crypto/tls/fipsonly"
+)
+
+// CryptoMode - returns the crypto mode of the running binary
+func CryptoMode() string {
+	if boring.Enabled() {
+		return CryptoModeFIPS
+	}
+	return CryptoModeStandard
+}
@@ -0,0 +1,9 @@
+//go:build !boringcrypto
+// +build !boringcrypto
+
+package config
+
+// CryptoMode - returns the crypto mode of the running binary
+func CryptoMode() string {
+	return CryptoModeStandard
+}
@@ -0,0 +1,19 @@
+package config
+
+const (
+	// DefaultPolicyAllow - the traffic of the network is forwarded unless a rule denies it
+	DefaultPolicyAllow = "allow"
+	// DefaultPolicyDeny - the traffic of the network is only forwarded when a rule allows it
+	DefaultPolicyDeny = "deny"
+)
+
+// DefaultPolicy - the default policy of the traffic of the peers of each network the host forwards out of
+// the mesh, by network name (linux, iptables and nftables only), the networks not listed are default-allow.
+// In default-deny networks only the traffic of the peers of egress gateways and of established connections
+// is forwarded
+type DefaultPolicy map[string]string
+
+// Deny - checks if the network is default-deny
+func (d DefaultPolicy) Deny(network string) bool {
+	return d[network] == DefaultPolicyDeny
+}
@@ -0,0 +1,58 @@
+package config
+
+const (
+	// DNSSecurityNo - disabled
+	DNSSecurityNo = "no"
+	// DNSSecurityOpportunistic - dns over tls is used when the resolver supports it
+	DNSSecurityOpportunistic = "opportunistic"
+	// DNSSecurityAllowDowngrade - dnssec is validated when the resolver supports it
+	DNSSecurityAllowDowngrade = "allow-downgrade"
+	// DNSSecurityYes - enforced, queries fail otherwise
+	DNSSecurityYes = "yes"
+)
+
+// DNSSecurity - dns over tls and dnssec settings of a network's dns
+type DNSSecurity struct {
+	// DNSOverTLS no, opportunistic or yes
+	DNSOverTLS string `json:"dnsovertls" yaml:"dnsovertls"`
+	// DNSSEC no, allow-downgrade or yes
+	DNSSEC string `json:"dnssec" yaml:"dnssec"`
+}
+
+// dnsSecurityLevel - orders the modes from least to most strict, unknown modes are ignored
+func dnsSecurityLevel(mode string) int {
+	switch mode {
+	case DNSSecurityNo:
+		return 1
+	case DNSSecurityOpportunistic, DNSSecurityAllowDowngrade:
+		return 2
+	case DNSSecurityYes:
+		return 3
+	}
+	return 0
+}
+
+// GetDNSSecurity - returns the strictest dns over tls and dnssec modes of the given networks,
+// empty modes mean the resolver default
+func GetDNSSecurity(networks []string) DNSSecurity {
+	result := DNSSecurity{}
+	for _, network := range networks {
+		security := Netclient().DNSSecurity[network]
+		if dnsSecurityLevel(security.DNSOverTLS) > dnsSecurityLevel(result.DNSOverTLS) {
+			result.DNSOverTLS = security.DNSOverTLS
+		}
+		if dnsSecurityLevel(security.DNSSEC) > dnsSecurityLevel(result.DNSSEC) {
+			result.DNSSEC = security.DNSSEC
+		}
+	}
+	return result
+}
+
+// GetSearchDomains - returns the dns search domains of the network, a local override replaces the
+// domains pushed by the server
+func GetSearchDomains(network string) []string {
+	if domains, ok := Netclient().SearchDomains[network]; ok {
+		return domains
+	}
+	return Netclient().ServerSearchDomains[network]
+}
@@ -0,0 +1,31 @@
+package config
+
+// EgressPolicyTableBase - routing table of the first egress policy without a configured table,
+// the following policies use the next tables
+const EgressPolicyTableBase = 5300
+
+// EgressPolicy - policy routing of egress traffic (linux): the traffic from the sources to the destinations
+// is marked and looked up in a dedicated routing table, routing it over the netmaker interface via the
+// gateway instead of the gateway the server assigned to the range. WireGuard picks the peer by destination
+// only, the destinations are moved to the allowed ips of the gateway, so the traffic of other sources to
+// the destinations entering the netmaker interface reaches the gateway as well
+type EgressPolicy struct {
+	// Name of the policy, for logs only
+	Name string `json:"name" yaml:"name"`
+	// Sources ranges of the local or forwarded traffic, empty matches any source
+	Sources []string `json:"sources" yaml:"sources"`
+	// Destinations egress ranges routed by the policy
+	Destinations []string `json:"destinations" yaml:"destinations"`
+	// Gateway mesh address of the egress gateway, it has to forward the traffic to the destinations
+	Gateway string `json:"gateway" yaml:"gateway"`
+	// Table routing table of the policy, 0 uses EgressPolicyTableBase plus the index of the policy
+	Table int `json:"table" yaml:"table"`
+}
+
+// GetTable - the routing table of the policy at index i of the configured policies
+func (e EgressPolicy) GetTable(i int) int {
+	if e.Table == 0 {
+		return EgressPolicyTableBase + i
+	}
+	return e.Table
+}
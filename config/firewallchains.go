@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// default names of the netmaker chains and of the builtin chains hooking them
+const (
+	DefaultFilterChain      = "netmakerfilter"
+	DefaultNatChain         = "netmakernat"
+	DefaultForwardChain     = "FORWARD"
+	DefaultPostroutingChain = "POSTROUTING"
+)
+
+// maxChainNameLen - the longest chain name accepted by iptables
+const maxChainNameLen = 28
+
+// FirewallChains - names of the netmaker firewall chains and of the chains hooking them, for
+// environments where other tooling uses the default names; empty names keep the defaults.
+// The hook chains only apply to iptables, a hook chain which is not builtin, e.g. DOCKER-USER,
+// is created if missing but has to be reached from the builtin chain by other means
+type FirewallChains struct {
+	// Filter the netmaker chain of the filter table
+	Filter string `json:"filter" yaml:"filter"`
+	// Nat the netmaker chain of the nat table
+	Nat string `json:"nat" yaml:"nat"`
+	// Forward the filter table chain holding the netmaker accept rules, FORWARD by default
+	Forward string `json:"forward" yaml:"forward"`
+	// Postrouting the nat table chain jumping to the netmaker nat chain, POSTROUTING by default
+	Postrouting string `json:"postrouting" yaml:"postrouting"`
+}
+
+// GetFilter - returns the name of the netmaker chain of the filter table
+func (c FirewallChains) GetFilter() string {
+	if c.Filter == "" {
+		return DefaultFilterChain
+	}
+	return c.Filter
+}
+
+// GetNat - returns the name of the netmaker chain of the nat table
+func (c FirewallChains) GetNat() string {
+	if c.Nat == "" {
+		return DefaultNatChain
+	}
+	return c.Nat
+}
+
+// GetForward - returns the name of the chain holding the netmaker accept rules
+func (c FirewallChains) GetForward() string {
+	if c.Forward == "" {
+		return DefaultForwardChain
+	}
+	return c.Forward
+}
+
+// GetPostrouting - returns the name of the chain jumping to the netmaker nat chain
+func (c FirewallChains) GetPostrouting() string {
+	if c.Postrouting == "" {
+		return DefaultPostroutingChain
+	}
+	return c.Postrouting
+}
+
+// Validate - checks the chain names, the netmaker chains are flushed and deleted on cleanup so
+// they must not name a builtin chain
+func (c FirewallChains) Validate() error {
+	for _, name := range []string{c.GetFilter(), c.GetNat(), c.GetForward(), c.GetPostrouting()} {
+		if len(name) > maxChainNameLen || strings.ContainsAny(name, " \t\n") {
+			return fmt.Errorf("invalid firewall chain name %q", name)
+		}
+	}
+	for _, name := range []string{c.GetFilter(), c.GetNat()} {
+		switch strings.ToUpper(name) {
+		case "INPUT", "OUTPUT", "FORWARD", "PREROUTING", "POSTROUTING":
+			return fmt.Errorf("netmaker firewall chain can not be the builtin chain %s", name)
+		}
+		if name == c.GetForward() || name == c.GetPostrouting() {
+			return fmt.Errorf("netmaker firewall chain %s can not hook itself", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+const (
+	// HealthCheckICMP - probe the target with icmp echo requests
+	HealthCheckICMP = "icmp"
+	// HealthCheckTCP - probe the target by opening a tcp connection
+	HealthCheckTCP = "tcp"
+	// DefaultHealthCheckFailures - consecutive failed probes before an egress range is demoted
+	DefaultHealthCheckFailures = 3
+	// DefaultHealthCheckHoldDown - time a demoted egress range stays demoted before it is retried
+	DefaultHealthCheckHoldDown = time.Minute * 5
+)
+
+// HealthCheck - probe verifying that an egress range is reachable through its gateway
+type HealthCheck struct {
+	// Target ip (icmp) or ip:port (tcp) behind the gateway
+	Target   string `json:"target" yaml:"target"`
+	Protocol string `json:"protocol" yaml:"protocol"`
+	// Failures consecutive failed probes before the range is demoted, zero means the default
+	Failures int `json:"failures" yaml:"failures"`
+}
+
+// GetFailures - returns the number of failed probes demoting the range
+func (h HealthCheck) GetFailures() int {
+	if h.Failures <= 0 {
+		return DefaultHealthCheckFailures
+	}
+	return h.Failures
+}
@@ -0,0 +1,30 @@
+package config
+
+// InterNetworkRouting - opt-in routing between the networks a host is joined to (linux only): traffic
+// arriving on the netmaker interface from the range of one network is forwarded to the range of
+// another only for the allowed pairs, routing between the other networks is dropped
+type InterNetworkRouting struct {
+	// Enabled turns on routing between the joined networks
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Allow the pairs of networks traffic is routed between, in the direction from -> to;
+	// replies of allowed connections are always routed back
+	Allow []InterNetworkPair `json:"allow" yaml:"allow"`
+}
+
+// InterNetworkPair - a pair of joined networks traffic is routed between
+type InterNetworkPair struct {
+	// From name of the network the connections are opened from
+	From string `json:"from" yaml:"from"`
+	// To name of the network the connections are opened to
+	To string `json:"to" yaml:"to"`
+}
+
+// Allowed - checks if connections from one network to another are routed
+func (r InterNetworkRouting) Allowed(from, to string) bool {
+	for _, pair := range r.Allow {
+		if pair.From == from && pair.To == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package config
+
+import "time"
+
+// DefaultMinimalRoutesIdleTimeout time without traffic after which the host route to a peer is removed
+const DefaultMinimalRoutesIdleTimeout = time.Minute * 10
+
+// MinimalRoutes - installs host routes (/32, /128) only to the peers actually communicated with and keeps
+// the routes to the network ranges at the lowest priority (linux only), for hosts with strict routing
+// table policies. A peer is learned once it exchanges traffic beyond keepalives; peers which have to be
+// routed regardless of the routes of the host are pinned
+type MinimalRoutes struct {
+	// Enabled demotes the routes to the network ranges and adds host routes to the learned peers,
+	// takes effect on the next start of the daemon
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// IdleTimeout seconds without traffic after which the route to a peer is removed, zero means the default
+	IdleTimeout int `json:"idletimeout" yaml:"idletimeout"`
+	// Pinned mesh addresses of the peers which are always routed
+	Pinned []string `json:"pinned" yaml:"pinned"`
+}
+
+// GetIdleTimeout - returns the time without traffic after which the route to a peer is removed
+func (m MinimalRoutes) GetIdleTimeout() time.Duration {
+	if m.IdleTimeout <= 0 {
+		return DefaultMinimalRoutesIdleTimeout
+	}
+	return time.Second * time.Duration(m.IdleTimeout)
+}
@@ -0,0 +1,25 @@
+package config
+
+// MSSClamp - the servers and networks whose ranges get the MSS of forwarded tcp connections clamped to
+// the path mtu (linux, iptables only), for gateways whose clients run into PMTU blackholes
+type MSSClamp struct {
+	// Servers names of the servers, all their networks are clamped
+	Servers []string `json:"servers" yaml:"servers"`
+	// Networks names of the networks
+	Networks []string `json:"networks" yaml:"networks"`
+}
+
+// Enabled - checks if MSS clamping is enabled for the network of the server
+func (m MSSClamp) Enabled(server, network string) bool {
+	for _, s := range m.Servers {
+		if s == server {
+			return true
+		}
+	}
+	for _, n := range m.Networks {
+		if n == network {
+			return true
+		}
+	}
+	return false
+}
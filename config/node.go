@@ -252,7 +252,7 @@ func ParseAccessToken(token string) (*models.AccessToken, error) {
 // ModPort - Change Node Port if ListenPort is not free
 func ModPort(host *Config) error {
 	var err error
-	host.ListenPort, err = ncutils.GetFreePort(host.ListenPort)
+	host.ListenPort, err = GetFreeListenPort(host.ListenPort)
 	return err
 }
 
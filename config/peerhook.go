@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+// DefaultPeerHookTimeout time the peer hook has to filter a peer update
+const DefaultPeerHookTimeout = time.Second * 5
+
+// PeerHook - local policy hook called with every peer update from a server before it is applied,
+// it may change or veto single peers of the update, e.g. strip a too broad allowed ip.
+// There is no embedded wasm runtime, a wasm module is run through the cli of a WASI runtime,
+// e.g. command "wasmtime" with args ["filter.wasm"]
+type PeerHook struct {
+	// Command an executable reading the peer update as json on stdin and writing the filtered update
+	// to stdout; go plugins (.so) are rejected as the releases are built without cgo
+	Command string `json:"command" yaml:"command"`
+	// Args arguments of the executable
+	Args []string `json:"args" yaml:"args"`
+	// Timeout seconds the hook has to filter an update, zero means the default
+	Timeout int `json:"timeout" yaml:"timeout"`
+	// FailOpen applies the update unfiltered if the hook fails, instead of rejecting it
+	FailOpen bool `json:"failopen" yaml:"failopen"`
+}
+
+// Enabled - checks if a peer hook is configured
+func (p PeerHook) Enabled() bool {
+	return p.Command != ""
+}
+
+// GetTimeout - returns the time the hook has to filter a peer update
+func (p PeerHook) GetTimeout() time.Duration {
+	if p.Timeout <= 0 {
+		return DefaultPeerHookTimeout
+	}
+	return time.Second * time.Duration(p.Timeout)
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"errors"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// PeerPathAuto - the path to the peer is selected automatically: a detected lan endpoint is
+	// preferred over the advertised one and the peer fails over to a relay when unreachable
+	PeerPathAuto = "auto"
+	// PeerPathDirect - the peer always uses its server advertised endpoint
+	PeerPathDirect = "direct"
+	// PeerPathLAN - the peer uses the endpoint detected on a shared lan and never fails over
+	PeerPathLAN = "lan"
+	// PeerPathRelay - the peer is always reached through a relay
+	PeerPathRelay = "relay"
+)
+
+// ValidatePeerPath - checks that path is one of the peer paths
+func ValidatePeerPath(path string) error {
+	switch path {
+	case PeerPathAuto, PeerPathDirect, PeerPathLAN, PeerPathRelay:
+		return nil
+	}
+	return errors.New("invalid path " + path + ", expected auto, direct, lan or relay")
+}
+
+// GetPeerPath - the path pinned for the peer, auto unless pinned with `netclient peer pin`
+func GetPeerPath(peerPubKey string) string {
+	if path, ok := Netclient().PeerPaths[peerPubKey]; ok {
+		return path
+	}
+	return PeerPathAuto
+}
+
+// migrateDirectPeers - pins the peers of the former directpeers setting to the direct path, the
+// setting is dropped from the config on the next write
+func migrateDirectPeers(cfg *Config, data []byte) {
+	legacy := struct {
+		DirectPeers []string `yaml:"directpeers"`
+	}{}
+	if err := yaml.Unmarshal(data, &legacy); err != nil || len(legacy.DirectPeers) == 0 {
+		return
+	}
+	if cfg.PeerPaths == nil {
+		cfg.PeerPaths = make(map[string]string)
+	}
+	for _, key := range legacy.DirectPeers {
+		if _, ok := cfg.PeerPaths[key]; !ok {
+			cfg.PeerPaths[key] = PeerPathDirect
+		}
+	}
+}
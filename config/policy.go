@@ -0,0 +1,130 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"os/user"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyFile - name of the local command authorization policy file
+const PolicyFile = "policy.yml"
+
+// CommandClass - class of local api commands that can be granted by the policy
+type CommandClass string
+
+const (
+	// CommandStatus - read-only status commands (list, network details)
+	CommandStatus CommandClass = "status"
+	// CommandNetwork - commands changing network membership (join, leave, connect, pull)
+	CommandNetwork CommandClass = "network"
+	// CommandFirewall - commands inspecting or changing firewall rules
+	CommandFirewall CommandClass = "firewall"
+	// CommandAdmin - host wide commands (uninstall)
+	CommandAdmin CommandClass = "admin"
+)
+
+// RequiredRole - returns the api token role needed for the command class when not granted by policy
+func (c CommandClass) RequiredRole() APIRole {
+	if c == CommandStatus {
+		return APIRoleReadOnly
+	}
+	return APIRoleAdmin
+}
+
+// Policy - maps os users and groups to the command classes they may use
+type Policy struct {
+	Users  map[string][]CommandClass `json:"users" yaml:"users"`
+	Groups map[string][]CommandClass `json:"groups" yaml:"groups"`
+	// UserNetworks networks an os user may connect/disconnect through its own config overlay
+	UserNetworks map[string][]string `json:"usernetworks" yaml:"usernetworks"`
+}
+
+// ReadPolicy - reads the local command authorization policy from disk
+func ReadPolicy() (*Policy, error) {
+	f, err := os.Open(GetNetclientPath() + PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	policy := Policy{}
+	if err := yaml.NewDecoder(f).Decode(&policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Allows - checks if the policy grants the command class to the given user
+func (p *Policy) Allows(u *user.User, class CommandClass) bool {
+	if p == nil || u == nil {
+		return false
+	}
+	if u.Uid == "0" {
+		return true
+	}
+	if hasClass(p.Users[u.Username], class) {
+		return true
+	}
+	groups, err := u.GroupIds()
+	if err != nil {
+		return false
+	}
+	for _, gid := range groups {
+		group, err := user.LookupGroupId(gid)
+		if err != nil {
+			continue
+		}
+		if hasClass(p.Groups[group.Name], class) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAllowedByPolicy - checks if the local policy grants the command class to the user with the given uid
+func IsAllowedByPolicy(uid string, class CommandClass) (bool, error) {
+	policy, err := ReadPolicy()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return false, err
+	}
+	return policy.Allows(u, class), nil
+}
+
+// IsNetworkAllowedByPolicy - checks if the local policy lets the user with the given uid
+// control the network through its config overlay, returns the user name if so
+func IsNetworkAllowedByPolicy(uid, network string) (string, bool, error) {
+	policy, err := ReadPolicy()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return "", false, err
+	}
+	for _, allowed := range policy.UserNetworks[u.Username] {
+		if allowed == network {
+			return u.Username, true, nil
+		}
+	}
+	return u.Username, false, nil
+}
+
+func hasClass(classes []CommandClass, class CommandClass) bool {
+	for _, c := range classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package config
+
+import "time"
+
+// DefaultPolicyHookTimeout time the policy engine has to decide on a connection
+const DefaultPolicyHookTimeout = time.Millisecond * 200
+
+// PolicyHook - local policy engine deciding on new connections from the mesh not covered by the static
+// rules (linux only): the first packet of each connection is queued over nfqueue to netclient, which
+// asks the engine to accept or drop it
+type PolicyHook struct {
+	// Engine an executable reading flows as json lines on stdin and answering each with a line
+	// "<id> accept" or "<id> drop"; go plugins (.so) are rejected as the releases are built without cgo
+	Engine string `json:"engine" yaml:"engine"`
+	// Args arguments of the executable
+	Args []string `json:"args" yaml:"args"`
+	// Queue nfqueue number the connections are queued to
+	Queue uint16 `json:"queue" yaml:"queue"`
+	// FailOpen accepts connections the engine does not decide on in time, or while netclient is not
+	// listening on the queue, instead of dropping them
+	FailOpen bool `json:"failopen" yaml:"failopen"`
+	// Timeout milliseconds the engine has to decide, zero means the default
+	Timeout int `json:"timeout" yaml:"timeout"`
+}
+
+// Enabled - checks if a policy engine is configured
+func (p PolicyHook) Enabled() bool {
+	return p.Engine != ""
+}
+
+// GetTimeout - returns the time the engine has to decide on a connection
+func (p PolicyHook) GetTimeout() time.Duration {
+	if p.Timeout <= 0 {
+		return DefaultPolicyHookTimeout
+	}
+	return time.Millisecond * time.Duration(p.Timeout)
+}
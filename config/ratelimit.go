@@ -0,0 +1,15 @@
+package config
+
+// ExtClientRateLimit - ceiling of the traffic each ext client of an ingress gateway forwards through the
+// host, in either direction (linux, iptables only), the traffic above it is dropped
+type ExtClientRateLimit struct {
+	// PacketsPerSecond packets per second, 0 for no limit
+	PacketsPerSecond int `json:"packetspersecond" yaml:"packetspersecond"`
+	// KilobytesPerSecond bandwidth in kilobytes per second, 0 for no limit
+	KilobytesPerSecond int `json:"kilobytespersecond" yaml:"kilobytespersecond"`
+}
+
+// Enabled - checks if a limit is configured
+func (r ExtClientRateLimit) Enabled() bool {
+	return r.PacketsPerSecond > 0 || r.KilobytesPerSecond > 0
+}
@@ -0,0 +1,50 @@
+package config
+
+import "time"
+
+// RemovedNetwork - a network the host was removed from by its server, kept to tell why it is gone
+type RemovedNetwork struct {
+	Server string    `json:"server" yaml:"server"`
+	NodeID string    `json:"nodeid" yaml:"nodeid"`
+	Reason string    `json:"reason" yaml:"reason"`
+	Time   time.Time `json:"time" yaml:"time"`
+}
+
+// RecordRemovedNetwork - records the removal of the node of a network by its server
+func RecordRemovedNetwork(node Node, reason string) {
+	host := Netclient()
+	removed := make(map[string]RemovedNetwork, len(host.RemovedNetworks)+1)
+	for network, r := range host.RemovedNetworks {
+		removed[network] = r
+	}
+	removed[node.Network] = RemovedNetwork{
+		Server: node.Server,
+		NodeID: node.ID.String(),
+		Reason: reason,
+		Time:   time.Now(),
+	}
+	host.RemovedNetworks = removed
+	UpdateNetclient(*host)
+}
+
+// ClearRemovedNetwork - forgets the removal of a network, when it is joined again
+func ClearRemovedNetwork(network string) {
+	host := Netclient()
+	if _, ok := host.RemovedNetworks[network]; !ok {
+		return
+	}
+	removed := make(map[string]RemovedNetwork, len(host.RemovedNetworks))
+	for k, r := range host.RemovedNetworks {
+		if k != network {
+			removed[k] = r
+		}
+	}
+	host.RemovedNetworks = removed
+	UpdateNetclient(*host)
+}
+
+// GetRemovedNetwork - returns the recorded removal of a network
+func GetRemovedNetwork(network string) (RemovedNetwork, bool) {
+	removed, ok := Netclient().RemovedNetworks[network]
+	return removed, ok
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// AccessSchedule - a time window a peer is allowed in, a peer with schedules is blocked locally
+// outside of all of its windows
+type AccessSchedule struct {
+	// Peer public key of the peer
+	Peer string `json:"peer" yaml:"peer"`
+	// Days the window starts on, as mon..sun or ranges like mon-fri, empty means every day
+	Days []string `json:"days" yaml:"days"`
+	// Start of the window as HH:MM
+	Start string `json:"start" yaml:"start"`
+	// End of the window as HH:MM, an end before the start closes the window on the next day
+	End string `json:"end" yaml:"end"`
+	// Timezone IANA name of the timezone of the window, empty means the local timezone
+	Timezone string `json:"timezone" yaml:"timezone"`
+}
+
+// accessWindow - parsed form of an AccessSchedule
+type accessWindow struct {
+	days       [7]bool
+	start, end time.Duration
+	loc        *time.Location
+}
+
+// Validate - checks the days, times and timezone of the schedule
+func (s AccessSchedule) Validate() error {
+	_, err := s.parse()
+	return err
+}
+
+func (s AccessSchedule) parse() (accessWindow, error) {
+	w := accessWindow{loc: time.Local}
+	var err error
+	if w.start, err = parseClock(s.Start); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(s.End); err != nil {
+		return w, err
+	}
+	if w.start == w.end {
+		return w, errors.New("start and end of the window are equal")
+	}
+	if s.Timezone != "" {
+		if w.loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return w, err
+		}
+	}
+	if len(s.Days) == 0 {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+		return w, nil
+	}
+	for _, day := range s.Days {
+		from, to, isRange := strings.Cut(strings.ToLower(day), "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return w, fmt.Errorf("invalid day %q", day)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return w, fmt.Errorf("invalid day %q", day)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return w, nil
+}
+
+// parseClock - parses HH:MM into the duration since midnight
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// bounds - the windows starting from the day before t up to a week after it
+func (w accessWindow) bounds(t time.Time) [][2]time.Time {
+	t = t.In(w.loc)
+	windows := [][2]time.Time{}
+	for offset := -1; offset <= 7; offset++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, w.loc)
+		if !w.days[day.Weekday()] {
+			continue
+		}
+		end := day
+		if w.end < w.start {
+			end = day.AddDate(0, 0, 1)
+		}
+		// time.Date normalizes the clock across daylight saving changes
+		windows = append(windows, [2]time.Time{
+			time.Date(day.Year(), day.Month(), day.Day(), 0, int(w.start/time.Minute), 0, 0, w.loc),
+			time.Date(end.Year(), end.Month(), end.Day(), 0, int(w.end/time.Minute), 0, 0, w.loc),
+		})
+	}
+	return windows
+}
+
+// Allows - checks if t is within a window of the schedule, an invalid schedule allows nothing
+func (s AccessSchedule) Allows(t time.Time) bool {
+	w, err := s.parse()
+	if err != nil {
+		return false
+	}
+	for _, window := range w.bounds(t) {
+		if !t.Before(window[0]) && t.Before(window[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextChange - returns the next start or end of a window after t, zero for an invalid schedule
+func (s AccessSchedule) NextChange(t time.Time) time.Time {
+	w, err := s.parse()
+	if err != nil {
+		return time.Time{}
+	}
+	next := time.Time{}
+	for _, window := range w.bounds(t) {
+		for _, bound := range window {
+			if bound.After(t) && (next.IsZero() || bound.Before(next)) {
+				next = bound
+			}
+		}
+	}
+	return next
+}
+
+// IsScheduledOut - checks if the peer has access schedules and t is outside of all of them
+func IsScheduledOut(peerPubKey string, t time.Time) bool {
+	scheduled := false
+	for _, schedule := range Netclient().AccessSchedules {
+		if schedule.Peer != peerPubKey {
+			continue
+		}
+		if schedule.Allows(t) {
+			return false
+		}
+		scheduled = true
+	}
+	return scheduled
+}
+
+// NextScheduleChange - returns the next time a peer enters or leaves a window of its access
+// schedules after t, zero if there are none
+func NextScheduleChange(t time.Time) time.Time {
+	next := time.Time{}
+	for _, schedule := range Netclient().AccessSchedules {
+		change := schedule.NextChange(t)
+		if !change.IsZero() && (next.IsZero() || change.Before(next)) {
+			next = change
+		}
+	}
+	return next
+}
+
+// IsExpiredExtClient - checks if the peer is an ext client whose expiry announced by its server passed at t
+func IsExpiredExtClient(peerPubKey string, t time.Time) bool {
+	for _, expiries := range Netclient().ExtClientExpiry {
+		if expiry, ok := expiries[peerPubKey]; ok && !t.Before(expiry) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDeniedPeers - checks if peers may be denied locally, by blocks, access schedules or ext client expiry
+func HasDeniedPeers() bool {
+	return len(Netclient().BlockedPeers) > 0 || len(Netclient().AccessSchedules) > 0 || len(Netclient().ExtClientExpiry) > 0
+}
+
+// IsDeniedPeer - checks if the peer is blocked locally, outside of its access schedules or an expired ext client
+func IsDeniedPeer(peerPubKey string) bool {
+	now := time.Now()
+	return IsBlockedPeer(peerPubKey) || IsScheduledOut(peerPubKey, now) || IsExpiredExtClient(peerPubKey, now)
+}
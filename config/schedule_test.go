@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessSchedule(t *testing.T) {
+	utc := func(day, hour, min int) time.Time {
+		// 2024-01-01 is a monday
+		return time.Date(2024, 1, day, hour, min, 0, 0, time.UTC)
+	}
+	t.Run("workdays", func(t *testing.T) {
+		s := AccessSchedule{Days: []string{"mon-fri"}, Start: "09:00", End: "17:00", Timezone: "UTC"}
+		assert.NoError(t, s.Validate())
+		assert.False(t, s.Allows(utc(1, 8, 59)))
+		assert.True(t, s.Allows(utc(1, 9, 0)))
+		assert.False(t, s.Allows(utc(1, 17, 0)))
+		assert.False(t, s.Allows(utc(6, 12, 0)))
+		assert.Equal(t, utc(1, 17, 0), s.NextChange(utc(1, 12, 0)))
+		// friday evening until monday morning
+		assert.Equal(t, utc(8, 9, 0), s.NextChange(utc(5, 18, 0)))
+	})
+	t.Run("over midnight", func(t *testing.T) {
+		s := AccessSchedule{Days: []string{"sun"}, Start: "22:00", End: "06:00", Timezone: "UTC"}
+		assert.NoError(t, s.Validate())
+		// started on sunday, ends on monday
+		assert.True(t, s.Allows(utc(1, 5, 0)))
+		assert.False(t, s.Allows(utc(1, 22, 30)))
+		assert.True(t, s.Allows(utc(7, 23, 0)))
+		assert.Equal(t, utc(1, 6, 0), s.NextChange(utc(1, 0, 0)))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		assert.Error(t, AccessSchedule{Start: "9", End: "17:00"}.Validate())
+		assert.Error(t, AccessSchedule{Start: "09:00", End: "09:00"}.Validate())
+		assert.Error(t, AccessSchedule{Days: []string{"monday"}, Start: "09:00", End: "17:00"}.Validate())
+		assert.Error(t, AccessSchedule{Start: "09:00", End: "17:00", Timezone: "Nowhere/City"}.Validate())
+		assert.False(t, AccessSchedule{Start: "9", End: "17:00"}.Allows(utc(1, 12, 0)))
+	})
+}
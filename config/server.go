@@ -2,9 +2,11 @@
 package config
 
 import (
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gravitl/netmaker/logger"
@@ -33,6 +35,32 @@ type Server struct {
 	MQID      uuid.UUID       `json:"mqid" yaml:"mqid"`
 	Nodes     map[string]bool `json:"nodes" yaml:"nodes"`
 	AccessKey string          `json:"accesskey" yaml:"accesskey"`
+	// CheckinInterval seconds between checkins, zero means the default
+	CheckinInterval int `json:"checkininterval" yaml:"checkininterval"`
+	// CheckinJitter maximum random seconds added to each checkin interval, zero means a tenth of the interval, negative disables
+	CheckinJitter int `json:"checkinjitter" yaml:"checkinjitter"`
+}
+
+// DefaultCheckinInterval - default interval between checkins
+const DefaultCheckinInterval = time.Minute
+
+// NextCheckin - returns the time to wait until the next checkin, the interval plus a random jitter
+// spreading the checkins of many hosts
+func (s *Server) NextCheckin() time.Duration {
+	interval := DefaultCheckinInterval
+	if s.CheckinInterval > 0 {
+		interval = time.Second * time.Duration(s.CheckinInterval)
+	}
+	jitter := interval / 10
+	if s.CheckinJitter > 0 {
+		jitter = time.Second * time.Duration(s.CheckinJitter)
+	} else if s.CheckinJitter < 0 {
+		jitter = 0
+	}
+	if jitter > 0 {
+		interval += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	return interval
 }
 
 // OldNetmakerServerConfig - pre v0.18.0 server configuration
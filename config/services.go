@@ -0,0 +1,25 @@
+package config
+
+// Service - a service of this host advertised to its peers
+type Service struct {
+	Name string `json:"name" yaml:"name"`
+	Port int    `json:"port" yaml:"port"`
+	// Protocol tcp or udp, defaults to tcp
+	Protocol string `json:"protocol" yaml:"protocol"`
+}
+
+// GetProtocol - returns the protocol of the service, tcp if unset
+func (s Service) GetProtocol() string {
+	if s.Protocol == "" {
+		return "tcp"
+	}
+	return s.Protocol
+}
+
+// ExposedService - a local service forwarded from the mesh addresses of this host to its peers
+type ExposedService struct {
+	// Target address of the local service, e.g. 127.0.0.1:8080
+	Target string `json:"target" yaml:"target"`
+	// Listen address and port the service is exposed on, an empty address means all mesh addresses
+	Listen string `json:"listen" yaml:"listen"`
+}
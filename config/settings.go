@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// nonSettings - fields of the config holding identity or state managed by netclient itself, they
+// cannot be set as local settings
+var nonSettings = map[string]bool{
+	"privatekey":          true,
+	"traffickeyprivate":   true,
+	"host_peers":          true,
+	"inittype":            true,
+	"extclientexpiry":     true,
+	"serversearchdomains": true,
+	"removednetworks":     true,
+}
+
+// SettingKeys - returns the keys of the local settings, named as in netclient.yml
+func SettingKeys() []string {
+	keys := []string{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := settingKey(t.Field(i)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// settingKey - returns the key of a local setting, empty for fields which are not settings
+func settingKey(field reflect.StructField) string {
+	if field.Anonymous {
+		return ""
+	}
+	key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if key == "" || key == "-" || nonSettings[key] {
+		return ""
+	}
+	return key
+}
+
+// settingField - returns the field of the local setting
+func (c *Config) settingField(key string) (reflect.Value, error) {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if settingKey(v.Type().Field(i)) == key {
+			return v.Field(i), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("unknown setting %q", key)
+}
+
+// decodeSetting - decodes a value of a setting, as read from yaml or json, into the type of the field
+func decodeSetting(field reflect.Value, key string, value any) (reflect.Value, error) {
+	decoded := reflect.New(field.Type())
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return decoded, err
+	}
+	if err := yaml.Unmarshal(data, decoded.Interface()); err != nil {
+		return decoded, fmt.Errorf("invalid value for setting %q: %w", key, err)
+	}
+	return decoded.Elem(), nil
+}
+
+// SettingEqual - checks if a local setting already has the value
+func (c *Config) SettingEqual(key string, value any) (bool, error) {
+	field, err := c.settingField(key)
+	if err != nil {
+		return false, err
+	}
+	decoded, err := decodeSetting(field, key, value)
+	if err != nil {
+		return false, err
+	}
+	// compare the encoded forms, nil and empty lists or maps are the same setting
+	current, err := yaml.Marshal(field.Interface())
+	if err != nil {
+		return false, err
+	}
+	wanted, err := yaml.Marshal(decoded.Interface())
+	if err != nil {
+		return false, err
+	}
+	return string(current) == string(wanted), nil
+}
+
+// SetSetting - sets a local setting to the value, as read from yaml or json
+func (c *Config) SetSetting(key string, value any) error {
+	field, err := c.settingField(key)
+	if err != nil {
+		return err
+	}
+	decoded, err := decodeSetting(field, key, value)
+	if err != nil {
+		return err
+	}
+	field.Set(decoded)
+	return nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings(t *testing.T) {
+	c := Config{WoLRelay: false, RouteTables: map[string]int{"net1": 100}}
+	assert.Contains(t, SettingKeys(), "wolrelay")
+	assert.NotContains(t, SettingKeys(), "privatekey")
+
+	equal, err := c.SettingEqual("wolrelay", true)
+	assert.NoError(t, err)
+	assert.False(t, equal)
+	assert.NoError(t, c.SetSetting("wolrelay", true))
+	assert.True(t, c.WoLRelay)
+
+	// values decoded from json carry numbers as float64
+	equal, err = c.SettingEqual("routetables", map[string]any{"net1": float64(100)})
+	assert.NoError(t, err)
+	assert.True(t, equal)
+	assert.NoError(t, c.SetSetting("routetables", map[string]any{"net2": 200}))
+	assert.Equal(t, map[string]int{"net2": 200}, c.RouteTables)
+
+	equal, err = c.SettingEqual("blockedpeers", []any{})
+	assert.NoError(t, err)
+	assert.True(t, equal)
+
+	_, err = c.SettingEqual("privatekey", "x")
+	assert.Error(t, err)
+	assert.Error(t, c.SetSetting("firewallcheckinterval", "often"))
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// TagPolicy - local behaviour applied to peers carrying a tag
+type TagPolicy struct {
+	// PersistentKeepalive seconds, overrides the keepalive set by the server when non zero
+	PersistentKeepalive int `json:"persistentkeepalive" yaml:"persistentkeepalive"`
+}
+
+// GetPeerTags - returns the tags assigned to a peer
+func GetPeerTags(peerPubKey string) []string {
+	return Netclient().PeerTags[peerPubKey]
+}
+
+// ApplyTagPolicies - applies the policies of the peer's tags to the peer config,
+// when several tags set a keepalive the shortest one wins
+func ApplyTagPolicies(peer *wgtypes.PeerConfig) {
+	policies := Netclient().TagPolicies
+	if len(policies) == 0 {
+		return
+	}
+	keepalive := 0
+	for _, tag := range GetPeerTags(peer.PublicKey.String()) {
+		policy, ok := policies[tag]
+		if !ok || policy.PersistentKeepalive <= 0 {
+			continue
+		}
+		if keepalive == 0 || policy.PersistentKeepalive < keepalive {
+			keepalive = policy.PersistentKeepalive
+		}
+	}
+	if keepalive > 0 {
+		interval := time.Second * time.Duration(keepalive)
+		peer.PersistentKeepaliveInterval = &interval
+	}
+}
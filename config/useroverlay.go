@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gravitl/netmaker/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// UserOverlayDir - directory (below the netclient path) holding the per-user config overlays
+const UserOverlayDir = "users"
+
+// UserOverlay - per-user settings layered over the machine config, only written by the daemon
+// on behalf of a user and only for networks the local policy lets that user control
+type UserOverlay struct {
+	// Networks desired connection state of networks, keyed by network name
+	Networks map[string]bool `json:"networks" yaml:"networks"`
+}
+
+// ReadUserOverlay - reads the config overlay of the user
+func ReadUserOverlay(username string) (*UserOverlay, error) {
+	return readUserOverlay(userOverlayPath(username))
+}
+
+// readUserOverlay - reads a config overlay file, a missing file is an empty overlay
+func readUserOverlay(path string) (*UserOverlay, error) {
+	overlay := UserOverlay{Networks: make(map[string]bool)}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &overlay, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if err := yaml.NewDecoder(f).Decode(&overlay); err != nil {
+		return nil, err
+	}
+	if overlay.Networks == nil {
+		overlay.Networks = make(map[string]bool)
+	}
+	return &overlay, nil
+}
+
+// WriteUserOverlay - writes the config overlay of the user
+func WriteUserOverlay(username string, overlay *UserOverlay) error {
+	if err := os.MkdirAll(filepath.Join(GetNetclientPath(), UserOverlayDir), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(userOverlayPath(username), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return yaml.NewEncoder(f).Encode(overlay)
+}
+
+func userOverlayPath(username string) string {
+	return filepath.Join(GetNetclientPath(), UserOverlayDir, filepath.Base(username)+".yml")
+}
+
+// applyUserOverlays - layers the overlays of the users in dir over the config: only the networks the policy
+// lets a user control are taken from the user's overlay, the users are applied in name order so a later
+// user's choice wins for a network several users control
+func applyUserOverlays(cfg *Config, policy *Policy, dir string) {
+	cfg.UserNetworks = make(map[string]bool)
+	users := make([]string, 0, len(policy.UserNetworks))
+	for username := range policy.UserNetworks {
+		users = append(users, username)
+	}
+	sort.Strings(users)
+	for _, username := range users {
+		overlay, err := readUserOverlay(filepath.Join(dir, filepath.Base(username)+".yml"))
+		if err != nil {
+			logger.Log(0, "failed to read the config overlay of user", username, err.Error())
+			continue
+		}
+		for _, network := range policy.UserNetworks[username] {
+			if connected, ok := overlay.Networks[network]; ok {
+				cfg.UserNetworks[network] = connected
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyUserOverlays(t *testing.T) {
+	dir := t.TempDir()
+	overlays := map[string]string{
+		"alice": "networks:\n  home: false\n  office: true\n",
+		"bob":   "networks:\n  home: true\n  lab: true\n",
+	}
+	for username, data := range overlays {
+		err := os.WriteFile(filepath.Join(dir, username+".yml"), []byte(data), 0600)
+		assert.Nil(t, err)
+	}
+	policy := &Policy{
+		UserNetworks: map[string][]string{
+			"alice": {"home", "office"},
+			"bob":   {"home"},
+			"carol": {"lab"},
+		},
+	}
+	cfg := Config{}
+	applyUserOverlays(&cfg, policy, dir)
+	// bob is applied after alice, lab is not a network bob controls, carol has no overlay
+	assert.Equal(t, map[string]bool{"home": true, "office": true}, cfg.UserNetworks)
+
+	// the networks are taken from the overlays of the users the policy lists only
+	cfg = Config{}
+	applyUserOverlays(&cfg, &Policy{}, dir)
+	assert.Empty(t, cfg.UserNetworks)
+}
@@ -42,6 +42,8 @@ func install() error {
 		return setuprunit()
 	case config.Initd:
 		return setupInitd()
+	case config.WSL:
+		return setupWSL()
 	default:
 		return errors.New("unsupported init type")
 	}
@@ -64,6 +66,8 @@ func start() error {
 		return startrunit()
 	case config.Initd:
 		return startInitd()
+	case config.WSL:
+		return startWSL()
 	default:
 		return errors.New("unsupported init type")
 	}
@@ -86,6 +90,8 @@ func stop() error {
 		return stoprunit()
 	case config.Initd:
 		return stopInitd()
+	case config.WSL:
+		return stopWSL()
 	default:
 		return signalDaemon(syscall.SIGTERM)
 	}
@@ -108,6 +114,8 @@ func hardRestart() error {
 		return restartrunit()
 	case config.Initd:
 		return restartInitd()
+	case config.WSL:
+		return restartWSL()
 	default:
 		return errors.New("unsupported init type")
 	}
@@ -136,6 +144,8 @@ func cleanUp() error {
 			err = removerunit()
 		case config.Initd:
 			err = removeInitd()
+		case config.WSL:
+			err = removeWSL()
 		default:
 			err = errors.New("unsupported init type")
 		}
@@ -173,6 +183,10 @@ func GetInitType() config.InitType {
 	if runtime.GOOS != "linux" {
 		return config.UnKnown
 	}
+	if ncutils.IsWSL() && !ncutils.FileExists("/run/systemd/system") {
+		// wsl without systemd enabled, no service manager available
+		return config.WSL
+	}
 	out, err := ncutils.RunCmd("ls -l /sbin/init", false)
 	if err != nil {
 		slog.Error("error checking /sbin/init", "error", err)
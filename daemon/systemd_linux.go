@@ -20,7 +20,6 @@ Wants=network-online.target
 [Service]
 User=root
 Type=simple
-ExecStartPre=/bin/sleep 17
 ExecStart=/sbin/netclient daemon
 Restart=on-failure
 RestartSec=15s
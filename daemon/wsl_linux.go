@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	wslConf    = "/etc/wsl.conf"
+	wslLogFile = "/var/log/netclient.log"
+	// wslBootCommand - started by wsl when the distribution boots, in place of a service manager
+	wslBootCommand = "command = /bin/sh -c 'nohup " + ExecDir + "netclient daemon >> " + wslLogFile + " 2>&1 &'"
+)
+
+// setupWSL - starts the daemon at boot of the wsl distribution through the [boot] command of wsl.conf
+func setupWSL() error {
+	data, err := os.ReadFile(wslConf)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	bootSection := -1
+	section := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			section = strings.ToLower(trimmed)
+			if section == "[boot]" {
+				bootSection = i
+			}
+			continue
+		}
+		if section != "[boot]" || !strings.HasPrefix(trimmed, "command") {
+			continue
+		}
+		if trimmed == wslBootCommand {
+			return nil
+		}
+		slog.Warn("wsl.conf already has a boot command, add the netclient daemon to it manually", "command", wslBootCommand)
+		return errors.New("wsl boot command already in use")
+	}
+	if bootSection < 0 {
+		lines = append(lines, "[boot]", wslBootCommand, "")
+	} else {
+		lines = append(lines[:bootSection+1], append([]string{wslBootCommand}, lines[bootSection+1:]...)...)
+	}
+	return os.WriteFile(wslConf, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// startWSL - starts the daemon detached from the calling shell
+func startWSL() error {
+	slog.Info("starting netclient daemon")
+	log, err := os.OpenFile(wslLogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	cmd := exec.Command(ExecDir+"netclient", "daemon")
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// stopWSL - stops the daemon
+func stopWSL() error {
+	slog.Info("stopping netclient daemon")
+	return signalDaemon(syscall.SIGTERM)
+}
+
+// restartWSL - restarts the daemon
+func restartWSL() error {
+	if err := stopWSL(); err != nil {
+		slog.Warn("failed to stop netclient daemon", "error", err)
+	} else {
+		// give the daemon time to close the interface
+		time.Sleep(time.Second * 3)
+	}
+	return startWSL()
+}
+
+// removeWSL - removes the daemon from the boot command of wsl.conf
+func removeWSL() error {
+	data, err := os.ReadFile(wslConf)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	lines := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != wslBootCommand {
+			lines = append(lines, line)
+		}
+	}
+	return os.WriteFile(wslConf, []byte(strings.Join(lines, "\n")), 0644)
+}
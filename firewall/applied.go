@@ -0,0 +1,60 @@
+package firewall
+
+import (
+	"net"
+	"reflect"
+	"sync"
+)
+
+// appliedState - the input last applied through a wrapper of the firewall manager; the wrappers run on
+// every peer update, an unchanged input is not passed on so the rules are not replaced needlessly
+type appliedState[T any] struct {
+	mux     sync.Mutex
+	applied *T
+}
+
+// apply - calls set unless wanted equals the input last applied, reports whether set was called; a failed
+// set forgets the input so the next call applies it again
+func (a *appliedState[T]) apply(wanted T, set func() error) (bool, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.applied != nil && reflect.DeepEqual(*a.applied, wanted) {
+		return false, nil
+	}
+	if err := set(); err != nil {
+		a.applied = nil
+		return true, err
+	}
+	a.applied = &wanted
+	return true, nil
+}
+
+// forget - forgets the input last applied, the next call applies its input
+func (a *appliedState[T]) forget() {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.applied = nil
+}
+
+// forgetAppliedStates - forgets the inputs last applied through all wrappers, a new firewall manager has
+// none of their rules
+func forgetAppliedStates() {
+	appliedDefaultDeny.forget()
+	appliedDropLogging.forget()
+	appliedEgressMarks.forget()
+	appliedInterNetworkRules.forget()
+	appliedMSSClamp.forget()
+	appliedStaticNat.forget()
+	appliedRateLimitsMutex.Lock()
+	appliedRateLimits = make(map[string]*appliedState[map[string]RateLimit])
+	appliedRateLimitsMutex.Unlock()
+}
+
+// rangeSet - the ranges as a set, the input of the wrappers keyed by range
+func rangeSet(ranges []net.IPNet) map[string]bool {
+	set := make(map[string]bool, len(ranges))
+	for _, r := range ranges {
+		set[r.String()] = true
+	}
+	return set
+}
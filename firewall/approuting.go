@@ -0,0 +1,12 @@
+package firewall
+
+import "errors"
+
+// SetAppMark - marks the traffic of the processes matched by the iptables cgroup match and masquerades
+// it to the mesh address when routed to the netmaker interface, an empty match removes the rules
+func SetAppMark(cgroupMatch []string, mark int) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	return fwCrtl.SetAppMark(cgroupMatch, mark)
+}
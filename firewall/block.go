@@ -0,0 +1,93 @@
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SetBlockedPeers - replaces the rules dropping traffic to and from the addresses of locally blocked
+// peers, keyed by peer public key
+func SetBlockedPeers(peers map[string][]net.IPNet) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	if err := fwCrtl.BlockPeers(peers); err != nil {
+		return err
+	}
+	// flows of the peers offloaded to the fast path would skip the new drop rules
+	return resetFastPath()
+}
+
+// blockRuleKey - key of the rules blocking an address of a peer in the block rule table, the rules of
+// peers sharing an address are kept apart
+func blockRuleKey(peerKey string, addr net.IPNet) string {
+	return peerKey + "@" + addr.String()
+}
+
+// blockedPeersOf - the blocked addresses by peer of a rule table of block rules
+func blockedPeersOf(rules ruletable) map[string][]net.IPNet {
+	peers := make(map[string][]net.IPNet)
+	for key, cfg := range rules {
+		_, addr, ok := strings.Cut(key, "@")
+		if !ok {
+			// saved by a version keying the rules by address only
+			addr = key
+		}
+		for peerKey := range cfg.rulesMap {
+			peers[peerKey] = append(peers[peerKey], toIPNet(addr))
+		}
+	}
+	return peers
+}
+
+// diffBlockRules - the block rules of the addresses of the peers, and the entries of the current rules to
+// remove and the new entries to add to get there; the rules of an address still blocked for the same
+// peer are kept, rulesOf makes the rules of the other addresses
+func diffBlockRules(current ruletable, peers map[string][]net.IPNet, rulesOf func(peerKey string, addr net.IPNet) []ruleInfo) (wanted, added, removed ruletable) {
+	wanted, added, removed = make(ruletable), make(ruletable), make(ruletable)
+	for peerKey, addrs := range peers {
+		for _, addr := range addrs {
+			key := blockRuleKey(peerKey, addr)
+			if cfg, ok := current[key]; ok {
+				wanted[key] = cfg
+				continue
+			}
+			cfg := rulesCfg{isIpv4: addr.IP.To4() != nil, rulesMap: map[string][]ruleInfo{peerKey: rulesOf(peerKey, addr)}}
+			wanted[key] = cfg
+			added[key] = cfg
+		}
+	}
+	for key, cfg := range current {
+		if _, ok := wanted[key]; !ok {
+			removed[key] = cfg
+		}
+	}
+	return wanted, added, removed
+}
+
+// addBlockRules - adds the rules of the new entries of the block rules one by one, the returned table
+// tracks the kept entries and the rules added, which on failure are the ones added before it
+func addBlockRules(wanted, added ruletable, add func(rule ruleInfo) error) (ruletable, error) {
+	tracked := make(ruletable, len(wanted))
+	for key, cfg := range wanted {
+		if _, ok := added[key]; !ok {
+			tracked[key] = cfg
+		}
+	}
+	for key, cfg := range added {
+		for peerKey, rules := range cfg.rulesMap {
+			inserted := []ruleInfo{}
+			for _, rule := range rules {
+				if err := add(rule); err != nil {
+					tracked[key] = rulesCfg{isIpv4: cfg.isIpv4, rulesMap: map[string][]ruleInfo{peerKey: inserted}}
+					return tracked, fmt.Errorf("failed to add rule %v for blocked peer %s: %w", rule.rule, peerKey, err)
+				}
+				inserted = append(inserted, rule)
+			}
+			tracked[key] = rulesCfg{isIpv4: cfg.isIpv4, rulesMap: map[string][]ruleInfo{peerKey: inserted}}
+		}
+	}
+	return tracked, nil
+}
@@ -0,0 +1,33 @@
+package firewall
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDiffBlockRules(t *testing.T) {
+	rulesOf := func(peerKey string, addr net.IPNet) []ruleInfo {
+		return []ruleInfo{{rule: []string{peerKey, addr.String()}}}
+	}
+	a, b := toIPNet("10.0.0.1/32"), toIPNet("10.0.0.2/32")
+	current, _, _ := diffBlockRules(make(ruletable), map[string][]net.IPNet{"peer1": {a}, "peer2": {a}}, rulesOf)
+	if len(current) != 2 {
+		t.Fatalf("peers sharing an address got %d entries, want 2", len(current))
+	}
+
+	// peer1 moved to another address, peer2 keeps the shared one
+	wanted, added, removed := diffBlockRules(current, map[string][]net.IPNet{"peer1": {b}, "peer2": {a}}, rulesOf)
+	if _, ok := added[blockRuleKey("peer1", b)]; !ok || len(added) != 1 {
+		t.Errorf("added = %v, want the new address of peer1 only", added)
+	}
+	if _, ok := removed[blockRuleKey("peer1", a)]; !ok || len(removed) != 1 {
+		t.Errorf("removed = %v, want the old address of peer1 only", removed)
+	}
+	if _, ok := wanted[blockRuleKey("peer2", a)]; !ok || len(wanted) != 2 {
+		t.Errorf("wanted = %v, want the rules of peer2 kept", wanted)
+	}
+	peers := blockedPeersOf(wanted)
+	if len(peers["peer1"]) != 1 || !peers["peer1"][0].IP.Equal(b.IP) {
+		t.Errorf("blocked addresses of peer1 = %v, want %s", peers["peer1"], b.String())
+	}
+}
@@ -0,0 +1,30 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+)
+
+// defaultDenyTable - rule table of the rules of default-deny networks, keyed by network range
+const defaultDenyTable = "defaultdeny"
+
+// appliedDefaultDeny - the ranges of the default-deny rules last applied
+var appliedDefaultDeny appliedState[map[string]bool]
+
+// SetDefaultDeny - switches the networks of the ranges to default-deny: the traffic of their peers forwarded
+// out of the mesh is dropped unless a rule of the netmaker filter chain accepts it (egress gateway peers,
+// established connections), the other networks stay default-allow, nil reverts all;
+// the rules are only replaced when the ranges changed
+func SetDefaultDeny(ranges []net.IPNet) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	changed, err := appliedDefaultDeny.apply(rangeSet(ranges), func() error {
+		return fwCrtl.SetDefaultDeny(ranges)
+	})
+	if err != nil || !changed {
+		return err
+	}
+	// flows offloaded to the fast path would skip the new drop rules
+	return resetFastPath()
+}
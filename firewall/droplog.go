@@ -0,0 +1,39 @@
+package firewall
+
+import "errors"
+
+const (
+	// dropLogPrefix - prefix of the kernel log entries of the packets dropped in the netmaker filter chain
+	dropLogPrefix = "netmaker-drop:"
+	// dropLogRate - kernel log entries per minute at most, after a burst of dropLogBurst entries
+	dropLogRate  = 10
+	dropLogBurst = 20
+)
+
+// errDropLoggingUnsupported - the firewall manager has no drop rules to log
+var errDropLoggingUnsupported = errors.New("drop logging is not supported by the firewall")
+
+// appliedDropLogging - the drop logging setting last applied
+var appliedDropLogging appliedState[bool]
+
+// SetDropLogging - switches the rate limited logging of the packets dropped by the netmaker rules (blocked
+// peers, inter-network routing, default-deny networks) to the kernel log with the netmaker-drop: prefix;
+// the setting is only applied when it changed, a firewall not supporting it reports so once
+func SetDropLogging(enabled bool) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	var unsupported error
+	_, err := appliedDropLogging.apply(enabled, func() error {
+		err := fwCrtl.SetDropLogging(enabled)
+		if errors.Is(err, errDropLoggingUnsupported) {
+			unsupported = err
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return unsupported
+}
@@ -0,0 +1,252 @@
+package firewall
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/gravitl/netmaker/logger"
+)
+
+// iptablesAPI - the iptables operations of the iptables manager, implemented by the go-iptables client
+// and by the dry run client
+type iptablesAPI interface {
+	Proto() iptables.Protocol
+	ListChains(table string) ([]string, error)
+	ChainExists(table, chain string) (bool, error)
+	NewChain(table, chain string) error
+	ClearAndDeleteChain(table, chain string) error
+	ChangePolicy(table, chain, target string) error
+	List(table, chain string) ([]string, error)
+	Exists(table, chain string, rulespec ...string) (bool, error)
+	Insert(table, chain string, pos int, rulespec ...string) error
+	Append(table, chain string, rulespec ...string) error
+	Delete(table, chain string, rulespec ...string) error
+	DeleteIfExists(table, chain string, rulespec ...string) error
+}
+
+// builtinChains - the chains of the iptables tables which exist without being created
+var builtinChains = map[string][]string{
+	"filter": {"INPUT", "FORWARD", "OUTPUT"},
+	"nat":    {"PREROUTING", "INPUT", "OUTPUT", "POSTROUTING"},
+	"mangle": {"PREROUTING", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING"},
+	"raw":    {"PREROUTING", "OUTPUT"},
+}
+
+// dryRunIPTables - an in memory iptables of one address family logging the changes made to it,
+// it starts with the builtin chains only, so it holds exactly the rules netclient installs
+type dryRunIPTables struct {
+	proto  iptables.Protocol
+	mux    sync.Mutex
+	tables map[string]map[string][]string
+}
+
+// newDryRunIPTables - returns an empty dry run iptables of the address family
+func newDryRunIPTables(proto iptables.Protocol) *dryRunIPTables {
+	return &dryRunIPTables{proto: proto, tables: make(map[string]map[string][]string)}
+}
+
+// dryRunIPTables.table - the chains of a table, created with its builtin chains on first use
+func (d *dryRunIPTables) table(table string) map[string][]string {
+	chains, ok := d.tables[table]
+	if !ok {
+		chains = make(map[string][]string)
+		for _, chain := range builtinChains[table] {
+			chains[chain] = []string{}
+		}
+		d.tables[table] = chains
+	}
+	return chains
+}
+
+// dryRunIPTables.log - logs a change as the equivalent iptables command
+func (d *dryRunIPTables) log(table string, args ...string) {
+	command := "iptables"
+	if d.proto == iptables.ProtocolIPv6 {
+		command = "ip6tables"
+	}
+	logger.Log(0, "firewall dry run:", command, "-t", table, strings.Join(args, " "))
+}
+
+func (d *dryRunIPTables) Proto() iptables.Protocol {
+	return d.proto
+}
+
+func (d *dryRunIPTables) ListChains(table string) ([]string, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	chains := []string{}
+	for chain := range d.table(table) {
+		chains = append(chains, chain)
+	}
+	sort.Strings(chains)
+	return chains, nil
+}
+
+func (d *dryRunIPTables) ChainExists(table, chain string) (bool, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	_, ok := d.table(table)[chain]
+	return ok, nil
+}
+
+func (d *dryRunIPTables) NewChain(table, chain string) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	chains := d.table(table)
+	if _, ok := chains[chain]; ok {
+		return fmt.Errorf("chain %s already exists in table %s", chain, table)
+	}
+	d.log(table, "-N", chain)
+	chains[chain] = []string{}
+	return nil
+}
+
+func (d *dryRunIPTables) ClearAndDeleteChain(table, chain string) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	chains := d.table(table)
+	if _, ok := chains[chain]; !ok {
+		return nil
+	}
+	d.log(table, "-F", chain)
+	d.log(table, "-X", chain)
+	delete(chains, chain)
+	return nil
+}
+
+func (d *dryRunIPTables) ChangePolicy(table, chain, target string) error {
+	d.log(table, "-P", chain, target)
+	return nil
+}
+
+func (d *dryRunIPTables) List(table, chain string) ([]string, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	rules, ok := d.table(table)[chain]
+	if !ok {
+		return nil, fmt.Errorf("chain %s does not exist in table %s", chain, table)
+	}
+	list := []string{"-N " + chain}
+	for _, builtin := range builtinChains[table] {
+		if builtin == chain {
+			list = []string{"-P " + chain + " ACCEPT"}
+		}
+	}
+	for _, rule := range rules {
+		list = append(list, "-A "+chain+" "+rule)
+	}
+	return list, nil
+}
+
+func (d *dryRunIPTables) Exists(table, chain string, rulespec ...string) (bool, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.index(table, chain, rulespec) >= 0, nil
+}
+
+func (d *dryRunIPTables) Insert(table, chain string, pos int, rulespec ...string) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	rules, ok := d.table(table)[chain]
+	if !ok {
+		return fmt.Errorf("chain %s does not exist in table %s", chain, table)
+	}
+	if pos < 1 || pos > len(rules)+1 {
+		return fmt.Errorf("index %d out of range in chain %s", pos, chain)
+	}
+	d.log(table, append([]string{"-I", chain, fmt.Sprint(pos)}, rulespec...)...)
+	rule := strings.Join(rulespec, " ")
+	rules = append(rules[:pos-1], append([]string{rule}, rules[pos-1:]...)...)
+	d.tables[table][chain] = rules
+	return nil
+}
+
+func (d *dryRunIPTables) Append(table, chain string, rulespec ...string) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	rules, ok := d.table(table)[chain]
+	if !ok {
+		return fmt.Errorf("chain %s does not exist in table %s", chain, table)
+	}
+	d.log(table, append([]string{"-A", chain}, rulespec...)...)
+	d.tables[table][chain] = append(rules, strings.Join(rulespec, " "))
+	return nil
+}
+
+func (d *dryRunIPTables) Delete(table, chain string, rulespec ...string) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	idx := d.index(table, chain, rulespec)
+	if idx < 0 {
+		return fmt.Errorf("rule %s does not exist in chain %s", strings.Join(rulespec, " "), chain)
+	}
+	d.log(table, append([]string{"-D", chain}, rulespec...)...)
+	rules := d.tables[table][chain]
+	d.tables[table][chain] = append(rules[:idx], rules[idx+1:]...)
+	return nil
+}
+
+func (d *dryRunIPTables) DeleteIfExists(table, chain string, rulespec ...string) error {
+	if ok, _ := d.Exists(table, chain, rulespec...); !ok {
+		return nil
+	}
+	return d.Delete(table, chain, rulespec...)
+}
+
+// dryRunIPTables.index - position of the rule in the chain, -1 if missing, caller must hold mux
+func (d *dryRunIPTables) index(table, chain string, rulespec []string) int {
+	rule := strings.Join(rulespec, " ")
+	for i, r := range d.table(table)[chain] {
+		if r == rule {
+			return i
+		}
+	}
+	return -1
+}
+
+// dryRunIPTables.rules - the rules of all chains, by table and chain name
+func (d *dryRunIPTables) rules() []PreviewRule {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	family := iptablesProtoToString(d.proto)
+	rules := []PreviewRule{}
+	tables := []string{}
+	for table := range d.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		chains := []string{}
+		for chain := range d.tables[table] {
+			chains = append(chains, chain)
+		}
+		sort.Strings(chains)
+		for _, chain := range chains {
+			for _, rule := range d.tables[table][chain] {
+				rules = append(rules, PreviewRule{Family: family, Table: table, Chain: chain, Rule: rule})
+			}
+		}
+	}
+	return rules
+}
+
+// dryRunManager - the iptables manager over dry run clients, nothing is applied to the host
+type dryRunManager struct {
+	*iptablesManager
+}
+
+// dryRunManager.preview - the rules the iptables manager installed in the dry run clients
+func (d *dryRunManager) preview() []PreviewRule {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	rules := []PreviewRule{}
+	for _, client := range []iptablesAPI{d.ipv4Client, d.ipv6Client} {
+		if c, ok := client.(*dryRunIPTables); ok {
+			rules = append(rules, c.rules()...)
+		}
+	}
+	return rules
+}
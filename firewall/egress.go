@@ -1,42 +1,145 @@
 package firewall
 
 import (
+	"context"
 	"errors"
 
 	"github.com/gravitl/netmaker/models"
 	"golang.org/x/exp/slog"
 )
 
-// SetEgressRoutes - sets the egress route for the gateway
-func SetEgressRoutes(server string, egressUpdate map[string]models.EgressInfo) error {
+// SetEgressRoutes - sets the egress route for the gateway, the fast path is reset when the rules changed
+func SetEgressRoutes(ctx context.Context, server string, egressUpdate map[string]models.EgressInfo) error {
 	if fwCrtl == nil {
 		return errors.New("firewall is not initialized yet")
 	}
+	updated := false
+	// flows offloaded to the fast path would skip the changed rules
+	defer func() {
+		if updated {
+			if err := resetFastPath(); err != nil {
+				slog.Error("failed to reset the fast path", "error", err)
+			}
+		}
+	}()
 	ruleTable := fwCrtl.FetchRuleTable(server, egressTable)
 	for egressNodeID := range ruleTable {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if _, ok := egressUpdate[egressNodeID]; !ok {
 			// egress GW is deleted, flush out all rules
 			fwCrtl.RemoveRoutingRules(server, egressTable, egressNodeID)
-
+			updated = true
 		}
 
 	}
 	for egressNodeID, egressInfo := range egressUpdate {
-		if _, ok := ruleTable[egressNodeID]; !ok {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cfg, ok := ruleTable[egressNodeID]
+		if !ok {
 			// set up rules for the GW on first time creation
 			slog.Info("setting egress routes", "node", egressNodeID)
 			fwCrtl.InsertEgressRoutingRules(server, egressInfo)
+			updated = true
 			continue
 		}
-
+		wanted := make(map[string]bool, len(egressInfo.EgressGWCfg.Ranges))
+		changed := false
+		for _, egressRange := range egressInfo.EgressGWCfg.Ranges {
+			wanted[egressRange] = true
+			if _, ok := cfg.rulesMap[egressRangeKey(egressRange)]; !ok {
+				changed = true
+			}
+		}
+		for _, egressRange := range cfg.egressRanges() {
+			if wanted[egressRange] {
+				continue
+			}
+			changed = true
+			if err := RemoveEgressRange(server, egressNodeID, egressRange); err != nil {
+				slog.Error("failed to remove egress range", "node", egressNodeID, "range", egressRange, "error", err)
+			}
+		}
+		if changed {
+			slog.Info("updating egress routes", "node", egressNodeID)
+			fwCrtl.InsertEgressRoutingRules(server, egressInfo)
+			updated = true
+		}
 	}
 	return nil
 }
 
+// RemoveEgressRange - removes the forwarding and nat rules of a range of an egress gateway
+func RemoveEgressRange(server, egressID, egressRange string) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	return fwCrtl.DeleteRoutingRule(server, egressTable, egressID, egressRangeKey(egressRange))
+}
+
 // DeleteEgressGwRoutes - deletes egress routes for the gateway
 func DeleteEgressGwRoutes(server string) {
 	if fwCrtl == nil {
 		return
 	}
+	if len(fwCrtl.FetchRuleTable(server, egressTable)) == 0 {
+		return
+	}
 	fwCrtl.CleanRoutingRules(server, egressTable)
+	if err := resetFastPath(); err != nil {
+		slog.Error("failed to reset the fast path", "error", err)
+	}
+}
+
+// FlushNetworkRules - removes the routing rules of the gateways of one network of the server, keeping
+// the rules of its other networks
+func FlushNetworkRules(server, network string) {
+	if fwCrtl == nil {
+		return
+	}
+	removed := false
+	for _, tableName := range []string{ingressTable, egressTable} {
+		for gateway, cfg := range fwCrtl.FetchRuleTable(server, tableName) {
+			if cfg.network != network {
+				continue
+			}
+			slog.Info("removing routing rules of gateway", "server", server, "network", network, "gateway", gateway)
+			if err := fwCrtl.RemoveRoutingRules(server, tableName, gateway); err != nil {
+				slog.Error("failed to remove routing rules of gateway", "gateway", gateway, "error", err)
+			}
+			removed = true
+		}
+	}
+	if removed {
+		if err := resetFastPath(); err != nil {
+			slog.Error("failed to reset the fast path", "error", err)
+		}
+	}
+}
+
+// RemovePeerRoutes - removes the routing rules installed for a peer on the gateways of the server
+func RemovePeerRoutes(server, peerKey string) {
+	if fwCrtl == nil {
+		return
+	}
+	removed := false
+	for _, tableName := range []string{ingressTable, egressTable} {
+		for gateway, cfg := range fwCrtl.FetchRuleTable(server, tableName) {
+			if _, ok := cfg.rulesMap[peerKey]; !ok {
+				continue
+			}
+			if err := fwCrtl.DeleteRoutingRule(server, tableName, gateway, peerKey); err != nil {
+				slog.Error("failed to remove routing rules of peer", "server", server, "peer", peerKey, "error", err)
+			}
+			removed = true
+		}
+	}
+	if removed {
+		if err := resetFastPath(); err != nil {
+			slog.Error("failed to reset the fast path", "error", err)
+		}
+	}
 }
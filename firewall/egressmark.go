@@ -0,0 +1,43 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+)
+
+// egressMarkTable - rule table of the rules marking egress traffic for policy routing, keyed by mark
+const egressMarkTable = "egressmark"
+
+// EgressMark - marks the traffic from the sources to the destinations, so an ip rule on the mark
+// selects the routing table of an egress policy
+type EgressMark struct {
+	// Sources ranges of the marked traffic, empty matches any source
+	Sources []net.IPNet
+	// Destinations egress ranges
+	Destinations []net.IPNet
+	Mark         int
+	// Mask the bits of the firewall mark set to Mark, the other bits are kept
+	Mask int
+}
+
+// appliedEgressMarks - the egress marks last applied
+var appliedEgressMarks appliedState[[]EgressMark]
+
+// SetEgressMarks - replaces the rules marking forwarded and local traffic to the egress ranges of the
+// egress policies, nil removes them, the rules are only replaced when the marks changed
+func SetEgressMarks(marks []EgressMark) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	if marks == nil {
+		marks = []EgressMark{}
+	}
+	changed, err := appliedEgressMarks.apply(marks, func() error {
+		return fwCrtl.SetEgressMarks(marks)
+	})
+	if err != nil || !changed {
+		return err
+	}
+	// flows offloaded to the fast path would skip the new marks
+	return resetFastPath()
+}
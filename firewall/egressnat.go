@@ -0,0 +1,85 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gravitl/netclient/config"
+	"golang.org/x/exp/slog"
+)
+
+// nat modes of an egress range
+const (
+	// EgressNatMasquerade - translates the source to the address of the outgoing interface
+	EgressNatMasquerade = "masquerade"
+	// EgressNatSNAT - translates the source to a fixed address, for hosts with several addresses
+	EgressNatSNAT = "snat"
+	// EgressNatRouted - no translation, the egress range routes its replies back to the mesh
+	EgressNatRouted = "routed"
+)
+
+// EgressNat - how traffic from the mesh to an egress range is translated
+type EgressNat struct {
+	Mode   string
+	Source net.IP
+}
+
+// ParseEgressNat - parses a nat mode given as masquerade, routed or snat:<source ip>
+func ParseEgressNat(s string) (EgressNat, error) {
+	mode, source, found := strings.Cut(strings.TrimSpace(s), ":")
+	nat := EgressNat{Mode: strings.ToLower(mode)}
+	switch nat.Mode {
+	case EgressNatMasquerade, EgressNatRouted:
+		if found {
+			return nat, fmt.Errorf("invalid egress nat %s, %s takes no source address", s, nat.Mode)
+		}
+	case EgressNatSNAT:
+		nat.Source = net.ParseIP(source)
+		if nat.Source == nil {
+			return nat, fmt.Errorf("invalid egress nat %s, expected snat:<source ip>", s)
+		}
+	default:
+		return nat, fmt.Errorf("invalid egress nat %s, expected masquerade, routed or snat:<source ip>", s)
+	}
+	return nat, nil
+}
+
+// egressNat - the nat mode of an egress range, as configured locally for the range or masquerade
+// when the server enables nat on the gateway, translated to the snat source of the range's family
+// when the host configures one
+func egressNat(egressRange string, natEnabled bool) EgressNat {
+	nat := EgressNat{Mode: EgressNatRouted}
+	if natEnabled {
+		nat = snatSource(isAddrIpv4(egressRange))
+	}
+	configured, ok := config.Netclient().EgressNat[egressRange]
+	if !ok {
+		return nat
+	}
+	local, err := ParseEgressNat(configured)
+	if err != nil {
+		slog.Warn("ignoring egress nat", "range", egressRange, "error", err)
+		return nat
+	}
+	if local.Mode == EgressNatSNAT && (local.Source.To4() != nil) != isAddrIpv4(egressRange) {
+		slog.Warn("ignoring egress nat, the source address family differs from the range", "range", egressRange, "source", local.Source)
+		return nat
+	}
+	return local
+}
+
+// snatSource - snat to the configured source address of the family, masquerade when there is none
+func snatSource(isIpv4 bool) EgressNat {
+	for _, source := range config.Netclient().SNATSources {
+		ip := net.ParseIP(strings.TrimSpace(source))
+		if ip == nil {
+			slog.Warn("ignoring invalid snat source", "source", source)
+			continue
+		}
+		if (ip.To4() != nil) == isIpv4 {
+			return EgressNat{Mode: EgressNatSNAT, Source: ip}
+		}
+	}
+	return EgressNat{Mode: EgressNatMasquerade}
+}
@@ -0,0 +1,50 @@
+package firewall
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gravitl/netclient/config"
+)
+
+func TestParseEgressNat(t *testing.T) {
+	valid := map[string]EgressNat{
+		"masquerade":        {Mode: EgressNatMasquerade},
+		"Routed":            {Mode: EgressNatRouted},
+		"snat:192.168.1.10": {Mode: EgressNatSNAT, Source: net.ParseIP("192.168.1.10")},
+		"snat:fd00::1":      {Mode: EgressNatSNAT, Source: net.ParseIP("fd00::1")},
+	}
+	for s, want := range valid {
+		got, err := ParseEgressNat(s)
+		if err != nil || got.Mode != want.Mode || !got.Source.Equal(want.Source) {
+			t.Errorf("ParseEgressNat(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "nat", "snat", "snat:host", "routed:10.0.0.1"} {
+		if _, err := ParseEgressNat(s); err == nil {
+			t.Errorf("ParseEgressNat(%q) accepted an invalid mode", s)
+		}
+	}
+}
+
+func TestEgressNatSNATSources(t *testing.T) {
+	current := *config.Netclient()
+	defer config.UpdateNetclient(current)
+	host := current
+	host.SNATSources = []string{"invalid", "192.168.1.10", "fd00::10"}
+	host.EgressNat = map[string]string{"10.20.0.0/16": "masquerade"}
+	config.UpdateNetclient(host)
+	for egressRange, want := range map[string]EgressNat{
+		"10.10.0.0/16": {Mode: EgressNatSNAT, Source: net.ParseIP("192.168.1.10")},
+		"fd10::/64":    {Mode: EgressNatSNAT, Source: net.ParseIP("fd00::10")},
+		"10.20.0.0/16": {Mode: EgressNatMasquerade},
+	} {
+		got := egressNat(egressRange, true)
+		if got.Mode != want.Mode || !got.Source.Equal(want.Source) {
+			t.Errorf("egressNat(%s) = %v, want %v", egressRange, got, want)
+		}
+	}
+	if got := egressNat("10.10.0.0/16", false); got.Mode != EgressNatRouted {
+		t.Errorf("egressNat() = %v, want routed without nat", got)
+	}
+}
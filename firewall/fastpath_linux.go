@@ -0,0 +1,123 @@
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+)
+
+const (
+	// fastPathTable - nftables table of the fast path, kept apart from the netmaker chains so it works
+	// alongside both the iptables and the nftables backends
+	fastPathTable = "netmaker-fastpath"
+	// fastPathFlowtable - flowtable the established flows are offloaded to
+	fastPathFlowtable = "netmaker"
+)
+
+var (
+	fastPathMutex   sync.Mutex
+	fastPathDevices []string
+)
+
+// SetFastPath - replaces the fast path offloading the established tcp and udp flows forwarded from or to
+// the netmaker interface to a kernel flowtable over devices, which forwards and nats their packets at the
+// ingress of the devices bypassing the netfilter chains; new flows and the rest of the traffic keep the
+// regular path, no devices removes the fast path
+func SetFastPath(devices []string) error {
+	if config.Netclient().FirewallDryRun {
+		return errors.New("the fast path is not loaded in firewall dry run")
+	}
+	fastPathMutex.Lock()
+	defer fastPathMutex.Unlock()
+	devices = append([]string{}, devices...)
+	sort.Strings(devices)
+	if strings.Join(devices, ",") == strings.Join(fastPathDevices, ",") {
+		return nil
+	}
+	if err := loadFastPath(devices); err != nil {
+		fastPathDevices = nil
+		return err
+	}
+	fastPathDevices = devices
+	return nil
+}
+
+// resetFastPath - reloads the fast path, so the offloaded flows go through the netfilter chains again
+// and are subject to rules changed since they were offloaded
+func resetFastPath() error {
+	fastPathMutex.Lock()
+	defer fastPathMutex.Unlock()
+	if len(fastPathDevices) == 0 {
+		return nil
+	}
+	return loadFastPath(fastPathDevices)
+}
+
+// loadFastPath - replaces the fast path table in a single transaction
+func loadFastPath(devices []string) error {
+	conn := &nftables.Conn{}
+	table := &nftables.Table{Name: fastPathTable, Family: nftables.TableFamilyINet}
+	tables, err := conn.ListTablesOfFamily(nftables.TableFamilyINet)
+	if err != nil {
+		return fmt.Errorf("failed to list nftables tables: %w", err)
+	}
+	for _, t := range tables {
+		if t.Name == fastPathTable {
+			conn.DelTable(t)
+		}
+	}
+	if len(devices) == 0 {
+		return conn.Flush()
+	}
+	conn.AddTable(table)
+	conn.AddFlowtable(&nftables.Flowtable{
+		Table:    table,
+		Name:     fastPathFlowtable,
+		Hooknum:  nftables.FlowtableHookIngress,
+		Priority: nftables.FlowtablePriorityFilter,
+		Devices:  devices,
+	})
+	policy := nftables.ChainPolicyAccept
+	chain := conn.AddChain(&nftables.Chain{
+		Name:     "forward",
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookForward,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &policy,
+	})
+	iface := []byte(ncutils.GetInterfaceName() + "\x00")
+	for _, key := range []expr.MetaKey{expr.MetaKeyIIFNAME, expr.MetaKeyOIFNAME} {
+		conn.AddRule(&nftables.Rule{
+			Table: table,
+			Chain: chain,
+			Exprs: []expr.Any{
+				&expr.Meta{Key: key, Register: 1},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: iface},
+				&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+				&expr.Bitwise{
+					SourceRegister: 1,
+					DestRegister:   1,
+					Len:            4,
+					Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitESTABLISHED),
+					Xor:            binaryutil.NativeEndian.PutUint32(0),
+				},
+				&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(0)},
+				// only tcp and udp flows are offloaded, the kernel skips the others
+				&expr.FlowOffload{Name: fastPathFlowtable},
+			},
+		})
+	}
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("kernel flowtables are not supported: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package firewall
+
+import "errors"
+
+// SetFastPath - the fast path relies on kernel flowtables, only available on linux
+func SetFastPath(devices []string) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	return errors.New("the fast path is only supported on linux")
+}
+
+// resetFastPath - there is no fast path to reload
+func resetFastPath() error {
+	return nil
+}
@@ -1,6 +1,13 @@
 package firewall
 
 import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 )
@@ -10,7 +17,10 @@ var (
 )
 
 type rulesCfg struct {
-	isIpv4   bool
+	isIpv4 bool
+	// network - the network of the gateway the rules belong to, rules of several networks of a server
+	// share its rule table
+	network  string
 	rulesMap map[string][]ruleInfo
 }
 
@@ -24,11 +34,156 @@ type ruletable map[string]rulesCfg
 
 type serverrulestable map[string]ruletable
 
+// copy - returns a copy of the rule table not sharing maps with the original
+func (r ruletable) copy() ruletable {
+	c := make(ruletable, len(r))
+	for key, cfg := range r {
+		rulesMap := make(map[string][]ruleInfo, len(cfg.rulesMap))
+		for peer, rules := range cfg.rulesMap {
+			rulesMap[peer] = append([]ruleInfo(nil), rules...)
+		}
+		c[key] = rulesCfg{isIpv4: cfg.isIpv4, network: cfg.network, rulesMap: rulesMap}
+	}
+	return c
+}
+
+// egressRangePrefix - prefix of the keys of egress ranges in the rule map of their gateway, apart from
+// the keys of peers
+const egressRangePrefix = "range:"
+
+// egressRangeKey - key of the rules of an egress range in the rule map of its gateway
+func egressRangeKey(egressRange string) string {
+	return egressRangePrefix + egressRange
+}
+
+// egressNetwork - the network of an egress gateway, by name or else by the range of a joined network
+func egressNetwork(egressInfo models.EgressInfo) string {
+	if egressInfo.EgressGWCfg.NetID != "" {
+		return egressInfo.EgressGWCfg.NetID
+	}
+	for _, node := range config.GetNodes() {
+		for _, r := range []net.IPNet{node.NetworkRange, node.NetworkRange6} {
+			if r.IP != nil && r.String() == egressInfo.Network.String() {
+				return node.Network
+			}
+		}
+	}
+	return ""
+}
+
+// egressRanges - the egress ranges recorded in the rule map of a gateway
+func (r rulesCfg) egressRanges() []string {
+	ranges := []string{}
+	for key := range r.rulesMap {
+		if strings.HasPrefix(key, egressRangePrefix) {
+			ranges = append(ranges, strings.TrimPrefix(key, egressRangePrefix))
+		}
+	}
+	return ranges
+}
+
 const (
 	ingressTable = "ingress"
 	egressTable  = "egress"
+	// blockTable - rule table of the locally blocked peers, keyed by address
+	blockTable = "block"
+	// staticNatTable - rule table of the one-to-one nat of public addresses to ext clients
+	staticNatTable = "staticnat"
+	// names under which the rules kept outside the rule tables are listed
+	inboundTable     = "inbound"
+	appMarkTable     = "appmark"
+	policyQueueTable = "policyqueue"
 )
 
+// ManagedRule - a rule maintained by the firewall manager, as listed to auditing tools
+type ManagedRule struct {
+	Server    string `json:"server,omitempty"`
+	Network   string `json:"network,omitempty"`
+	RuleTable string `json:"ruletable"`
+	// Key - the egress gateway, ext client, blocked peer@address or public address the rule belongs to
+	Key    string `json:"key"`
+	Peer   string `json:"peer,omitempty"`
+	Family string `json:"family"`
+	Table  string `json:"table,omitempty"`
+	Chain  string `json:"chain,omitempty"`
+	Rule   string `json:"rule"`
+	// Spec - the arguments of the rule, Rule joined them with spaces
+	Spec []string `json:"spec"`
+}
+
+// managedRules - the rules of the rule table, sorted by key and peer
+func (r ruletable) managedRules(server, tableName string) []ManagedRule {
+	rules := []ManagedRule{}
+	for key, cfg := range r {
+		family := "ipv4"
+		if !cfg.isIpv4 {
+			family = "ipv6"
+		}
+		for peer, infos := range cfg.rulesMap {
+			for _, info := range infos {
+				rules = append(rules, ManagedRule{
+					Server:    server,
+					Network:   cfg.network,
+					RuleTable: tableName,
+					Key:       key,
+					Peer:      peer,
+					Family:    family,
+					Table:     info.table,
+					Chain:     info.chain,
+					Rule:      strings.Join(info.rule, " "),
+					Spec:      append([]string{}, info.rule...),
+				})
+			}
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Key != rules[j].Key {
+			return rules[i].Key < rules[j].Key
+		}
+		return rules[i].Peer < rules[j].Peer
+	})
+	return rules
+}
+
+// listManagedRules - the ingress and egress rules of every server, followed by the block and static nat rules
+func listManagedRules(ingRules, egressRules serverrulestable, blockRules, staticNatRules ruletable) []ManagedRule {
+	servers := []string{}
+	for server := range ingRules {
+		servers = append(servers, server)
+	}
+	for server := range egressRules {
+		if _, ok := ingRules[server]; !ok {
+			servers = append(servers, server)
+		}
+	}
+	sort.Strings(servers)
+	rules := []ManagedRule{}
+	for _, server := range servers {
+		rules = append(rules, ingRules[server].managedRules(server, ingressTable)...)
+		rules = append(rules, egressRules[server].managedRules(server, egressTable)...)
+	}
+	rules = append(rules, blockRules.managedRules("", blockTable)...)
+	return append(rules, staticNatRules.managedRules("", staticNatTable)...)
+}
+
+// listedRules - the rules kept in a list outside the rule tables, applied to each of the families
+func listedRules(tableName string, infos []ruleInfo, families []string) []ManagedRule {
+	rules := []ManagedRule{}
+	for _, family := range families {
+		for _, info := range infos {
+			rules = append(rules, ManagedRule{
+				RuleTable: tableName,
+				Family:    family,
+				Table:     info.table,
+				Chain:     info.chain,
+				Rule:      strings.Join(info.rule, " "),
+				Spec:      append([]string{}, info.rule...),
+			})
+		}
+	}
+	return rules
+}
+
 type firewallController interface {
 	// CreateChains  creates a firewall chains and jump rules
 	CreateChains() error
@@ -50,16 +205,45 @@ type firewallController interface {
 	SaveRules(server, ruleTableName string, ruleTable ruletable)
 	// FlushAll - clears all rules from netmaker chains and deletes the chains
 	FlushAll()
+	// VerifyChains - checks that netmaker rules were not removed or bypassed by other tools and repairs them
+	VerifyChains() ([]string, error)
+	// BlockPeers - replaces the drop rules for locally blocked peers with rules for the given addresses
+	BlockPeers(peers map[string][]net.IPNet) error
+	// SetOutboundOnly - replaces the rules rejecting unsolicited inbound mesh traffic
+	SetOutboundOnly(enabled bool, allowed []Port) error
+	// SetAppMark - replaces the rules marking the traffic of a cgroup, an empty match removes them
+	SetAppMark(cgroupMatch []string, mark int) error
+	// SetStaticNat - replaces the one-to-one nat of public addresses to ext clients, nil removes it
+	SetStaticNat(mappings []StaticNat) error
+	// SetPolicyQueue - replaces the rules queueing new connections from the mesh to the policy hook
+	SetPolicyQueue(enabled bool, queue uint16, failOpen bool) error
+	// ListRules - lists the rules of all rule tables
+	ListRules() []ManagedRule
+	// SetInterNetworkRules - replaces the forward rules of inter-network routing, nil removes them
+	SetInterNetworkRules(rules []InterNetworkRule) error
+	// SetMSSClamp - replaces the rules clamping the MSS of tcp connections to the ranges, nil removes them
+	SetMSSClamp(ranges []net.IPNet) error
+	// SetEgressMarks - replaces the rules marking the traffic of egress policies, nil removes them
+	SetEgressMarks(marks []EgressMark) error
+	// SetRateLimits - replaces the rules limiting the traffic of the ext clients of a server, nil removes them
+	SetRateLimits(server string, limits []RateLimit) error
+	// SetDefaultDeny - replaces the rules dropping the traffic of default-deny networks, nil removes them
+	SetDefaultDeny(ranges []net.IPNet) error
+	// SetDropLogging - switches the logging of the packets dropped by the netmaker rules
+	SetDropLogging(enabled bool) error
 }
 
-// Init - initialises the firewall controller,return a close func to flush all rules
-func Init() (func(), error) {
+// Init - initialises the firewall controller,return a close func to flush all rules,
+// rule changes still in progress when ctx is done are aborted
+func Init(ctx context.Context) (func(), error) {
 	var err error
 	logger.Log(0, "Starting firewall...")
-	fwCrtl, err = newFirewall()
+	fwCrtl, err = newFirewall(ctx)
 	if err != nil {
 		return nil, err
 	}
+	forgetAppliedStates()
+	removeStaleRules(fwCrtl)
 	if err := fwCrtl.CreateChains(); err != nil {
 		return fwCrtl.FlushAll, err
 	}
@@ -69,3 +253,73 @@ func Init() (func(), error) {
 	}
 	return fwCrtl.FlushAll, nil
 }
+
+// errDryRunUnsupported - returned on the platforms without a dry run of the firewall, which is left untouched
+var errDryRunUnsupported = errors.New("firewall dry run is only supported on linux, firewall rules are not applied")
+
+// PreviewRule - a rule installed by netclient in dry run mode
+type PreviewRule struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Chain  string `json:"chain"`
+	Rule   string `json:"rule"`
+}
+
+// previewer - a firewall manager recording its rules instead of applying them
+type previewer interface {
+	preview() []PreviewRule
+}
+
+// Preview - the rules netclient would have installed, only available in dry run mode
+func Preview() ([]PreviewRule, error) {
+	if fwCrtl == nil {
+		return nil, errors.New("firewall is not initialized yet")
+	}
+	p, ok := fwCrtl.(previewer)
+	if !ok {
+		return nil, errors.New("firewall dry run is not enabled, set firewalldryrun in netclient.yml")
+	}
+	return p.preview(), nil
+}
+
+// RuleFilter - the values the listed rules must have by field (server, network, ruletable, peer), the fields
+// left out match any value
+type RuleFilter map[string]string
+
+// RuleFilterFields - the fields of the managed rules a RuleFilter selects by
+var RuleFilterFields = []string{"server", "network", "ruletable", "peer"}
+
+// matches - checks if the rule has the values of the filter
+func (f RuleFilter) matches(rule ManagedRule) bool {
+	fields := map[string]string{"server": rule.Server, "network": rule.Network, "ruletable": rule.RuleTable, "peer": rule.Peer}
+	for field, value := range f {
+		if fields[field] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ListRules - the rules maintained by the firewall manager matching the filter, by server and table, with
+// the owner peer and network of the rules where known; a nil filter lists all rules
+func ListRules(filter RuleFilter) ([]ManagedRule, error) {
+	if fwCrtl == nil {
+		return nil, errors.New("firewall is not initialized yet")
+	}
+	rules := []ManagedRule{}
+	for _, rule := range fwCrtl.ListRules() {
+		if filter.matches(rule) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// VerifyChains - checks the netmaker chains and jump rules against changes by other tools
+// (docker, kube-proxy, fail2ban), repositioning them if needed, returns the problems found
+func VerifyChains() ([]string, error) {
+	if fwCrtl == nil {
+		return nil, errors.New("firewall is not initialized yet")
+	}
+	return fwCrtl.VerifyChains()
+}
@@ -0,0 +1,35 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package firewall
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/gravitl/netclient/ncutils"
+)
+
+// getInterfaceName - returns the interface of the route to dst
+func getInterfaceName(dst net.IPNet) (string, error) {
+	ip := dst.IP
+	if dst.String() == "0.0.0.0/0" || dst.String() == "::/0" {
+		ip = net.ParseIP("1.1.1.1")
+	}
+	family := "-inet"
+	if ip.To4() == nil {
+		family = "-inet6"
+	}
+	out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("route", "-n", "get", family, ip.String()))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, found := strings.Cut(strings.TrimSpace(line), ":"); found && key == "interface" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", errors.New("interface not found for: " + dst.String())
+}
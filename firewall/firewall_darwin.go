@@ -0,0 +1,53 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/logger"
+)
+
+// pfAnchor - anchor of the netmaker rules, the default pf.conf of macOS evaluates the anchors under com.apple
+const pfAnchor = "com.apple/netmaker"
+
+// newFirewall - returns a manager of pf rules in the netmaker anchor
+func newFirewall(ctx context.Context) (firewallController, error) {
+	if config.Netclient().FirewallDryRun {
+		return nil, errDryRunUnsupported
+	}
+	if _, err := exec.LookPath("pfctl"); err != nil {
+		return nil, errors.New("pfctl not found, firewall rules are not applied")
+	}
+	logger.Log(0, "using pf")
+	return &pfManager{
+		ctx:          ctx,
+		anchor:       pfAnchor,
+		ingRules:     make(serverrulestable),
+		engressRules: make(serverrulestable),
+		blockRules:   make(ruletable),
+	}, nil
+}
+
+// pfEnable - enables pf with a reference, pf is disabled again once all references are released
+func pfEnable() (string, error) {
+	out, err := pfctlOutput("-E")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, found := strings.Cut(line, ":"); found && strings.TrimSpace(key) == "Token" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", nil
+}
+
+// pfRelease - releases a reference of pfEnable
+func pfRelease(token string) {
+	if err := pfctl("", "-X", token); err != nil {
+		logger.Log(1, "failed to release pf enable reference: ", err.Error())
+	}
+}
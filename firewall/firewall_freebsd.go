@@ -0,0 +1,75 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/logger"
+)
+
+// pfAnchor - anchor of the netmaker rules, pf.conf must reference it with nat-anchor and anchor rules
+const pfAnchor = "netmaker"
+
+// newFirewall - returns a manager for the firewall selected by config.SelectFirewall
+func newFirewall(ctx context.Context) (firewallController, error) {
+	if config.Netclient().FirewallDryRun {
+		return nil, errDryRunUnsupported
+	}
+	switch config.SelectFirewall() {
+	case config.FirewallPF:
+		logger.Log(0, "using pf")
+		if !pfAnchorReferenced() {
+			logger.Log(0, "WARNING: pf.conf does not reference the netmaker anchor, add nat-anchor \""+pfAnchor+
+				"\" and anchor \""+pfAnchor+"\" to /etc/pf.conf for the netmaker rules to apply")
+		}
+		return &pfManager{
+			ctx:          ctx,
+			anchor:       pfAnchor,
+			ingRules:     make(serverrulestable),
+			engressRules: make(serverrulestable),
+			blockRules:   make(ruletable),
+		}, nil
+	case config.FirewallIPFW:
+		logger.Log(0, "using ipfw")
+		return &ipfwManager{
+			ctx:          ctx,
+			ingRules:     make(serverrulestable),
+			engressRules: make(serverrulestable),
+			blockRules:   make(ruletable),
+		}, nil
+	}
+	return nil, errors.New("firewall support not found")
+}
+
+// pfAnchorReferenced - checks if the main pf ruleset evaluates the translation and filter rules of the anchor
+func pfAnchorReferenced() bool {
+	nat, err := pfctlOutput("-s", "nat")
+	if err != nil {
+		return false
+	}
+	rules, err := pfctlOutput("-s", "rules")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(nat, "nat-anchor \""+pfAnchor+"\"") && strings.Contains(rules, "anchor \""+pfAnchor+"\"")
+}
+
+// pfEnable - enables pf, loading its kernel module if needed; freebsd does not count references
+func pfEnable() (string, error) {
+	if !ncutils.IsKernelModuleLoaded("pf") {
+		if out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("kldload", "pf")); err != nil {
+			return "", fmt.Errorf("failed to load pf: %w: %s", err, strings.TrimSpace(out))
+		}
+	}
+	if out, err := pfctlOutput("-s", "info"); err == nil && strings.Contains(out, "Status: Enabled") {
+		return "", nil
+	}
+	return "", pfctl("", "-e")
+}
+
+// pfRelease - pf stays enabled on freebsd, it may filter other traffic of the host
+func pfRelease(token string) {}
@@ -1,40 +1,86 @@
 package firewall
 
 import (
+	"context"
 	"errors"
 	"net"
-	"os/exec"
 
 	"github.com/coreos/go-iptables/iptables"
 	"github.com/google/nftables"
+	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
 	"github.com/vishvananda/netlink"
 )
 
-// newFirewall if supported, returns an iptables manager, otherwise returns a nftables manager
-func newFirewall() (firewallController, error) {
+// newFirewall - returns a manager for the firewall backend selected by config.SelectFirewall
+func newFirewall(ctx context.Context) (firewallController, error) {
 
 	var manager firewallController
 
-	if isIptablesSupported() {
-		logger.Log(0, "iptables is supported")
-		ipv4Client, _ := iptables.NewWithProtocol(iptables.ProtocolIPv4)
-		ipv6Client, _ := iptables.NewWithProtocol(iptables.ProtocolIPv6)
+	chains := config.Netclient().FirewallChains
+	if err := chains.Validate(); err != nil {
+		return nil, err
+	}
+	backend := config.SelectFirewall()
+	setChainNames(chains, config.Netclient().FirewallDryRun || backend != models.FIREWALL_NFTABLES)
+	if config.Netclient().FirewallDryRun {
+		logger.Log(0, "firewall dry run, the iptables rules are logged instead of applied")
+		return &dryRunManager{iptablesManager: &iptablesManager{
+			ctx:            ctx,
+			ipv4Client:     newDryRunIPTables(iptables.ProtocolIPv4),
+			ipv6Client:     newDryRunIPTables(iptables.ProtocolIPv6),
+			ingRules:       make(serverrulestable),
+			engressRules:   make(serverrulestable),
+			blockRules:     make(ruletable),
+			staticNatRules: make(ruletable),
+		}}, nil
+	}
+	switch backend {
+	case models.FIREWALL_IPTABLES:
+		logger.Log(0, "using iptables")
+		ipv4Client, ipv6Client, err := newIPTablesClients()
+		if err != nil {
+			return nil, err
+		}
 		manager = &iptablesManager{
-			ipv4Client:   ipv4Client,
-			ipv6Client:   ipv6Client,
-			ingRules:     make(serverrulestable),
-			engressRules: make(serverrulestable),
+			ctx:            ctx,
+			ipv4Client:     ipv4Client,
+			ipv6Client:     ipv6Client,
+			ingRules:       make(serverrulestable),
+			engressRules:   make(serverrulestable),
+			persistRules:   true,
+			blockRules:     make(ruletable),
+			staticNatRules: make(ruletable),
 		}
 		return manager, nil
-	}
-	logger.Log(0, "iptables is not supported, using nftables")
-	if isNftablesSupported() {
-		logger.Log(0, "nftables is supported")
+	case config.FirewallFirewalld:
+		logger.Log(0, "using iptables with firewalld direct rules")
+		ipv4Client, ipv6Client, err := newIPTablesClients()
+		if err != nil {
+			return nil, err
+		}
+		manager = &firewalldManager{iptablesManager: &iptablesManager{
+			ctx:            ctx,
+			ipv4Client:     ipv4Client,
+			ipv6Client:     ipv6Client,
+			ingRules:       make(serverrulestable),
+			engressRules:   make(serverrulestable),
+			persistRules:   true,
+			blockRules:     make(ruletable),
+			staticNatRules: make(ruletable),
+		}}
+		return manager, nil
+	case models.FIREWALL_NFTABLES:
+		logger.Log(0, "using nftables")
 		manager = &nftablesManager{
-			conn:         &nftables.Conn{},
-			ingRules:     make(serverrulestable),
-			engressRules: make(serverrulestable),
+			ctx:            ctx,
+			conn:           &nftables.Conn{},
+			ingRules:       make(serverrulestable),
+			engressRules:   make(serverrulestable),
+			persistRules:   true,
+			blockRules:     make(ruletable),
+			staticNatRules: make(ruletable),
 		}
 		return manager, nil
 	}
@@ -42,10 +88,39 @@ func newFirewall() (firewallController, error) {
 	return manager, errors.New("firewall support not found")
 }
 
-func isIptablesSupported() bool {
-	_, err4 := exec.LookPath("iptables")
-	_, err6 := exec.LookPath("ip6tables")
-	return (err4 == nil && err6 == nil)
+// newIPTablesClients - returns the iptables clients of both address families, the client of a family
+// whose binary is missing is nil and the family is skipped, e.g. in ipv4 only containers
+func newIPTablesClients() (iptablesAPI, iptablesAPI, error) {
+	clients := []iptablesAPI{nil, nil}
+	for idx, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		client, err := iptables.New(iptables.IPFamily(proto), iptables.Timeout(iptablesLockWait))
+		if err != nil {
+			logger.Log(0, "skipping", iptablesProtoToString(proto), "firewall rules:", err.Error())
+			continue
+		}
+		clients[idx] = client
+	}
+	if clients[0] == nil && clients[1] == nil {
+		return nil, nil, errors.New("neither iptables nor ip6tables is usable")
+	}
+	return clients[0], clients[1], nil
+}
+
+// setChainNames - names the netmaker chains, and with hooks the chains hooking them, from the config;
+// nftables keeps the hook chains of its own tables
+func setChainNames(chains config.FirewallChains, hooks bool) {
+	netmakerFilterChain = chains.GetFilter()
+	netmakerNatChain = chains.GetNat()
+	if hooks {
+		iptableFWDChain = chains.GetForward()
+		nattablePRTChain = chains.GetPostrouting()
+	}
+	if netmakerFilterChain != config.DefaultFilterChain || netmakerNatChain != config.DefaultNatChain ||
+		iptableFWDChain != config.DefaultForwardChain || nattablePRTChain != config.DefaultPostroutingChain {
+		logger.Log(0, "using firewall chains", netmakerFilterChain, netmakerNatChain, "hooked from", iptableFWDChain, nattablePRTChain)
+	}
+	setIptablesChainRules()
+	setNftablesChainRules()
 }
 
 func getInterfaceName(dst net.IPNet) (string, error) {
@@ -68,8 +143,3 @@ func getInterfaceName(dst net.IPNet) (string, error) {
 	}
 	return "", errors.New("interface not found for: " + dst.String())
 }
-
-func isNftablesSupported() bool {
-	_, err := exec.LookPath("nft")
-	return err == nil
-}
@@ -1,9 +1,12 @@
-//go:build !linux
-// +build !linux
+//go:build !linux && !windows && !darwin && !freebsd
+// +build !linux,!windows,!darwin,!freebsd
 
 package firewall
 
 import (
+	"context"
+	"net"
+
 	"github.com/gravitl/netmaker/models"
 )
 
@@ -57,7 +60,29 @@ func (unimplementedFirewall) DeleteRuleTable(server, ruleTableName string) {
 
 }
 
+func (unimplementedFirewall) VerifyChains() ([]string, error) {
+	return nil, nil
+}
+
+func (unimplementedFirewall) BlockPeers(peers map[string][]net.IPNet) error {
+	return nil
+}
+
+func (unimplementedFirewall) SetOutboundOnly(enabled bool, allowed []Port) error {
+	return nil
+}
+
+func (unimplementedFirewall) SetAppMark(cgroupMatch []string, mark int) error {
+	return nil
+}
+func (unimplementedFirewall) SetStaticNat(mappings []StaticNat) error {
+	return nil
+}
+func (unimplementedFirewall) SetPolicyQueue(enabled bool, queue uint16, failOpen bool) error {
+	return nil
+}
+
 // newFirewall returns an unimplemented Firewall manager
-func newFirewall() (firewallController, error) {
+func newFirewall(ctx context.Context) (firewallController, error) {
 	return unimplementedFirewall{}, nil
 }
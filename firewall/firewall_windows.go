@@ -0,0 +1,27 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/logger"
+)
+
+// newFirewall - returns a manager of windows defender firewall rules through netsh advfirewall
+func newFirewall(ctx context.Context) (firewallController, error) {
+	if config.Netclient().FirewallDryRun {
+		return nil, errDryRunUnsupported
+	}
+	if _, err := exec.LookPath("netsh"); err != nil {
+		return nil, errors.New("netsh not found, firewall rules are not applied")
+	}
+	logger.Log(0, "using windows firewall")
+	return &netshManager{
+		ctx:          ctx,
+		ingRules:     make(serverrulestable),
+		engressRules: make(serverrulestable),
+		blockRules:   make(ruletable),
+	}, nil
+}
@@ -0,0 +1,634 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+)
+
+// priorities of the firewalld direct rules, lower priorities are evaluated first like the rules the
+// iptables manager inserts last at the top of a chain
+const (
+	directPriorityBlockLog = iota
+	directPriorityBlock
+	directPriorityInterNetworkReply
+	directPriorityInterNetworkLog
+	directPriorityInterNetwork
+	directPriorityPolicy
+	directPriorityInbound
+	directPriorityNat
+	directPriorityForward
+	directPriorityDropLog
+	directPriorityDefaultDeny
+	directPriorityJump
+)
+
+// firewalldManager - manages the netmaker rules on hosts run by firewalld: the rules are applied by the
+// iptables manager and mirrored as permanent firewalld direct rules, which firewalld restores on every
+// reload that wipes the iptables chains
+type firewalldManager struct {
+	*iptablesManager
+}
+
+// firewalldManager.CreateChains - creates the netmaker chains and removes stale direct rules of a previous run
+func (f *firewalldManager) CreateChains() error {
+	if err := f.iptablesManager.CreateChains(); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.ForwardRule - inserts the forwarding rules
+func (f *firewalldManager) ForwardRule() error {
+	if err := f.iptablesManager.ForwardRule(); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.VerifyChains - verifies the chains and the direct rules mirroring them
+func (f *firewalldManager) VerifyChains() ([]string, error) {
+	issues, err := f.iptablesManager.VerifyChains()
+	if err != nil {
+		return issues, err
+	}
+	return issues, f.sync()
+}
+
+// firewalldManager.InsertEgressRoutingRules - inserts egress routes for the GW peers
+func (f *firewalldManager) InsertEgressRoutingRules(server string, egressInfo models.EgressInfo) error {
+	if err := f.iptablesManager.InsertEgressRoutingRules(server, egressInfo); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.RemoveRoutingRules - removes the rules of a gateway from a rule table
+func (f *firewalldManager) RemoveRoutingRules(server, ruletableName, peerKey string) error {
+	if err := f.iptablesManager.RemoveRoutingRules(server, ruletableName, peerKey); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.DeleteRoutingRule - removes the rules of a peer on a gateway
+func (f *firewalldManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, dstPeerKey string) error {
+	if err := f.iptablesManager.DeleteRoutingRule(server, ruletableName, srcPeerKey, dstPeerKey); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.CleanRoutingRules - removes all the rules of a rule table of a server
+func (f *firewalldManager) CleanRoutingRules(server, ruleTableName string) {
+	f.iptablesManager.CleanRoutingRules(server, ruleTableName)
+	if err := f.sync(); err != nil {
+		logger.Log(0, "failed to update firewalld direct rules: ", err.Error())
+	}
+}
+
+// firewalldManager.BlockPeers - replaces the drop rules of the locally blocked peers
+func (f *firewalldManager) BlockPeers(peers map[string][]net.IPNet) error {
+	if err := f.iptablesManager.BlockPeers(peers); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetOutboundOnly - replaces the rules of outbound only mode
+func (f *firewalldManager) SetOutboundOnly(enabled bool, allowed []Port) error {
+	if err := f.iptablesManager.SetOutboundOnly(enabled, allowed); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetAppMark - replaces the rules marking the traffic of application routing
+func (f *firewalldManager) SetAppMark(cgroupMatch []string, mark int) error {
+	if err := f.iptablesManager.SetAppMark(cgroupMatch, mark); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetStaticNat - replaces the rules of the one-to-one nat of public addresses to ext clients
+func (f *firewalldManager) SetStaticNat(mappings []StaticNat) error {
+	if err := f.iptablesManager.SetStaticNat(mappings); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetPolicyQueue - replaces the rules queueing new connections to the policy hook
+func (f *firewalldManager) SetPolicyQueue(enabled bool, queue uint16, failOpen bool) error {
+	if err := f.iptablesManager.SetPolicyQueue(enabled, queue, failOpen); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetInterNetworkRules - replaces the rules of inter-network routing
+func (f *firewalldManager) SetInterNetworkRules(rules []InterNetworkRule) error {
+	if err := f.iptablesManager.SetInterNetworkRules(rules); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetMSSClamp - replaces the MSS clamping rules
+func (f *firewalldManager) SetMSSClamp(ranges []net.IPNet) error {
+	if err := f.iptablesManager.SetMSSClamp(ranges); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetEgressMarks - replaces the rules marking the traffic of egress policies
+func (f *firewalldManager) SetEgressMarks(marks []EgressMark) error {
+	if err := f.iptablesManager.SetEgressMarks(marks); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetRateLimits - replaces the rules limiting the traffic of the ext clients of the server
+func (f *firewalldManager) SetRateLimits(server string, limits []RateLimit) error {
+	if err := f.iptablesManager.SetRateLimits(server, limits); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetDefaultDeny - replaces the rules of default-deny networks
+func (f *firewalldManager) SetDefaultDeny(ranges []net.IPNet) error {
+	if err := f.iptablesManager.SetDefaultDeny(ranges); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.SetDropLogging - switches the logging of the packets dropped by the netmaker rules
+func (f *firewalldManager) SetDropLogging(enabled bool) error {
+	if err := f.iptablesManager.SetDropLogging(enabled); err != nil {
+		return err
+	}
+	return f.sync()
+}
+
+// firewalldManager.FlushAll - removes all the rules added by netmaker and their direct rules
+func (f *firewalldManager) FlushAll() {
+	f.iptablesManager.FlushAll()
+	// the rules are flushed on shutdown when the manager context is already done
+	if err := f.apply(context.Background(), nil, nil); err != nil {
+		logger.Log(0, "failed to remove firewalld direct rules: ", err.Error())
+	}
+}
+
+// firewalldManager.sync - replaces the permanent netmaker direct chains and rules of firewalld with the
+// chains and rules currently applied, the runtime rules are already in place
+func (f *firewalldManager) sync() error {
+	chains, rules := f.directConfig()
+	return f.apply(f.ctx, chains, rules)
+}
+
+// firewalldManager.apply - replaces the permanent netmaker direct chains and rules of firewalld in a single
+// update of the direct configuration, keeping the chains, rules and passthroughs of other tools
+func (f *firewalldManager) apply(ctx context.Context, wantedChains []directChain, wantedRules []directRule) error {
+	current, err := getDirectSettings(ctx)
+	if err != nil {
+		return err
+	}
+	updated := directSettings{passthroughs: current.passthroughs}
+	currentKeys := []string{}
+	for _, chain := range current.chains {
+		if chain.isNetmaker() {
+			currentKeys = append(currentKeys, chain.key())
+			continue
+		}
+		updated.chains = append(updated.chains, chain)
+	}
+	for _, rule := range current.rules {
+		if rule.isNetmaker() {
+			currentKeys = append(currentKeys, rule.key())
+			continue
+		}
+		updated.rules = append(updated.rules, rule)
+	}
+	wantedKeys := []string{}
+	for _, chain := range wantedChains {
+		wantedKeys = append(wantedKeys, chain.key())
+	}
+	for _, rule := range wantedRules {
+		wantedKeys = append(wantedKeys, rule.key())
+	}
+	sort.Strings(currentKeys)
+	sort.Strings(wantedKeys)
+	if strings.Join(currentKeys, "\n") == strings.Join(wantedKeys, "\n") {
+		return nil
+	}
+	updated.chains = append(updated.chains, wantedChains...)
+	updated.rules = append(updated.rules, wantedRules...)
+	return setDirectSettings(ctx, updated)
+}
+
+// firewalldManager.directConfig - the netmaker chains and rules applied by the iptables manager, in the
+// form of the firewalld direct configuration
+func (f *firewalldManager) directConfig() ([]directChain, []directRule) {
+	i := f.iptablesManager
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	chains := []directChain{}
+	rules := []directRule{}
+	// the families whose iptables binary is missing are skipped
+	present := []string{}
+	for _, client := range i.clients() {
+		present = append(present, iptablesProtoToString(client.Proto()))
+	}
+	isPresent := func(family string) bool {
+		for _, f := range present {
+			if f == family {
+				return true
+			}
+		}
+		return false
+	}
+	for _, family := range present {
+		chains = append(chains,
+			directChain{family: family, table: defaultIpTable, chain: netmakerFilterChain},
+			directChain{family: family, table: defaultNatTable, chain: netmakerNatChain})
+		// hook chains which are not builtin are direct chains as well
+		if iptableFWDChain != config.DefaultForwardChain {
+			chains = append(chains, directChain{family: family, table: defaultIpTable, chain: iptableFWDChain})
+		}
+		if nattablePRTChain != config.DefaultPostroutingChain {
+			chains = append(chains, directChain{family: family, table: defaultNatTable, chain: nattablePRTChain})
+		}
+	}
+	add := func(families []string, priority int, rule ruleInfo) {
+		for _, family := range families {
+			if !isPresent(family) {
+				continue
+			}
+			rules = append(rules, directRule{family: family, table: rule.table, chain: rule.chain, priority: priority, args: rule.rule})
+		}
+	}
+	for _, rule := range filterNmJumpRules {
+		add(present, directPriorityJump, rule)
+	}
+	for _, rule := range natNmJumpRules {
+		add(present, directPriorityJump, rule)
+	}
+	for _, spec := range forwardAcceptRules() {
+		add(present, directPriorityForward, ruleInfo{rule: spec, table: defaultIpTable, chain: iptableFWDChain})
+	}
+	for _, rule := range i.inboundRules {
+		add(present, directPriorityInbound, rule)
+	}
+	for _, rule := range i.appMarkRules {
+		add(present, directPriorityNat, rule)
+	}
+	for _, rule := range i.policyQueueRules {
+		add(present, directPriorityPolicy, rule)
+	}
+	for key, cfg := range i.interNetworkRules {
+		family, priority := []string{ipv4}, directPriorityInterNetwork
+		if !cfg.isIpv4 {
+			family = []string{ipv6}
+		}
+		if key == interNetworkReplyKey(cfg.isIpv4) {
+			priority = directPriorityInterNetworkReply
+		}
+		for _, peerRules := range cfg.rulesMap {
+			for _, rule := range peerRules {
+				if isDropLogRule(rule) {
+					add(family, directPriorityInterNetworkLog, rule)
+					continue
+				}
+				add(family, priority, rule)
+			}
+		}
+	}
+	for _, family := range present {
+		isIpv4 := family == ipv4
+		for _, rule := range i.defaultDenyJumps(isIpv4) {
+			add([]string{family}, directPriorityInterNetwork, rule)
+		}
+		for _, rule := range i.defaultDenyDrops(isIpv4) {
+			priority := directPriorityDefaultDeny
+			if isDropLogRule(rule) {
+				priority = directPriorityDropLog
+			}
+			add([]string{family}, priority, rule)
+		}
+	}
+	tables := []struct {
+		priority int
+		table    ruletable
+	}{{directPriorityBlock, i.blockRules}, {directPriorityBlock, i.staticNatRules}, {directPriorityForward, i.mssClampRules}, {directPriorityNat, i.egressMarkRules}, {directPriorityBlock, i.rateLimitRules}}
+	for _, serverTables := range []serverrulestable{i.ingRules, i.engressRules} {
+		for _, table := range serverTables {
+			tables = append(tables, struct {
+				priority int
+				table    ruletable
+			}{directPriorityNat, table})
+		}
+	}
+	for _, t := range tables {
+		for _, cfg := range t.table {
+			family := []string{ipv4}
+			if !cfg.isIpv4 {
+				family = []string{ipv6}
+			}
+			for _, peerRules := range cfg.rulesMap {
+				for _, rule := range peerRules {
+					// the log rules of the blocked peers go ahead of their drop rules
+					if t.priority == directPriorityBlock && isDropLogRule(rule) {
+						add(family, directPriorityBlockLog, rule)
+						continue
+					}
+					add(family, t.priority, rule)
+				}
+			}
+		}
+	}
+	sort.Slice(rules, func(a, b int) bool { return rules[a].key() < rules[b].key() })
+	return chains, rules
+}
+
+// directChain - a chain of the firewalld direct configuration
+type directChain struct {
+	family string
+	table  string
+	chain  string
+}
+
+// directChain.key - identifies the chain when comparing direct configurations
+func (c directChain) key() string {
+	return strings.Join([]string{c.family, c.table, c.chain}, " ")
+}
+
+// directChain.isNetmaker - checks if the chain belongs to netmaker
+func (c directChain) isNetmaker() bool {
+	return strings.HasPrefix(c.chain, "netmaker")
+}
+
+// directRule - a rule of the firewalld direct configuration
+type directRule struct {
+	family   string
+	table    string
+	chain    string
+	priority int
+	args     []string
+}
+
+// directRule.key - identifies the rule when comparing direct configurations
+func (r directRule) key() string {
+	return strings.Join(append([]string{r.family, r.table, r.chain, strconv.Itoa(r.priority)}, r.args...), " ")
+}
+
+// directRule.isNetmaker - checks if the rule belongs to netmaker
+func (r directRule) isNetmaker() bool {
+	if strings.HasPrefix(r.chain, "netmaker") {
+		return true
+	}
+	for _, arg := range r.args {
+		if arg == netmakerSignature || strings.HasPrefix(arg, netmakerCommentPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// directPassthrough - a passthrough of the firewalld direct configuration, never managed by netmaker
+type directPassthrough struct {
+	family string
+	args   []string
+}
+
+// directSettings - the permanent firewalld direct configuration, exchanged as a whole with the
+// config.direct d-bus interface of firewalld
+type directSettings struct {
+	chains       []directChain
+	rules        []directRule
+	passthroughs []directPassthrough
+}
+
+const (
+	firewalldDest            = "org.fedoraproject.FirewallD1"
+	firewalldConfigPath      = "/org/fedoraproject/FirewallD1/config"
+	firewalldDirectInterface = "org.fedoraproject.FirewallD1.config.direct"
+	directSettingsSignature  = "(a(sss)a(sssias)a(sas))"
+)
+
+// getDirectSettings - reads the permanent direct configuration of firewalld
+func getDirectSettings(ctx context.Context) (directSettings, error) {
+	out, err := firewalldDirectCall(ctx, "getSettings")
+	if err != nil {
+		return directSettings{}, err
+	}
+	tokens, err := busctlTokens(out)
+	if err != nil {
+		return directSettings{}, err
+	}
+	settings, err := parseDirectSettings(tokens)
+	if err != nil {
+		return directSettings{}, fmt.Errorf("failed to parse the firewalld direct configuration: %w", err)
+	}
+	return settings, nil
+}
+
+// setDirectSettings - replaces the permanent direct configuration of firewalld
+func setDirectSettings(ctx context.Context, settings directSettings) error {
+	_, err := firewalldDirectCall(ctx, "update", append([]string{directSettingsSignature}, settings.busctlArgs()...)...)
+	return err
+}
+
+// firewalldDirectCall - calls a method of the config.direct interface of firewalld over d-bus, the
+// arguments follow "--" as rule arguments start with a dash
+func firewalldDirectCall(ctx context.Context, method string, args ...string) (string, error) {
+	cmdArgs := append([]string{"--system", "call", "--", firewalldDest, firewalldConfigPath, firewalldDirectInterface, method}, args...)
+	out, err := ncutils.Exec(ctx, ncutils.NewCommand("busctl", cmdArgs...))
+	if err != nil {
+		return out, fmt.Errorf("firewalld %s failed: %w: %s", method, err, strings.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// directSettings.busctlArgs - the settings as busctl arguments of the direct settings signature
+func (s directSettings) busctlArgs() []string {
+	args := []string{strconv.Itoa(len(s.chains))}
+	for _, c := range s.chains {
+		args = append(args, c.family, c.table, c.chain)
+	}
+	args = append(args, strconv.Itoa(len(s.rules)))
+	for _, r := range s.rules {
+		args = append(args, r.family, r.table, r.chain, strconv.Itoa(r.priority), strconv.Itoa(len(r.args)))
+		args = append(args, r.args...)
+	}
+	args = append(args, strconv.Itoa(len(s.passthroughs)))
+	for _, p := range s.passthroughs {
+		args = append(args, p.family, strconv.Itoa(len(p.args)))
+		args = append(args, p.args...)
+	}
+	return args
+}
+
+// parseDirectSettings - parses the busctl output tokens of the direct settings, led by their signature
+func parseDirectSettings(tokens []string) (directSettings, error) {
+	settings := directSettings{}
+	if len(tokens) == 0 || tokens[0] != directSettingsSignature {
+		return settings, fmt.Errorf("unexpected reply %v", tokens)
+	}
+	tokens = tokens[1:]
+	next := func(n int) ([]string, error) {
+		if len(tokens) < n {
+			return nil, errors.New("reply is truncated")
+		}
+		values := tokens[:n]
+		tokens = tokens[n:]
+		return values, nil
+	}
+	count := func() (int, error) {
+		values, err := next(1)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(values[0])
+	}
+	n, err := count()
+	if err != nil {
+		return settings, err
+	}
+	for ; n > 0; n-- {
+		values, err := next(3)
+		if err != nil {
+			return settings, err
+		}
+		settings.chains = append(settings.chains, directChain{family: values[0], table: values[1], chain: values[2]})
+	}
+	if n, err = count(); err != nil {
+		return settings, err
+	}
+	for ; n > 0; n-- {
+		values, err := next(4)
+		if err != nil {
+			return settings, err
+		}
+		priority, err := strconv.Atoi(values[3])
+		if err != nil {
+			return settings, err
+		}
+		argc, err := count()
+		if err != nil {
+			return settings, err
+		}
+		args, err := next(argc)
+		if err != nil {
+			return settings, err
+		}
+		settings.rules = append(settings.rules, directRule{family: values[0], table: values[1], chain: values[2],
+			priority: priority, args: args})
+	}
+	if n, err = count(); err != nil {
+		return settings, err
+	}
+	for ; n > 0; n-- {
+		family, err := next(1)
+		if err != nil {
+			return settings, err
+		}
+		argc, err := count()
+		if err != nil {
+			return settings, err
+		}
+		args, err := next(argc)
+		if err != nil {
+			return settings, err
+		}
+		settings.passthroughs = append(settings.passthroughs, directPassthrough{family: family[0], args: args})
+	}
+	return settings, nil
+}
+
+// busctlTokens - splits the output of a busctl call into its values, unquoting the c-escaped strings
+func busctlTokens(out string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(out); {
+		switch c := out[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"':
+			var sb strings.Builder
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] != '\\' {
+					sb.WriteByte(out[i])
+					continue
+				}
+				if i++; i == len(out) {
+					break
+				}
+				switch e := out[i]; {
+				case e == 'x' && i+2 < len(out):
+					b, err := strconv.ParseUint(out[i+1:i+3], 16, 8)
+					if err != nil {
+						return nil, fmt.Errorf("invalid escape in %q: %w", out, err)
+					}
+					sb.WriteByte(byte(b))
+					i += 2
+				case e >= '0' && e <= '7' && i+2 < len(out):
+					b, err := strconv.ParseUint(out[i:i+3], 8, 8)
+					if err != nil {
+						return nil, fmt.Errorf("invalid escape in %q: %w", out, err)
+					}
+					sb.WriteByte(byte(b))
+					i += 2
+				default:
+					sb.WriteByte(unescapeChar(e))
+				}
+			}
+			if i >= len(out) {
+				return nil, fmt.Errorf("unterminated string in %q", out)
+			}
+			tokens = append(tokens, sb.String())
+			i++
+		default:
+			j := i
+			for j < len(out) && out[j] != ' ' && out[j] != '\t' && out[j] != '\n' {
+				j++
+			}
+			tokens = append(tokens, out[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// unescapeChar - the character of a single character c escape
+func unescapeChar(e byte) byte {
+	switch e {
+	case 'a':
+		return '\a'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'v':
+		return '\v'
+	}
+	return e
+}
@@ -0,0 +1,34 @@
+package firewall
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirectSettings(t *testing.T) {
+	out := `(a(sss)a(sssias)a(sas)) 1 "ipv4" "filter" "netmakerfilter" 2 "ipv4" "filter" "FORWARD" 8 4 "-i" "netmaker" "-j" "ACCEPT" "ipv4" "filter" "INPUT" 0 4 "-m" "comment" "--comment" "say \"hi\"\x21" 1 "ipv6" 2 "-t" "raw"` + "\n"
+	tokens, err := busctlTokens(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := parseDirectSettings(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.chains) != 1 || !settings.chains[0].isNetmaker() {
+		t.Fatalf("chains = %v, want the netmaker chain", settings.chains)
+	}
+	if len(settings.rules) != 2 || settings.rules[0].priority != 8 || settings.rules[1].args[3] != `say "hi"!` {
+		t.Fatalf("rules = %v, want both rules unquoted", settings.rules)
+	}
+	if len(settings.passthroughs) != 1 || settings.passthroughs[0].family != "ipv6" {
+		t.Fatalf("passthroughs = %v, want the ipv6 passthrough", settings.passthroughs)
+	}
+	// the update arguments are the reply values without the signature and quoting
+	if args := settings.busctlArgs(); !reflect.DeepEqual(args, tokens[1:]) {
+		t.Fatalf("busctlArgs() = %v, want %v", args, tokens[1:])
+	}
+	if _, err := parseDirectSettings(tokens[:len(tokens)-1]); err == nil {
+		t.Fatal("parseDirectSettings() of a truncated reply succeeded")
+	}
+}
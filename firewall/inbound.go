@@ -0,0 +1,41 @@
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Port - a port reachable from the mesh in outbound only mode
+type Port struct {
+	Port     int
+	Protocol string
+}
+
+// ParsePort - parses a port given as port[/protocol], the protocol is tcp or udp and defaults to tcp
+func ParsePort(s string) (Port, error) {
+	port, proto, found := strings.Cut(s, "/")
+	p := Port{Protocol: "tcp"}
+	if found {
+		p.Protocol = strings.ToLower(proto)
+	}
+	if p.Protocol != "tcp" && p.Protocol != "udp" {
+		return p, fmt.Errorf("invalid protocol in port %s, expected tcp or udp", s)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return p, fmt.Errorf("invalid port %s", s)
+	}
+	p.Port = n
+	return p, nil
+}
+
+// SetOutboundOnly - when enabled, rejects inbound traffic from the mesh to this host unless it belongs
+// to a connection initiated by the host or targets one of the allowed ports, disabled removes the rules
+func SetOutboundOnly(enabled bool, allowed []Port) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	return fwCrtl.SetOutboundOnly(enabled, allowed)
+}
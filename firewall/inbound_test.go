@@ -0,0 +1,22 @@
+package firewall
+
+import "testing"
+
+func TestParsePort(t *testing.T) {
+	valid := map[string]Port{
+		"22":       {Port: 22, Protocol: "tcp"},
+		"53/udp":   {Port: 53, Protocol: "udp"},
+		"8080/TCP": {Port: 8080, Protocol: "tcp"},
+	}
+	for s, want := range valid {
+		got, err := ParsePort(s)
+		if err != nil || got != want {
+			t.Errorf("ParsePort(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "0", "70000", "ssh", "22/icmp"} {
+		if _, err := ParsePort(s); err == nil {
+			t.Errorf("ParsePort(%q) accepted an invalid port", s)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+)
+
+// interNetworkTable - rule table of the rules of inter-network routing, keyed by source and destination range
+const interNetworkTable = "internetwork"
+
+// InterNetworkRule - allows or drops traffic routed by the host from the range of one joined network
+// to the range of another
+type InterNetworkRule struct {
+	Src   net.IPNet
+	Dst   net.IPNet
+	Allow bool
+}
+
+// key - key of the rule in the rule table of inter-network routing
+func (r InterNetworkRule) key() string {
+	return r.Src.String() + ">" + r.Dst.String()
+}
+
+// interNetworkReplyKey - key of the rule accepting replies of inter-network connections of a family
+func interNetworkReplyKey(isIpv4 bool) string {
+	if isIpv4 {
+		return "replies-ipv4"
+	}
+	return "replies-ipv6"
+}
+
+// appliedInterNetworkRules - the rules of inter-network routing last applied, by key
+var appliedInterNetworkRules appliedState[map[string]bool]
+
+// SetInterNetworkRules - replaces the forward rules of inter-network routing, inserted below the rules of
+// blocked peers ahead of the netmaker accept rules; nil removes them, the rules are only replaced when they
+// differ from the rules last applied
+func SetInterNetworkRules(rules []InterNetworkRule) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	wanted := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		wanted[rule.key()] = rule.Allow
+	}
+	changed, err := appliedInterNetworkRules.apply(wanted, func() error {
+		return fwCrtl.SetInterNetworkRules(rules)
+	})
+	if err != nil || !changed {
+		return err
+	}
+	// flows offloaded to the fast path would skip the new drop rules
+	return resetFastPath()
+}
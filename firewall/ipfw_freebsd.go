@@ -0,0 +1,480 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+)
+
+const (
+	// ipfwSet - rule set holding the netmaker rules
+	ipfwSet = "17"
+	// ipfwRuleBase - number of the first netmaker rule, ahead of the usual rules of the host
+	ipfwRuleBase = 1000
+	// ipfwRuleStep - numbering step of the netmaker rules
+	ipfwRuleStep = 10
+	// ipfwNatBase - number of the first nat instance of the egress ranges
+	ipfwNatBase = 1700
+	// ipfwNatTable - table of the nat instances and rules, after the filter rules
+	ipfwNatTable = "nat"
+	// ipfwFilterTable - table of the filter rules
+	ipfwFilterTable = "filter"
+)
+
+// ipfwManager - manages the netmaker rules in an ipfw rule set; the rules are kept in the same rule tables
+// as the linux managers and the set is rewritten in one ipfw batch on every change
+type ipfwManager struct {
+	ctx          context.Context
+	ingRules     serverrulestable
+	engressRules serverrulestable
+	// blockRules - block rules of the locally blocked peers, keyed by peer and address
+	blockRules ruletable
+	// inboundRules - rules of outbound only mode
+	inboundRules []ruleInfo
+	mux          sync.Mutex
+}
+
+// ipfwManager.CreateChains - loads ipfw and its nat and empties the netmaker rule set
+func (i *ipfwManager) CreateChains() error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	for _, module := range []string{"ipfw", "ipfw_nat"} {
+		if ncutils.IsKernelModuleLoaded(module) {
+			continue
+		}
+		if out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("kldload", module)); err != nil {
+			return fmt.Errorf("failed to load %s: %w: %s", module, err, strings.TrimSpace(out))
+		}
+	}
+	return ipfw("", "-q", "delete", "set", ipfwSet)
+}
+
+// ipfwManager.ForwardRule - forwarded traffic passes unless blocked, forwarding itself is a sysctl
+func (i *ipfwManager) ForwardRule() error {
+	return nil
+}
+
+// ipfwManager.VerifyChains - checks that the netmaker rule set holds its rules, reloading it when
+// rules were deleted by other tools
+func (i *ipfwManager) VerifyChains() ([]string, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	out, err := ipfwOutput("set", ipfwSet, "list")
+	if err != nil {
+		return nil, err
+	}
+	loaded := 0
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) != "" {
+			loaded++
+		}
+	}
+	expected := 0
+	for _, rule := range i.rules() {
+		if rule.chain != "nat" {
+			expected++
+		}
+	}
+	if loaded >= expected {
+		return nil, nil
+	}
+	issues := []string{fmt.Sprintf("ipfw set %s holds %d of %d rules", ipfwSet, loaded, expected)}
+	return issues, i.load()
+}
+
+// ipfwManager.InsertEgressRoutingRules - inserts the nat rules of the egress ranges of the gateway
+func (i *ipfwManager) InsertEgressRoutingRules(server string, egressInfo models.EgressInfo) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	ruleTable := i.ruleTable(server, egressTable)
+	egressGwRoutes := make(map[string][]ruleInfo)
+	for _, egressGwRange := range egressInfo.EgressGWCfg.Ranges {
+		egressGwRoutes[egressRangeKey(egressGwRange)] = []ruleInfo{}
+		nat := egressNat(egressGwRange, egressInfo.EgressGWCfg.NatEnabled == "yes")
+		if nat.Mode == EgressNatRouted {
+			continue
+		}
+		dst := toIPNet(egressGwRange)
+		if dst.IP.To4() == nil {
+			// ipfw nat translates ipv4 only
+			logger.Log(0, "ipfw does not nat ipv6 egress range", egressGwRange)
+			continue
+		}
+		egressRangeIface, err := getInterfaceName(dst)
+		if err != nil {
+			logger.Log(0, "failed to get interface name: ", egressRangeIface, err.Error())
+			continue
+		}
+		// the nat instance is configured by its target, numbered when the set is loaded
+		target := []string{"if", egressRangeIface}
+		if nat.Mode == EgressNatSNAT {
+			target = []string{"ip", nat.Source.String()}
+		}
+		egressGwRoutes[egressRangeKey(egressGwRange)] = []ruleInfo{
+			{rule: append([]string{"config"}, target...), table: ipfwNatTable, chain: "nat"},
+			{rule: []string{"ip", "from", "any", "to", dst.String(), "out", "via", egressRangeIface}, table: ipfwNatTable, chain: strings.Join(target, " ")},
+			{rule: []string{"ip", "from", dst.String(), "to", "any", "in", "via", egressRangeIface}, table: ipfwNatTable, chain: strings.Join(target, " ")},
+		}
+	}
+	ruleTable[egressInfo.EgressID] = rulesCfg{
+		isIpv4:   isAddrIpv4(egressInfo.EgressGwAddr.String()),
+		network:  egressNetwork(egressInfo),
+		rulesMap: egressGwRoutes,
+	}
+	return i.load()
+}
+
+// ipfwManager.RemoveRoutingRules - removes the rules of a gateway from a rule table
+func (i *ipfwManager) RemoveRoutingRules(server, ruletableName, peerKey string) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := i.ruleTable(server, ruletableName)
+	if _, ok := rulesTable[peerKey]; !ok {
+		return errors.New("peer not found in rule table: " + peerKey)
+	}
+	delete(rulesTable, peerKey)
+	return i.load()
+}
+
+// ipfwManager.DeleteRoutingRule - removes the rules of a peer on a gateway
+func (i *ipfwManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, dstPeerKey string) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := i.ruleTable(server, ruletableName)
+	if _, ok := rulesTable[srcPeerKey]; !ok {
+		return errors.New("peer not found in rule table: " + srcPeerKey)
+	}
+	if _, ok := rulesTable[srcPeerKey].rulesMap[dstPeerKey]; !ok {
+		return errors.New("rules not found for: " + dstPeerKey)
+	}
+	delete(rulesTable[srcPeerKey].rulesMap, dstPeerKey)
+	return i.load()
+}
+
+// ipfwManager.CleanRoutingRules - removes all the rules of a rule table of a server
+func (i *ipfwManager) CleanRoutingRules(server, ruleTableName string) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.deleteRuleTable(server, ruleTableName)
+	if err := i.load(); err != nil {
+		logger.Log(0, "failed to reload ipfw rules: ", err.Error())
+	}
+}
+
+// ipfwManager.FetchRuleTable - fetches a copy of the rule table by table name
+func (i *ipfwManager) FetchRuleTable(server string, tableName string) ruletable {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return i.ruleTable(server, tableName).copy()
+}
+
+// ipfwManager.ListRules - lists the rules of all rule tables
+func (i *ipfwManager) ListRules() []ManagedRule {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return listManagedRules(i.ingRules, i.engressRules, i.blockRules, nil)
+}
+
+// ipfwManager.DeleteRuleTable - deletes a rule table
+func (i *ipfwManager) DeleteRuleTable(server, ruleTableName string) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.deleteRuleTable(server, ruleTableName)
+}
+
+// ipfwManager.SaveRules - saves the rule table by table name
+func (i *ipfwManager) SaveRules(server, tableName string, rules ruletable) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	switch tableName {
+	case ingressTable:
+		i.ingRules[server] = rules.copy()
+	case egressTable:
+		i.engressRules[server] = rules.copy()
+	case blockTable:
+		i.blockRules = rules.copy()
+	}
+}
+
+// ipfwManager.BlockPeers - replaces the rules dropping the traffic of the locally blocked peers
+func (i *ipfwManager) BlockPeers(peers map[string][]net.IPNet) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	iface := ncutils.GetInterfaceName()
+	i.blockRules, _, _ = diffBlockRules(i.blockRules, peers, func(_ string, addr net.IPNet) []ruleInfo {
+		return []ruleInfo{
+			{rule: []string{"deny", "ip", "from", addr.String(), "to", "any", "in", "via", iface}, table: ipfwFilterTable},
+			{rule: []string{"deny", "ip", "from", "any", "to", addr.String(), "out", "via", iface}, table: ipfwFilterTable},
+		}
+	})
+	return i.load()
+}
+
+// ipfwManager.SetOutboundOnly - replaces the rules denying inbound connections from the netmaker networks
+// to ports other than the allowed ones, replies pass through the dynamic rules of the outbound connections
+func (i *ipfwManager) SetOutboundOnly(enabled bool, allowed []Port) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	i.inboundRules = nil
+	if !enabled {
+		return i.load()
+	}
+	ranges := []string{}
+	for _, node := range config.GetNodes() {
+		for _, network := range []net.IPNet{node.NetworkRange, node.NetworkRange6} {
+			if network.IP != nil {
+				ranges = append(ranges, network.String())
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return i.load()
+	}
+	iface := ncutils.GetInterfaceName()
+	i.inboundRules = append(i.inboundRules,
+		ruleInfo{rule: []string{"check-state"}, table: ipfwFilterTable},
+		ruleInfo{rule: []string{"allow", "ip", "from", "any", "to", "any", "out", "via", iface, "keep-state"}, table: ipfwFilterTable},
+	)
+	for _, protocol := range []string{"tcp", "udp"} {
+		ports := []string{}
+		for _, port := range allowed {
+			if port.Protocol == protocol {
+				ports = append(ports, strconv.Itoa(port.Port))
+			}
+		}
+		if len(ports) == 0 {
+			continue
+		}
+		sort.Strings(ports)
+		for _, network := range ranges {
+			i.inboundRules = append(i.inboundRules, ruleInfo{
+				rule:  []string{"allow", protocol, "from", network, "to", "any", "dst-port", strings.Join(ports, ","), "in", "via", iface, "keep-state"},
+				table: ipfwFilterTable,
+			})
+		}
+	}
+	for _, network := range ranges {
+		i.inboundRules = append(i.inboundRules, ruleInfo{
+			rule:  []string{"deny", "ip", "from", network, "to", "any", "in", "via", iface},
+			table: ipfwFilterTable,
+		})
+	}
+	return i.load()
+}
+
+// ipfwManager.SetAppMark - application routing relies on cgroups, not available with ipfw
+func (i *ipfwManager) SetAppMark(cgroupMatch []string, mark int) error {
+	if len(cgroupMatch) == 0 {
+		return nil
+	}
+	return errors.New("application routing is not supported with ipfw")
+}
+
+// ipfwManager.SetStaticNat - one-to-one nat of ext clients is only available on linux
+func (i *ipfwManager) SetStaticNat(mappings []StaticNat) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+	return errors.New("static nat of ext clients is not supported with ipfw")
+}
+
+// ipfwManager.SetPolicyQueue - the policy hook relies on nfqueue, only available on linux
+func (i *ipfwManager) SetPolicyQueue(enabled bool, queue uint16, failOpen bool) error {
+	if !enabled {
+		return nil
+	}
+	return errors.New("the policy hook is not supported with ipfw")
+}
+
+// ipfwManager.FlushAll - deletes the netmaker rule set,
+// it runs regardless of ctx as it cleans up on shutdown
+func (i *ipfwManager) FlushAll() {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if err := ipfw("", "-q", "delete", "set", ipfwSet); err != nil {
+		logger.Log(0, "failed to delete ipfw rules: ", err.Error())
+	}
+	i.ingRules = make(serverrulestable)
+	i.engressRules = make(serverrulestable)
+	i.blockRules = make(ruletable)
+	i.inboundRules = nil
+}
+
+// ipfwManager.load - rewrites the netmaker rule set in one batch: filter rules first, then one nat
+// instance per distinct target with the rules translating the egress ranges through it
+func (i *ipfwManager) load() error {
+	lines := []string{"delete set " + ipfwSet}
+	number := ipfwRuleBase
+	add := func(rule []string) {
+		lines = append(lines, fmt.Sprintf("add %d set %s %s", number, ipfwSet, strings.Join(rule, " ")))
+		number += ipfwRuleStep
+	}
+	rules := i.rules()
+	for _, rule := range rules {
+		if rule.table == ipfwFilterTable {
+			add(rule.rule)
+		}
+	}
+	instances := map[string]int{}
+	for _, rule := range rules {
+		if rule.table != ipfwNatTable || rule.chain != "nat" {
+			continue
+		}
+		target := strings.Join(rule.rule[1:], " ")
+		if _, ok := instances[target]; !ok {
+			instances[target] = ipfwNatBase + len(instances)
+			lines = append(lines, fmt.Sprintf("nat %d config %s same_ports", instances[target], target))
+		}
+	}
+	for _, rule := range rules {
+		if rule.table == ipfwNatTable && rule.chain != "nat" {
+			add(append([]string{"nat", strconv.Itoa(instances[rule.chain])}, rule.rule...))
+		}
+	}
+	return ipfw(strings.Join(lines, "\n")+"\n", "-q", "/dev/stdin")
+}
+
+// ipfwManager.rules - all the rules of the set, block rules ahead of the rules of outbound only mode
+func (i *ipfwManager) rules() []ruleInfo {
+	rules := []ruleInfo{}
+	tables := []ruletable{i.blockRules}
+	for _, serverTables := range []serverrulestable{i.ingRules, i.engressRules} {
+		for _, table := range serverTables {
+			tables = append(tables, table)
+		}
+	}
+	for _, table := range tables {
+		for _, cfg := range table {
+			for _, peerRules := range cfg.rulesMap {
+				rules = append(rules, peerRules...)
+			}
+		}
+	}
+	return append(rules, i.inboundRules...)
+}
+
+// ipfwManager.ruleTable - returns the stored rule table by table name, creating it if needed
+func (i *ipfwManager) ruleTable(server, tableName string) ruletable {
+	var tables serverrulestable
+	switch tableName {
+	case ingressTable:
+		tables = i.ingRules
+	case egressTable:
+		tables = i.engressRules
+	case blockTable:
+		return i.blockRules
+	default:
+		return make(ruletable)
+	}
+	rules, ok := tables[server]
+	if !ok {
+		rules = make(ruletable)
+		tables[server] = rules
+	}
+	return rules
+}
+
+func (i *ipfwManager) deleteRuleTable(server, tableName string) {
+	logger.Log(1, "Deleting rules table: ", server, tableName)
+	switch tableName {
+	case ingressTable:
+		delete(i.ingRules, server)
+	case egressTable:
+		delete(i.engressRules, server)
+	case blockTable:
+		i.blockRules = make(ruletable)
+	}
+}
+
+// ipfw - runs ipfw with stdin as its input
+func ipfw(stdin string, args ...string) error {
+	cmd := ncutils.NewCommand("ipfw", args...)
+	cmd.Stdin = stdin
+	if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// ipfwOutput - runs ipfw and returns its output
+func ipfwOutput(args ...string) (string, error) {
+	out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("ipfw", args...))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// ipfwManager.SetInterNetworkRules - inter-network routing is not supported with ipfw
+func (i *ipfwManager) SetInterNetworkRules(rules []InterNetworkRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	return errors.New("inter-network routing is not supported with ipfw")
+}
+
+// ipfwManager.SetMSSClamp - MSS clamping is not supported with ipfw
+func (i *ipfwManager) SetMSSClamp(ranges []net.IPNet) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+	return errors.New("MSS clamping is not supported with ipfw")
+}
+
+// ipfwManager.SetEgressMarks - policy routing of egress traffic is not supported with ipfw
+func (i *ipfwManager) SetEgressMarks(marks []EgressMark) error {
+	if len(marks) == 0 {
+		return nil
+	}
+	return errors.New("egress policy routing is not supported with ipfw")
+}
+
+// ipfwManager.SetRateLimits - ext client rate limiting is not supported with ipfw
+func (i *ipfwManager) SetRateLimits(server string, limits []RateLimit) error {
+	if len(limits) == 0 {
+		return nil
+	}
+	return errors.New("ext client rate limiting is not supported with ipfw")
+}
+
+// ipfwManager.SetDefaultDeny - ipfw has no rules allowing the traffic of gateway peers explicitly, a default-deny
+// network would lose all its forwarded traffic, so only default-allow is supported
+func (i *ipfwManager) SetDefaultDeny(ranges []net.IPNet) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+	return errors.New("default-deny networks are not supported with ipfw")
+}
+
+// ipfwManager.SetDropLogging - logging the dropped packets is not supported with ipfw
+func (i *ipfwManager) SetDropLogging(enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	return fmt.Errorf("%w: ipfw has no drop rules to log", errDropLoggingUnsupported)
+}
@@ -0,0 +1,139 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/logger"
+)
+
+// iptablesOp - a rule inserted at the top of its chain or deleted
+type iptablesOp struct {
+	insert bool
+	rule   ruleInfo
+}
+
+// iptablesBatch - rule changes of one address family accumulated to be applied atomically by a single
+// iptables-restore invocation instead of one iptables command per rule
+type iptablesBatch struct {
+	client iptablesAPI
+	ops    []iptablesOp
+}
+
+// iptablesBatches - the batches of both address families of an operation
+type iptablesBatches struct {
+	v4, v6 *iptablesBatch
+}
+
+// iptablesManager.newBatches - returns empty batches for the ipv4 and ipv6 clients
+func (i *iptablesManager) newBatches() iptablesBatches {
+	return iptablesBatches{v4: &iptablesBatch{client: i.ipv4Client}, v6: &iptablesBatch{client: i.ipv6Client}}
+}
+
+// iptablesBatches.family - the batch of the address family
+func (b iptablesBatches) family(isIpv4 bool) *iptablesBatch {
+	if isIpv4 {
+		return b.v4
+	}
+	return b.v6
+}
+
+// iptablesBatches.apply - applies the batches of both address families, returns the first error
+func (b iptablesBatches) apply() error {
+	err := b.v4.apply()
+	if err6 := b.v6.apply(); err == nil {
+		err = err6
+	}
+	return err
+}
+
+// iptablesBatch.insert - queues the insertion of the rule at the top of its chain
+func (b *iptablesBatch) insert(rule ruleInfo) {
+	b.ops = append(b.ops, iptablesOp{insert: true, rule: rule})
+}
+
+// iptablesBatch.delete - queues the deletion of the rule
+func (b *iptablesBatch) delete(rule ruleInfo) {
+	b.ops = append(b.ops, iptablesOp{rule: rule})
+}
+
+// iptablesBatch.apply - applies the queued changes with iptables-restore, keeping the other rules; when the
+// restore fails, e.g. as a rule to delete was already removed by another tool, the changes are applied one
+// by one, ignoring rules that are missing
+func (b *iptablesBatch) apply() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	defer func() { b.ops = nil }()
+	// the address family is skipped when its iptables binary is missing
+	if b.client == nil {
+		logger.Log(3, fmt.Sprintf("skipping %d rule changes of an unavailable address family", len(b.ops)))
+		return nil
+	}
+	// the dry run client records the changes one by one
+	if _, dryRun := b.client.(*dryRunIPTables); !dryRun {
+		restore := "iptables-restore"
+		if b.client.Proto() == iptables.ProtocolIPv6 {
+			restore = "ip6tables-restore"
+		}
+		cmd := ncutils.NewCommand(restore, "--noflush")
+		cmd.Stdin = b.restoreInput()
+		out, err := ncutils.Exec(context.Background(), cmd)
+		if err == nil {
+			return nil
+		}
+		logger.Log(1, fmt.Sprintf("%s failed, applying %d rule changes one by one: %v %s", restore, len(b.ops), err, strings.TrimSpace(out)))
+	}
+	var err error
+	var firstErr error
+	for _, op := range b.ops {
+		if op.insert {
+			err = b.client.Insert(op.rule.table, op.rule.chain, 1, op.rule.rule...)
+		} else {
+			err = b.client.DeleteIfExists(op.rule.table, op.rule.chain, op.rule.rule...)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to apply %s rule %v: %w", iptablesProtoToString(b.client.Proto()), op.rule.rule, err)
+		}
+	}
+	return firstErr
+}
+
+// iptablesBatch.restoreInput - the queued changes in the iptables-restore format, grouped by table in order
+func (b *iptablesBatch) restoreInput() string {
+	tables := []string{}
+	lines := make(map[string][]string)
+	for _, op := range b.ops {
+		if _, ok := lines[op.rule.table]; !ok {
+			tables = append(tables, op.rule.table)
+		}
+		line := []string{"-D", op.rule.chain}
+		if op.insert {
+			line = []string{"-I", op.rule.chain, "1"}
+		}
+		for _, arg := range op.rule.rule {
+			line = append(line, quoteRestoreArg(arg))
+		}
+		lines[op.rule.table] = append(lines[op.rule.table], strings.Join(line, " "))
+	}
+	var sb strings.Builder
+	for _, table := range tables {
+		sb.WriteString("*" + table + "\n")
+		for _, line := range lines[table] {
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("COMMIT\n")
+	}
+	return sb.String()
+}
+
+// quoteRestoreArg - quotes an argument holding spaces or quotes for iptables-restore
+func quoteRestoreArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'") {
+		return arg
+	}
+	return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+}
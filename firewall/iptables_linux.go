@@ -1,8 +1,13 @@
 package firewall
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -15,49 +20,94 @@ import (
 
 // constants needed to manage and create iptable rules
 const (
-	ipv6                = "ipv6"
-	ipv4                = "ipv4"
-	defaultIpTable      = "filter"
-	netmakerFilterChain = "netmakerfilter"
-	defaultNatTable     = "nat"
-	netmakerNatChain    = "netmakernat"
-	iptableFWDChain     = "FORWARD"
-	nattablePRTChain    = "POSTROUTING"
-	netmakerSignature   = "NETMAKER"
+	ipv6              = "ipv6"
+	ipv4              = "ipv4"
+	defaultIpTable    = "filter"
+	defaultNatTable   = "nat"
+	dockerUserChain   = "DOCKER-USER"
+	netmakerSignature = "NETMAKER"
+	// netmakerCommentPrefix - prefix of the comments tagging the rules of a peer of a server
+	netmakerCommentPrefix = "netmaker-"
+	// iptablesLockWait - seconds an iptables command waits for the xtables lock
+	iptablesLockWait = 5
 )
 
+// iptablesManager - manages the netmaker iptables rules; every exported method is one operation
+// holding mux for its whole duration, unexported methods expect mux to be held by the caller.
+// Once ctx is done, operations are refused and in-flight ones stop before their next command
 type iptablesManager struct {
-	ipv4Client   *iptables.IPTables
-	ipv6Client   *iptables.IPTables
+	ctx          context.Context
+	ipv4Client   iptablesAPI
+	ipv6Client   iptablesAPI
 	ingRules     serverrulestable
 	engressRules serverrulestable
-	mux          sync.Mutex
+	// persistRules - the rule tables are persisted, for the cleanup after a crash
+	persistRules bool
+	// blockRules - drop rules of the locally blocked peers, keyed by peer and address
+	blockRules ruletable
+	// inboundRules - INPUT chain rules of outbound only mode, the same for ipv4 and ipv6
+	inboundRules []ruleInfo
+	// appMarkRules - rules marking the traffic of application routing, the same for ipv4 and ipv6
+	appMarkRules []ruleInfo
+	// staticNatRules - rules of the one-to-one nat of public addresses to ext clients, keyed by public address
+	staticNatRules ruletable
+	// policyQueueRules - rules queueing new connections to the policy hook, the same for ipv4 and ipv6
+	policyQueueRules []ruleInfo
+	// interNetworkRules - FORWARD chain rules of inter-network routing, keyed by source and destination range
+	interNetworkRules ruletable
+	// mssClampRules - mangle table rules clamping the MSS of tcp connections, keyed by range
+	mssClampRules ruletable
+	// egressMarkRules - mangle table rules marking the traffic of egress policies, keyed by mark
+	egressMarkRules ruletable
+	// rateLimitRules - mangle table rules limiting the traffic of ext clients, keyed by server and address
+	rateLimitRules ruletable
+	// defaultDenyRules - FORWARD chain jumps and netmaker filter chain drops of default-deny networks, keyed by range
+	defaultDenyRules ruletable
+	// logDrops - the drop rules are preceded by rate limited LOG rules
+	logDrops bool
+	mux      sync.Mutex
 }
 
+// names of the netmaker chains and of the chains hooking them, see setChainNames
 var (
-	dropRuleFilter = ruleInfo{
+	netmakerFilterChain = config.DefaultFilterChain
+	netmakerNatChain    = config.DefaultNatChain
+	iptableFWDChain     = config.DefaultForwardChain
+	nattablePRTChain    = config.DefaultPostroutingChain
+)
+
+var (
+	dropRuleFilter ruleInfo
+	dropRuleNat    ruleInfo
+	// filter table netmaker jump rules
+	filterNmJumpRules []ruleInfo
+	// nat table nm jump rules
+	natNmJumpRules []ruleInfo
+)
+
+func init() {
+	setIptablesChainRules()
+}
 
+// setIptablesChainRules - builds the rules referring to the netmaker chains by name
+func setIptablesChainRules() {
+	dropRuleFilter = ruleInfo{
 		rule:  []string{"-j", "DROP"},
 		table: defaultIpTable,
 		chain: netmakerFilterChain,
 	}
-
 	dropRuleNat = ruleInfo{
-
 		rule:  []string{"-j", "DROP"},
 		table: defaultNatTable,
 		chain: netmakerNatChain,
 	}
-
-	// filter table netmaker jump rules
 	filterNmJumpRules = []ruleInfo{
 		{
-			rule:  []string{"-j", "RETURN"},
+			rule:  appendNetmakerCommentToRule([]string{"-j", "RETURN"}),
 			table: defaultIpTable,
 			chain: netmakerFilterChain,
 		},
 	}
-	// nat table nm jump rules
 	natNmJumpRules = []ruleInfo{
 		{
 			rule: []string{"-o", ncutils.GetInterfaceName(), "-j", netmakerNatChain,
@@ -66,14 +116,27 @@ var (
 			chain: nattablePRTChain,
 		},
 		{
-			rule:  []string{"-j", "RETURN"},
+			rule:  appendNetmakerCommentToRule([]string{"-j", "RETURN"}),
 			table: defaultNatTable,
 			chain: netmakerNatChain,
 		},
 	}
-)
+}
+
+// ensureHookChains - creates the chains hooking the netmaker chains which are not builtin chains
+func ensureHookChains(client iptablesAPI) error {
+	if iptableFWDChain != config.DefaultForwardChain {
+		if err := createChain(client, defaultIpTable, iptableFWDChain); err != nil {
+			return err
+		}
+	}
+	if nattablePRTChain != config.DefaultPostroutingChain {
+		return createChain(client, defaultNatTable, nattablePRTChain)
+	}
+	return nil
+}
 
-func createChain(iptables *iptables.IPTables, table, newChain string) error {
+func createChain(iptables iptablesAPI, table, newChain string) error {
 
 	chains, err := iptables.ListChains(table)
 	if err != nil {
@@ -100,41 +163,293 @@ func createChain(iptables *iptables.IPTables, table, newChain string) error {
 func (i *iptablesManager) ForwardRule() error {
 	i.mux.Lock()
 	defer i.mux.Unlock()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
 	logger.Log(0, "adding forwarding rule")
 
-	iptablesClient := i.ipv4Client
-	// Set the policy To accept on forward chain
-	iptablesClient.ChangePolicy(defaultIpTable, iptableFWDChain, "ACCEPT")
-	// remove DROP rule if present
-	iptablesClient.DeleteIfExists(dropRuleFilter.table, dropRuleFilter.chain, dropRuleFilter.rule...)
-	iptablesClient.DeleteIfExists(dropRuleNat.table, dropRuleNat.chain, dropRuleNat.rule...)
-	createChain(iptablesClient, defaultIpTable, netmakerFilterChain)
-	ruleSpec := []string{"-i", "netmaker", "-j", "ACCEPT"}
-	ruleSpec = appendNetmakerCommentToRule(ruleSpec)
-	ok, err := i.ipv4Client.Exists(defaultIpTable, iptableFWDChain, ruleSpec...)
-	if err == nil && !ok {
-		if err := i.ipv4Client.Insert(defaultIpTable, iptableFWDChain, 1, ruleSpec...); err != nil {
-			logger.Log(1, fmt.Sprintf("failed to add rule: %v Err: %v", ruleSpec, err.Error()))
+	if iptablesClient := i.ipv4Client; iptablesClient != nil {
+		// Set the policy To accept on forward chain
+		iptablesClient.ChangePolicy(defaultIpTable, config.DefaultForwardChain, "ACCEPT")
+		// remove DROP rule if present
+		iptablesClient.DeleteIfExists(dropRuleFilter.table, dropRuleFilter.chain, dropRuleFilter.rule...)
+		iptablesClient.DeleteIfExists(dropRuleNat.table, dropRuleNat.chain, dropRuleNat.rule...)
+		createChain(iptablesClient, defaultIpTable, netmakerFilterChain)
+	}
+	for _, client := range i.clients() {
+		if err := i.ctx.Err(); err != nil {
+			return err
+		}
+		for _, ruleSpec := range forwardAcceptRules() {
+			ok, err := client.Exists(defaultIpTable, iptableFWDChain, ruleSpec...)
+			if err == nil && !ok {
+				if err := client.Insert(defaultIpTable, iptableFWDChain, 1, ruleSpec...); err != nil {
+					logger.Log(1, fmt.Sprintf("failed to add rule: %v Err: %v", ruleSpec, err.Error()))
+				}
+			}
+		}
+		if _, err := ensureDockerUserRules(client); err != nil {
+			logger.Log(1, "failed to add docker rules: ", err.Error())
+		}
+	}
+	return nil
+}
+
+// ensureDockerUserRules - when docker is present, accepts netmaker traffic at the top of the DOCKER-USER chain
+// so docker's own forwarding rules do not drop mesh traffic to/from containers, returns if rules were added
+func ensureDockerUserRules(client iptablesAPI) (bool, error) {
+	exists, err := client.ChainExists(defaultIpTable, dockerUserChain)
+	if err != nil || !exists {
+		return false, err
+	}
+	added := false
+	for _, ruleSpec := range forwardAcceptRules() {
+		ok, err := client.Exists(defaultIpTable, dockerUserChain, ruleSpec...)
+		if err != nil {
+			return added, err
+		}
+		if ok {
+			continue
+		}
+		if err := client.Insert(defaultIpTable, dockerUserChain, 1, ruleSpec...); err != nil {
+			return added, err
+		}
+		added = true
+	}
+	return added, nil
+}
+
+// removeDockerUserRules - removes the netmaker rules from the DOCKER-USER chain
+func removeDockerUserRules(client iptablesAPI) {
+	if exists, err := client.ChainExists(defaultIpTable, dockerUserChain); err != nil || !exists {
+		return
+	}
+	for _, ruleSpec := range forwardAcceptRules() {
+		if err := client.DeleteIfExists(defaultIpTable, dockerUserChain, ruleSpec...); err != nil {
+			logger.Log(1, "failed to delete rule: ", strings.Join(ruleSpec, " "), err.Error())
+		}
+	}
+}
+
+// forwardAcceptRules - FORWARD chain rules accepting netmaker traffic, in insertion order
+func forwardAcceptRules() [][]string {
+	return [][]string{
+		appendNetmakerCommentToRule([]string{"-i", "netmaker", "-j", "ACCEPT"}),
+		appendNetmakerCommentToRule([]string{"-o", "netmaker", "-j", "ACCEPT"}),
+	}
+}
+
+// iptablesManager.VerifyChains - checks that the netmaker accept rules still lead the FORWARD chain, the
+// nat jump rule is present and the netmaker chains and rules were not flushed, repositioning or restoring
+// them when another tool (docker, kube-proxy, fail2ban, an admin) inserted rules ahead of them or removed
+// them, returns the problems found
+func (i *iptablesManager) VerifyChains() ([]string, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if err := i.ctx.Err(); err != nil {
+		return nil, err
+	}
+	issues := []string{}
+	for _, client := range i.clients() {
+		proto := iptablesProtoToString(client.Proto())
+		rules, err := client.List(defaultIpTable, iptableFWDChain)
+		if err != nil {
+			return issues, fmt.Errorf("failed to list %s %s chain: %w", proto, iptableFWDChain, err)
+		}
+		leading := 0
+		misplaced := false
+		for _, rule := range rules {
+			if strings.HasPrefix(rule, "-P ") {
+				if rule == "-P "+config.DefaultForwardChain+" DROP" {
+					issues = append(issues, proto+" FORWARD policy is DROP, netmaker traffic relies on the netmaker accept rules leading the chain")
+				}
+				continue
+			}
+			if !addedByNetmaker(rule) {
+				if leading < len(forwardAcceptRules()) {
+					misplaced = true
+				}
+				break
+			}
+			leading++
+		}
+		if misplaced || leading < len(forwardAcceptRules()) {
+			issues = append(issues, proto+" netmaker accept rules are no longer first in the FORWARD chain, repositioning")
+			for _, ruleSpec := range forwardAcceptRules() {
+				client.DeleteIfExists(defaultIpTable, iptableFWDChain, ruleSpec...)
+				if err := client.Insert(defaultIpTable, iptableFWDChain, 1, ruleSpec...); err != nil {
+					return issues, fmt.Errorf("failed to reposition rule %v: %w", ruleSpec, err)
+				}
+			}
+			// the rules of inter-network routing and the drop rules of blocked peers have to stay ahead
+			// of the accept rules
+			if err := i.reinsertInterNetworkRules(client); err != nil {
+				return issues, err
+			}
+			if err := i.reinsertDefaultDenyJumps(client); err != nil {
+				return issues, err
+			}
+			if err := i.reinsertBlockRules(client, iptableFWDChain); err != nil {
+				return issues, err
+			}
+		}
+		added, err := ensureDockerUserRules(client)
+		if err != nil {
+			return issues, fmt.Errorf("failed to restore docker rules: %w", err)
+		}
+		if added {
+			issues = append(issues, proto+" netmaker rules missing from the docker DOCKER-USER chain, restoring")
+		}
+		jump := natNmJumpRules[0]
+		ok, err := client.Exists(jump.table, jump.chain, jump.rule...)
+		if err == nil && !ok {
+			issues = append(issues, proto+" netmaker nat jump rule was removed, restoring")
+			if err := client.Append(jump.table, jump.chain, jump.rule...); err != nil {
+				return issues, fmt.Errorf("failed to restore rule %v: %w", jump.rule, err)
+			}
+		}
+		restored, err := i.reconcileRules(client)
+		issues = append(issues, restored...)
+		if err != nil {
+			return issues, err
+		}
+		removed, err := i.removeOrphanedRules(client)
+		issues = append(issues, removed...)
+		if err != nil {
+			return issues, err
+		}
+	}
+	return issues, nil
+}
+
+// chainRef - a chain of a table
+type chainRef struct {
+	table, chain string
+}
+
+// iptablesManager.trackedRules - the rules applied for the address family besides the forward accept and
+// jump rules, in the order they are inserted at the top of their chains
+func (i *iptablesManager) trackedRules(isIpv4 bool) []ruleInfo {
+	rules := []ruleInfo{}
+	fromTable := func(table ruletable) {
+		for _, cfg := range table {
+			if cfg.isIpv4 != isIpv4 {
+				continue
+			}
+			for _, peerRules := range cfg.rulesMap {
+				rules = append(rules, peerRules...)
+			}
+		}
+	}
+	for _, tables := range []serverrulestable{i.ingRules, i.engressRules} {
+		for _, table := range tables {
+			fromTable(table)
+		}
+	}
+	fromTable(i.staticNatRules)
+	rules = append(rules, i.appMarkRules...)
+	for idx := len(i.inboundRules) - 1; idx >= 0; idx-- {
+		rules = append(rules, i.inboundRules[idx])
+	}
+	rules = append(rules, i.policyQueueRules...)
+	fromTable(i.interNetworkRules)
+	fromTable(i.mssClampRules)
+	fromTable(i.egressMarkRules)
+	fromTable(i.rateLimitRules)
+	rules = append(rules, i.defaultDenyJumps(isIpv4)...)
+	fromTable(i.blockRules)
+	return rules
+}
+
+// iptablesManager.reconcileRules - restores the netmaker chains and the tracked rules deleted by another
+// tool, e.g. with `iptables -F`; the chains are listed once and their rules only checked one by one when a
+// chain holds fewer netmaker rules than expected
+func (i *iptablesManager) reconcileRules(client iptablesAPI) ([]string, error) {
+	proto := iptablesProtoToString(client.Proto())
+	issues := []string{}
+	for _, c := range []chainRef{{defaultIpTable, netmakerFilterChain}, {defaultNatTable, netmakerNatChain}} {
+		exists, err := client.ChainExists(c.table, c.chain)
+		if err != nil {
+			return issues, fmt.Errorf("failed to check %s %s chain: %w", proto, c.chain, err)
+		}
+		if !exists {
+			issues = append(issues, fmt.Sprintf("%s netmaker chain %s was deleted, restoring", proto, c.chain))
+			if err := createChain(client, c.table, c.chain); err != nil {
+				return issues, err
+			}
 		}
 	}
-	ok, err = i.ipv6Client.Exists(defaultIpTable, iptableFWDChain, ruleSpec...)
-	if err == nil && !ok {
-		if err := i.ipv6Client.Insert(defaultIpTable, iptableFWDChain, 1, ruleSpec...); err != nil {
-			logger.Log(1, fmt.Sprintf("failed to add rule: %v Err: %v", ruleSpec, err.Error()))
+	tracked := i.trackedRules(client.Proto() == iptables.ProtocolIPv4)
+	// the RETURN rules close the netmaker chains, behind the drop rules of default-deny networks in the
+	// filter chain
+	closing := append(i.defaultDenyDrops(client.Proto() == iptables.ProtocolIPv4), filterNmJumpRules[0], natNmJumpRules[1])
+	expected := map[chainRef]int{
+		{defaultIpTable, iptableFWDChain}:                  len(forwardAcceptRules()),
+		{natNmJumpRules[0].table, natNmJumpRules[0].chain}: 1,
+	}
+	for _, rule := range append(append([]ruleInfo{}, tracked...), closing...) {
+		expected[chainRef{rule.table, rule.chain}]++
+	}
+	for c, count := range expected {
+		rules, err := client.List(c.table, c.chain)
+		if err != nil {
+			return issues, fmt.Errorf("failed to list %s %s chain: %w", proto, c.chain, err)
+		}
+		netmakerChain := c.chain == netmakerFilterChain || c.chain == netmakerNatChain
+		live := 0
+		for _, rule := range rules {
+			if strings.HasPrefix(rule, "-A ") && (netmakerChain || addedByNetmaker(rule)) {
+				live++
+			}
+		}
+		if live >= count {
+			continue
+		}
+		issues = append(issues, fmt.Sprintf("%s %d netmaker rules missing from the %s %s chain, restoring", proto, count-live, c.table, c.chain))
+		for _, rule := range tracked {
+			if rule.table != c.table || rule.chain != c.chain {
+				continue
+			}
+			if ok, err := client.Exists(rule.table, rule.chain, rule.rule...); err != nil || ok {
+				continue
+			}
+			if err := client.Insert(rule.table, rule.chain, 1, rule.rule...); err != nil {
+				return issues, fmt.Errorf("failed to restore rule %v: %w", rule.rule, err)
+			}
+		}
+		if err := restoreClosingRules(client, c, closing); err != nil {
+			return issues, err
+		}
+		// the drop rules of blocked peers have to stay ahead of the restored rules
+		if err := i.reinsertBlockRules(client, c.chain); err != nil {
+			return issues, err
 		}
 	}
-	ruleSpec = []string{"-o", "netmaker", "-j", "ACCEPT"}
-	ruleSpec = appendNetmakerCommentToRule(ruleSpec)
-	ok, err = i.ipv4Client.Exists(defaultIpTable, iptableFWDChain, ruleSpec...)
-	if err == nil && !ok {
-		if err := i.ipv4Client.Insert(defaultIpTable, iptableFWDChain, 1, ruleSpec...); err != nil {
-			logger.Log(1, fmt.Sprintf("failed to add rule: %v Err: %v", ruleSpec, err.Error()))
+	return issues, nil
+}
+
+// restoreClosingRules - appends the closing rules of the chain again in order when one of them is missing
+func restoreClosingRules(client iptablesAPI, c chainRef, closing []ruleInfo) error {
+	rules := []ruleInfo{}
+	missing := false
+	for _, rule := range closing {
+		if rule.table != c.table || rule.chain != c.chain {
+			continue
 		}
+		rules = append(rules, rule)
+		if ok, err := client.Exists(rule.table, rule.chain, rule.rule...); err == nil && !ok {
+			missing = true
+		}
+	}
+	if !missing {
+		return nil
+	}
+	for _, rule := range rules {
+		client.DeleteIfExists(rule.table, rule.chain, rule.rule...)
 	}
-	ok, err = i.ipv6Client.Exists(defaultIpTable, iptableFWDChain, ruleSpec...)
-	if err == nil && !ok {
-		if err := i.ipv6Client.Insert(defaultIpTable, iptableFWDChain, 1, ruleSpec...); err != nil {
-			logger.Log(1, fmt.Sprintf("failed to add rule: %v Err: %v", ruleSpec, err.Error()))
+	for _, rule := range rules {
+		if err := client.Append(rule.table, rule.chain, rule.rule...); err != nil {
+			return fmt.Errorf("failed to restore rule %v: %w", rule.rule, err)
 		}
 	}
 	return nil
@@ -142,31 +457,78 @@ func (i *iptablesManager) ForwardRule() error {
 
 // CleanRoutingRules cleans existing iptables resources that we created by the agent
 func (i *iptablesManager) CleanRoutingRules(server, ruleTableName string) {
-	ruleTable := i.FetchRuleTable(server, ruleTableName)
-	defer i.DeleteRuleTable(server, ruleTableName)
 	i.mux.Lock()
 	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	ruleTable := i.ruleTable(server, ruleTableName)
+	batches := i.newBatches()
 	for _, rulesCfg := range ruleTable {
-		for key, rules := range rulesCfg.rulesMap {
-			iptablesClient := i.ipv4Client
-			if !rulesCfg.isIpv4 {
-				iptablesClient = i.ipv6Client
-			}
+		for _, rules := range rulesCfg.rulesMap {
 			for _, rule := range rules {
-				err := iptablesClient.DeleteIfExists(rule.table, rule.chain, rule.rule...)
-				if err != nil {
-					logger.Log(1, fmt.Sprintf("failed to delete rule [%s]: %+v, Err: %s", key, rule, err.Error()))
-				}
+				batches.family(rulesCfg.isIpv4).delete(rule)
 			}
 		}
 	}
+	if err := batches.apply(); err != nil {
+		logger.Log(1, "failed to delete rules of table", ruleTableName, err.Error())
+	}
+	i.deleteRuleTable(server, ruleTableName)
+	for _, client := range i.clients() {
+		if client == nil {
+			continue
+		}
+		if _, err := i.removeOrphanedRules(client); err != nil {
+			logger.Log(1, "failed to remove orphaned rules: ", err.Error())
+		}
+	}
+}
 
+// iptablesManager.removeOrphanedRules - deletes the rules tagged with the comment of a peer of a server
+// which are no longer tracked in the rule tables, e.g. left behind by a failed deletion
+func (i *iptablesManager) removeOrphanedRules(client iptablesAPI) ([]string, error) {
+	proto := iptablesProtoToString(client.Proto())
+	tracked := make(map[string]bool)
+	for _, tables := range []serverrulestable{i.ingRules, i.engressRules} {
+		for _, table := range tables {
+			for _, cfg := range table {
+				for _, rules := range cfg.rulesMap {
+					for _, rule := range rules {
+						tracked[commentOf(strings.Join(rule.rule, " "))] = true
+					}
+				}
+			}
+		}
+	}
+	issues := []string{}
+	for _, c := range []chainRef{
+		{defaultIpTable, iptableFWDChain}, {defaultIpTable, netmakerFilterChain},
+		{defaultNatTable, nattablePRTChain}, {defaultNatTable, netmakerNatChain},
+	} {
+		rules, err := client.List(c.table, c.chain)
+		if err != nil {
+			return issues, fmt.Errorf("failed to list %s %s chain: %w", proto, c.chain, err)
+		}
+		for _, rule := range rules {
+			comment := commentOf(rule)
+			if !strings.HasPrefix(rule, "-A ") || !strings.HasPrefix(comment, netmakerCommentPrefix) || tracked[comment] {
+				continue
+			}
+			issues = append(issues, fmt.Sprintf("%s orphaned netmaker rule %s in the %s %s chain, removing", proto, comment, c.table, c.chain))
+			if err := client.Delete(c.table, c.chain, ruleSpecOf(rule)...); err != nil {
+				return issues, fmt.Errorf("failed to delete rule %s: %w", rule, err)
+			}
+		}
+	}
+	return issues, nil
 }
 
 // iptablesManager.CreateChains - creates default chains and rules
 func (i *iptablesManager) CreateChains() error {
 	i.mux.Lock()
 	defer i.mux.Unlock()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
 	// remove jump rules
 	i.removeJumpRules()
 	i.cleanup(defaultIpTable, netmakerFilterChain)
@@ -174,26 +536,19 @@ func (i *iptablesManager) CreateChains() error {
 
 	//errMSGFormat := "iptables: failed creating %s chain %s,error: %v"
 
-	err := createChain(i.ipv4Client, defaultIpTable, netmakerFilterChain)
-	if err != nil {
-		logger.Log(1, "failed to create netmaker chain: ", err.Error())
-		return err
-	}
-	err = createChain(i.ipv4Client, defaultNatTable, netmakerNatChain)
-	if err != nil {
-		logger.Log(1, "failed to create netmaker chain: ", err.Error())
-		return err
-	}
-
-	err = createChain(i.ipv6Client, defaultIpTable, netmakerFilterChain)
-	if err != nil {
-		logger.Log(1, "failed to create netmaker chain: ", err.Error())
-		return err
-	}
-	err = createChain(i.ipv6Client, defaultNatTable, netmakerNatChain)
-	if err != nil {
-		logger.Log(1, "failed to create netmaker chain: ", err.Error())
-		return err
+	for _, client := range i.clients() {
+		if err := createChain(client, defaultIpTable, netmakerFilterChain); err != nil {
+			logger.Log(1, "failed to create netmaker chain: ", err.Error())
+			return err
+		}
+		if err := createChain(client, defaultNatTable, netmakerNatChain); err != nil {
+			logger.Log(1, "failed to create netmaker chain: ", err.Error())
+			return err
+		}
+		if err := ensureHookChains(client); err != nil {
+			logger.Log(1, "failed to create hook chain: ", err.Error())
+			return err
+		}
 	}
 	// add jump rules
 	i.addJumpRules()
@@ -201,132 +556,121 @@ func (i *iptablesManager) CreateChains() error {
 }
 
 func (i *iptablesManager) addJumpRules() {
-	for _, rule := range filterNmJumpRules {
-		err := i.ipv4Client.Append(rule.table, rule.chain, rule.rule...)
-		if err != nil {
-			logger.Log(1, fmt.Sprintf("failed to add rule: %v, Err: %v ", rule.rule, err.Error()))
-		}
-		err = i.ipv6Client.Append(rule.table, rule.chain, rule.rule...)
-		if err != nil {
-			logger.Log(1, fmt.Sprintf("failed to add rule: %v, Err: %v ", rule.rule, err.Error()))
-		}
-	}
-	for _, rule := range natNmJumpRules {
-		err := i.ipv4Client.Append(rule.table, rule.chain, rule.rule...)
-		if err != nil {
-			logger.Log(1, fmt.Sprintf("failed to add rule: %v, Err: %v ", rule.rule, err.Error()))
-		}
-		err = i.ipv6Client.Append(rule.table, rule.chain, rule.rule...)
-		if err != nil {
-			logger.Log(1, fmt.Sprintf("failed to add rule: %v, Err: %v ", rule.rule, err.Error()))
+	for _, client := range i.clients() {
+		for _, rule := range append(append([]ruleInfo{}, filterNmJumpRules...), natNmJumpRules...) {
+			if err := client.Append(rule.table, rule.chain, rule.rule...); err != nil {
+				logger.Log(1, fmt.Sprintf("failed to add rule: %v, Err: %v ", rule.rule, err.Error()))
+			}
 		}
 	}
 }
 
 // checks if rule has been added by netmaker
 func addedByNetmaker(ruleString string) bool {
+	comment := commentOf(ruleString)
+	return comment == netmakerSignature || strings.HasPrefix(comment, netmakerCommentPrefix)
+}
+
+// commentOf - the comment of a rule as listed by iptables -S, which quotes comments holding
+// characters other than letters, digits, dashes and underscores
+func commentOf(ruleString string) string {
 	rule := strings.Fields(ruleString)
 	for i, flag := range rule {
 		if flag == "--comment" && len(rule)-1 > i {
-			if rule[i+1] == netmakerSignature {
-				return true
-			}
+			return strings.Trim(rule[i+1], "\"")
 		}
 	}
-	return false
+	return ""
 }
-func (i *iptablesManager) removeJumpRules() {
-	rules, err := i.ipv4Client.List(defaultIpTable, iptableFWDChain)
-	if err == nil {
-		for _, rule := range rules {
-			if addedByNetmaker(rule) {
-				err := i.ipv4Client.Delete(defaultIpTable, iptableFWDChain, strings.Fields(rule)[2:]...)
-				if err != nil {
-					logger.Log(1, "failed to delete rule: ", rule, err.Error())
-				}
-			}
-		}
+
+// ruleSpecOf - the rule specification of a rule as listed by iptables -S, without the -A <chain> prefix
+func ruleSpecOf(ruleString string) []string {
+	fields := strings.Fields(ruleString)
+	if len(fields) < 2 {
+		return nil
 	}
-	rules, err = i.ipv6Client.List(defaultIpTable, iptableFWDChain)
-	if err == nil {
-		for _, rule := range rules {
-			if addedByNetmaker(rule) {
-				err := i.ipv6Client.Delete(defaultIpTable, iptableFWDChain, strings.Fields(rule)[2:]...)
-				if err != nil {
-					logger.Log(1, "failed to delete rule: ", rule, err.Error())
-				}
-			}
-		}
+	spec := fields[2:]
+	for i := range spec {
+		spec[i] = strings.Trim(spec[i], "\"")
 	}
-	rules, err = i.ipv4Client.List(defaultNatTable, nattablePRTChain)
-	if err == nil {
-		for _, rule := range rules {
-			if addedByNetmaker(rule) {
-				err := i.ipv4Client.Delete(defaultNatTable, nattablePRTChain, strings.Fields(rule)[2:]...)
-				if err != nil {
-					logger.Log(1, "failed to delete rule: ", rule, err.Error())
-				}
+	return spec
+}
+func (i *iptablesManager) removeJumpRules() {
+	for _, client := range i.clients() {
+		for _, c := range []chainRef{{defaultIpTable, iptableFWDChain}, {defaultNatTable, nattablePRTChain}} {
+			rules, err := client.List(c.table, c.chain)
+			if err != nil {
+				continue
 			}
-		}
-	}
-	rules, err = i.ipv6Client.List(defaultNatTable, nattablePRTChain)
-	if err == nil {
-		for _, rule := range rules {
-			if addedByNetmaker(rule) {
-				err := i.ipv6Client.Delete(defaultNatTable, nattablePRTChain, strings.Fields(rule)[2:]...)
-				if err != nil {
-					logger.Log(1, "failed to delete rule: ", rule, err.Error())
+			for _, rule := range rules {
+				if addedByNetmaker(rule) {
+					err := client.Delete(c.table, c.chain, ruleSpecOf(rule)...)
+					if err != nil {
+						logger.Log(1, "failed to delete rule: ", rule, err.Error())
+					}
 				}
 			}
 		}
 	}
-
 }
 
 // iptablesManager.InsertEgressRoutingRules - inserts egress routes for the GW peers
 func (i *iptablesManager) InsertEgressRoutingRules(server string, egressInfo models.EgressInfo) error {
-	ruleTable := i.FetchRuleTable(server, egressTable)
-	defer i.SaveRules(server, egressTable, ruleTable)
 	i.mux.Lock()
 	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	ruleTable := i.ruleTable(server, egressTable)
 	// add jump Rules for egress GW
-	iptablesClient := i.ipv4Client
-	isIpv4 := true
-	if !isAddrIpv4(egressInfo.EgressGwAddr.String()) {
-		iptablesClient = i.ipv6Client
-		isIpv4 = false
+	isIpv4 := isAddrIpv4(egressInfo.EgressGwAddr.String())
+	batch := i.newBatches().family(isIpv4)
+	cfg, ok := ruleTable[egressInfo.EgressID]
+	if !ok || cfg.isIpv4 != isIpv4 {
+		cfg = rulesCfg{isIpv4: isIpv4, rulesMap: make(map[string][]ruleInfo)}
 	}
-	ruleTable[egressInfo.EgressID] = rulesCfg{
-		isIpv4:   isIpv4,
-		rulesMap: make(map[string][]ruleInfo),
+	cfg.network = egressNetwork(egressInfo)
+	ruleTable[egressInfo.EgressID] = cfg
+	// replace the nat rules of the ranges of a previous update of the gateway, keeping the rules of its peers
+	for _, egressRange := range cfg.egressRanges() {
+		for _, rule := range cfg.rulesMap[egressRangeKey(egressRange)] {
+			batch.delete(rule)
+		}
+		delete(cfg.rulesMap, egressRangeKey(egressRange))
 	}
-	egressGwRoutes := []ruleInfo{}
 	for _, egressGwRange := range egressInfo.EgressGWCfg.Ranges {
-		if egressInfo.EgressGWCfg.NatEnabled == "yes" {
-			egressRangeIface, err := getInterfaceName(config.ToIPNet(egressGwRange))
+		if i.ctx.Err() != nil {
+			// keep the rules added so far in the table so they are cleaned up
+			break
+		}
+		cfg.rulesMap[egressRangeKey(egressGwRange)] = []ruleInfo{}
+		if isAddrIpv4(egressGwRange) != isIpv4 {
+			// the rules of the gateway are kept in the table of its address family
+			continue
+		}
+		nat := egressNat(egressGwRange, egressInfo.EgressGWCfg.NatEnabled == "yes")
+		if nat.Mode != EgressNatRouted {
+			dst := toIPNet(egressGwRange)
+			egressRangeIface, err := getInterfaceName(dst)
 			if err != nil {
 				logger.Log(0, "failed to get interface name: ", egressRangeIface, err.Error())
 			} else {
-				ruleSpec := []string{"-o", egressRangeIface, "-j", "MASQUERADE"}
-				ruleSpec = appendNetmakerCommentToRule(ruleSpec)
-				// to avoid duplicate iface route rule,delete if exists
-				iptablesClient.DeleteIfExists(defaultNatTable, nattablePRTChain, ruleSpec...)
-				err := iptablesClient.Insert(defaultNatTable, nattablePRTChain, 1, ruleSpec...)
-				if err != nil {
-					logger.Log(1, fmt.Sprintf("failed to add rule: %v, Err: %v ", ruleSpec, err.Error()))
-				} else {
-					egressGwRoutes = append(egressGwRoutes, ruleInfo{
-						table: defaultNatTable,
-						chain: nattablePRTChain,
-						rule:  ruleSpec,
-					})
+				ruleSpec := []string{"-o", egressRangeIface, "-d", dst.String(), "-j", "MASQUERADE"}
+				if nat.Mode == EgressNatSNAT {
+					ruleSpec = []string{"-o", egressRangeIface, "-d", dst.String(), "-j", "SNAT", "--to-source", nat.Source.String()}
 				}
+				rule := ruleInfo{
+					table: defaultNatTable,
+					chain: nattablePRTChain,
+					rule:  appendCommentToRule(ruleSpec, ruleComment(server, egressInfo.EgressID)),
+				}
+				batch.insert(rule)
+				cfg.rulesMap[egressRangeKey(egressGwRange)] = []ruleInfo{rule}
 			}
 		}
 	}
-	ruleTable[egressInfo.EgressID].rulesMap[egressInfo.EgressID] = egressGwRoutes
-
-	return nil
+	return batch.apply()
 }
 
 // iptablesManager.AddEgressRoutingRule - inserts iptable rule for gateway peer
@@ -335,17 +679,23 @@ func (i *iptablesManager) AddEgressRoutingRule(server string, egressInfo models.
 	if !peer.Allow {
 		return nil
 	}
-	ruleTable := i.FetchRuleTable(server, egressTable)
-	defer i.SaveRules(server, egressTable, ruleTable)
 	i.mux.Lock()
 	defer i.mux.Unlock()
-	iptablesClient := i.ipv4Client
-
-	if !isAddrIpv4(egressInfo.EgressGwAddr.String()) {
-		iptablesClient = i.ipv6Client
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	ruleTable := i.ruleTable(server, egressTable)
+	if _, ok := ruleTable[egressInfo.EgressID]; !ok {
+		return errors.New("egress gateway not found in rule table: " + egressInfo.EgressID)
+	}
+	iptablesClient := i.client(isAddrIpv4(egressInfo.EgressGwAddr.String()))
+	if iptablesClient == nil {
+		return nil
 	}
 
-	ruleSpec := []string{"-s", peer.PeerAddr.String(), "-d", strings.Join(egressInfo.EgressGWCfg.Ranges, ","), "-j", "ACCEPT"}
+	ruleSpec := appendCommentToRule([]string{"-s", peer.PeerAddr.String(), "-d", strings.Join(normalizeRanges(egressInfo.EgressGWCfg.Ranges), ","), "-j", "ACCEPT"},
+		ruleComment(server, peer.PeerKey))
 	err := iptablesClient.Insert(defaultIpTable, netmakerFilterChain, 1, ruleSpec...)
 	if err != nil {
 		logger.Log(1, fmt.Sprintf("failed to add rule: %v, Err: %v ", ruleSpec, err.Error()))
@@ -366,33 +716,37 @@ func (i *iptablesManager) AddEgressRoutingRule(server string, egressInfo models.
 
 func (i *iptablesManager) cleanup(table, chain string) {
 
-	err := i.ipv4Client.ClearAndDeleteChain(table, chain)
-	if err != nil {
-		logger.Log(1, "[ipv4] failed to clear chain: ", table, chain, err.Error())
-	}
-	err = i.ipv6Client.ClearAndDeleteChain(table, chain)
-	if err != nil {
-		logger.Log(1, "[ipv6] failed to clear chain: ", table, chain, err.Error())
+	for _, client := range i.clients() {
+		if err := client.ClearAndDeleteChain(table, chain); err != nil {
+			logger.Log(1, "["+iptablesProtoToString(client.Proto())+"] failed to clear chain: ", table, chain, err.Error())
+		}
 	}
 }
 
-// iptablesManager.FetchRuleTable - fetches the rule table by table name
+// iptablesManager.FetchRuleTable - fetches a copy of the rule table by table name
 func (i *iptablesManager) FetchRuleTable(server string, tableName string) ruletable {
 	i.mux.Lock()
 	defer i.mux.Unlock()
-	var rules ruletable
-	switch tableName {
-	case ingressTable:
-		rules = i.ingRules[server]
-		if rules == nil {
-			rules = make(ruletable)
-		}
-	case egressTable:
-		rules = i.engressRules[server]
-		if rules == nil {
-			rules = make(ruletable)
-		}
+	return i.ruleTable(server, tableName).copy()
+}
+
+// iptablesManager.ListRules - lists the rules of all rule tables and rule lists
+func (i *iptablesManager) ListRules() []ManagedRule {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	rules := listManagedRules(i.ingRules, i.engressRules, i.blockRules, i.staticNatRules)
+	families := []string{}
+	for _, client := range i.clients() {
+		families = append(families, iptablesProtoToString(client.Proto()))
 	}
+	rules = append(rules, listedRules(inboundTable, i.inboundRules, families)...)
+	rules = append(rules, listedRules(appMarkTable, i.appMarkRules, families)...)
+	rules = append(rules, listedRules(policyQueueTable, i.policyQueueRules, families)...)
+	rules = append(rules, i.interNetworkRules.managedRules("", interNetworkTable)...)
+	rules = append(rules, i.mssClampRules.managedRules("", mssClampTable)...)
+	rules = append(rules, i.egressMarkRules.managedRules("", egressMarkTable)...)
+	rules = append(rules, i.rateLimitRules.managedRules("", rateLimitTable)...)
+	rules = append(rules, i.defaultDenyRules.managedRules("", defaultDenyTable)...)
 	return rules
 }
 
@@ -400,72 +754,172 @@ func (i *iptablesManager) FetchRuleTable(server string, tableName string) ruleta
 func (i *iptablesManager) DeleteRuleTable(server, ruleTableName string) {
 	i.mux.Lock()
 	defer i.mux.Unlock()
-	logger.Log(1, "Deleting rules table: ", server, ruleTableName)
-	switch ruleTableName {
-	case ingressTable:
-		delete(i.ingRules, server)
-	case egressTable:
-		delete(i.engressRules, server)
-	}
+	defer i.saveRuleState()
+	i.deleteRuleTable(server, ruleTableName)
 }
 
 // iptablesManager.SaveRules - saves the rule table by tablename
 func (i *iptablesManager) SaveRules(server, tableName string, rules ruletable) {
 	i.mux.Lock()
 	defer i.mux.Unlock()
+	defer i.saveRuleState()
 	logger.Log(1, "Saving rules to table: ", tableName)
+	i.saveRuleTable(server, tableName, rules.copy())
+}
+
+// iptablesManager.ruleTable - returns the stored rule table by table name, creating it if needed
+func (i *iptablesManager) ruleTable(server, tableName string) ruletable {
+	var tables serverrulestable
+	switch tableName {
+	case ingressTable:
+		tables = i.ingRules
+	case egressTable:
+		tables = i.engressRules
+	case blockTable:
+		return i.blockRules
+	default:
+		return make(ruletable)
+	}
+	rules, ok := tables[server]
+	if !ok {
+		rules = make(ruletable)
+		tables[server] = rules
+	}
+	return rules
+}
+
+func (i *iptablesManager) saveRuleTable(server, tableName string, rules ruletable) {
 	switch tableName {
 	case ingressTable:
 		i.ingRules[server] = rules
 	case egressTable:
 		i.engressRules[server] = rules
+	case blockTable:
+		i.blockRules = rules
 	}
 }
 
-// iptablesManager.RemoveRoutingRules removes an iptables rules related to a peer
-func (i *iptablesManager) RemoveRoutingRules(server, ruletableName, peerKey string) error {
-	rulesTable := i.FetchRuleTable(server, ruletableName)
-	defer i.SaveRules(server, ruletableName, rulesTable)
-	i.mux.Lock()
-	defer i.mux.Unlock()
-	if _, ok := rulesTable[peerKey]; !ok {
-		return errors.New("peer not found in rule table: " + peerKey)
+// iptablesManager.saveRuleState - persists all rule tables, the lock is held by the caller
+func (i *iptablesManager) saveRuleState() {
+	if i.persistRules {
+		saveRuleState(i.ruleTables())
+	}
+}
+
+// iptablesManager.ruleTables - all rule tables by rule table name, the tables not kept per server under the
+// empty server and the rule lists applied to both families keyed by family; the lock is held by the caller
+func (i *iptablesManager) ruleTables() map[string]serverrulestable {
+	families := []bool{}
+	for _, client := range i.clients() {
+		families = append(families, client.Proto() == iptables.ProtocolIPv4)
 	}
-	iptablesClient := i.ipv4Client
-	if !rulesTable[peerKey].isIpv4 {
-		iptablesClient = i.ipv6Client
+	return map[string]serverrulestable{
+		ingressTable:      i.ingRules,
+		egressTable:       i.engressRules,
+		blockTable:        {"": i.blockRules},
+		staticNatTable:    {"": i.staticNatRules},
+		inboundTable:      {"": listTable(i.inboundRules, families...)},
+		appMarkTable:      {"": listTable(i.appMarkRules, families...)},
+		policyQueueTable:  {"": listTable(i.policyQueueRules, families...)},
+		interNetworkTable: {"": i.interNetworkRules},
+		mssClampTable:     {"": i.mssClampRules},
+		egressMarkTable:   {"": i.egressMarkRules},
+		rateLimitTable:    {"": i.rateLimitRules},
+		defaultDenyTable:  {"": i.defaultDenyRules},
 	}
+}
 
-	for _, rules := range rulesTable[peerKey].rulesMap {
-		for _, rule := range rules {
-			err := iptablesClient.DeleteIfExists(rule.table, rule.chain, rule.rule...)
-			if err != nil {
-				return fmt.Errorf("iptables: error while removing existing %s rules [%v] for %s: %v",
-					rule.table, rule.rule, peerKey, err)
-			}
+// listTable - the rule table of a rule list applied to each of the families, keyed by family
+func listTable(rules []ruleInfo, families ...bool) ruletable {
+	table := make(ruletable)
+	if len(rules) == 0 {
+		return table
+	}
+	for _, isIpv4 := range families {
+		family := ipv6
+		if isIpv4 {
+			family = ipv4
 		}
-
+		table[family] = rulesCfg{isIpv4: isIpv4, rulesMap: map[string][]ruleInfo{"": rules}}
 	}
-	delete(rulesTable, peerKey)
-	return nil
+	return table
 }
 
-// iptablesManager.DeleteRoutingRule - removes an iptables rule pair from forwarding and nat chains
-func (i *iptablesManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, dstPeerKey string) error {
-	rulesTable := i.FetchRuleTable(server, ruletableName)
-	defer i.SaveRules(server, ruletableName, rulesTable)
+// iptablesManager.removeSavedRules - removes the rules of a rule table persisted by a previous daemon
+func (i *iptablesManager) removeSavedRules(rules ruletable) {
 	i.mux.Lock()
 	defer i.mux.Unlock()
-	if _, ok := rulesTable[srcPeerKey]; !ok {
-		return errors.New("peer not found in rule table: " + srcPeerKey)
-	}
-	iptablesClient := i.ipv4Client
-	if !rulesTable[srcPeerKey].isIpv4 {
-		iptablesClient = i.ipv6Client
+	for _, cfg := range rules {
+		client := i.client(cfg.isIpv4)
+		if client == nil {
+			continue
+		}
+		for _, peerRules := range cfg.rulesMap {
+			for _, rule := range peerRules {
+				if err := client.DeleteIfExists(rule.table, rule.chain, rule.rule...); err != nil {
+					logger.Log(1, fmt.Sprintf("failed to delete stale rule: %v, Err: %s", rule.rule, err.Error()))
+				}
+			}
+		}
 	}
-	if rules, ok := rulesTable[srcPeerKey].rulesMap[dstPeerKey]; ok {
-		for _, rule := range rules {
-			err := iptablesClient.DeleteIfExists(rule.table, rule.chain, rule.rule...)
+}
+
+func (i *iptablesManager) deleteRuleTable(server, tableName string) {
+	logger.Log(1, "Deleting rules table: ", server, tableName)
+	switch tableName {
+	case ingressTable:
+		delete(i.ingRules, server)
+	case egressTable:
+		delete(i.engressRules, server)
+	case blockTable:
+		i.blockRules = make(ruletable)
+	}
+}
+
+// iptablesManager.RemoveRoutingRules removes an iptables rules related to a peer
+func (i *iptablesManager) RemoveRoutingRules(server, ruletableName, peerKey string) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := i.ruleTable(server, ruletableName)
+	if _, ok := rulesTable[peerKey]; !ok {
+		return errors.New("peer not found in rule table: " + peerKey)
+	}
+	batch := i.newBatches().family(rulesTable[peerKey].isIpv4)
+	for _, rules := range rulesTable[peerKey].rulesMap {
+		for _, rule := range rules {
+			batch.delete(rule)
+		}
+	}
+	if err := batch.apply(); err != nil {
+		return fmt.Errorf("iptables: error while removing existing rules for %s: %w", peerKey, err)
+	}
+	delete(rulesTable, peerKey)
+	return nil
+}
+
+// iptablesManager.DeleteRoutingRule - removes an iptables rule pair from forwarding and nat chains
+func (i *iptablesManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, dstPeerKey string) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := i.ruleTable(server, ruletableName)
+	if _, ok := rulesTable[srcPeerKey]; !ok {
+		return errors.New("peer not found in rule table: " + srcPeerKey)
+	}
+	iptablesClient := i.client(rulesTable[srcPeerKey].isIpv4)
+	if rules, ok := rulesTable[srcPeerKey].rulesMap[dstPeerKey]; ok {
+		for _, rule := range rules {
+			if iptablesClient == nil {
+				break
+			}
+			err := iptablesClient.DeleteIfExists(rule.table, rule.chain, rule.rule...)
 			if err != nil {
 				return fmt.Errorf("iptables: error while removing existing %s rules [%v] for %s: %v",
 					rule.table, rule.rule, srcPeerKey, err)
@@ -479,16 +933,985 @@ func (i *iptablesManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, d
 	return nil
 }
 
-// iptablesManager.FlushAll - removes all the rules added by netmaker and deletes the netmaker chains
+// iptablesManager.BlockPeers - replaces the drop rules of the locally blocked peers, the rules are
+// inserted at the top of the INPUT, FORWARD and OUTPUT chains ahead of the netmaker accept rules
+func (i *iptablesManager) BlockPeers(peers map[string][]net.IPNet) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	return i.blockPeers(peers, false)
+}
+
+// iptablesManager.blockPeers - replaces the drop rules of the blocked peers, the rules of addresses still
+// blocked are kept unless rebuild; the lock is held by the caller
+func (i *iptablesManager) blockPeers(peers map[string][]net.IPNet, rebuild bool) error {
+	batches := i.newBatches()
+	if rebuild {
+		i.unblockPeers(batches)
+	}
+	wanted, added, removed := diffBlockRules(i.blockRules, peers, func(_ string, addr net.IPNet) []ruleInfo {
+		return i.withDropLogs(peerBlockRules(addr.String()))
+	})
+	for _, cfg := range removed {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).delete(rule)
+			}
+		}
+	}
+	for _, cfg := range added {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).insert(rule)
+			}
+		}
+	}
+	i.blockRules = wanted
+	if err := batches.apply(); err != nil {
+		return fmt.Errorf("failed to update the rules of blocked peers: %w", err)
+	}
+	return nil
+}
+
+// iptablesManager.unblockPeers - queues the removal of the drop rules of the blocked peers
+func (i *iptablesManager) unblockPeers(batches iptablesBatches) {
+	for _, cfg := range i.blockRules {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).delete(rule)
+			}
+		}
+	}
+	i.blockRules = make(ruletable)
+}
+
+// iptablesManager.removeGatewayRules - removes the ingress and egress rules of all servers, the nat rules of
+// egress gateways are in the postrouting chain and not flushed with the netmaker chains
+func (i *iptablesManager) removeGatewayRules(batches iptablesBatches) {
+	for _, tables := range []serverrulestable{i.ingRules, i.engressRules} {
+		for _, table := range tables {
+			for _, cfg := range table {
+				for _, rules := range cfg.rulesMap {
+					for _, rule := range rules {
+						batches.family(cfg.isIpv4).delete(rule)
+					}
+				}
+			}
+		}
+	}
+	i.ingRules = make(serverrulestable)
+	i.engressRules = make(serverrulestable)
+}
+
+// iptablesManager.reinsertBlockRules - moves the drop rules of the blocked peers in the chain back to the top
+func (i *iptablesManager) reinsertBlockRules(client iptablesAPI, chain string) error {
+	for _, cfg := range i.blockRules {
+		if cfg.isIpv4 != (client.Proto() == iptables.ProtocolIPv4) {
+			continue
+		}
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				if rule.chain != chain {
+					continue
+				}
+				client.DeleteIfExists(rule.table, rule.chain, rule.rule...)
+				if err := client.Insert(rule.table, rule.chain, 1, rule.rule...); err != nil {
+					return fmt.Errorf("failed to reposition rule %v: %w", rule.rule, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// iptablesManager.SetInterNetworkRules - replaces the FORWARD chain rules of inter-network routing, the
+// replies of allowed connections are accepted ahead of the rules dropping the other traffic
+func (i *iptablesManager) SetInterNetworkRules(rules []InterNetworkRule) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	return i.setInterNetworkRules(rules)
+}
+
+// iptablesManager.setInterNetworkRules - replaces the rules of inter-network routing, the lock is held by the caller
+func (i *iptablesManager) setInterNetworkRules(rules []InterNetworkRule) error {
+	batches := i.newBatches()
+	i.removeInterNetworkRules(batches)
+	families := make(map[bool]bool)
+	for _, r := range rules {
+		isIpv4 := r.Src.IP.To4() != nil
+		ruleInfos := i.withDropLogs([]ruleInfo{interNetworkRuleInfo(r)})
+		for _, rule := range ruleInfos {
+			batches.family(isIpv4).insert(rule)
+		}
+		i.interNetworkRules[r.key()] = rulesCfg{isIpv4: isIpv4, rulesMap: map[string][]ruleInfo{r.key(): ruleInfos}}
+		families[isIpv4] = true
+	}
+	// inserted last to end up on top
+	for isIpv4 := range families {
+		rule := interNetworkReplyRule()
+		batches.family(isIpv4).insert(rule)
+		i.interNetworkRules[interNetworkReplyKey(isIpv4)] = rulesCfg{isIpv4: isIpv4, rulesMap: map[string][]ruleInfo{"": {rule}}}
+	}
+	if err := batches.apply(); err != nil {
+		return fmt.Errorf("failed to update the rules of inter-network routing: %w", err)
+	}
+	for _, client := range i.clients() {
+		if err := i.reinsertBlockRules(client, iptableFWDChain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iptablesManager.removeInterNetworkRules - queues the removal of the rules of inter-network routing
+func (i *iptablesManager) removeInterNetworkRules(batches iptablesBatches) {
+	for _, cfg := range i.interNetworkRules {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).delete(rule)
+			}
+		}
+	}
+	i.interNetworkRules = make(ruletable)
+}
+
+// iptablesManager.reinsertInterNetworkRules - moves the rules of inter-network routing of the client's
+// family back to the top of the FORWARD chain, the reply rule ahead of the others
+func (i *iptablesManager) reinsertInterNetworkRules(client iptablesAPI) error {
+	isIpv4 := client.Proto() == iptables.ProtocolIPv4
+	rules := []ruleInfo{}
+	for key, cfg := range i.interNetworkRules {
+		if cfg.isIpv4 != isIpv4 || key == interNetworkReplyKey(isIpv4) {
+			continue
+		}
+		for _, peerRules := range cfg.rulesMap {
+			rules = append(rules, peerRules...)
+		}
+	}
+	if cfg, ok := i.interNetworkRules[interNetworkReplyKey(isIpv4)]; ok {
+		for _, peerRules := range cfg.rulesMap {
+			rules = append(rules, peerRules...)
+		}
+	}
+	for _, rule := range rules {
+		client.DeleteIfExists(rule.table, rule.chain, rule.rule...)
+		if err := client.Insert(rule.table, rule.chain, 1, rule.rule...); err != nil {
+			return fmt.Errorf("failed to reposition rule %v: %w", rule.rule, err)
+		}
+	}
+	return nil
+}
+
+// iptablesManager.SetMSSClamp - replaces the mangle table rules clamping the MSS of tcp connections
+// forwarded to the ranges over the netmaker interface to the path mtu
+func (i *iptablesManager) SetMSSClamp(ranges []net.IPNet) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	batches := i.newBatches()
+	i.removeMSSClampRules(batches)
+	for _, r := range ranges {
+		isIpv4 := r.IP.To4() != nil
+		rule := mssClampRule(r)
+		batches.family(isIpv4).insert(rule)
+		i.mssClampRules[r.String()] = rulesCfg{isIpv4: isIpv4, rulesMap: map[string][]ruleInfo{r.String(): {rule}}}
+	}
+	if err := batches.apply(); err != nil {
+		return fmt.Errorf("failed to update the MSS clamping rules: %w", err)
+	}
+	return nil
+}
+
+// iptablesManager.removeMSSClampRules - queues the removal of the MSS clamping rules
+func (i *iptablesManager) removeMSSClampRules(batches iptablesBatches) {
+	for _, cfg := range i.mssClampRules {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).delete(rule)
+			}
+		}
+	}
+	i.mssClampRules = make(ruletable)
+}
+
+// iptablesManager.SetEgressMarks - replaces the mangle table rules marking the traffic from the sources
+// to the destinations of the egress policies, in PREROUTING for forwarded and OUTPUT for local traffic
+func (i *iptablesManager) SetEgressMarks(marks []EgressMark) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	batches := i.newBatches()
+	i.removeEgressMarkRules(batches)
+	for _, m := range marks {
+		for _, family := range []string{ipv4, ipv6} {
+			isIpv4 := family == ipv4
+			rules := egressMarkRules(m, isIpv4)
+			if len(rules) == 0 {
+				continue
+			}
+			for _, rule := range rules {
+				batches.family(isIpv4).insert(rule)
+			}
+			key := fmt.Sprintf("0x%x/%s", m.Mark, family)
+			i.egressMarkRules[key] = rulesCfg{isIpv4: isIpv4, rulesMap: map[string][]ruleInfo{key: rules}}
+		}
+	}
+	if err := batches.apply(); err != nil {
+		return fmt.Errorf("failed to update the egress mark rules: %w", err)
+	}
+	return nil
+}
+
+// iptablesManager.removeEgressMarkRules - queues the removal of the egress mark rules
+func (i *iptablesManager) removeEgressMarkRules(batches iptablesBatches) {
+	for _, cfg := range i.egressMarkRules {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).delete(rule)
+			}
+		}
+	}
+	i.egressMarkRules = make(ruletable)
+}
+
+// iptablesManager.SetRateLimits - replaces the mangle table rules dropping the traffic of the ext clients
+// of the server above their limits, ahead of the filter table so no accept rule skips them
+func (i *iptablesManager) SetRateLimits(server string, limits []RateLimit) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	wanted := make(ruletable)
+	for _, l := range limits {
+		rules := rateLimitRules(l)
+		if len(rules) == 0 {
+			continue
+		}
+		key := server + "/" + l.Addr.String()
+		wanted[key] = rulesCfg{isIpv4: l.Addr.IP.To4() != nil, rulesMap: map[string][]ruleInfo{l.Addr.String(): rules}}
+	}
+	current := make(ruletable)
+	for key, cfg := range i.rateLimitRules {
+		if strings.HasPrefix(key, server+"/") {
+			current[key] = cfg
+		}
+	}
+	if reflect.DeepEqual(current, wanted) {
+		return nil
+	}
+	batches := i.newBatches()
+	i.removeRateLimitRules(batches, server)
+	for key, cfg := range wanted {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).insert(rule)
+			}
+		}
+		i.rateLimitRules[key] = cfg
+	}
+	if err := batches.apply(); err != nil {
+		return fmt.Errorf("failed to update the rate limit rules: %w", err)
+	}
+	return nil
+}
+
+// iptablesManager.removeRateLimitRules - queues the removal of the rate limit rules of the server,
+// of all servers if empty
+func (i *iptablesManager) removeRateLimitRules(batches iptablesBatches, server string) {
+	if i.rateLimitRules == nil {
+		i.rateLimitRules = make(ruletable)
+	}
+	for key, cfg := range i.rateLimitRules {
+		if server != "" && !strings.HasPrefix(key, server+"/") {
+			continue
+		}
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).delete(rule)
+			}
+		}
+		delete(i.rateLimitRules, key)
+	}
+}
+
+// iptablesManager.SetDefaultDeny - replaces the rules of default-deny networks: the traffic of their ranges
+// leaving the mesh jumps from the FORWARD chain, ahead of the accept rules, to the netmaker filter chain,
+// where it is dropped behind the rules allowing traffic
+func (i *iptablesManager) SetDefaultDeny(ranges []net.IPNet) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	return i.setDefaultDeny(ranges)
+}
+
+// iptablesManager.SetDropLogging - adds or removes the LOG rules ahead of the drop rules of blocked peers,
+// of inter-network routing and of default-deny networks
+func (i *iptablesManager) SetDropLogging(enabled bool) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	if i.logDrops == enabled {
+		return nil
+	}
+	i.logDrops = enabled
+	ranges := []net.IPNet{}
+	for key := range i.defaultDenyRules {
+		ranges = append(ranges, toIPNet(key))
+	}
+	if err := i.setDefaultDeny(ranges); err != nil {
+		return err
+	}
+	if err := i.setInterNetworkRules(interNetworkRulesOf(i.interNetworkRules)); err != nil {
+		return err
+	}
+	return i.blockPeers(blockedPeersOf(i.blockRules), true)
+}
+
+// iptablesManager.withDropLogs - the rules followed, when drop logging is on, by a rule logging the traffic
+// of each drop rule; inserted at the top in this order, the log rule ends up ahead of its drop rule
+func (i *iptablesManager) withDropLogs(rules []ruleInfo) []ruleInfo {
+	if !i.logDrops {
+		return rules
+	}
+	logged := make([]ruleInfo, 0, 2*len(rules))
+	for _, rule := range rules {
+		logged = append(logged, rule)
+		if isDropRule(rule) {
+			logged = append(logged, dropLogRuleOf(rule))
+		}
+	}
+	return logged
+}
+
+// iptablesManager.setDefaultDeny - replaces the rules of default-deny networks, the lock is held by the caller
+func (i *iptablesManager) setDefaultDeny(ranges []net.IPNet) error {
+	batches := i.newBatches()
+	i.removeDefaultDenyRules(batches)
+	if err := batches.apply(); err != nil {
+		return fmt.Errorf("failed to remove the default-deny rules: %w", err)
+	}
+	for _, r := range ranges {
+		rules := []ruleInfo{defaultDenyJumpRule(r)}
+		if i.logDrops {
+			rules = append(rules, dropLogRule(r))
+		}
+		i.defaultDenyRules[r.String()] = rulesCfg{
+			isIpv4:   r.IP.To4() != nil,
+			rulesMap: map[string][]ruleInfo{r.String(): append(rules, defaultDenyDropRule(r))},
+		}
+	}
+	for _, client := range i.clients() {
+		isIpv4 := client.Proto() == iptables.ProtocolIPv4
+		for _, rule := range i.defaultDenyJumps(isIpv4) {
+			if err := client.Insert(rule.table, rule.chain, 1, rule.rule...); err != nil {
+				return fmt.Errorf("failed to add rule %v: %w", rule.rule, err)
+			}
+		}
+		// the drop rules of default-deny networks go behind the rules allowing traffic, ahead of RETURN
+		closing := append(i.defaultDenyDrops(isIpv4), filterNmJumpRules[0])
+		for _, rule := range closing {
+			client.DeleteIfExists(rule.table, rule.chain, rule.rule...)
+		}
+		for _, rule := range closing {
+			if err := client.Append(rule.table, rule.chain, rule.rule...); err != nil {
+				return fmt.Errorf("failed to add rule %v: %w", rule.rule, err)
+			}
+		}
+		// the drop rules of blocked peers have to stay ahead of the jumps to the filter chain
+		if err := i.reinsertBlockRules(client, iptableFWDChain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iptablesManager.removeDefaultDenyRules - queues the removal of the rules of default-deny networks
+func (i *iptablesManager) removeDefaultDenyRules(batches iptablesBatches) {
+	for _, cfg := range i.defaultDenyRules {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).delete(rule)
+			}
+		}
+	}
+	i.defaultDenyRules = make(ruletable)
+}
+
+// iptablesManager.defaultDenyJumps - the FORWARD chain rules of the default-deny networks of the family
+func (i *iptablesManager) defaultDenyJumps(isIpv4 bool) []ruleInfo {
+	return i.defaultDenyRulesOf(isIpv4, iptableFWDChain)
+}
+
+// iptablesManager.defaultDenyDrops - the netmaker filter chain rules of the default-deny networks of the family,
+// each drop rule preceded by its LOG rule if drops are logged
+func (i *iptablesManager) defaultDenyDrops(isIpv4 bool) []ruleInfo {
+	return i.defaultDenyRulesOf(isIpv4, netmakerFilterChain)
+}
+
+// iptablesManager.defaultDenyRulesOf - the rules of the default-deny networks of the family in the chain,
+// sorted by range
+func (i *iptablesManager) defaultDenyRulesOf(isIpv4 bool, chain string) []ruleInfo {
+	keys := []string{}
+	for key, cfg := range i.defaultDenyRules {
+		if cfg.isIpv4 == isIpv4 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	rules := []ruleInfo{}
+	for _, key := range keys {
+		for _, rule := range i.defaultDenyRules[key].rulesMap[key] {
+			if rule.chain == chain {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules
+}
+
+// iptablesManager.reinsertDefaultDenyJumps - moves the FORWARD chain rules of default-deny networks back
+// ahead of the accept rules
+func (i *iptablesManager) reinsertDefaultDenyJumps(client iptablesAPI) error {
+	for _, rule := range i.defaultDenyJumps(client.Proto() == iptables.ProtocolIPv4) {
+		client.DeleteIfExists(rule.table, rule.chain, rule.rule...)
+		if err := client.Insert(rule.table, rule.chain, 1, rule.rule...); err != nil {
+			return fmt.Errorf("failed to reposition rule %v: %w", rule.rule, err)
+		}
+	}
+	return nil
+}
+
+// iptablesManager.SetOutboundOnly - replaces the rules of outbound only mode at the top of the INPUT chain,
+// below the drop rules of blocked peers
+func (i *iptablesManager) SetOutboundOnly(enabled bool, allowed []Port) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	i.removeInboundRules()
+	if !enabled {
+		return nil
+	}
+	i.inboundRules = outboundOnlyRules(allowed)
+	for _, client := range i.clients() {
+		// insert in reverse to keep the order of the rules at the top of the chain
+		for idx := len(i.inboundRules) - 1; idx >= 0; idx-- {
+			rule := i.inboundRules[idx]
+			if err := client.Insert(rule.table, rule.chain, 1, rule.rule...); err != nil {
+				return fmt.Errorf("failed to add %s rule %v: %w", iptablesProtoToString(client.Proto()), rule.rule, err)
+			}
+		}
+		if err := i.reinsertBlockRules(client, "INPUT"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iptablesManager.removeInboundRules - removes the rules of outbound only mode
+func (i *iptablesManager) removeInboundRules() {
+	for _, client := range i.clients() {
+		for _, rule := range i.inboundRules {
+			if err := client.DeleteIfExists(rule.table, rule.chain, rule.rule...); err != nil {
+				logger.Log(1, fmt.Sprintf("failed to delete rule: %v, Err: %s", rule.rule, err.Error()))
+			}
+		}
+	}
+	i.inboundRules = nil
+}
+
+// iptablesManager.SetAppMark - replaces the rules marking the traffic of the cgroup of application routing
+func (i *iptablesManager) SetAppMark(cgroupMatch []string, mark int) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	i.removeAppMarkRules()
+	if len(cgroupMatch) == 0 {
+		return nil
+	}
+	// only the low bits are the mark of application routing, the high bits are left to egress policies
+	markSpec := fmt.Sprintf("0x%x/0xffff", mark)
+	i.appMarkRules = []ruleInfo{
+		{
+			rule:  appendNetmakerCommentToRule(append(append([]string{}, cgroupMatch...), "-j", "MARK", "--set-xmark", markSpec)),
+			table: "mangle",
+			chain: "OUTPUT",
+		},
+		{
+			// the source address was chosen by the route lookup before the packet was marked
+			rule:  appendNetmakerCommentToRule([]string{"-o", ncutils.GetInterfaceName(), "-m", "mark", "--mark", markSpec, "-j", "MASQUERADE"}),
+			table: defaultNatTable,
+			chain: nattablePRTChain,
+		},
+	}
+	for _, client := range i.clients() {
+		for _, rule := range i.appMarkRules {
+			if err := client.Insert(rule.table, rule.chain, 1, rule.rule...); err != nil {
+				return fmt.Errorf("failed to add %s rule %v: %w", iptablesProtoToString(client.Proto()), rule.rule, err)
+			}
+		}
+	}
+	return nil
+}
+
+// iptablesManager.removeAppMarkRules - removes the rules of application routing
+func (i *iptablesManager) removeAppMarkRules() {
+	for _, client := range i.clients() {
+		for _, rule := range i.appMarkRules {
+			if err := client.DeleteIfExists(rule.table, rule.chain, rule.rule...); err != nil {
+				logger.Log(1, fmt.Sprintf("failed to delete rule: %v, Err: %s", rule.rule, err.Error()))
+			}
+		}
+	}
+	i.appMarkRules = nil
+}
+
+// iptablesManager.SetStaticNat - replaces the rules of the one-to-one nat of public addresses to ext clients,
+// inserted at the top of the nat chains ahead of the masquerade rules of egress ranges
+func (i *iptablesManager) SetStaticNat(mappings []StaticNat) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	batches := i.newBatches()
+	i.removeStaticNatRules(batches)
+	announced := make(map[string]string)
+	defer announceStaticNat(announced)
+	pending := make(map[string]string)
+	for _, m := range mappings {
+		iface, err := staticNatInterface(m.Public)
+		if err != nil {
+			batches.apply()
+			return err
+		}
+		isIpv4 := m.Public.To4() != nil
+		rules := staticNatRules(m, iface)
+		for _, rule := range rules {
+			batches.family(isIpv4).insert(rule)
+		}
+		i.staticNatRules[m.Public.String()] = rulesCfg{isIpv4: isIpv4, rulesMap: map[string][]ruleInfo{m.Mesh.String(): rules}}
+		pending[m.Public.String()] = iface
+	}
+	if err := batches.apply(); err != nil {
+		return fmt.Errorf("failed to update the rules of static nat: %w", err)
+	}
+	for addr, iface := range pending {
+		announced[addr] = iface
+	}
+	return nil
+}
+
+// iptablesManager.removeStaticNatRules - queues the removal of the rules of the one-to-one nat
+func (i *iptablesManager) removeStaticNatRules(batches iptablesBatches) {
+	for _, cfg := range i.staticNatRules {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				batches.family(cfg.isIpv4).delete(rule)
+			}
+		}
+	}
+	i.staticNatRules = make(ruletable)
+}
+
+// iptablesManager.SetPolicyQueue - replaces the rules queueing new connections from the mesh to the policy hook,
+// at the top of the INPUT and FORWARD chains below the drop rules of blocked peers
+func (i *iptablesManager) SetPolicyQueue(enabled bool, queue uint16, failOpen bool) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+	i.removePolicyQueueRules()
+	if !enabled {
+		return nil
+	}
+	i.policyQueueRules = policyQueueRules(queue, failOpen)
+	for _, client := range i.clients() {
+		for _, rule := range i.policyQueueRules {
+			if err := client.Insert(rule.table, rule.chain, 1, rule.rule...); err != nil {
+				return fmt.Errorf("failed to add %s rule %v: %w", iptablesProtoToString(client.Proto()), rule.rule, err)
+			}
+		}
+		for _, chain := range []string{"INPUT", iptableFWDChain} {
+			if err := i.reinsertBlockRules(client, chain); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// iptablesManager.removePolicyQueueRules - removes the rules of the policy hook
+func (i *iptablesManager) removePolicyQueueRules() {
+	for _, client := range i.clients() {
+		for _, rule := range i.policyQueueRules {
+			if err := client.DeleteIfExists(rule.table, rule.chain, rule.rule...); err != nil {
+				logger.Log(1, fmt.Sprintf("failed to delete rule: %v, Err: %s", rule.rule, err.Error()))
+			}
+		}
+	}
+	i.policyQueueRules = nil
+}
+
+// policyQueueRules - rules queueing the first packet of new connections from the mesh, without
+// failOpen packets are dropped while no one listens on the queue
+func policyQueueRules(queue uint16, failOpen bool) []ruleInfo {
+	spec := []string{"-i", ncutils.GetInterfaceName(), "-m", "conntrack", "--ctstate", "NEW",
+		"-j", "NFQUEUE", "--queue-num", strconv.Itoa(int(queue))}
+	if failOpen {
+		spec = append(spec, "--queue-bypass")
+	}
+	return []ruleInfo{
+		{rule: appendNetmakerCommentToRule(append([]string{}, spec...)), table: defaultIpTable, chain: "INPUT"},
+		{rule: appendNetmakerCommentToRule(append([]string{}, spec...)), table: defaultIpTable, chain: iptableFWDChain},
+	}
+}
+
+// staticNatRules - rules translating the public address of a mapping to the ext client and back,
+// iface is the interface of the public address
+func staticNatRules(m StaticNat, iface string) []ruleInfo {
+	return []ruleInfo{
+		{
+			rule:  appendNetmakerCommentToRule([]string{"-d", m.Public.String(), "-j", "DNAT", "--to-destination", m.Mesh.String()}),
+			table: defaultNatTable,
+			chain: "PREROUTING",
+		},
+		{
+			rule:  appendNetmakerCommentToRule([]string{"-s", m.Mesh.String(), "-o", iface, "-j", "SNAT", "--to-source", m.Public.String()}),
+			table: defaultNatTable,
+			chain: nattablePRTChain,
+		},
+	}
+}
+
+// outboundOnlyRules - INPUT chain rules accepting replies and the allowed ports from the mesh and
+// rejecting the rest, in order
+func outboundOnlyRules(allowed []Port) []ruleInfo {
+	iface := ncutils.GetInterfaceName()
+	rules := []ruleInfo{
+		{
+			rule:  appendNetmakerCommentToRule([]string{"-i", iface, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"}),
+			table: defaultIpTable,
+			chain: "INPUT",
+		},
+	}
+	for _, port := range allowed {
+		rules = append(rules, ruleInfo{
+			rule:  appendNetmakerCommentToRule([]string{"-i", iface, "-p", port.Protocol, "--dport", strconv.Itoa(port.Port), "-j", "ACCEPT"}),
+			table: defaultIpTable,
+			chain: "INPUT",
+		})
+	}
+	return append(rules, ruleInfo{
+		rule:  appendNetmakerCommentToRule([]string{"-i", iface, "-j", "REJECT"}),
+		table: defaultIpTable,
+		chain: "INPUT",
+	})
+}
+
+// peerBlockRules - rules dropping the traffic from and to an address of a blocked peer
+func peerBlockRules(addr string) []ruleInfo {
+	iface := ncutils.GetInterfaceName()
+	return []ruleInfo{
+		{
+			rule:  appendNetmakerCommentToRule([]string{"-i", iface, "-s", addr, "-j", "DROP"}),
+			table: defaultIpTable,
+			chain: "INPUT",
+		},
+		{
+			rule:  appendNetmakerCommentToRule([]string{"-o", iface, "-d", addr, "-j", "DROP"}),
+			table: defaultIpTable,
+			chain: "OUTPUT",
+		},
+		{
+			rule:  appendNetmakerCommentToRule([]string{"-i", iface, "-s", addr, "-j", "DROP"}),
+			table: defaultIpTable,
+			chain: iptableFWDChain,
+		},
+		{
+			rule:  appendNetmakerCommentToRule([]string{"-o", iface, "-d", addr, "-j", "DROP"}),
+			table: defaultIpTable,
+			chain: iptableFWDChain,
+		},
+	}
+}
+
+// interNetworkRuleInfo - FORWARD chain rule accepting or dropping traffic routed between the ranges of two networks
+func interNetworkRuleInfo(r InterNetworkRule) ruleInfo {
+	iface := ncutils.GetInterfaceName()
+	target := "DROP"
+	if r.Allow {
+		target = "ACCEPT"
+	}
+	return ruleInfo{
+		rule:  appendNetmakerCommentToRule([]string{"-i", iface, "-o", iface, "-s", r.Src.String(), "-d", r.Dst.String(), "-j", target}),
+		table: defaultIpTable,
+		chain: iptableFWDChain,
+	}
+}
+
+// egressMarkRules - mangle table rules marking the traffic of the family from the sources to the
+// destinations of the egress mark
+func egressMarkRules(m EgressMark, isIpv4 bool) []ruleInfo {
+	rules := []ruleInfo{}
+	for _, pair := range egressMarkPairs(m, isIpv4) {
+		for _, chain := range []string{"PREROUTING", "OUTPUT"} {
+			rules = append(rules, egressMarkRule(m, pair[0], *pair[1], chain))
+		}
+	}
+	return rules
+}
+
+// egressMarkPairs - the source and destination ranges of the family marked by the egress mark, a nil
+// source matches any source
+func egressMarkPairs(m EgressMark, isIpv4 bool) [][2]*net.IPNet {
+	sources := []*net.IPNet{}
+	for i := range m.Sources {
+		if (m.Sources[i].IP.To4() != nil) == isIpv4 {
+			sources = append(sources, &m.Sources[i])
+		}
+	}
+	if len(m.Sources) == 0 {
+		sources = append(sources, nil)
+	}
+	pairs := [][2]*net.IPNet{}
+	for i := range m.Destinations {
+		if (m.Destinations[i].IP.To4() != nil) != isIpv4 {
+			continue
+		}
+		for _, src := range sources {
+			pairs = append(pairs, [2]*net.IPNet{src, &m.Destinations[i]})
+		}
+	}
+	return pairs
+}
+
+// egressMarkRule - mangle table rule setting the bits of the mark of the egress policy on the traffic from
+// the source to the destination, keeping the other bits of the firewall mark
+func egressMarkRule(m EgressMark, src *net.IPNet, dst net.IPNet, chain string) ruleInfo {
+	match := []string{"-d", dst.String()}
+	if src != nil {
+		match = append(match, "-s", src.String())
+	}
+	return ruleInfo{
+		rule:  appendNetmakerCommentToRule(append(match, "-j", "MARK", "--set-xmark", fmt.Sprintf("0x%x/0x%x", m.Mark, m.Mask))),
+		table: "mangle",
+		chain: chain,
+	}
+}
+
+// rateLimitRules - mangle table rules dropping the traffic forwarded from and to the ext client above its
+// limits, the hashlimit tables are shared by the ext clients and keep a bucket per address
+func rateLimitRules(l RateLimit) []ruleInfo {
+	limits := [][2]string{}
+	if l.PacketsPerSecond > 0 {
+		limits = append(limits, [2]string{fmt.Sprintf("%d/sec", l.PacketsPerSecond), "nmext-pps"})
+	}
+	if l.KilobytesPerSecond > 0 {
+		limits = append(limits, [2]string{fmt.Sprintf("%dkb/s", l.KilobytesPerSecond), "nmext-kbs"})
+	}
+	iface := ncutils.GetInterfaceName()
+	rules := []ruleInfo{}
+	for _, limit := range limits {
+		for _, dir := range [][4]string{{"-i", "-s", "srcip", "-up"}, {"-o", "-d", "dstip", "-dn"}} {
+			rules = append(rules, ruleInfo{
+				rule: appendNetmakerCommentToRule([]string{dir[0], iface, dir[1], l.Addr.String(), "-m", "hashlimit",
+					"--hashlimit-above", limit[0], "--hashlimit-mode", dir[2], "--hashlimit-name", limit[1] + dir[3], "-j", "DROP"}),
+				table: "mangle",
+				chain: "FORWARD",
+			})
+		}
+	}
+	return rules
+}
+
+// defaultDenyJumpRule - FORWARD chain rule sending the traffic of the range leaving the mesh through the
+// netmaker filter chain
+func defaultDenyJumpRule(r net.IPNet) ruleInfo {
+	iface := ncutils.GetInterfaceName()
+	return ruleInfo{
+		rule:  appendNetmakerCommentToRule([]string{"-s", r.String(), "-i", iface, "!", "-o", iface, "-j", netmakerFilterChain}),
+		table: defaultIpTable,
+		chain: iptableFWDChain,
+	}
+}
+
+// defaultDenyDropRule - netmaker filter chain rule dropping the traffic of the range leaving the mesh which
+// was not accepted ahead of it
+func defaultDenyDropRule(r net.IPNet) ruleInfo {
+	iface := ncutils.GetInterfaceName()
+	return ruleInfo{
+		rule:  appendNetmakerCommentToRule([]string{"-s", r.String(), "-i", iface, "!", "-o", iface, "-j", "DROP"}),
+		table: defaultIpTable,
+		chain: netmakerFilterChain,
+	}
+}
+
+// dropLogRule - netmaker filter chain rule logging the traffic of the range dropped by the following
+// default-deny rule, rate limited
+func dropLogRule(r net.IPNet) ruleInfo {
+	return dropLogRuleOf(defaultDenyDropRule(r))
+}
+
+// dropLogRuleOf - rule logging the traffic dropped by the drop rule, rate limited, with the matches of the
+// drop rule
+func dropLogRuleOf(drop ruleInfo) ruleInfo {
+	spec := []string{}
+	for j := 0; j < len(drop.rule); j++ {
+		if drop.rule[j] == "-j" && j+1 < len(drop.rule) && drop.rule[j+1] == "DROP" {
+			spec = append(spec, "-m", "limit", "--limit", fmt.Sprintf("%d/min", dropLogRate), "--limit-burst", strconv.Itoa(dropLogBurst),
+				"-j", "LOG", "--log-prefix", dropLogPrefix)
+			j++
+			continue
+		}
+		spec = append(spec, drop.rule[j])
+	}
+	return ruleInfo{rule: spec, table: drop.table, chain: drop.chain}
+}
+
+// isDropRule - checks if the target of the rule is DROP
+func isDropRule(rule ruleInfo) bool {
+	for j := 0; j+1 < len(rule.rule); j++ {
+		if rule.rule[j] == "-j" && rule.rule[j+1] == "DROP" {
+			return true
+		}
+	}
+	return false
+}
+
+// interNetworkRulesOf - the rules of inter-network routing of a rule table of inter-network rules, without
+// the rules accepting replies
+func interNetworkRulesOf(rules ruletable) []InterNetworkRule {
+	interNetworkRules := []InterNetworkRule{}
+	for key, cfg := range rules {
+		src, dst, ok := strings.Cut(key, ">")
+		if !ok {
+			continue
+		}
+		allow := true
+		for _, peerRules := range cfg.rulesMap {
+			for _, rule := range peerRules {
+				if isDropRule(rule) {
+					allow = false
+				}
+			}
+		}
+		interNetworkRules = append(interNetworkRules, InterNetworkRule{Src: toIPNet(src), Dst: toIPNet(dst), Allow: allow})
+	}
+	return interNetworkRules
+}
+
+// isDropLogRule - checks if the rule logs dropped packets
+func isDropLogRule(rule ruleInfo) bool {
+	for _, arg := range rule.rule {
+		if arg == "--log-prefix" {
+			return true
+		}
+	}
+	return false
+}
+
+// mssClampRule - mangle table rule clamping the MSS of tcp connections forwarded to the range over the
+// netmaker interface to the path mtu
+func mssClampRule(r net.IPNet) ruleInfo {
+	return ruleInfo{
+		rule: appendNetmakerCommentToRule([]string{"-o", ncutils.GetInterfaceName(), "-d", r.String(), "-p", "tcp",
+			"--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu"}),
+		table: "mangle",
+		chain: "FORWARD",
+	}
+}
+
+// interNetworkReplyRule - FORWARD chain rule accepting the replies of allowed inter-network connections
+func interNetworkReplyRule() ruleInfo {
+	iface := ncutils.GetInterfaceName()
+	return ruleInfo{
+		rule:  appendNetmakerCommentToRule([]string{"-i", iface, "-o", iface, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"}),
+		table: defaultIpTable,
+		chain: iptableFWDChain,
+	}
+}
+
+// iptablesManager.FlushAll - removes all the rules added by netmaker and deletes the netmaker chains,
+// it runs regardless of ctx as it cleans up on shutdown
 func (i *iptablesManager) FlushAll() {
 	i.mux.Lock()
 	defer i.mux.Unlock()
+	defer i.saveRuleState()
+	batches := i.newBatches()
+	i.unblockPeers(batches)
+	i.removeInterNetworkRules(batches)
+	i.removeMSSClampRules(batches)
+	i.removeEgressMarkRules(batches)
+	i.removeRateLimitRules(batches, "")
+	i.removeDefaultDenyRules(batches)
+	i.removeStaticNatRules(batches)
+	i.removeGatewayRules(batches)
+	if err := batches.apply(); err != nil {
+		logger.Log(1, "failed to delete rules: ", err.Error())
+	}
+	i.removeInboundRules()
+	i.removeAppMarkRules()
+	announceStaticNat(nil)
+	i.removePolicyQueueRules()
 	// remove jump rules
 	i.removeJumpRules()
+	for _, client := range i.clients() {
+		removeDockerUserRules(client)
+	}
 	i.cleanup(defaultIpTable, netmakerFilterChain)
 	i.cleanup(defaultNatTable, netmakerNatChain)
 }
 
+// iptablesManager.clients - the clients of the address families available on the host
+func (i *iptablesManager) clients() []iptablesAPI {
+	clients := []iptablesAPI{}
+	for _, client := range []iptablesAPI{i.ipv4Client, i.ipv6Client} {
+		if client != nil {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// iptablesManager.client - the client of an address family, nil if its iptables binary is missing
+// and the family is skipped
+func (i *iptablesManager) client(isIpv4 bool) iptablesAPI {
+	if isIpv4 {
+		return i.ipv4Client
+	}
+	return i.ipv6Client
+}
+
 func iptablesProtoToString(proto iptables.Protocol) string {
 	if proto == iptables.ProtocolIPv6 {
 		return ipv6
@@ -497,6 +1920,16 @@ func iptablesProtoToString(proto iptables.Protocol) string {
 }
 
 func appendNetmakerCommentToRule(ruleSpec []string) []string {
-	ruleSpec = append(ruleSpec, "-m", "comment", "--comment", netmakerSignature)
-	return ruleSpec
+	return appendCommentToRule(ruleSpec, netmakerSignature)
+}
+
+// appendCommentToRule - tags a rule with a comment
+func appendCommentToRule(ruleSpec []string, comment string) []string {
+	return append(ruleSpec, "-m", "comment", "--comment", comment)
+}
+
+// ruleComment - comment tagging the rules of a peer, or of the ranges of an egress gateway, of a server,
+// it tells the rules of netclient apart in the builtin chains and finds the orphaned ones
+func ruleComment(server, peer string) string {
+	return netmakerCommentPrefix + server + "-" + peer
 }
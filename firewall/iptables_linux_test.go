@@ -0,0 +1,358 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/gravitl/netclient/config"
+)
+
+func newTestIptablesManager() *iptablesManager {
+	return &iptablesManager{
+		ctx:          context.Background(),
+		ingRules:     make(serverrulestable),
+		engressRules: make(serverrulestable),
+		blockRules:   make(ruletable),
+	}
+}
+
+// newTestDryRunManager - a dry run manager of both address families with the netmaker chains created
+func newTestDryRunManager(t *testing.T) *dryRunManager {
+	t.Helper()
+	m := &dryRunManager{iptablesManager: newTestIptablesManager()}
+	m.ipv4Client = newDryRunIPTables(iptables.ProtocolIPv4)
+	m.ipv6Client = newDryRunIPTables(iptables.ProtocolIPv6)
+	if err := m.CreateChains(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func testRuleTable(peer string) ruletable {
+	return ruletable{
+		peer: rulesCfg{
+			isIpv4:   true,
+			rulesMap: map[string][]ruleInfo{},
+		},
+	}
+}
+
+func TestFetchRuleTableReturnsCopy(t *testing.T) {
+	i := newTestIptablesManager()
+	i.SaveRules("server", egressTable, testRuleTable("gw"))
+	fetched := i.FetchRuleTable("server", egressTable)
+	fetched["gw"].rulesMap["peer"] = []ruleInfo{{table: defaultIpTable, chain: netmakerFilterChain}}
+	delete(fetched, "gw")
+	stored := i.FetchRuleTable("server", egressTable)
+	if _, ok := stored["gw"]; !ok {
+		t.Fatal("deleting from a fetched table changed the stored table")
+	}
+	if len(stored["gw"].rulesMap) != 0 {
+		t.Fatal("adding to a fetched table changed the stored table")
+	}
+}
+
+func TestRuleTableConcurrentAccess(t *testing.T) {
+	i := newTestIptablesManager()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg := sync.WaitGroup{}
+		for n := 0; n < 20; n++ {
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				server := fmt.Sprintf("server%d", n%3)
+				for j := 0; j < 100; j++ {
+					i.SaveRules(server, egressTable, testRuleTable("gw"))
+					for range i.FetchRuleTable(server, egressTable) {
+					}
+					_ = i.RemoveRoutingRules(server, egressTable, "missing")
+					_ = i.DeleteRoutingRule(server, egressTable, "gw", "missing")
+					i.CleanRoutingRules(server, ingressTable)
+					i.DeleteRuleTable(server, egressTable)
+				}
+			}(n)
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 30):
+		t.Fatal("rule table operations deadlocked")
+	}
+}
+
+func TestBatchRestoreInput(t *testing.T) {
+	b := &iptablesBatch{}
+	b.delete(ruleInfo{table: defaultIpTable, chain: "INPUT", rule: []string{"-s", "10.0.0.2", "-j", "DROP"}})
+	b.insert(ruleInfo{table: defaultNatTable, chain: nattablePRTChain, rule: []string{"-j", "MASQUERADE"}})
+	b.insert(ruleInfo{table: defaultIpTable, chain: "INPUT", rule: []string{"-m", "comment", "--comment", "a b", "-j", "DROP"}})
+	want := "*filter\n-D INPUT -s 10.0.0.2 -j DROP\n-I INPUT 1 -m comment --comment \"a b\" -j DROP\nCOMMIT\n" +
+		"*nat\n-I POSTROUTING 1 -j MASQUERADE\nCOMMIT\n"
+	if got := b.restoreInput(); got != want {
+		t.Fatalf("restoreInput() = %q, want %q", got, want)
+	}
+}
+
+func TestRuleComments(t *testing.T) {
+	comment := ruleComment("netmaker.example.com", "kfz0u5yZc0JEzRqGxH0bXFXt3ZlJ0c/Q9IPbXZ3Cr2o=")
+	listed := "-A POSTROUTING -s 10.0.0.2/32 -m comment --comment \"" + comment + "\" -j ACCEPT"
+	if got := commentOf(listed); got != comment {
+		t.Fatalf("commentOf() = %q, want %q", got, comment)
+	}
+	if !addedByNetmaker(listed) || !addedByNetmaker("-A FORWARD -i netmaker -m comment --comment NETMAKER -j ACCEPT") {
+		t.Fatal("tagged rules not recognized as netmaker rules")
+	}
+	if addedByNetmaker("-A FORWARD -i docker0 -j ACCEPT") {
+		t.Fatal("untagged rule recognized as netmaker rule")
+	}
+	want := strings.Join(appendCommentToRule([]string{"-s", "10.0.0.2/32"}, comment), " ") + " -j ACCEPT"
+	if got := strings.Join(ruleSpecOf(listed), " "); got != want {
+		t.Fatalf("ruleSpecOf() = %q, want %q", got, want)
+	}
+}
+
+func TestDryRunRules(t *testing.T) {
+	m := newTestDryRunManager(t)
+	if err := m.ForwardRule(); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, rule := range m.preview() {
+		if rule.Family == ipv4 && rule.Table == defaultIpTable && rule.Chain == iptableFWDChain &&
+			rule.Rule == strings.Join(forwardAcceptRules()[0], " ") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("forward accept rule missing from the preview: %v", m.preview())
+	}
+	if issues, err := m.VerifyChains(); err != nil || len(issues) > 0 {
+		t.Fatalf("VerifyChains() = %v, %v, want no issues", issues, err)
+	}
+}
+
+func TestChainNames(t *testing.T) {
+	setChainNames(config.FirewallChains{Filter: "nmfilter", Nat: "nmnat", Forward: dockerUserChain}, true)
+	defer setChainNames(config.FirewallChains{}, true)
+	m := newTestDryRunManager(t)
+	if err := m.ForwardRule(); err != nil {
+		t.Fatal(err)
+	}
+	chains := map[string]bool{}
+	for _, rule := range m.preview() {
+		chains[rule.Chain] = true
+	}
+	for _, chain := range []string{"nmfilter", "nmnat", dockerUserChain} {
+		if !chains[chain] {
+			t.Errorf("no rules in chain %s: %v", chain, m.preview())
+		}
+	}
+	if chains[config.DefaultFilterChain] || chains[config.DefaultForwardChain] {
+		t.Errorf("rules left in the default chains: %v", m.preview())
+	}
+	if err := (config.FirewallChains{Filter: "FORWARD"}).Validate(); err == nil {
+		t.Error("Validate() accepted a builtin chain as netmaker chain")
+	}
+}
+
+func TestSingleStack(t *testing.T) {
+	m := &dryRunManager{iptablesManager: newTestIptablesManager()}
+	m.ipv4Client = newDryRunIPTables(iptables.ProtocolIPv4)
+	if err := m.CreateChains(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ForwardRule(); err != nil {
+		t.Fatal(err)
+	}
+	_, ipv6Net, _ := net.ParseCIDR("fd00::5/128")
+	if err := m.BlockPeers(map[string][]net.IPNet{"peer": {*ipv6Net}}); err != nil {
+		t.Fatal(err)
+	}
+	if issues, err := m.VerifyChains(); err != nil || len(issues) > 0 {
+		t.Fatalf("VerifyChains() = %v, %v, want no issues", issues, err)
+	}
+	for _, rule := range m.preview() {
+		if rule.Family != ipv4 {
+			t.Fatalf("rule of the missing family in the preview: %v", rule)
+		}
+	}
+	m.FlushAll()
+}
+
+func TestInterNetworkRules(t *testing.T) {
+	m := newTestDryRunManager(t)
+	_, a, _ := net.ParseCIDR("10.10.0.0/16")
+	_, b, _ := net.ParseCIDR("10.20.0.0/16")
+	rules := []InterNetworkRule{{Src: *a, Dst: *b, Allow: true}, {Src: *b, Dst: *a}}
+	if err := m.SetInterNetworkRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	listed, _ := m.ipv4Client.List(defaultIpTable, iptableFWDChain)
+	if len(listed) < 4 || !strings.Contains(listed[1], "ESTABLISHED,RELATED") {
+		t.Fatalf("forward chain = %v, want the reply rule first", listed)
+	}
+	if issues, err := m.removeOrphanedRules(m.ipv4Client); err != nil || len(issues) > 0 {
+		t.Fatalf("removeOrphanedRules() = %v, %v, want the inter-network rules tracked", issues, err)
+	}
+	if got := len(m.ListRules()); got != 3 {
+		t.Fatalf("ListRules() listed %d rules, want 3", got)
+	}
+	if err := m.SetInterNetworkRules(nil); err != nil {
+		t.Fatal(err)
+	}
+	remaining, _ := m.ipv4Client.List(defaultIpTable, iptableFWDChain)
+	for _, r := range remaining {
+		if strings.Contains(r, "ESTABLISHED,RELATED") || strings.Contains(r, b.String()) {
+			t.Fatalf("forward chain = %v, want the inter-network rules removed", remaining)
+		}
+	}
+}
+
+func TestEgressMarkRules(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	_, dst4, _ := net.ParseCIDR("10.50.0.0/16")
+	_, dst6, _ := net.ParseCIDR("fd00:50::/64")
+	m := EgressMark{Sources: []net.IPNet{*lan}, Destinations: []net.IPNet{*dst4, *dst6}, Mark: 0x10000, Mask: 0xff0000}
+	rules := egressMarkRules(m, true)
+	if len(rules) != 2 || rules[0].chain != "PREROUTING" || rules[1].chain != "OUTPUT" {
+		t.Fatalf("egressMarkRules() = %v, want a PREROUTING and an OUTPUT rule", rules)
+	}
+	spec := strings.Join(rules[0].rule, " ")
+	if !strings.Contains(spec, "-d 10.50.0.0/16 -s 192.168.1.0/24") || !strings.Contains(spec, "--set-xmark 0x10000/0xff0000") {
+		t.Fatalf("rule = %s, want the source, destination and mark matched", spec)
+	}
+	if rules := egressMarkRules(m, false); len(rules) != 0 {
+		t.Fatalf("egressMarkRules() = %v, want no ipv6 rules for ipv4 sources", rules)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	m := newTestDryRunManager(t)
+	for server, addr := range map[string]string{"a": "10.10.0.20/32", "b": "10.20.0.20/32"} {
+		_, cidr, _ := net.ParseCIDR(addr)
+		if err := m.SetRateLimits(server, []RateLimit{{Addr: *cidr, PacketsPerSecond: 500}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listed, _ := m.ipv4Client.List("mangle", "FORWARD")
+	if got := strings.Count(strings.Join(listed, "\n"), "--hashlimit-above 500/sec"); got != 4 {
+		t.Fatalf("mangle FORWARD = %v, want the up and down rules of both ext clients", listed)
+	}
+	if err := m.SetRateLimits("a", nil); err != nil {
+		t.Fatal(err)
+	}
+	listed, _ = m.ipv4Client.List("mangle", "FORWARD")
+	if rules := strings.Join(listed, "\n"); strings.Contains(rules, "10.10.0.20") || !strings.Contains(rules, "10.20.0.20") {
+		t.Fatalf("mangle FORWARD = %v, want only the rules of server b kept", listed)
+	}
+}
+
+func TestDefaultDeny(t *testing.T) {
+	m := newTestDryRunManager(t)
+	_, r, _ := net.ParseCIDR("10.10.0.0/16")
+	if err := m.SetDefaultDeny([]net.IPNet{*r}); err != nil {
+		t.Fatal(err)
+	}
+	tail := func() []string {
+		listed, _ := m.ipv4Client.List(defaultIpTable, netmakerFilterChain)
+		return listed[len(listed)-2:]
+	}
+	if got := tail(); !strings.Contains(got[0], "-s 10.10.0.0/16") || !strings.Contains(got[0], "-j DROP") ||
+		!strings.Contains(got[1], "-j RETURN") {
+		t.Fatalf("filter chain ends with %v, want the drop rule ahead of RETURN", got)
+	}
+	forward, _ := m.ipv4Client.List(defaultIpTable, iptableFWDChain)
+	if !strings.Contains(strings.Join(forward, "\n"), "-s 10.10.0.0/16 -i netmaker ! -o netmaker -j "+netmakerFilterChain) {
+		t.Fatalf("forward chain = %v, want the jump of the default-deny network", forward)
+	}
+	drop := defaultDenyDropRule(*r)
+	if err := m.ipv4Client.Delete(drop.table, drop.chain, drop.rule...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.reconcileRules(m.ipv4Client); err != nil {
+		t.Fatal(err)
+	}
+	if got := tail(); !strings.Contains(got[0], "-j DROP") || !strings.Contains(got[1], "-j RETURN") {
+		t.Fatalf("filter chain ends with %v after reconciling, want the drop rule restored ahead of RETURN", got)
+	}
+	if err := m.SetDropLogging(true); err != nil {
+		t.Fatal(err)
+	}
+	listed, _ := m.ipv4Client.List(defaultIpTable, netmakerFilterChain)
+	if got := listed[len(listed)-3:]; !strings.Contains(got[0], "-j LOG --log-prefix "+dropLogPrefix) ||
+		!strings.Contains(got[1], "-j DROP") {
+		t.Fatalf("filter chain ends with %v, want the log rule ahead of the drop rule", got)
+	}
+	if err := m.SetDropLogging(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := tail(); strings.Contains(strings.Join(got, "\n"), "-j LOG") {
+		t.Fatalf("filter chain ends with %v, want the log rule removed", got)
+	}
+	if err := m.SetDefaultDeny(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := tail(); strings.Contains(got[0], "-j DROP") {
+		t.Fatalf("filter chain ends with %v, want the drop rule removed", got)
+	}
+}
+
+func TestDropLoggingOfBlockAndInterNetworkRules(t *testing.T) {
+	m := newTestDryRunManager(t)
+	_, peer, _ := net.ParseCIDR("10.10.0.5/32")
+	_, src, _ := net.ParseCIDR("10.10.0.0/16")
+	_, dst, _ := net.ParseCIDR("10.20.0.0/16")
+	if err := m.BlockPeers(map[string][]net.IPNet{"peer": {*peer}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetInterNetworkRules([]InterNetworkRule{{Src: *src, Dst: *dst}, {Src: *dst, Dst: *src, Allow: true}}); err != nil {
+		t.Fatal(err)
+	}
+	// the log rule of each drop rule is the rule right above it
+	logsAhead := func(chain string) bool {
+		listed, _ := m.ipv4Client.List(defaultIpTable, chain)
+		drops := 0
+		for idx, rule := range listed {
+			if !strings.Contains(rule, "-j DROP") {
+				continue
+			}
+			drops++
+			if idx == 0 || !strings.Contains(listed[idx-1], "-j LOG --log-prefix "+dropLogPrefix) {
+				return false
+			}
+		}
+		return drops > 0
+	}
+	if err := m.SetDropLogging(true); err != nil {
+		t.Fatal(err)
+	}
+	for _, chain := range []string{"INPUT", "OUTPUT", iptableFWDChain} {
+		if !logsAhead(chain) {
+			listed, _ := m.ipv4Client.List(defaultIpTable, chain)
+			t.Fatalf("%s chain = %v, want a log rule ahead of each drop rule", chain, listed)
+		}
+	}
+	forward, _ := m.ipv4Client.List(defaultIpTable, iptableFWDChain)
+	if rules := strings.Join(forward, "\n"); strings.Count(rules, "-j LOG") != 3 || !strings.Contains(rules, "-s 10.20.0.0/16 -d 10.10.0.0/16 -j ACCEPT") {
+		t.Fatalf("forward chain = %v, want the log rules of the blocked peer and the denied network only", forward)
+	}
+	if err := m.SetDropLogging(false); err != nil {
+		t.Fatal(err)
+	}
+	for _, chain := range []string{"INPUT", "OUTPUT", iptableFWDChain} {
+		if listed, _ := m.ipv4Client.List(defaultIpTable, chain); strings.Contains(strings.Join(listed, "\n"), "-j LOG") {
+			t.Fatalf("%s chain = %v, want the log rules removed", chain, listed)
+		}
+	}
+	if rules := interNetworkRulesOf(m.interNetworkRules); len(rules) != 2 {
+		t.Fatalf("inter-network rules = %v, want both rules kept", rules)
+	}
+}
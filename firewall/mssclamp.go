@@ -0,0 +1,25 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+)
+
+// mssClampTable - rule table of the rules clamping the MSS of tcp connections, keyed by range
+const mssClampTable = "mssclamp"
+
+// appliedMSSClamp - the ranges of the MSS clamping rules last applied
+var appliedMSSClamp appliedState[map[string]bool]
+
+// SetMSSClamp - clamps the MSS of the tcp connections forwarded through the netmaker interface to the
+// ranges to the path mtu, so clients behind a gateway do not run into PMTU blackholes; nil removes it,
+// the rules are only replaced when the ranges changed
+func SetMSSClamp(ranges []net.IPNet) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	_, err := appliedMSSClamp.apply(rangeSet(ranges), func() error {
+		return fwCrtl.SetMSSClamp(ranges)
+	})
+	return err
+}
@@ -0,0 +1,591 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// netshRulePrefix - prefix of the names of the windows firewall rules added by netmaker
+	netshRulePrefix = "netmaker-"
+	// netshTable - table of the rule infos of windows firewall rules, their chain holds the rule name
+	netshTable = "advfirewall"
+)
+
+// netshManager - manages the netmaker rules of windows defender firewall with netsh advfirewall,
+// keeping the same rule tables as the linux managers. The windows firewall filters the traffic of
+// the host only, forwarded traffic of gateways is not filtered; egress ranges are masqueraded with
+// WinNAT networks kept in the egress table.
+type netshManager struct {
+	ctx          context.Context
+	ingRules     serverrulestable
+	engressRules serverrulestable
+	// blockRules - block rules of the locally blocked peers, keyed by peer and address
+	blockRules ruletable
+	// inboundRules - inbound block rules of outbound only mode
+	inboundRules []ruleInfo
+	mux          sync.Mutex
+}
+
+// netshManager.CreateChains - removes netmaker rules and nat networks left behind by a previous run,
+// windows firewall rules are not grouped in chains
+func (n *netshManager) CreateChains() error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	names, err := listNetshRules()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := deleteNetshRule(name); err != nil {
+			logger.Log(1, "failed to delete stale firewall rule", name, err.Error())
+		}
+	}
+	nats, err := listWinNats()
+	if err != nil {
+		// WinNAT is missing on older windows versions
+		logger.Log(1, err.Error())
+		return nil
+	}
+	for _, name := range nats {
+		if err := removeWinNat(name); err != nil {
+			logger.Log(1, "failed to delete stale nat network", name, err.Error())
+		}
+	}
+	return nil
+}
+
+// netshManager.ForwardRule - forwarding is enabled per interface on windows, no rule is needed
+func (n *netshManager) ForwardRule() error {
+	return nil
+}
+
+// netshManager.VerifyChains - checks that the netmaker rules still exist and restores removed ones
+func (n *netshManager) VerifyChains() ([]string, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	names, err := listNetshRules()
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+	}
+	issues := []string{}
+	natsListed := false
+	for _, rule := range n.rules() {
+		if rule.table == winNatTable && !natsListed {
+			nats, err := listWinNats()
+			if err != nil {
+				return issues, err
+			}
+			for _, name := range nats {
+				present[name] = true
+			}
+			natsListed = true
+		}
+		if present[rule.chain] {
+			continue
+		}
+		if rule.table == winNatTable {
+			issues = append(issues, "nat network "+rule.chain+" was removed")
+			if err := addWinNat(rule); err != nil {
+				return issues, fmt.Errorf("failed to restore nat network %s: %w", rule.chain, err)
+			}
+			continue
+		}
+		issues = append(issues, "firewall rule "+rule.chain+" was removed")
+		if err := addNetshRule(rule); err != nil {
+			return issues, fmt.Errorf("failed to restore firewall rule %s: %w", rule.chain, err)
+		}
+	}
+	return issues, nil
+}
+
+// netshManager.InsertEgressRoutingRules - masquerades the traffic of the network of the egress gateway to
+// its ipv4 egress ranges with a WinNAT network, which translates to the address of the outgoing interface
+func (n *netshManager) InsertEgressRoutingRules(server string, egressInfo models.EgressInfo) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	isIpv4 := egressInfo.EgressGwAddr.IP.To4() != nil
+	natRanges := []string{}
+	for _, egressRange := range egressInfo.EgressGWCfg.Ranges {
+		nat := egressNat(egressRange, egressInfo.EgressGWCfg.NatEnabled == "yes")
+		switch {
+		case nat.Mode == EgressNatRouted || isAddrIpv4(egressRange) != isIpv4:
+			continue
+		case !isIpv4:
+			slog.Warn("WinNAT only translates ipv4, the range is routed", "range", egressRange)
+			continue
+		case nat.Mode == EgressNatSNAT:
+			slog.Warn("WinNAT translates to the address of the outgoing interface, the snat source is ignored", "range", egressRange, "source", nat.Source)
+		}
+		natRanges = append(natRanges, egressRange)
+	}
+	ruleTable := n.ruleTable(server, egressTable)
+	if cfg, ok := ruleTable[egressInfo.EgressID]; ok {
+		for _, rule := range cfg.rulesMap[egressInfo.EgressID] {
+			if err := deleteRule(rule); err != nil {
+				logger.Log(1, "failed to delete nat network", rule.chain, err.Error())
+			}
+		}
+	}
+	// the ranges are recorded without rules, a single nat network translates all of them
+	rulesMap := map[string][]ruleInfo{egressInfo.EgressID: {}}
+	for _, egressRange := range egressInfo.EgressGWCfg.Ranges {
+		rulesMap[egressRangeKey(egressRange)] = []ruleInfo{}
+	}
+	ruleTable[egressInfo.EgressID] = rulesCfg{
+		isIpv4:   isIpv4,
+		network:  egressNetwork(egressInfo),
+		rulesMap: rulesMap,
+	}
+	if len(natRanges) == 0 {
+		return nil
+	}
+	rule := winNatRule(egressInfo.Network, natRanges)
+	if err := addWinNat(rule); err != nil {
+		return err
+	}
+	ruleTable[egressInfo.EgressID].rulesMap[egressInfo.EgressID] = []ruleInfo{rule}
+	return nil
+}
+
+// netshManager.RemoveRoutingRules - removes the rules of a gateway from a rule table
+func (n *netshManager) RemoveRoutingRules(server, ruletableName, peerKey string) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := n.ruleTable(server, ruletableName)
+	if _, ok := rulesTable[peerKey]; !ok {
+		return errors.New("peer not found in rule table: " + peerKey)
+	}
+	for _, rules := range rulesTable[peerKey].rulesMap {
+		for _, rule := range rules {
+			if err := deleteRule(rule); err != nil {
+				return fmt.Errorf("netsh: error while removing rule %s for %s: %v", rule.chain, peerKey, err)
+			}
+		}
+	}
+	delete(rulesTable, peerKey)
+	return nil
+}
+
+// netshManager.DeleteRoutingRule - removes the rules of a peer on a gateway
+func (n *netshManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, dstPeerKey string) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := n.ruleTable(server, ruletableName)
+	if _, ok := rulesTable[srcPeerKey]; !ok {
+		return errors.New("peer not found in rule table: " + srcPeerKey)
+	}
+	rules, ok := rulesTable[srcPeerKey].rulesMap[dstPeerKey]
+	if !ok {
+		return errors.New("rules not found for: " + dstPeerKey)
+	}
+	for _, rule := range rules {
+		if err := deleteRule(rule); err != nil {
+			return fmt.Errorf("netsh: error while removing rule %s for %s: %v", rule.chain, srcPeerKey, err)
+		}
+	}
+	delete(rulesTable[srcPeerKey].rulesMap, dstPeerKey)
+	return nil
+}
+
+// netshManager.CleanRoutingRules - removes all the rules of a rule table of a server
+func (n *netshManager) CleanRoutingRules(server, ruleTableName string) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	for _, cfg := range n.ruleTable(server, ruleTableName) {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				if err := deleteRule(rule); err != nil {
+					logger.Log(1, "failed to delete firewall rule", rule.chain, err.Error())
+				}
+			}
+		}
+	}
+	n.deleteRuleTable(server, ruleTableName)
+}
+
+// netshManager.FetchRuleTable - fetches a copy of the rule table by table name
+func (n *netshManager) FetchRuleTable(server string, tableName string) ruletable {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return n.ruleTable(server, tableName).copy()
+}
+
+// netshManager.ListRules - lists the rules of all rule tables
+func (n *netshManager) ListRules() []ManagedRule {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return listManagedRules(n.ingRules, n.engressRules, n.blockRules, nil)
+}
+
+// netshManager.DeleteRuleTable - deletes a rule table
+func (n *netshManager) DeleteRuleTable(server, ruleTableName string) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.deleteRuleTable(server, ruleTableName)
+}
+
+// netshManager.SaveRules - saves the rule table by table name
+func (n *netshManager) SaveRules(server, tableName string, rules ruletable) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	switch tableName {
+	case ingressTable:
+		n.ingRules[server] = rules.copy()
+	case egressTable:
+		n.engressRules[server] = rules.copy()
+	case blockTable:
+		n.blockRules = rules.copy()
+	}
+}
+
+// netshManager.BlockPeers - replaces the block rules of the locally blocked peers, block rules take
+// precedence over allow rules in the windows firewall
+func (n *netshManager) BlockPeers(peers map[string][]net.IPNet) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	wanted, added, removed := diffBlockRules(n.blockRules, peers, func(peerKey string, addr net.IPNet) []ruleInfo {
+		rules := []ruleInfo{}
+		for _, dir := range []string{"in", "out"} {
+			rules = append(rules, netshRule("block-"+shortHash(peerKey+addr.String())+"-"+dir, "dir="+dir, "action=block",
+				"remoteip="+addr.String()))
+		}
+		return rules
+	})
+	deleteBlockRules(removed)
+	var err error
+	n.blockRules, err = addBlockRules(wanted, added, addNetshRule)
+	return err
+}
+
+// netshManager.SetOutboundOnly - replaces the rules blocking inbound connections from the netmaker networks
+// to ports other than the allowed ones, replies to connections of the host pass as the firewall is stateful
+func (n *netshManager) SetOutboundOnly(enabled bool, allowed []Port) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	n.removeInboundRules()
+	if !enabled {
+		return nil
+	}
+	ranges := []string{}
+	for _, node := range config.GetNodes() {
+		for _, network := range []net.IPNet{node.NetworkRange, node.NetworkRange6} {
+			if network.IP != nil {
+				ranges = append(ranges, network.String())
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	remote := "remoteip=" + strings.Join(ranges, ",")
+	rules := []ruleInfo{
+		netshRule("outbound-only-icmpv4", "dir=in", "action=block", "protocol=icmpv4", remote),
+		netshRule("outbound-only-icmpv6", "dir=in", "action=block", "protocol=icmpv6", remote),
+	}
+	for _, protocol := range []string{"tcp", "udp"} {
+		if blocked := blockedPortRanges(allowed, protocol); blocked != "" {
+			rules = append(rules, netshRule("outbound-only-"+protocol, "dir=in", "action=block",
+				"protocol="+protocol, "localport="+blocked, remote))
+		}
+	}
+	for _, rule := range rules {
+		if err := addNetshRule(rule); err != nil {
+			return fmt.Errorf("failed to add rule %s: %w", rule.chain, err)
+		}
+		n.inboundRules = append(n.inboundRules, rule)
+	}
+	return nil
+}
+
+// netshManager.SetAppMark - application routing relies on cgroups, not available on windows
+func (n *netshManager) SetAppMark(cgroupMatch []string, mark int) error {
+	if len(cgroupMatch) == 0 {
+		return nil
+	}
+	return errors.New("application routing is not supported on windows")
+}
+
+// netshManager.SetStaticNat - one-to-one nat of ext clients is only available on linux
+func (n *netshManager) SetStaticNat(mappings []StaticNat) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+	return errors.New("static nat of ext clients is not supported with windows")
+}
+
+// netshManager.SetPolicyQueue - the policy hook relies on nfqueue, only available on linux
+func (n *netshManager) SetPolicyQueue(enabled bool, queue uint16, failOpen bool) error {
+	if !enabled {
+		return nil
+	}
+	return errors.New("the policy hook is not supported with windows")
+}
+
+// netshManager.FlushAll - removes all the rules added by netmaker,
+// it runs regardless of ctx as it cleans up on shutdown
+func (n *netshManager) FlushAll() {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	for _, rule := range n.rules() {
+		if err := deleteRule(rule); err != nil {
+			logger.Log(1, "failed to delete firewall rule", rule.chain, err.Error())
+		}
+	}
+	n.ingRules = make(serverrulestable)
+	n.engressRules = make(serverrulestable)
+	n.blockRules = make(ruletable)
+	n.inboundRules = nil
+}
+
+// netshManager.rules - all the rules and nat networks added by netmaker
+func (n *netshManager) rules() []ruleInfo {
+	rules := append([]ruleInfo{}, n.inboundRules...)
+	tables := []ruletable{n.blockRules}
+	for _, serverTables := range []serverrulestable{n.ingRules, n.engressRules} {
+		for _, table := range serverTables {
+			tables = append(tables, table)
+		}
+	}
+	for _, table := range tables {
+		for _, cfg := range table {
+			for _, peerRules := range cfg.rulesMap {
+				rules = append(rules, peerRules...)
+			}
+		}
+	}
+	return rules
+}
+
+// netshManager.unblockPeers - removes the block rules of the blocked peers
+func (n *netshManager) unblockPeers() {
+	deleteBlockRules(n.blockRules)
+	n.blockRules = make(ruletable)
+}
+
+// deleteBlockRules - deletes the netsh rules of a table of block rules
+func deleteBlockRules(rules ruletable) {
+	for key, cfg := range rules {
+		for _, infos := range cfg.rulesMap {
+			for _, rule := range infos {
+				if err := deleteNetshRule(rule.chain); err != nil {
+					logger.Log(1, fmt.Sprintf("failed to delete rule [%s]: %s, Err: %s", key, rule.chain, err.Error()))
+				}
+			}
+		}
+	}
+}
+
+// netshManager.removeInboundRules - removes the rules of outbound only mode
+func (n *netshManager) removeInboundRules() {
+	for _, rule := range n.inboundRules {
+		if err := deleteNetshRule(rule.chain); err != nil {
+			logger.Log(1, fmt.Sprintf("failed to delete rule: %s, Err: %s", rule.chain, err.Error()))
+		}
+	}
+	n.inboundRules = nil
+}
+
+// netshManager.ruleTable - returns the stored rule table by table name, creating it if needed
+func (n *netshManager) ruleTable(server, tableName string) ruletable {
+	var tables serverrulestable
+	switch tableName {
+	case ingressTable:
+		tables = n.ingRules
+	case egressTable:
+		tables = n.engressRules
+	case blockTable:
+		return n.blockRules
+	default:
+		return make(ruletable)
+	}
+	rules, ok := tables[server]
+	if !ok {
+		rules = make(ruletable)
+		tables[server] = rules
+	}
+	return rules
+}
+
+func (n *netshManager) deleteRuleTable(server, tableName string) {
+	logger.Log(1, "Deleting rules table: ", server, tableName)
+	switch tableName {
+	case ingressTable:
+		delete(n.ingRules, server)
+	case egressTable:
+		delete(n.engressRules, server)
+	case blockTable:
+		n.blockRules = make(ruletable)
+	}
+}
+
+// netshRule - a windows firewall rule named with the netmaker prefix
+func netshRule(name string, args ...string) ruleInfo {
+	name = netshRulePrefix + name
+	return ruleInfo{
+		rule:  append([]string{"name=" + name}, append(args, "enable=yes")...),
+		table: netshTable,
+		chain: name,
+	}
+}
+
+// addNetshRule - adds a windows firewall rule, replacing a rule of the same name
+func addNetshRule(rule ruleInfo) error {
+	_ = deleteNetshRule(rule.chain)
+	args := append([]string{"advfirewall", "firewall", "add", "rule"}, rule.rule...)
+	if out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("netsh", args...)); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// deleteNetshRule - deletes the windows firewall rules of a name
+func deleteNetshRule(name string) error {
+	out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("netsh", "advfirewall", "firewall", "delete", "rule", "name="+name))
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// listNetshRules - names of the windows firewall rules added by netmaker, the labels of the output
+// are localized so names are matched by their prefix
+func listNetshRules() ([]string, error) {
+	out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("netsh", "advfirewall", "firewall", "show", "rule", "name=all"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list firewall rules: %w", err)
+	}
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		_, value, found := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		if !found || !strings.HasPrefix(value, netshRulePrefix) || seen[value] {
+			continue
+		}
+		seen[value] = true
+		names = append(names, value)
+	}
+	return names, nil
+}
+
+// blockedPortRanges - the port ranges of a protocol outside of the allowed ports, as a netsh port list
+func blockedPortRanges(allowed []Port, protocol string) string {
+	ports := []int{}
+	for _, port := range allowed {
+		if port.Protocol == protocol {
+			ports = append(ports, port.Port)
+		}
+	}
+	sort.Ints(ports)
+	ranges := []string{}
+	start := 1
+	for _, port := range ports {
+		if port > start {
+			ranges = append(ranges, portRange(start, port-1))
+		}
+		if port+1 > start {
+			start = port + 1
+		}
+	}
+	if start <= 65535 {
+		ranges = append(ranges, portRange(start, 65535))
+	}
+	return strings.Join(ranges, ",")
+}
+
+// portRange - a netsh port range
+func portRange(start, end int) string {
+	if start == end {
+		return strconv.Itoa(start)
+	}
+	return strconv.Itoa(start) + "-" + strconv.Itoa(end)
+}
+
+// shortHash - a short stable identifier for rule names
+func shortHash(s string) string {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// netshManager.SetInterNetworkRules - inter-network routing is not supported with netsh
+func (n *netshManager) SetInterNetworkRules(rules []InterNetworkRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	return errors.New("inter-network routing is not supported with netsh")
+}
+
+// netshManager.SetMSSClamp - MSS clamping is not supported with netsh
+func (n *netshManager) SetMSSClamp(ranges []net.IPNet) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+	return errors.New("MSS clamping is not supported with netsh")
+}
+
+// netshManager.SetEgressMarks - policy routing of egress traffic is not supported with netsh
+func (n *netshManager) SetEgressMarks(marks []EgressMark) error {
+	if len(marks) == 0 {
+		return nil
+	}
+	return errors.New("egress policy routing is not supported with netsh")
+}
+
+// netshManager.SetRateLimits - ext client rate limiting is not supported with netsh
+func (n *netshManager) SetRateLimits(server string, limits []RateLimit) error {
+	if len(limits) == 0 {
+		return nil
+	}
+	return errors.New("ext client rate limiting is not supported with netsh")
+}
+
+// netshManager.SetDefaultDeny - netsh has no rules allowing the traffic of gateway peers explicitly, a default-deny
+// network would lose all its forwarded traffic, so only default-allow is supported
+func (n *netshManager) SetDefaultDeny(ranges []net.IPNet) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+	return errors.New("default-deny networks are not supported with netsh")
+}
+
+// netshManager.SetDropLogging - logging the dropped packets is not supported with netsh
+func (n *netshManager) SetDropLogging(enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	return fmt.Errorf("%w: netsh has no drop rules to log", errDropLoggingUnsupported)
+}
@@ -0,0 +1,251 @@
+package firewall
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/exp/slog"
+	"golang.org/x/sys/unix"
+)
+
+// nfqueue netlink messages and attributes, from linux/netfilter/nfnetlink_queue.h
+const (
+	nfqnlMsgPacket  = 0
+	nfqnlMsgVerdict = 1
+	nfqnlMsgConfig  = 2
+
+	nfqaPacketHdr  = 1
+	nfqaVerdictHdr = 2
+	nfqaPayload    = 10
+
+	nfqaCfgCmd    = 1
+	nfqaCfgParams = 2
+
+	nfqnlCfgCmdBind   = 1
+	nfqnlCfgCmdUnbind = 2
+	nfqnlCopyPacket   = 2
+
+	nfDrop   = 0
+	nfAccept = 1
+
+	// nfqueueCopyRange - bytes of each packet copied to netclient, enough for the ip and transport headers
+	nfqueueCopyRange = 128
+)
+
+// nfQueue - a netlink socket bound to an nfqueue
+type nfQueue struct {
+	conn *netlink.Conn
+	num  uint16
+}
+
+// openNFQueue - binds to the queue, copying the headers of the queued packets
+func openNFQueue(num uint16) (*nfQueue, error) {
+	conn, err := netlink.Dial(unix.NETLINK_NETFILTER, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nfqueue socket: %w", err)
+	}
+	_ = conn.SetOption(netlink.NoENOBUFS, true)
+	q := &nfQueue{conn: conn, num: num}
+	if err := q.config(nfqaCfgCmd, []byte{nfqnlCfgCmdBind, 0, 0, 0}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to bind nfqueue %d: %w", num, err)
+	}
+	params := make([]byte, 5)
+	binary.BigEndian.PutUint32(params, nfqueueCopyRange)
+	params[4] = nfqnlCopyPacket
+	if err := q.config(nfqaCfgParams, params); err != nil {
+		q.close()
+		return nil, fmt.Errorf("failed to configure nfqueue %d: %w", num, err)
+	}
+	return q, nil
+}
+
+// nfQueue.config - sends a config attribute of the queue
+func (q *nfQueue) config(attr uint16, data []byte) error {
+	ae := netlink.NewAttributeEncoder()
+	ae.Bytes(attr, data)
+	attrs, err := ae.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = q.conn.Execute(q.message(nfqnlMsgConfig, netlink.Request|netlink.Acknowledge, attrs))
+	return err
+}
+
+// nfQueue.message - a netfilter message of the queue subsystem
+func (q *nfQueue) message(msgType int, flags netlink.HeaderFlags, attrs []byte) netlink.Message {
+	// nfgenmsg: family, version, queue number
+	header := []byte{unix.AF_UNSPEC, unix.NFNETLINK_V0, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], q.num)
+	return netlink.Message{
+		Header: netlink.Header{Type: netlink.HeaderType(unix.NFNL_SUBSYS_QUEUE<<8 | msgType), Flags: flags},
+		Data:   append(header, attrs...),
+	}
+}
+
+// nfQueue.receive - waits for queued packets
+func (q *nfQueue) receive() ([]Flow, error) {
+	msgs, err := q.conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+	flows := []Flow{}
+	for _, msg := range msgs {
+		if msg.Header.Type&0xff != nfqnlMsgPacket || len(msg.Data) < 4 {
+			continue
+		}
+		ad, err := netlink.NewAttributeDecoder(msg.Data[4:])
+		if err != nil {
+			continue
+		}
+		var flow Flow
+		found := false
+		for ad.Next() {
+			switch ad.Type() {
+			case nfqaPacketHdr:
+				// packet id, hardware protocol, hook
+				if hdr := ad.Bytes(); len(hdr) >= 7 {
+					flow.ID = binary.BigEndian.Uint32(hdr)
+					flow.Hook = "forward"
+					if hdr[6] == unix.NF_INET_LOCAL_IN {
+						flow.Hook = "input"
+					}
+					found = true
+				}
+			case nfqaPayload:
+				parseFlow(ad.Bytes(), &flow)
+			}
+		}
+		if found {
+			flows = append(flows, flow)
+		}
+	}
+	return flows, nil
+}
+
+// nfQueue.verdict - accepts or drops a queued packet
+func (q *nfQueue) verdict(id uint32, accept bool) error {
+	hdr := make([]byte, 8)
+	binary.BigEndian.PutUint32(hdr, nfDrop)
+	if accept {
+		binary.BigEndian.PutUint32(hdr, nfAccept)
+	}
+	binary.BigEndian.PutUint32(hdr[4:], id)
+	ae := netlink.NewAttributeEncoder()
+	ae.Bytes(nfqaVerdictHdr, hdr)
+	attrs, err := ae.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = q.conn.Send(q.message(nfqnlMsgVerdict, netlink.Request, attrs))
+	return err
+}
+
+// nfQueue.close - unbinds from the queue, packets queued afterwards follow the bypass setting of the rules
+func (q *nfQueue) close() {
+	_ = q.config(nfqaCfgCmd, []byte{nfqnlCfgCmdUnbind, 0, 0, 0})
+	q.conn.Close()
+}
+
+// parseFlow - reads the addresses, protocol and ports of an ip packet
+func parseFlow(packet []byte, flow *Flow) {
+	if len(packet) < 1 {
+		return
+	}
+	var proto byte
+	var transport []byte
+	switch packet[0] >> 4 {
+	case 4:
+		ihl := int(packet[0]&0x0f) * 4
+		if len(packet) < 20 || len(packet) < ihl {
+			return
+		}
+		proto, flow.Src, flow.Dst = packet[9], net.IP(packet[12:16]), net.IP(packet[16:20])
+		transport = packet[ihl:]
+	case 6:
+		if len(packet) < 40 {
+			return
+		}
+		proto, flow.Src, flow.Dst = packet[6], net.IP(packet[8:24]), net.IP(packet[24:40])
+		transport = packet[40:]
+	default:
+		return
+	}
+	switch proto {
+	case unix.IPPROTO_TCP, unix.IPPROTO_UDP:
+		flow.Protocol = "tcp"
+		if proto == unix.IPPROTO_UDP {
+			flow.Protocol = "udp"
+		}
+		if len(transport) >= 4 {
+			flow.SrcPort = int(binary.BigEndian.Uint16(transport))
+			flow.DstPort = int(binary.BigEndian.Uint16(transport[2:]))
+		}
+	case unix.IPPROTO_ICMP:
+		flow.Protocol = "icmp"
+	case unix.IPPROTO_ICMPV6:
+		flow.Protocol = "icmpv6"
+	default:
+		flow.Protocol = strconv.Itoa(int(proto))
+	}
+}
+
+// RunPolicyHook - queues new connections from the mesh to the policy engine until ctx is done; connections
+// the engine does not decide on in time are accepted or dropped as configured
+func RunPolicyHook(ctx context.Context, hook config.PolicyHook) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	engine, err := newPolicyEngine(ctx, hook)
+	if err != nil {
+		return err
+	}
+	defer engine.close()
+	queue, err := openNFQueue(hook.Queue)
+	if err != nil {
+		return err
+	}
+	defer queue.close()
+	if err := fwCrtl.SetPolicyQueue(true, hook.Queue, hook.FailOpen); err != nil {
+		return err
+	}
+	defer func() {
+		if err := fwCrtl.SetPolicyQueue(false, hook.Queue, hook.FailOpen); err != nil {
+			slog.Error("failed to remove the rules of the policy hook", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		// unblocks receive
+		queue.conn.Close()
+	}()
+	for {
+		flows, err := queue.receive()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("policy hook: %w", err)
+		}
+		for _, flow := range flows {
+			go func(flow Flow) {
+				decideCtx, cancel := context.WithTimeout(ctx, hook.GetTimeout())
+				defer cancel()
+				accept, err := engine.decide(decideCtx, flow)
+				if err != nil {
+					accept = hook.FailOpen
+					slog.Debug("policy engine did not decide", "flow", flow, "error", err, "accept", accept)
+				}
+				if err := queue.verdict(flow.ID, accept); err != nil && ctx.Err() == nil {
+					slog.Error("failed to send verdict of the policy hook", "error", err)
+				}
+			}(flow)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package firewall
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseFlow(t *testing.T) {
+	// ipv4 header without options followed by the ports of a tcp header
+	packet := []byte{
+		0x45, 0, 0, 40, 0, 0, 0, 0, 64, 6, 0, 0,
+		10, 0, 0, 1,
+		10, 0, 0, 2,
+		0xc3, 0x50, 0, 22,
+	}
+	var flow Flow
+	parseFlow(packet, &flow)
+	if flow.Protocol != "tcp" || !flow.Src.Equal(net.ParseIP("10.0.0.1")) || !flow.Dst.Equal(net.ParseIP("10.0.0.2")) ||
+		flow.SrcPort != 50000 || flow.DstPort != 22 {
+		t.Errorf("parseFlow() = %+v", flow)
+	}
+	flow = Flow{}
+	parseFlow([]byte{0x45, 0}, &flow)
+	if flow.Src != nil {
+		t.Errorf("parseFlow() parsed a truncated packet: %+v", flow)
+	}
+}
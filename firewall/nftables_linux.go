@@ -1,37 +1,73 @@
 package firewall
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
 	"github.com/google/nftables/expr"
-	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
+	"golang.org/x/sys/unix"
 )
 
+// nftablesManager - manages the netmaker nftables rules; every exported method is one operation holding
+// mux for its whole duration, unexported methods expect mux to be held by the caller.
+// Once ctx is done, operations are refused and in-flight ones stop before their next rule
 type nftablesManager struct {
+	ctx          context.Context
 	conn         *nftables.Conn
 	ingRules     serverrulestable
 	engressRules serverrulestable
-	mux          sync.Mutex
+	// persistRules - the rule tables are persisted, for the cleanup after a crash
+	persistRules bool
+	// blockRules - drop rules of the locally blocked peers, keyed by peer and address
+	blockRules ruletable
+	// inboundRules - input chain rules of outbound only mode
+	inboundRules []ruleInfo
+	// staticNatRules - rules of the one-to-one nat of public addresses to ext clients, keyed by public address
+	staticNatRules ruletable
+	// policyQueueRules - rules queueing new connections to the policy hook
+	policyQueueRules []ruleInfo
+	// interNetworkRules - forward chain rules of inter-network routing, keyed by source and destination range
+	interNetworkRules ruletable
+	// defaultDenyRules - netmaker filter chain drop rules of default-deny networks, keyed by range
+	defaultDenyRules ruletable
+	// mssClampRules - mangle table rules clamping the MSS of tcp connections, keyed by range
+	mssClampRules ruletable
+	// egressMarkRules - mangle table rules marking the traffic of egress policies, keyed by mark
+	egressMarkRules ruletable
+	// logDrops - the drop rules are preceded by rate limited log rules
+	logDrops bool
+	mux      sync.Mutex
 }
 
 func init() {
-	nfJumpRules = append(nfJumpRules, nfFilterJumpRules...)
-	nfJumpRules = append(nfJumpRules, nfNatJumpRules...)
+	setNftablesChainRules()
 }
 
 var (
 	filterTable = &nftables.Table{Name: defaultIpTable, Family: nftables.TableFamilyINet}
 	natTable    = &nftables.Table{Name: defaultNatTable, Family: nftables.TableFamilyINet}
+	mangleTable = &nftables.Table{Name: "mangle", Family: nftables.TableFamilyINet}
 
 	nfJumpRules []ruleInfo
+	dropRule    ruleInfo
 	// filter table netmaker jump rules
+	nfFilterJumpRules []ruleInfo
+	// nat table nm jump rules
+	nfNatJumpRules []ruleInfo
+)
+
+// setNftablesChainRules - builds the rules referring to the netmaker chains by name
+func setNftablesChainRules() {
 	dropRule = ruleInfo{
 		nfRule: &nftables.Rule{
 			Table: filterTable,
@@ -94,7 +130,6 @@ var (
 			chain: netmakerFilterChain,
 		},
 	}
-	// nat table nm jump rules
 	nfNatJumpRules = []ruleInfo{
 		{
 			nfRule: &nftables.Rule{
@@ -131,7 +166,8 @@ var (
 			chain: netmakerNatChain,
 		},
 	}
-)
+	nfJumpRules = append(append([]ruleInfo{}, nfFilterJumpRules...), nfNatJumpRules...)
+}
 
 // nftables.CreateChains - creates default chains and rules
 func (n *nftablesManager) CreateChains() error {
@@ -220,6 +256,7 @@ func (n *nftablesManager) CreateChains() error {
 		Table: natTable,
 	}
 	n.conn.AddChain(natChain)
+	n.addMangleChains()
 
 	if err := n.conn.Flush(); err != nil {
 		return err
@@ -248,17 +285,142 @@ func (n *nftablesManager) ForwardRule() error {
 			},
 			&expr.Verdict{Kind: expr.VerdictAccept},
 		},
+		UserData: []byte(forwardAcceptRuleKey),
 	})
 	return n.conn.Flush()
 }
 
+// nftables.VerifyChains - checks that the netmaker forward accept and jump rules and the tracked rules are
+// still present, e.g. after another tool flushed the ruleset, restoring them when missing, returns the
+// problems found
+func (n *nftablesManager) VerifyChains() ([]string, error) {
+	issues := []string{}
+	missing := false
+	if _, err := n.getRule(defaultIpTable, iptableFWDChain, forwardAcceptRuleKey); err != nil {
+		missing = true
+	}
+	for _, rule := range nfJumpRules {
+		r := rule.nfRule.(*nftables.Rule)
+		if _, err := n.getRule(r.Table.Name, r.Chain.Name, string(r.UserData)); err != nil {
+			missing = true
+		}
+	}
+	if missing {
+		issues = append(issues, "netmaker nftables rules were removed, restoring")
+		if err := n.ForwardRule(); err != nil {
+			return issues, err
+		}
+	}
+	restored, err := n.restoreTrackedRules()
+	return append(issues, restored...), err
+}
+
+// nftables.restoreTrackedRules - restores the tracked rules deleted by another tool, the rules of each
+// chain are listed once
+func (n *nftablesManager) restoreTrackedRules() ([]string, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	inserted := []ruleInfo{}
+	fromTable := func(table ruletable) {
+		for _, cfg := range table {
+			for _, rules := range cfg.rulesMap {
+				inserted = append(inserted, rules...)
+			}
+		}
+	}
+	for _, tables := range []serverrulestable{n.ingRules, n.engressRules} {
+		for _, table := range tables {
+			fromTable(table)
+		}
+	}
+	fromTable(n.staticNatRules)
+	inserted = append(inserted, n.policyQueueRules...)
+	fromTable(n.interNetworkRules)
+	fromTable(n.blockRules)
+	present := make(map[chainRef]map[string]bool)
+	isMissing := func(rule ruleInfo) bool {
+		c := chainRef{rule.table, rule.chain}
+		if _, ok := present[c]; !ok {
+			present[c] = make(map[string]bool)
+			rules, err := n.conn.GetRules(&nftables.Table{Name: c.table, Family: nftables.TableFamilyINet}, &nftables.Chain{Name: c.chain})
+			if err != nil {
+				// the chain is gone along with its rules
+				logger.Log(1, "failed to list rules of chain", c.table, c.chain, err.Error())
+			}
+			for _, r := range rules {
+				present[c][string(r.UserData)] = true
+			}
+		}
+		return !present[c][genRuleKey(rule.rule...)]
+	}
+	restore := func(rule ruleInfo) *nftables.Rule {
+		nfRule, ok := rule.nfRule.(*nftables.Rule)
+		if !ok {
+			return nil
+		}
+		return &nftables.Rule{Table: nfRule.Table, Chain: nfRule.Chain, UserData: nfRule.UserData, Exprs: nfRule.Exprs}
+	}
+	missing := 0
+	for _, rule := range inserted {
+		if nfRule := restore(rule); nfRule != nil && isMissing(rule) {
+			n.conn.InsertRule(nfRule)
+			missing++
+		}
+	}
+	// the rules of outbound only mode are appended in order, they are all added again when one is missing
+	inboundMissing := false
+	for _, rule := range n.inboundRules {
+		if isMissing(rule) {
+			inboundMissing = true
+		}
+	}
+	if inboundMissing {
+		for _, rule := range n.inboundRules {
+			if !isMissing(rule) {
+				n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...))
+			}
+			if nfRule := restore(rule); nfRule != nil {
+				n.conn.AddRule(nfRule)
+				missing++
+			}
+		}
+	}
+	// the drop rules of default-deny networks close the filter chain ahead of RETURN, they are all added
+	// again with RETURN when one is missing
+	closing := append(n.defaultDenyDrops(), nfFilterJumpRules[0])
+	closingMissing := false
+	for _, rule := range closing {
+		if isMissing(rule) {
+			closingMissing = true
+		}
+	}
+	if closingMissing {
+		for _, rule := range closing {
+			if !isMissing(rule) {
+				n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...))
+			}
+			if nfRule := restore(rule); nfRule != nil {
+				n.conn.AddRule(nfRule)
+				missing++
+			}
+		}
+	}
+	if missing == 0 {
+		return nil, nil
+	}
+	issues := []string{fmt.Sprintf("%d netmaker nftables rules were removed, restoring", missing)}
+	if err := n.conn.Flush(); err != nil {
+		return issues, fmt.Errorf("failed to restore rules: %w", err)
+	}
+	return issues, n.reinsertBlockRules()
+}
+
 // nftables.CleanRoutingRules cleans existing nftable resources that we created by the agent
 func (n *nftablesManager) CleanRoutingRules(server, ruleTableName string) {
-	ruleTable := n.FetchRuleTable(server, ruleTableName)
-	defer n.DeleteRuleTable(server, ruleTableName)
 	n.mux.Lock()
 	defer n.mux.Unlock()
-	for _, rulesCfg := range ruleTable {
+	defer n.saveRuleState()
+	for _, rulesCfg := range n.ruleTable(server, ruleTableName) {
 		for _, rules := range rulesCfg.rulesMap {
 			for _, rule := range rules {
 				if err := n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...)); err != nil {
@@ -267,12 +429,19 @@ func (n *nftablesManager) CleanRoutingRules(server, ruleTableName string) {
 			}
 		}
 	}
+	n.deleteRuleTable(server, ruleTableName)
 }
 
 // nftables.DeleteRuleTable - deletes all rules from a table
 func (n *nftablesManager) DeleteRuleTable(server, ruleTableName string) {
 	n.mux.Lock()
 	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	n.deleteRuleTable(server, ruleTableName)
+}
+
+// nftables.deleteRuleTable - forgets the rule table, the lock is held by the caller
+func (n *nftablesManager) deleteRuleTable(server, ruleTableName string) {
 	logger.Log(1, "Deleting rules table: ", server, ruleTableName)
 	switch ruleTableName {
 	case ingressTable:
@@ -284,82 +453,115 @@ func (n *nftablesManager) DeleteRuleTable(server, ruleTableName string) {
 
 // nftables.InsertEgressRoutingRules - inserts egress routes for the GW peers
 func (n *nftablesManager) InsertEgressRoutingRules(server string, egressInfo models.EgressInfo) error {
-	ruleTable := n.FetchRuleTable(server, egressTable)
-	defer n.SaveRules(server, egressTable, ruleTable)
 	n.mux.Lock()
 	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	ruleTable := n.ruleTable(server, egressTable)
 	// add jump Rules for egress GW
 	var (
-		rule           *nftables.Rule
-		isIpv4         = isAddrIpv4(egressInfo.EgressGwAddr.String())
-		egressGwRoutes = []ruleInfo{}
+		rule   *nftables.Rule
+		isIpv4 = isAddrIpv4(egressInfo.EgressGwAddr.String())
 	)
-	ruleTable[egressInfo.EgressID] = rulesCfg{
-		isIpv4:   isIpv4,
-		rulesMap: make(map[string][]ruleInfo),
+	cfg, ok := ruleTable[egressInfo.EgressID]
+	if !ok {
+		cfg = rulesCfg{isIpv4: isIpv4, rulesMap: make(map[string][]ruleInfo)}
+	}
+	cfg.network = egressNetwork(egressInfo)
+	ruleTable[egressInfo.EgressID] = cfg
+	// replace the nat rules of the ranges of a previous update of the gateway, keeping the rules of its peers
+	for _, egressRange := range cfg.egressRanges() {
+		for _, rule := range cfg.rulesMap[egressRangeKey(egressRange)] {
+			n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...))
+		}
+		delete(cfg.rulesMap, egressRangeKey(egressRange))
 	}
 	for _, egressGwRange := range egressInfo.EgressGWCfg.Ranges {
-		if egressInfo.EgressGWCfg.NatEnabled == "yes" {
-			if egressRangeIface, err := getInterfaceName(config.ToIPNet(egressGwRange)); err != nil {
-				logger.Log(0, "failed to get interface name: ", egressRangeIface, err.Error())
+		if err := n.ctx.Err(); err != nil {
+			return err
+		}
+		cfg.rulesMap[egressRangeKey(egressGwRange)] = []ruleInfo{}
+		nat := egressNat(egressGwRange, egressInfo.EgressGWCfg.NatEnabled == "yes")
+		if nat.Mode == EgressNatRouted {
+			continue
+		}
+		dst := toIPNet(egressGwRange)
+		if egressRangeIface, err := getInterfaceName(dst); err != nil {
+			logger.Log(0, "failed to get interface name: ", egressRangeIface, err.Error())
+		} else {
+			ruleSpec := []string{"-o", egressRangeIface, "-d", dst.String(), "-j", "MASQUERADE"}
+			if nat.Mode == EgressNatSNAT {
+				ruleSpec = []string{"-o", egressRangeIface, "-d", dst.String(), "-j", "SNAT", "--to-source", nat.Source.String()}
+			}
+			// to avoid duplicate range rule,delete if exists
+			n.deleteRule(defaultNatTable, nattablePRTChain, genRuleKey(ruleSpec...))
+			rule = &nftables.Rule{
+				Table:    natTable,
+				Chain:    &nftables.Chain{Name: nattablePRTChain, Table: natTable},
+				UserData: []byte(genRuleKey(ruleSpec...)),
+				Exprs:    nfEgressNatExprs(egressRangeIface, dst, nat),
+			}
+			n.conn.InsertRule(rule)
+			if err := n.conn.Flush(); err != nil {
+				logger.Log(0, fmt.Sprintf("failed to add rule: %v, Err: %v ", ruleSpec, err.Error()))
 			} else {
-				ruleSpec := []string{"-o", egressRangeIface, "-j", "MASQUERADE"}
-				// to avoid duplicate iface route rule,delete if exists
-				n.deleteRule(defaultNatTable, nattablePRTChain, genRuleKey(ruleSpec...))
-				rule = &nftables.Rule{
-					Table:    natTable,
-					Chain:    &nftables.Chain{Name: nattablePRTChain, Table: natTable},
-					UserData: []byte(genRuleKey(ruleSpec...)),
-					Exprs: []expr.Any{
-						&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
-						&expr.Cmp{
-							Op:       expr.CmpOpEq,
-							Register: 1,
-							Data:     []byte(egressRangeIface + "\x00"),
-						},
-						&expr.Counter{},
-						&expr.Masq{},
-					},
-				}
-				n.conn.InsertRule(rule)
-				if err := n.conn.Flush(); err != nil {
-					logger.Log(0, fmt.Sprintf("failed to add rule: %v, Err: %v ", ruleSpec, err.Error()))
-				} else {
-					egressGwRoutes = append(egressGwRoutes, ruleInfo{
-						nfRule: rule,
-						table:  defaultNatTable,
-						chain:  nattablePRTChain,
-						rule:   ruleSpec,
-					})
-				}
+				cfg.rulesMap[egressRangeKey(egressGwRange)] = []ruleInfo{{
+					nfRule: rule,
+					table:  defaultNatTable,
+					chain:  nattablePRTChain,
+					rule:   ruleSpec,
+				}}
 			}
 		}
 	}
-	ruleTable[egressInfo.EgressID].rulesMap[egressInfo.EgressID] = egressGwRoutes
-
 	return nil
 }
 
-// nftables.FetchRuleTable - fetches the rule table by table name
+// nftables.FetchRuleTable - returns a copy of the rule table by table name
 func (n *nftablesManager) FetchRuleTable(server string, tableName string) ruletable {
 	n.mux.Lock()
 	defer n.mux.Unlock()
-	var rules ruletable
+	return n.ruleTable(server, tableName).copy()
+}
+
+// nftables.ruleTable - the stored rule table of the server by table name, created when missing; the lock is
+// held by the caller, who may modify it in place
+func (n *nftablesManager) ruleTable(server, tableName string) ruletable {
+	var tables serverrulestable
 	switch tableName {
 	case ingressTable:
-		rules = n.ingRules[server]
-		if rules == nil {
-			rules = make(ruletable)
-		}
+		tables = n.ingRules
 	case egressTable:
-		rules = n.engressRules[server]
-		if rules == nil {
-			rules = make(ruletable)
-		}
+		tables = n.engressRules
+	case blockTable:
+		return n.blockRules
+	default:
+		return make(ruletable)
+	}
+	rules, ok := tables[server]
+	if !ok {
+		rules = make(ruletable)
+		tables[server] = rules
 	}
 	return rules
 }
 
+// nftables.ListRules - lists the rules of all rule tables and rule lists, the rules of the lists are
+// inet rules matching both families
+func (n *nftablesManager) ListRules() []ManagedRule {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	rules := listManagedRules(n.ingRules, n.engressRules, n.blockRules, n.staticNatRules)
+	rules = append(rules, listedRules(inboundTable, n.inboundRules, []string{"inet"})...)
+	rules = append(rules, listedRules(policyQueueTable, n.policyQueueRules, []string{"inet"})...)
+	rules = append(rules, n.defaultDenyRules.managedRules("", defaultDenyTable)...)
+	rules = append(rules, n.mssClampRules.managedRules("", mssClampTable)...)
+	rules = append(rules, n.egressMarkRules.managedRules("", egressMarkTable)...)
+	return append(rules, n.interNetworkRules.managedRules("", interNetworkTable)...)
+}
+
 // nftables.SaveRules - saves the rule table by tablename
 func (n *nftablesManager) SaveRules(server, tableName string, rules ruletable) {
 	n.mux.Lock()
@@ -371,14 +573,18 @@ func (n *nftablesManager) SaveRules(server, tableName string, rules ruletable) {
 	case egressTable:
 		n.engressRules[server] = rules
 	}
+	n.saveRuleState()
 }
 
 // nftables.RemoveRoutingRules removes an nfatbles rules related to a peer
 func (n *nftablesManager) RemoveRoutingRules(server, ruletableName, peerKey string) error {
-	rulesTable := n.FetchRuleTable(server, ruletableName)
-	defer n.SaveRules(server, ruletableName, rulesTable)
 	n.mux.Lock()
 	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := n.ruleTable(server, ruletableName)
 	if _, ok := rulesTable[peerKey]; !ok {
 		return errors.New("peer not found in rule table: " + peerKey)
 	}
@@ -396,10 +602,13 @@ func (n *nftablesManager) RemoveRoutingRules(server, ruletableName, peerKey stri
 
 // nftables.DeleteRoutingRule - removes an nftables rule pair from forwarding and nat chains
 func (n *nftablesManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, dstPeerKey string) error {
-	rulesTable := n.FetchRuleTable(server, ruletableName)
-	defer n.SaveRules(server, ruletableName, rulesTable)
 	n.mux.Lock()
 	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := n.ruleTable(server, ruletableName)
 	if _, ok := rulesTable[srcPeerKey]; !ok {
 		return errors.New("peer not found in rule table: " + srcPeerKey)
 	}
@@ -410,6 +619,7 @@ func (n *nftablesManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, d
 					rule.table, rule.rule, srcPeerKey, err)
 			}
 		}
+		delete(rulesTable[srcPeerKey].rulesMap, dstPeerKey)
 	} else {
 		return errors.New("rules not found for: " + dstPeerKey)
 	}
@@ -420,11 +630,796 @@ func (n *nftablesManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, d
 func (n *nftablesManager) FlushAll() {
 	n.mux.Lock()
 	defer n.mux.Unlock()
+	defer n.saveRuleState()
 	n.conn.FlushTable(filterTable)
 	n.conn.FlushTable(natTable)
+	n.conn.FlushTable(mangleTable)
 	if err := n.conn.Flush(); err != nil {
 		logger.Log(0, "Error flushing tables: ", err.Error())
 	}
+	n.ingRules = make(serverrulestable)
+	n.engressRules = make(serverrulestable)
+	n.blockRules = make(ruletable)
+	n.interNetworkRules = make(ruletable)
+	n.defaultDenyRules = make(ruletable)
+	n.mssClampRules = make(ruletable)
+	n.egressMarkRules = make(ruletable)
+	n.inboundRules = nil
+	n.staticNatRules = make(ruletable)
+	announceStaticNat(nil)
+	n.policyQueueRules = nil
+}
+
+// nftables.BlockPeers - replaces the drop rules of the locally blocked peers, the rules are
+// inserted at the top of the input, forward and output chains
+func (n *nftablesManager) BlockPeers(peers map[string][]net.IPNet) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	return n.blockPeers(peers, false)
+}
+
+// nftables.blockPeers - replaces the drop rules of the blocked peers, the rules of addresses still blocked
+// are kept unless rebuild; the lock is held by the caller
+func (n *nftablesManager) blockPeers(peers map[string][]net.IPNet, rebuild bool) error {
+	current := n.blockRules
+	if rebuild {
+		current = make(ruletable)
+	}
+	wanted, added, removed := diffBlockRules(current, peers, func(_ string, addr net.IPNet) []ruleInfo {
+		rules := []ruleInfo{}
+		for _, rule := range peerBlockRules(addr.String()) {
+			rules = append(rules, n.withDropLogs(rule, nfBlockExprs(addr, rule.rule[0] == "-i"))...)
+		}
+		return rules
+	})
+	if rebuild {
+		removed = n.blockRules
+	}
+	for key, cfg := range removed {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				if err := n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...)); err != nil {
+					logger.Log(1, fmt.Sprintf("failed to delete rule [%s]: %v, Err: %s", key, rule.rule, err.Error()))
+				}
+			}
+		}
+	}
+	var err error
+	n.blockRules, err = addBlockRules(wanted, added, func(rule ruleInfo) error {
+		n.conn.InsertRule(rule.nfRule.(*nftables.Rule))
+		return n.conn.Flush()
+	})
+	return err
+}
+
+// nftables.SetInterNetworkRules - replaces the forward chain rules of inter-network routing, the
+// replies of allowed connections are accepted ahead of the rules dropping the other traffic
+func (n *nftablesManager) SetInterNetworkRules(rules []InterNetworkRule) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	return n.setInterNetworkRules(rules)
+}
+
+// nftables.setInterNetworkRules - replaces the rules of inter-network routing, the lock is held by the caller
+func (n *nftablesManager) setInterNetworkRules(rules []InterNetworkRule) error {
+	for key, cfg := range n.interNetworkRules {
+		for _, peerRules := range cfg.rulesMap {
+			for _, rule := range peerRules {
+				if err := n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...)); err != nil {
+					logger.Log(1, fmt.Sprintf("failed to delete rule [%s]: %v, Err: %s", key, rule.rule, err.Error()))
+				}
+			}
+		}
+	}
+	n.interNetworkRules = make(ruletable)
+	insert := func(key string, isIpv4 bool, rule ruleInfo, exprs []expr.Any) error {
+		added := []ruleInfo{}
+		for _, r := range n.withDropLogs(rule, exprs) {
+			n.conn.InsertRule(r.nfRule.(*nftables.Rule))
+			if err := n.conn.Flush(); err != nil {
+				return fmt.Errorf("failed to add rule %v of inter-network routing: %w", r.rule, err)
+			}
+			added = append(added, r)
+			n.interNetworkRules[key] = rulesCfg{isIpv4: isIpv4, rulesMap: map[string][]ruleInfo{"": added}}
+		}
+		return nil
+	}
+	families := make(map[bool]bool)
+	for _, r := range rules {
+		isIpv4 := r.Src.IP.To4() != nil
+		if err := insert(r.key(), isIpv4, interNetworkRuleInfo(r), nfInterNetworkExprs(r)); err != nil {
+			return err
+		}
+		families[isIpv4] = true
+	}
+	// inserted last to end up on top
+	for isIpv4 := range families {
+		if err := insert(interNetworkReplyKey(isIpv4), isIpv4, interNetworkReplyRule(), nfInterNetworkReplyExprs(isIpv4)); err != nil {
+			return err
+		}
+	}
+	return n.reinsertBlockRules()
+}
+
+// nftables.SetDefaultDeny - replaces the drop rules of default-deny networks, appended to the netmaker
+// filter chain the forward chain jumps to, behind the rules allowing traffic and ahead of RETURN
+func (n *nftablesManager) SetDefaultDeny(ranges []net.IPNet) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	return n.setDefaultDeny(ranges)
+}
+
+// nftables.saveRuleState - persists all rule tables, the lock is held by the caller
+func (n *nftablesManager) saveRuleState() {
+	if n.persistRules {
+		saveRuleState(n.ruleTables())
+	}
+}
+
+// nftables.ruleTables - all rule tables by rule table name, the tables not kept per server under the empty
+// server and the inet rule lists as a single table; the lock is held by the caller
+func (n *nftablesManager) ruleTables() map[string]serverrulestable {
+	return map[string]serverrulestable{
+		ingressTable:      n.ingRules,
+		egressTable:       n.engressRules,
+		blockTable:        {"": n.blockRules},
+		staticNatTable:    {"": n.staticNatRules},
+		inboundTable:      {"": listTable(n.inboundRules, true)},
+		policyQueueTable:  {"": listTable(n.policyQueueRules, true)},
+		interNetworkTable: {"": n.interNetworkRules},
+		mssClampTable:     {"": n.mssClampRules},
+		egressMarkTable:   {"": n.egressMarkRules},
+		defaultDenyTable:  {"": n.defaultDenyRules},
+	}
+}
+
+// nftables.removeSavedRules - removes the rules of a rule table persisted by a previous daemon, found by
+// the key of their rule spec, in one transaction
+func (n *nftablesManager) removeSavedRules(rules ruletable) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	for _, cfg := range rules {
+		for _, peerRules := range cfg.rulesMap {
+			for _, rule := range peerRules {
+				if nfRule, err := n.getRule(rule.table, rule.chain, genRuleKey(rule.rule...)); err == nil {
+					n.conn.DelRule(nfRule)
+				}
+			}
+		}
+	}
+	if err := n.conn.Flush(); err != nil {
+		logger.Log(0, "failed to remove stale rules:", err.Error())
+	}
+}
+
+// nftables.SetDropLogging - adds or removes the log rules ahead of the drop rules of blocked peers, of
+// inter-network routing and of default-deny networks
+func (n *nftablesManager) SetDropLogging(enabled bool) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	if n.logDrops == enabled {
+		return nil
+	}
+	n.logDrops = enabled
+	ranges := []net.IPNet{}
+	for key := range n.defaultDenyRules {
+		ranges = append(ranges, toIPNet(key))
+	}
+	if err := n.setDefaultDeny(ranges); err != nil {
+		return err
+	}
+	if err := n.setInterNetworkRules(interNetworkRulesOf(n.interNetworkRules)); err != nil {
+		return err
+	}
+	return n.blockPeers(blockedPeersOf(n.blockRules), true)
+}
+
+// nftables.withDropLogs - the filter table rule of the rule and its expressions, followed, when it drops
+// and drop logging is on, by a rule logging the dropped traffic; inserted at the top in this order, the
+// log rule ends up ahead of its drop rule
+func (n *nftablesManager) withDropLogs(rule ruleInfo, exprs []expr.Any) []ruleInfo {
+	nfRule := func(rule ruleInfo, exprs []expr.Any) ruleInfo {
+		rule.nfRule = &nftables.Rule{
+			Table:    filterTable,
+			Chain:    &nftables.Chain{Name: rule.chain, Table: filterTable},
+			UserData: []byte(genRuleKey(rule.rule...)),
+			Exprs:    exprs,
+		}
+		return rule
+	}
+	rules := []ruleInfo{nfRule(rule, exprs)}
+	if n.logDrops && isDropRule(rule) {
+		rules = append(rules, nfRule(dropLogRuleOf(rule), nfDropLogExprs(exprs)))
+	}
+	return rules
+}
+
+// nftables.setDefaultDeny - replaces the rules of default-deny networks, the lock is held by the caller
+func (n *nftablesManager) setDefaultDeny(ranges []net.IPNet) error {
+	closing := append(n.defaultDenyDrops(), nfFilterJumpRules[0])
+	for _, rule := range closing {
+		if err := n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...)); err != nil {
+			logger.Log(1, fmt.Sprintf("failed to delete rule: %v, Err: %s", rule.rule, err.Error()))
+		}
+	}
+	n.defaultDenyRules = make(ruletable)
+	for _, r := range ranges {
+		rules := []ruleInfo{}
+		for _, log := range []bool{true, false} {
+			if log && !n.logDrops {
+				continue
+			}
+			target := []string{"-j", "DROP"}
+			if log {
+				target = []string{"-j", "LOG", "--log-prefix", dropLogPrefix}
+			}
+			rule := ruleInfo{
+				rule:  append([]string{"-s", r.String(), "-i", ncutils.GetInterfaceName(), "!", "-o", ncutils.GetInterfaceName()}, target...),
+				table: defaultIpTable,
+				chain: netmakerFilterChain,
+			}
+			rule.nfRule = &nftables.Rule{
+				Table:    filterTable,
+				Chain:    &nftables.Chain{Name: rule.chain, Table: filterTable},
+				UserData: []byte(genRuleKey(rule.rule...)),
+				Exprs:    nfDefaultDenyExprs(r, log),
+			}
+			rules = append(rules, rule)
+		}
+		n.defaultDenyRules[r.String()] = rulesCfg{isIpv4: r.IP.To4() != nil, rulesMap: map[string][]ruleInfo{r.String(): rules}}
+	}
+	for _, rule := range append(n.defaultDenyDrops(), nfFilterJumpRules[0]) {
+		nfRule := rule.nfRule.(*nftables.Rule)
+		n.conn.AddRule(&nftables.Rule{Table: nfRule.Table, Chain: nfRule.Chain, UserData: nfRule.UserData, Exprs: nfRule.Exprs})
+	}
+	if err := n.conn.Flush(); err != nil {
+		return fmt.Errorf("failed to add the rules of default-deny networks: %w", err)
+	}
+	return nil
+}
+
+// nftables.defaultDenyDrops - the drop rules of the default-deny networks, sorted by range, each preceded by
+// its log rule if drops are logged
+func (n *nftablesManager) defaultDenyDrops() []ruleInfo {
+	keys := []string{}
+	for key := range n.defaultDenyRules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rules := []ruleInfo{}
+	for _, key := range keys {
+		rules = append(rules, n.defaultDenyRules[key].rulesMap[key]...)
+	}
+	return rules
+}
+
+// nftables.SetMSSClamp - replaces the mangle table rules clamping the MSS of tcp connections to the path
+// mtu, the equivalent of the iptables TCPMSS target
+func (n *nftablesManager) SetMSSClamp(ranges []net.IPNet) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	wanted := make(ruletable)
+	for _, r := range ranges {
+		rule := mssClampRule(r)
+		rule.nfRule = &nftables.Rule{
+			Table:    mangleTable,
+			Chain:    &nftables.Chain{Name: rule.chain, Table: mangleTable},
+			UserData: []byte(genRuleKey(rule.rule...)),
+			Exprs:    nfMSSClampExprs(r),
+		}
+		wanted[r.String()] = rulesCfg{isIpv4: r.IP.To4() != nil, rulesMap: map[string][]ruleInfo{r.String(): {rule}}}
+	}
+	if err := n.replaceRules(n.mssClampRules, wanted); err != nil {
+		return fmt.Errorf("failed to update the MSS clamping rules: %w", err)
+	}
+	n.mssClampRules = wanted
+	return nil
+}
+
+// nftables.addMangleChains - adds the base chains of the mangle table, they hook at the mangle priority
+// like the chains of the iptables mangle table
+func (n *nftablesManager) addMangleChains() {
+	n.conn.AddTable(mangleTable)
+	for _, chain := range []*nftables.Chain{
+		{Name: "PREROUTING", Type: nftables.ChainTypeFilter, Hooknum: nftables.ChainHookPrerouting},
+		{Name: "FORWARD", Type: nftables.ChainTypeFilter, Hooknum: nftables.ChainHookForward},
+		{Name: "OUTPUT", Type: nftables.ChainTypeRoute, Hooknum: nftables.ChainHookOutput},
+	} {
+		chain.Table = mangleTable
+		chain.Priority = nftables.ChainPriorityMangle
+		n.conn.AddChain(chain)
+	}
+}
+
+// nftables.replaceRules - replaces the rules of the current rule table by the rules of the wanted one in
+// a single transaction, so the rules kept are never missing; the lock is held by the caller
+func (n *nftablesManager) replaceRules(current, wanted ruletable) error {
+	for _, cfg := range current {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				nfRule, err := n.getRule(rule.table, rule.chain, genRuleKey(rule.rule...))
+				if err != nil {
+					logger.Log(1, "rule to replace is missing:", strings.Join(rule.rule, " "))
+					continue
+				}
+				n.conn.DelRule(nfRule)
+			}
+		}
+	}
+	for _, cfg := range wanted {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				n.conn.AddRule(rule.nfRule.(*nftables.Rule))
+			}
+		}
+	}
+	return n.conn.Flush()
+}
+
+// nftables.SetEgressMarks - replaces the mangle table rules marking the traffic from the sources to the
+// destinations of the egress policies, in PREROUTING for forwarded and OUTPUT for local traffic
+func (n *nftablesManager) SetEgressMarks(marks []EgressMark) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	wanted := make(ruletable)
+	for _, m := range marks {
+		for _, family := range []string{ipv4, ipv6} {
+			rules := []ruleInfo{}
+			for _, pair := range egressMarkPairs(m, family == ipv4) {
+				for _, chain := range []string{"PREROUTING", "OUTPUT"} {
+					rule := egressMarkRule(m, pair[0], *pair[1], chain)
+					rule.nfRule = &nftables.Rule{
+						Table:    mangleTable,
+						Chain:    &nftables.Chain{Name: chain, Table: mangleTable},
+						UserData: []byte(genRuleKey(rule.rule...)),
+						Exprs:    nfEgressMarkExprs(m, pair[0], *pair[1]),
+					}
+					rules = append(rules, rule)
+				}
+			}
+			if len(rules) == 0 {
+				continue
+			}
+			key := fmt.Sprintf("0x%x/%s", m.Mark, family)
+			wanted[key] = rulesCfg{isIpv4: family == ipv4, rulesMap: map[string][]ruleInfo{key: rules}}
+		}
+	}
+	if err := n.replaceRules(n.egressMarkRules, wanted); err != nil {
+		return fmt.Errorf("failed to update the egress mark rules: %w", err)
+	}
+	n.egressMarkRules = wanted
+	return nil
+}
+
+// nftables.SetRateLimits - the per address buckets of ext client rate limiting rely on the iptables
+// hashlimit match, not supported with nftables
+func (n *nftablesManager) SetRateLimits(server string, limits []RateLimit) error {
+	if len(limits) == 0 {
+		return nil
+	}
+	return errors.New("ext client rate limiting requires iptables")
+}
+
+// nftables.SetOutboundOnly - replaces the rules of outbound only mode, appended to the input chain
+// so the drop rules of blocked peers stay ahead of them
+func (n *nftablesManager) SetOutboundOnly(enabled bool, allowed []Port) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	for _, rule := range n.inboundRules {
+		if err := n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...)); err != nil {
+			logger.Log(1, fmt.Sprintf("failed to delete rule: %v, Err: %s", rule.rule, err.Error()))
+		}
+	}
+	n.inboundRules = nil
+	if !enabled {
+		return nil
+	}
+	iface := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte(ncutils.GetInterfaceName() + "\x00"),
+		},
+	}
+	rules := outboundOnlyRules(allowed)
+	for idx, rule := range rules {
+		exprs := append([]expr.Any{}, iface...)
+		switch {
+		case idx == 0:
+			exprs = append(exprs,
+				&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+				&expr.Bitwise{
+					SourceRegister: 1,
+					DestRegister:   1,
+					Len:            4,
+					Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitESTABLISHED | expr.CtStateBitRELATED),
+					Xor:            binaryutil.NativeEndian.PutUint32(0),
+				},
+				&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(0)},
+				&expr.Counter{},
+				&expr.Verdict{Kind: expr.VerdictAccept},
+			)
+		case idx <= len(allowed):
+			port := allowed[idx-1]
+			proto := byte(unix.IPPROTO_TCP)
+			if port.Protocol == "udp" {
+				proto = unix.IPPROTO_UDP
+			}
+			exprs = append(exprs,
+				&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+				&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.BigEndian.PutUint16(uint16(port.Port))},
+				&expr.Counter{},
+				&expr.Verdict{Kind: expr.VerdictAccept},
+			)
+		default:
+			exprs = append(exprs,
+				&expr.Counter{},
+				&expr.Reject{Type: unix.NFT_REJECT_ICMPX_UNREACH, Code: unix.NFT_REJECT_ICMPX_PORT_UNREACH},
+			)
+		}
+		rule.nfRule = &nftables.Rule{
+			Table:    filterTable,
+			Chain:    &nftables.Chain{Name: rule.chain, Table: filterTable},
+			UserData: []byte(genRuleKey(rule.rule...)),
+			Exprs:    exprs,
+		}
+		n.conn.AddRule(rule.nfRule.(*nftables.Rule))
+		if err := n.conn.Flush(); err != nil {
+			return fmt.Errorf("failed to add rule %v: %w", rule.rule, err)
+		}
+		n.inboundRules = append(n.inboundRules, rule)
+	}
+	return nil
+}
+
+// nftables.SetAppMark - application routing relies on the iptables cgroup match, not supported with nftables
+func (n *nftablesManager) SetAppMark(cgroupMatch []string, mark int) error {
+	if len(cgroupMatch) == 0 {
+		return nil
+	}
+	return errors.New("application routing requires iptables")
+}
+
+// nftables.SetStaticNat - replaces the rules of the one-to-one nat of public addresses to ext clients,
+// inserted at the top of the nat chains ahead of the masquerade rules of egress ranges
+func (n *nftablesManager) SetStaticNat(mappings []StaticNat) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	for addr, cfg := range n.staticNatRules {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				if err := n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...)); err != nil {
+					logger.Log(1, fmt.Sprintf("failed to delete rule [%s]: %v, Err: %s", addr, rule.rule, err.Error()))
+				}
+			}
+		}
+	}
+	n.staticNatRules = make(ruletable)
+	announced := make(map[string]string)
+	defer announceStaticNat(announced)
+	for _, m := range mappings {
+		iface, err := staticNatInterface(m.Public)
+		if err != nil {
+			return err
+		}
+		isIpv4 := m.Public.To4() != nil
+		added := []ruleInfo{}
+		for _, rule := range staticNatRules(m, iface) {
+			nfRule := &nftables.Rule{
+				Table:    natTable,
+				Chain:    &nftables.Chain{Name: rule.chain, Table: natTable},
+				UserData: []byte(genRuleKey(rule.rule...)),
+				Exprs:    nfStaticNatExprs(m, iface, rule.chain == nattablePRTChain),
+			}
+			n.conn.InsertRule(nfRule)
+			if err := n.conn.Flush(); err != nil {
+				n.staticNatRules[m.Public.String()] = rulesCfg{isIpv4: isIpv4, rulesMap: map[string][]ruleInfo{m.Mesh.String(): added}}
+				return fmt.Errorf("failed to add rule %v for static nat of %s: %w", rule.rule, m.Public, err)
+			}
+			rule.nfRule = nfRule
+			added = append(added, rule)
+		}
+		n.staticNatRules[m.Public.String()] = rulesCfg{isIpv4: isIpv4, rulesMap: map[string][]ruleInfo{m.Mesh.String(): added}}
+		announced[m.Public.String()] = iface
+	}
+	return nil
+}
+
+// nftables.SetPolicyQueue - replaces the rules queueing new connections from the mesh to the policy hook,
+// at the top of the input and forward chains below the drop rules of blocked peers
+func (n *nftablesManager) SetPolicyQueue(enabled bool, queue uint16, failOpen bool) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	defer n.saveRuleState()
+	if err := n.ctx.Err(); err != nil {
+		return err
+	}
+	for _, rule := range n.policyQueueRules {
+		if err := n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...)); err != nil {
+			logger.Log(1, fmt.Sprintf("failed to delete rule: %v, Err: %s", rule.rule, err.Error()))
+		}
+	}
+	n.policyQueueRules = nil
+	if !enabled {
+		return nil
+	}
+	var flag expr.QueueFlag
+	if failOpen {
+		flag = expr.QueueFlagBypass
+	}
+	for _, rule := range policyQueueRules(queue, failOpen) {
+		nfRule := &nftables.Rule{
+			Table:    filterTable,
+			Chain:    &nftables.Chain{Name: rule.chain, Table: filterTable},
+			UserData: []byte(genRuleKey(rule.rule...)),
+			Exprs: []expr.Any{
+				&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+				&expr.Cmp{
+					Op:       expr.CmpOpEq,
+					Register: 1,
+					Data:     []byte(ncutils.GetInterfaceName() + "\x00"),
+				},
+				&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+				&expr.Bitwise{
+					SourceRegister: 1,
+					DestRegister:   1,
+					Len:            4,
+					Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitNEW),
+					Xor:            binaryutil.NativeEndian.PutUint32(0),
+				},
+				&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(0)},
+				&expr.Counter{},
+				&expr.Queue{Num: queue, Flag: flag},
+			},
+		}
+		n.conn.InsertRule(nfRule)
+		if err := n.conn.Flush(); err != nil {
+			return fmt.Errorf("failed to add rule %v: %w", rule.rule, err)
+		}
+		rule.nfRule = nfRule
+		n.policyQueueRules = append(n.policyQueueRules, rule)
+	}
+	return n.reinsertBlockRules()
+}
+
+// nftables.reinsertBlockRules - moves the drop rules of the blocked peers back to the top of their chains
+func (n *nftablesManager) reinsertBlockRules() error {
+	for _, cfg := range n.blockRules {
+		for _, rules := range cfg.rulesMap {
+			for _, rule := range rules {
+				nfRule, ok := rule.nfRule.(*nftables.Rule)
+				if !ok {
+					continue
+				}
+				n.deleteRule(rule.table, rule.chain, genRuleKey(rule.rule...))
+				n.conn.InsertRule(&nftables.Rule{Table: nfRule.Table, Chain: nfRule.Chain, UserData: nfRule.UserData, Exprs: nfRule.Exprs})
+			}
+		}
+	}
+	if err := n.conn.Flush(); err != nil {
+		return fmt.Errorf("failed to reposition the rules of blocked peers: %w", err)
+	}
+	return nil
+}
+
+// nfStaticNatExprs - expressions translating the destination of packets to the public address to the
+// ext client, or the source of packets of the ext client leaving through iface to the public address
+func nfStaticNatExprs(m StaticNat, iface string, source bool) []expr.Any {
+	// offset of the source address in the ip header, followed by the destination address
+	proto, public, mesh, offset := byte(unix.NFPROTO_IPV4), m.Public.To4(), m.Mesh.To4(), uint32(12)
+	if public == nil {
+		proto, public, mesh, offset = unix.NFPROTO_IPV6, m.Public.To16(), m.Mesh.To16(), 8
+	}
+	exprs := []expr.Any{}
+	match, target, natType := public, mesh, expr.NATTypeDestNAT
+	if source {
+		match, target, natType = mesh, public, expr.NATTypeSourceNAT
+		exprs = append(exprs,
+			&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte(iface + "\x00")},
+		)
+	} else {
+		offset += uint32(len(public))
+	}
+	return append(exprs,
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: uint32(len(match))},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: match},
+		&expr.Counter{},
+		&expr.Immediate{Register: 1, Data: target},
+		&expr.NAT{Type: natType, Family: uint32(proto), RegAddrMin: 1},
+	)
+}
+
+// nfBlockExprs - expressions dropping packets received from (inbound) or sent to an address on the netmaker interface
+func nfBlockExprs(addr net.IPNet, inbound bool) []expr.Any {
+	// offset of the source address in the ip header, followed by the destination address
+	proto, ip, offset := byte(unix.NFPROTO_IPV4), addr.IP.To4(), uint32(12)
+	if ip == nil {
+		proto, ip, offset = unix.NFPROTO_IPV6, addr.IP.To16(), 8
+	}
+	ifaceKey := expr.MetaKeyIIFNAME
+	if !inbound {
+		ifaceKey, offset = expr.MetaKeyOIFNAME, offset+uint32(len(ip))
+	}
+	ones, _ := addr.Mask.Size()
+	mask := net.CIDRMask(ones, len(ip)*8)
+	return []expr.Any{
+		&expr.Meta{Key: ifaceKey, Register: 1},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte(ncutils.GetInterfaceName() + "\x00"),
+		},
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: uint32(len(ip))},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: uint32(len(ip)), Mask: mask, Xor: make([]byte, len(ip))},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ip.Mask(mask)},
+		&expr.Counter{},
+		&expr.Verdict{Kind: expr.VerdictDrop},
+	}
+}
+
+// nfInterNetworkExprs - expressions accepting or dropping packets routed through the netmaker interface
+// from the source to the destination range of the rule
+func nfInterNetworkExprs(r InterNetworkRule) []expr.Any {
+	// offset of the source address in the ip header, followed by the destination address
+	proto, src, dst, offset := byte(unix.NFPROTO_IPV4), r.Src.IP.To4(), r.Dst.IP.To4(), uint32(12)
+	if src == nil {
+		proto, src, dst, offset = unix.NFPROTO_IPV6, r.Src.IP.To16(), r.Dst.IP.To16(), 8
+	}
+	iface := []byte(ncutils.GetInterfaceName() + "\x00")
+	exprs := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: iface},
+		&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: iface},
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+	}
+	for idx, cidr := range []net.IPNet{r.Src, r.Dst} {
+		ip := []net.IP{src, dst}[idx]
+		ones, _ := cidr.Mask.Size()
+		mask := net.CIDRMask(ones, len(ip)*8)
+		exprs = append(exprs,
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset + uint32(idx*len(ip)), Len: uint32(len(ip))},
+			&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: uint32(len(ip)), Mask: mask, Xor: make([]byte, len(ip))},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ip.Mask(mask)},
+		)
+	}
+	verdict := expr.VerdictDrop
+	if r.Allow {
+		verdict = expr.VerdictAccept
+	}
+	return append(exprs, &expr.Counter{}, &expr.Verdict{Kind: verdict})
+}
+
+// nfDefaultDenyExprs - expressions dropping the traffic of the range from the netmaker interface leaving
+// through another interface, or logging it rate limited
+func nfDefaultDenyExprs(r net.IPNet, log bool) []expr.Any {
+	iface := []byte(ncutils.GetInterfaceName() + "\x00")
+	exprs := append([]expr.Any{
+		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: iface},
+		&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: iface},
+	}, nfRangeExprs(r, true)...)
+	exprs = append(exprs, &expr.Counter{}, &expr.Verdict{Kind: expr.VerdictDrop})
+	if log {
+		return nfDropLogExprs(exprs)
+	}
+	return exprs
+}
+
+// nfDropLogExprs - expressions logging the packets dropped by the drop expressions rate limited, the
+// closing counter and verdict replaced by the limit and the log
+func nfDropLogExprs(drop []expr.Any) []expr.Any {
+	return append(append([]expr.Any{}, drop[:len(drop)-2]...),
+		&expr.Limit{Type: expr.LimitTypePkts, Rate: dropLogRate, Unit: expr.LimitTimeMinute, Burst: dropLogBurst},
+		&expr.Log{Key: 1 << unix.NFTA_LOG_PREFIX, Data: []byte(dropLogPrefix)},
+	)
+}
+
+// nfInterNetworkReplyExprs - expressions accepting the replies of the family routed through the netmaker interface
+func nfInterNetworkReplyExprs(isIpv4 bool) []expr.Any {
+	proto := byte(unix.NFPROTO_IPV4)
+	if !isIpv4 {
+		proto = unix.NFPROTO_IPV6
+	}
+	iface := []byte(ncutils.GetInterfaceName() + "\x00")
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: iface},
+		&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: iface},
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitESTABLISHED | expr.CtStateBitRELATED),
+			Xor:            binaryutil.NativeEndian.PutUint32(0),
+		},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(0)},
+		&expr.Counter{},
+		&expr.Verdict{Kind: expr.VerdictAccept},
+	}
+}
+
+// nfEgressNatExprs - expressions translating the source of packets sent to an egress range over its interface,
+// to the interface address or to the source address of the nat mode
+func nfEgressNatExprs(iface string, dst net.IPNet, nat EgressNat) []expr.Any {
+	// offset of the destination address in the ip header
+	proto, ip, offset := byte(unix.NFPROTO_IPV4), dst.IP.To4(), uint32(16)
+	if ip == nil {
+		proto, ip, offset = unix.NFPROTO_IPV6, dst.IP.To16(), 24
+	}
+	ones, _ := dst.Mask.Size()
+	mask := net.CIDRMask(ones, len(ip)*8)
+	exprs := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte(iface + "\x00"),
+		},
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: uint32(len(ip))},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: uint32(len(ip)), Mask: mask, Xor: make([]byte, len(ip))},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ip.Mask(mask)},
+		&expr.Counter{},
+	}
+	if nat.Mode != EgressNatSNAT {
+		return append(exprs, &expr.Masq{})
+	}
+	source := nat.Source.To4()
+	if source == nil {
+		source = nat.Source.To16()
+	}
+	return append(exprs,
+		&expr.Immediate{Register: 1, Data: source},
+		&expr.NAT{Type: expr.NATTypeSourceNAT, Family: uint32(proto), RegAddrMin: 1},
+	)
 }
 
 // private functions
@@ -515,6 +1510,69 @@ func (n *nftablesManager) removeJumpRules() {
 	}
 }
 
+// forwardAcceptRuleKey - key of the rule accepting traffic from the netmaker interface in the forward chain
+var forwardAcceptRuleKey = genRuleKey("-i", ncutils.GetInterfaceName(), "-j", "ACCEPT")
+
 func genRuleKey(rule ...string) string {
 	return strings.Join(rule, ":")
 }
+
+// nfRangeExprs - expressions matching the source or destination address of the packet against the range,
+// including the address family
+func nfRangeExprs(r net.IPNet, src bool) []expr.Any {
+	// offsets of the source and destination addresses in the ip header
+	proto, ip, offset := byte(unix.NFPROTO_IPV4), r.IP.To4(), uint32(12)
+	if ip == nil {
+		proto, ip, offset = unix.NFPROTO_IPV6, r.IP.To16(), 8
+	}
+	if !src {
+		offset += uint32(len(ip))
+	}
+	ones, _ := r.Mask.Size()
+	mask := net.CIDRMask(ones, len(ip)*8)
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: uint32(len(ip))},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: uint32(len(ip)), Mask: mask, Xor: make([]byte, len(ip))},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ip.Mask(mask)},
+	}
+}
+
+// nfMSSClampExprs - expressions setting the MSS option of tcp SYN packets forwarded to the range over the
+// netmaker interface to the path mtu: tcp option maxseg size set rt mtu
+func nfMSSClampExprs(r net.IPNet) []expr.Any {
+	exprs := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte(ncutils.GetInterfaceName() + "\x00")},
+	}
+	exprs = append(exprs, nfRangeExprs(r, false)...)
+	return append(exprs,
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.IPPROTO_TCP}},
+		// tcp flags & (syn|rst) == syn
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 13, Len: 1},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: 1, Mask: []byte{0x06}, Xor: []byte{0x00}},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{0x02}},
+		&expr.Rt{Register: 1, Key: expr.RtTCPMSS},
+		&expr.Byteorder{SourceRegister: 1, DestRegister: 1, Op: expr.ByteorderHton, Len: 2, Size: 2},
+		&expr.Exthdr{SourceRegister: 1, Type: 2, Offset: 2, Len: 2, Op: expr.ExthdrOpTcpopt},
+	)
+}
+
+// nfEgressMarkExprs - expressions setting the bits of the mark of the egress policy on the traffic from the
+// source, any if nil, to the destination: meta mark set meta mark & ~mask | mark
+func nfEgressMarkExprs(m EgressMark, src *net.IPNet, dst net.IPNet) []expr.Any {
+	exprs := []expr.Any{}
+	if src != nil {
+		exprs = append(exprs, nfRangeExprs(*src, true)...)
+	}
+	exprs = append(exprs, nfRangeExprs(dst, false)...)
+	return append(exprs,
+		&expr.Meta{Key: expr.MetaKeyMARK, Register: 1},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: 4,
+			Mask: binaryutil.NativeEndian.PutUint32(^uint32(m.Mask)),
+			Xor:  binaryutil.NativeEndian.PutUint32(uint32(m.Mark & m.Mask))},
+		&expr.Meta{Key: expr.MetaKeyMARK, SourceRegister: true, Register: 1},
+	)
+}
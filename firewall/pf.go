@@ -0,0 +1,482 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+)
+
+const (
+	// pfNatTable - table of the translation rules, loaded before the filter rules of the anchor
+	pfNatTable = "nat"
+	// pfFilterTable - table of the filter rules
+	pfFilterTable = "filter"
+)
+
+// pfManager - manages the netmaker rules in a pf anchor; the rules are kept in the same rule tables
+// as the linux managers and the whole anchor is loaded on every change, as pf replaces rulesets atomically
+type pfManager struct {
+	ctx    context.Context
+	anchor string
+	// token - reference of the pf enable request, released on FlushAll
+	token        string
+	ingRules     serverrulestable
+	engressRules serverrulestable
+	// blockRules - block rules of the locally blocked peers, keyed by peer and address
+	blockRules ruletable
+	// inboundRules - rules of outbound only mode
+	inboundRules []ruleInfo
+	mux          sync.Mutex
+}
+
+// pfManager.CreateChains - enables pf and empties the netmaker anchor
+func (p *pfManager) CreateChains() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err := p.enable(); err != nil {
+		return err
+	}
+	return pfctl("", "-a", p.anchor, "-F", "all")
+}
+
+// pfManager.ForwardRule - pf passes forwarded traffic unless blocked, forwarding itself is a sysctl
+func (p *pfManager) ForwardRule() error {
+	return nil
+}
+
+// pfManager.VerifyChains - checks that pf is enabled and the anchor holds the netmaker rules,
+// reloading the anchor when rules were flushed by other tools
+func (p *pfManager) VerifyChains() ([]string, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	issues := []string{}
+	info, err := pfctlOutput("-s", "info")
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(info, "Status: Enabled") {
+		issues = append(issues, "pf was disabled")
+		if err := p.enable(); err != nil {
+			return issues, err
+		}
+	}
+	loaded := 0
+	for _, kind := range []string{"nat", "rules"} {
+		out, err := pfctlOutput("-a", p.anchor, "-s", kind)
+		if err != nil {
+			return issues, err
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if strings.TrimSpace(line) != "" {
+				loaded++
+			}
+		}
+	}
+	if loaded < len(p.rules()) {
+		issues = append(issues, fmt.Sprintf("anchor %s holds %d of %d rules", p.anchor, loaded, len(p.rules())))
+		if err := p.load(); err != nil {
+			return issues, err
+		}
+	}
+	return issues, nil
+}
+
+// pfManager.InsertEgressRoutingRules - inserts the nat rules of the egress ranges of the gateway
+func (p *pfManager) InsertEgressRoutingRules(server string, egressInfo models.EgressInfo) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	ruleTable := p.ruleTable(server, egressTable)
+	egressGwRoutes := make(map[string][]ruleInfo)
+	for _, egressGwRange := range egressInfo.EgressGWCfg.Ranges {
+		egressGwRoutes[egressRangeKey(egressGwRange)] = []ruleInfo{}
+		nat := egressNat(egressGwRange, egressInfo.EgressGWCfg.NatEnabled == "yes")
+		if nat.Mode == EgressNatRouted {
+			continue
+		}
+		dst := toIPNet(egressGwRange)
+		egressRangeIface, err := getInterfaceName(dst)
+		if err != nil {
+			logger.Log(0, "failed to get interface name: ", egressRangeIface, err.Error())
+			continue
+		}
+		target := "(" + egressRangeIface + ")"
+		if nat.Mode == EgressNatSNAT {
+			target = nat.Source.String()
+		}
+		egressGwRoutes[egressRangeKey(egressGwRange)] = []ruleInfo{{
+			rule:  []string{"nat", "on", egressRangeIface, pfFamily(dst.IP), "from", "any", "to", dst.String(), "->", target},
+			table: pfNatTable,
+			chain: p.anchor,
+		}}
+	}
+	ruleTable[egressInfo.EgressID] = rulesCfg{
+		isIpv4:   isAddrIpv4(egressInfo.EgressGwAddr.String()),
+		network:  egressNetwork(egressInfo),
+		rulesMap: egressGwRoutes,
+	}
+	return p.load()
+}
+
+// pfManager.RemoveRoutingRules - removes the rules of a gateway from a rule table
+func (p *pfManager) RemoveRoutingRules(server, ruletableName, peerKey string) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := p.ruleTable(server, ruletableName)
+	if _, ok := rulesTable[peerKey]; !ok {
+		return errors.New("peer not found in rule table: " + peerKey)
+	}
+	delete(rulesTable, peerKey)
+	return p.load()
+}
+
+// pfManager.DeleteRoutingRule - removes the rules of a peer on a gateway
+func (p *pfManager) DeleteRoutingRule(server, ruletableName, srcPeerKey, dstPeerKey string) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	rulesTable := p.ruleTable(server, ruletableName)
+	if _, ok := rulesTable[srcPeerKey]; !ok {
+		return errors.New("peer not found in rule table: " + srcPeerKey)
+	}
+	if _, ok := rulesTable[srcPeerKey].rulesMap[dstPeerKey]; !ok {
+		return errors.New("rules not found for: " + dstPeerKey)
+	}
+	delete(rulesTable[srcPeerKey].rulesMap, dstPeerKey)
+	return p.load()
+}
+
+// pfManager.CleanRoutingRules - removes all the rules of a rule table of a server
+func (p *pfManager) CleanRoutingRules(server, ruleTableName string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.deleteRuleTable(server, ruleTableName)
+	if err := p.load(); err != nil {
+		logger.Log(0, "failed to reload pf anchor: ", err.Error())
+	}
+}
+
+// pfManager.FetchRuleTable - fetches a copy of the rule table by table name
+func (p *pfManager) FetchRuleTable(server string, tableName string) ruletable {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.ruleTable(server, tableName).copy()
+}
+
+// pfManager.ListRules - lists the rules of all rule tables
+func (p *pfManager) ListRules() []ManagedRule {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return listManagedRules(p.ingRules, p.engressRules, p.blockRules, nil)
+}
+
+// pfManager.DeleteRuleTable - deletes a rule table
+func (p *pfManager) DeleteRuleTable(server, ruleTableName string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.deleteRuleTable(server, ruleTableName)
+}
+
+// pfManager.SaveRules - saves the rule table by table name
+func (p *pfManager) SaveRules(server, tableName string, rules ruletable) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	switch tableName {
+	case ingressTable:
+		p.ingRules[server] = rules.copy()
+	case egressTable:
+		p.engressRules[server] = rules.copy()
+	case blockTable:
+		p.blockRules = rules.copy()
+	}
+}
+
+// pfManager.BlockPeers - replaces the rules dropping the traffic of the locally blocked peers
+func (p *pfManager) BlockPeers(peers map[string][]net.IPNet) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	iface := ncutils.GetInterfaceName()
+	p.blockRules, _, _ = diffBlockRules(p.blockRules, peers, func(_ string, addr net.IPNet) []ruleInfo {
+		return []ruleInfo{
+			{rule: []string{"block", "drop", "in", "quick", "on", iface, "from", addr.String(), "to", "any"}, table: pfFilterTable, chain: p.anchor},
+			{rule: []string{"block", "drop", "out", "quick", "on", iface, "from", "any", "to", addr.String()}, table: pfFilterTable, chain: p.anchor},
+		}
+	})
+	return p.load()
+}
+
+// pfManager.SetOutboundOnly - replaces the rules rejecting inbound connections from the netmaker networks
+// to ports other than the allowed ones, replies pass through the states of the outbound connections
+func (p *pfManager) SetOutboundOnly(enabled bool, allowed []Port) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	p.inboundRules = nil
+	if !enabled {
+		return p.load()
+	}
+	ranges := []string{}
+	for _, node := range config.GetNodes() {
+		for _, network := range []net.IPNet{node.NetworkRange, node.NetworkRange6} {
+			if network.IP != nil {
+				ranges = append(ranges, network.String())
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return p.load()
+	}
+	iface := ncutils.GetInterfaceName()
+	from := "{ " + strings.Join(ranges, " ") + " }"
+	p.inboundRules = append(p.inboundRules, ruleInfo{
+		rule:  []string{"pass", "out", "quick", "on", iface, "all", "keep", "state"},
+		table: pfFilterTable, chain: p.anchor,
+	})
+	for _, protocol := range []string{"tcp", "udp"} {
+		ports := []string{}
+		for _, port := range allowed {
+			if port.Protocol == protocol {
+				ports = append(ports, strconv.Itoa(port.Port))
+			}
+		}
+		if len(ports) == 0 {
+			continue
+		}
+		sort.Strings(ports)
+		p.inboundRules = append(p.inboundRules, ruleInfo{
+			rule: []string{"pass", "in", "quick", "on", iface, "proto", protocol, "from", from,
+				"to", "any", "port", "{ " + strings.Join(ports, " ") + " }", "keep", "state"},
+			table: pfFilterTable, chain: p.anchor,
+		})
+	}
+	p.inboundRules = append(p.inboundRules, ruleInfo{
+		rule:  []string{"block", "return", "in", "quick", "on", iface, "from", from, "to", "any"},
+		table: pfFilterTable, chain: p.anchor,
+	})
+	return p.load()
+}
+
+// pfManager.SetAppMark - application routing relies on cgroups, not available with pf
+func (p *pfManager) SetAppMark(cgroupMatch []string, mark int) error {
+	if len(cgroupMatch) == 0 {
+		return nil
+	}
+	return errors.New("application routing is not supported with pf")
+}
+
+// pfManager.SetStaticNat - one-to-one nat of ext clients is only available on linux
+func (p *pfManager) SetStaticNat(mappings []StaticNat) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+	return errors.New("static nat of ext clients is not supported with pf")
+}
+
+// pfManager.SetPolicyQueue - the policy hook relies on nfqueue, only available on linux
+func (p *pfManager) SetPolicyQueue(enabled bool, queue uint16, failOpen bool) error {
+	if !enabled {
+		return nil
+	}
+	return errors.New("the policy hook is not supported with pf")
+}
+
+// pfManager.FlushAll - empties the netmaker anchor and releases the pf enable reference,
+// it runs regardless of ctx as it cleans up on shutdown
+func (p *pfManager) FlushAll() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err := pfctl("", "-a", p.anchor, "-F", "all"); err != nil {
+		logger.Log(0, "failed to flush pf anchor: ", err.Error())
+	}
+	if p.token != "" {
+		pfRelease(p.token)
+		p.token = ""
+	}
+	p.ingRules = make(serverrulestable)
+	p.engressRules = make(serverrulestable)
+	p.blockRules = make(ruletable)
+	p.inboundRules = nil
+}
+
+// pfManager.enable - enables pf, keeping the reference of the request when pf counts them
+func (p *pfManager) enable() error {
+	token, err := pfEnable()
+	if err != nil {
+		return err
+	}
+	if p.token != "" && token != "" {
+		// a reference is held already, release the new one
+		pfRelease(token)
+		return nil
+	}
+	if token != "" {
+		p.token = token
+	}
+	return nil
+}
+
+// pfManager.load - loads all the rules into the anchor, translation rules first as pf requires
+func (p *pfManager) load() error {
+	lines := []string{}
+	for _, table := range []string{pfNatTable, pfFilterTable} {
+		for _, rule := range p.rules() {
+			if rule.table == table {
+				lines = append(lines, strings.Join(rule.rule, " "))
+			}
+		}
+	}
+	return pfctl(strings.Join(lines, "\n")+"\n", "-a", p.anchor, "-f", "-")
+}
+
+// pfManager.rules - all the rules of the anchor, block rules ahead of the rules of outbound only mode
+func (p *pfManager) rules() []ruleInfo {
+	rules := []ruleInfo{}
+	tables := []ruletable{p.blockRules}
+	for _, serverTables := range []serverrulestable{p.ingRules, p.engressRules} {
+		for _, table := range serverTables {
+			tables = append(tables, table)
+		}
+	}
+	for _, table := range tables {
+		for _, cfg := range table {
+			for _, peerRules := range cfg.rulesMap {
+				rules = append(rules, peerRules...)
+			}
+		}
+	}
+	return append(rules, p.inboundRules...)
+}
+
+// pfManager.ruleTable - returns the stored rule table by table name, creating it if needed
+func (p *pfManager) ruleTable(server, tableName string) ruletable {
+	var tables serverrulestable
+	switch tableName {
+	case ingressTable:
+		tables = p.ingRules
+	case egressTable:
+		tables = p.engressRules
+	case blockTable:
+		return p.blockRules
+	default:
+		return make(ruletable)
+	}
+	rules, ok := tables[server]
+	if !ok {
+		rules = make(ruletable)
+		tables[server] = rules
+	}
+	return rules
+}
+
+func (p *pfManager) deleteRuleTable(server, tableName string) {
+	logger.Log(1, "Deleting rules table: ", server, tableName)
+	switch tableName {
+	case ingressTable:
+		delete(p.ingRules, server)
+	case egressTable:
+		delete(p.engressRules, server)
+	case blockTable:
+		p.blockRules = make(ruletable)
+	}
+}
+
+// pfFamily - the pf address family of ip
+func pfFamily(ip net.IP) string {
+	if ip.To4() == nil {
+		return "inet6"
+	}
+	return "inet"
+}
+
+// pfctl - runs pfctl with stdin as its input
+func pfctl(stdin string, args ...string) error {
+	cmd := ncutils.NewCommand("pfctl", args...)
+	cmd.Stdin = stdin
+	if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// pfctlOutput - runs pfctl and returns its output
+func pfctlOutput(args ...string) (string, error) {
+	out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("pfctl", args...))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// pfManager.SetInterNetworkRules - inter-network routing is not supported with pf
+func (p *pfManager) SetInterNetworkRules(rules []InterNetworkRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	return errors.New("inter-network routing is not supported with pf")
+}
+
+// pfManager.SetMSSClamp - MSS clamping is not supported with pf
+func (p *pfManager) SetMSSClamp(ranges []net.IPNet) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+	return errors.New("MSS clamping is not supported with pf")
+}
+
+// pfManager.SetEgressMarks - policy routing of egress traffic is not supported with pf
+func (p *pfManager) SetEgressMarks(marks []EgressMark) error {
+	if len(marks) == 0 {
+		return nil
+	}
+	return errors.New("egress policy routing is not supported with pf")
+}
+
+// pfManager.SetRateLimits - ext client rate limiting is not supported with pf
+func (p *pfManager) SetRateLimits(server string, limits []RateLimit) error {
+	if len(limits) == 0 {
+		return nil
+	}
+	return errors.New("ext client rate limiting is not supported with pf")
+}
+
+// pfManager.SetDefaultDeny - pf has no rules allowing the traffic of gateway peers explicitly, a default-deny
+// network would lose all its forwarded traffic, so only default-allow is supported
+func (p *pfManager) SetDefaultDeny(ranges []net.IPNet) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+	return errors.New("default-deny networks are not supported with pf")
+}
+
+// pfManager.SetDropLogging - logging the dropped packets is not supported with pf
+func (p *pfManager) SetDropLogging(enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	return fmt.Errorf("%w: pf has no drop rules to log", errDropLoggingUnsupported)
+}
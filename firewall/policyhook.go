@@ -0,0 +1,128 @@
+package firewall
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gravitl/netclient/config"
+)
+
+// Flow - the first packet of a new connection from the mesh, as handed to the policy engine
+type Flow struct {
+	ID       uint32 `json:"id"`
+	Hook     string `json:"hook"`
+	Protocol string `json:"protocol"`
+	Src      net.IP `json:"src"`
+	Dst      net.IP `json:"dst"`
+	SrcPort  int    `json:"src_port,omitempty"`
+	DstPort  int    `json:"dst_port,omitempty"`
+}
+
+// policyEngine - decides whether a flow is accepted
+type policyEngine interface {
+	decide(ctx context.Context, flow Flow) (bool, error)
+	close() error
+}
+
+// newPolicyEngine - starts the executable of the policy hook, go plugins need a cgo build of netclient,
+// which the releases are not
+func newPolicyEngine(ctx context.Context, hook config.PolicyHook) (policyEngine, error) {
+	if strings.HasSuffix(hook.Engine, ".so") {
+		return nil, fmt.Errorf("policy engine %s is a go plugin, which is not supported: configure an executable", hook.Engine)
+	}
+	return startProcessEngine(ctx, hook.Engine, hook.Args)
+}
+
+// processEngine - an executable reading the flows as json lines on stdin and answering each with
+// "<id> accept" or "<id> drop" on stdout, answers may come in any order
+type processEngine struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[uint32]chan bool
+	// done - closed once the process stopped answering
+	done chan struct{}
+}
+
+func startProcessEngine(ctx context.Context, name string, args []string) (*processEngine, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start policy engine: %w", err)
+	}
+	p := &processEngine{cmd: cmd, stdin: stdin, pending: make(map[uint32]chan bool), done: make(chan struct{})}
+	go p.readAnswers(stdout)
+	return p, nil
+}
+
+// processEngine.readAnswers - dispatches the answers of the process to the pending flows
+func (p *processEngine) readAnswers(stdout io.Reader) {
+	defer close(p.done)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		id, verdict, found := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		n, err := strconv.ParseUint(id, 10, 32)
+		if !found || err != nil {
+			continue
+		}
+		p.mu.Lock()
+		answer, ok := p.pending[uint32(n)]
+		delete(p.pending, uint32(n))
+		p.mu.Unlock()
+		if ok {
+			answer <- strings.EqualFold(strings.TrimSpace(verdict), "accept")
+		}
+	}
+}
+
+func (p *processEngine) decide(ctx context.Context, flow Flow) (bool, error) {
+	data, err := json.Marshal(flow)
+	if err != nil {
+		return false, err
+	}
+	answer := make(chan bool, 1)
+	p.mu.Lock()
+	p.pending[flow.ID] = answer
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, flow.ID)
+		p.mu.Unlock()
+	}()
+	p.writeMu.Lock()
+	_, err = p.stdin.Write(append(data, '\n'))
+	p.writeMu.Unlock()
+	if err != nil {
+		return false, fmt.Errorf("policy engine: %w", err)
+	}
+	select {
+	case accept := <-answer:
+		return accept, nil
+	case <-p.done:
+		return false, errors.New("policy engine exited")
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func (p *processEngine) close() error {
+	p.stdin.Close()
+	return p.cmd.Wait()
+}
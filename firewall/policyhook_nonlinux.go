@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package firewall
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gravitl/netclient/config"
+)
+
+// RunPolicyHook - the policy hook relies on nfqueue, only available on linux
+func RunPolicyHook(ctx context.Context, hook config.PolicyHook) error {
+	return errors.New("the policy hook is only supported on linux")
+}
@@ -0,0 +1,50 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// rateLimitTable - rule table of the rules limiting the traffic of ext clients, keyed by server and address
+const rateLimitTable = "ratelimit"
+
+// RateLimit - the ceiling of the traffic forwarded from and to an ext client, a zero rate is not limited
+type RateLimit struct {
+	Addr               net.IPNet
+	PacketsPerSecond   int
+	KilobytesPerSecond int
+}
+
+var (
+	// appliedRateLimits - the rate limits last applied by server, keyed by address
+	appliedRateLimits      = make(map[string]*appliedState[map[string]RateLimit])
+	appliedRateLimitsMutex sync.Mutex
+)
+
+// SetRateLimits - replaces the rules limiting the traffic of the ext clients of the server, nil removes them;
+// the rules are only replaced when the limits changed
+func SetRateLimits(server string, limits []RateLimit) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	appliedRateLimitsMutex.Lock()
+	applied, ok := appliedRateLimits[server]
+	if !ok {
+		applied = &appliedState[map[string]RateLimit]{}
+		appliedRateLimits[server] = applied
+	}
+	appliedRateLimitsMutex.Unlock()
+	wanted := make(map[string]RateLimit, len(limits))
+	for _, limit := range limits {
+		wanted[limit.Addr.String()] = limit
+	}
+	changed, err := applied.apply(wanted, func() error {
+		return fwCrtl.SetRateLimits(server, limits)
+	})
+	if err != nil || !changed {
+		return err
+	}
+	// flows offloaded to the fast path would skip the new limits
+	return resetFastPath()
+}
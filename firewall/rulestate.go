@@ -0,0 +1,159 @@
+package firewall
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/logger"
+)
+
+// ruleStateFile - file of the netclient directory holding the rule tables of the firewall manager, so a
+// daemon restarted after a crash can remove the rules its predecessor installed
+const ruleStateFile = "firewall-rules.json"
+
+// savedRule - a rule of a rule table as persisted
+type savedRule struct {
+	Rule  []string `json:"rule"`
+	Table string   `json:"table"`
+	Chain string   `json:"chain"`
+}
+
+// savedRulesCfg - the rules of a peer as persisted
+type savedRulesCfg struct {
+	IsIpv4   bool                   `json:"isipv4"`
+	Network  string                 `json:"network,omitempty"`
+	RulesMap map[string][]savedRule `json:"rules"`
+}
+
+// ruleState - the rule tables persisted, by rule table name and server
+type ruleState map[string]map[string]map[string]savedRulesCfg
+
+// ruleStatePath - path of the rule state file
+var ruleStatePath = filepath.Join(config.GetNetclientPath(), ruleStateFile)
+
+// lastRuleState - the rule state last written, the file is only rewritten when the rules changed
+var lastRuleState []byte
+
+// staleRuleRemover - a manager removing the rules a previous daemon installed
+type staleRuleRemover interface {
+	// removeSavedRules - removes the rules of a persisted rule table which are still installed
+	removeSavedRules(rules ruletable)
+}
+
+// saveRuleState - persists all rule tables of a manager by rule table name, the rule tables not kept per
+// server under the empty server; the file is removed when all tables are empty
+func saveRuleState(tables map[string]serverrulestable) {
+	state := ruleState{}
+	for tableName, serverTables := range tables {
+		for server, rules := range serverTables {
+			if len(rules) == 0 {
+				continue
+			}
+			if state[tableName] == nil {
+				state[tableName] = map[string]map[string]savedRulesCfg{}
+			}
+			state[tableName][server] = savedRuleTable(rules)
+		}
+	}
+	if len(state) == 0 {
+		if lastRuleState == nil {
+			return
+		}
+		if err := os.Remove(ruleStatePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Log(1, "failed to remove the firewall rule state:", err.Error())
+			return
+		}
+		lastRuleState = nil
+		return
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		logger.Log(1, "failed to encode the firewall rule state:", err.Error())
+		return
+	}
+	if bytes.Equal(data, lastRuleState) {
+		return
+	}
+	// written to a temporary file renamed over the state, a crash never leaves a partial file
+	if err := os.WriteFile(ruleStatePath+".tmp", data, 0600); err != nil {
+		logger.Log(1, "failed to write the firewall rule state:", err.Error())
+		return
+	}
+	if err := os.Rename(ruleStatePath+".tmp", ruleStatePath); err != nil {
+		logger.Log(1, "failed to write the firewall rule state:", err.Error())
+		return
+	}
+	lastRuleState = data
+}
+
+// loadRuleState - reads the rule tables persisted by a previous daemon, nil if there are none
+func loadRuleState() (ruleState, error) {
+	data, err := os.ReadFile(ruleStatePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	state := ruleState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// savedRuleTable - the persisted form of a rule table
+func savedRuleTable(rules ruletable) map[string]savedRulesCfg {
+	saved := make(map[string]savedRulesCfg, len(rules))
+	for key, cfg := range rules {
+		rulesMap := make(map[string][]savedRule, len(cfg.rulesMap))
+		for peer, infos := range cfg.rulesMap {
+			for _, info := range infos {
+				rulesMap[peer] = append(rulesMap[peer], savedRule{Rule: info.rule, Table: info.table, Chain: info.chain})
+			}
+		}
+		saved[key] = savedRulesCfg{IsIpv4: cfg.isIpv4, Network: cfg.network, RulesMap: rulesMap}
+	}
+	return saved
+}
+
+// ruleTableOf - the rule table of its persisted form, the nftables rules are only identified by the key
+// of their rule spec
+func ruleTableOf(saved map[string]savedRulesCfg) ruletable {
+	rules := make(ruletable, len(saved))
+	for key, cfg := range saved {
+		rulesMap := make(map[string][]ruleInfo, len(cfg.RulesMap))
+		for peer, infos := range cfg.RulesMap {
+			for _, info := range infos {
+				rulesMap[peer] = append(rulesMap[peer], ruleInfo{rule: info.Rule, table: info.Table, chain: info.Chain})
+			}
+		}
+		rules[key] = rulesCfg{isIpv4: cfg.IsIpv4, network: cfg.Network, rulesMap: rulesMap}
+	}
+	return rules
+}
+
+// removeStaleRules - removes the rules of all rule tables persisted by a previous daemon which did not
+// flush them as it crashed or was killed, before the chains are set up again; only the rules recorded
+// are removed, the rules of other tools in the same chains are left alone
+func removeStaleRules(fw firewallController) {
+	remover, ok := fw.(staleRuleRemover)
+	if !ok {
+		return
+	}
+	state, err := loadRuleState()
+	if err != nil {
+		logger.Log(0, "failed to read the firewall rule state, rules of the previous run are not cleaned up:", err.Error())
+		return
+	}
+	for tableName, tables := range state {
+		for server, saved := range tables {
+			logger.Log(0, "removing", tableName, "rules of the previous run for server", server)
+			remover.removeSavedRules(ruleTableOf(saved))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package firewall
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// withRuleStateFile - persists the rule state to a temporary file for the test
+func withRuleStateFile(t *testing.T) {
+	t.Helper()
+	path, last := ruleStatePath, lastRuleState
+	ruleStatePath = filepath.Join(t.TempDir(), ruleStateFile)
+	lastRuleState = nil
+	t.Cleanup(func() {
+		ruleStatePath, lastRuleState = path, last
+	})
+}
+
+// applyTestRules - installs rules of most rule tables and lists
+func applyTestRules(t *testing.T, m *dryRunManager) {
+	t.Helper()
+	_, mesh, _ := net.ParseCIDR("10.10.0.0/16")
+	_, other, _ := net.ParseCIDR("10.20.0.0/16")
+	_, peer, _ := net.ParseCIDR("10.10.0.5/32")
+	for _, err := range []error{
+		m.BlockPeers(map[string][]net.IPNet{"peer": {*peer}}),
+		m.SetInterNetworkRules([]InterNetworkRule{{Src: *mesh, Dst: *other, Allow: true}}),
+		m.SetMSSClamp([]net.IPNet{*mesh}),
+		m.SetRateLimits("server", []RateLimit{{Addr: *peer, PacketsPerSecond: 100}}),
+		m.SetDefaultDeny([]net.IPNet{*other}),
+		m.SetDropLogging(true),
+		m.SetOutboundOnly(true, []Port{{Port: 22, Protocol: "tcp"}}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ingress := ruleInfo{rule: []string{"-s", "10.10.0.6", "-j", "ACCEPT"}, table: defaultIpTable, chain: netmakerFilterChain}
+	if err := m.ipv4Client.Append(ingress.table, ingress.chain, ingress.rule...); err != nil {
+		t.Fatal(err)
+	}
+	m.SaveRules("server", ingressTable, ruletable{"gw": {isIpv4: true, rulesMap: map[string][]ruleInfo{"peer": {ingress}}}})
+}
+
+func TestRuleStateRoundTrip(t *testing.T) {
+	withRuleStateFile(t)
+	m := newTestDryRunManager(t)
+	applyTestRules(t, m)
+	tables := m.ruleTables()
+	saveRuleState(tables)
+	state, err := loadRuleState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tableName, serverTables := range tables {
+		for server, rules := range serverTables {
+			if len(rules) == 0 {
+				if _, ok := state[tableName][server]; ok {
+					t.Errorf("empty %s table of server %q was persisted", tableName, server)
+				}
+				continue
+			}
+			if got := ruleTableOf(state[tableName][server]); !reflect.DeepEqual(got, rules) {
+				t.Errorf("%s table of server %q = %v, want %v", tableName, server, got, rules)
+			}
+		}
+	}
+	for _, tableName := range []string{ingressTable, blockTable, interNetworkTable, mssClampTable, rateLimitTable, defaultDenyTable, inboundTable} {
+		if _, ok := state[tableName]; !ok {
+			t.Errorf("%s table was not persisted", tableName)
+		}
+	}
+	m.persistRules = true
+	m.FlushAll()
+	if state, err := loadRuleState(); err != nil || state != nil {
+		t.Fatalf("loadRuleState() = %v, %v after flushing, want no state", state, err)
+	}
+}
+
+func TestRemoveStaleRules(t *testing.T) {
+	withRuleStateFile(t)
+	m := newTestDryRunManager(t)
+	baseline := m.preview()
+	m.persistRules = true
+	applyTestRules(t, m)
+	if len(m.preview()) <= len(baseline) {
+		t.Fatal("no rules were installed")
+	}
+	// the daemon crashed: a new manager finds the rules of its predecessor in the chains
+	restarted := &dryRunManager{iptablesManager: newTestIptablesManager()}
+	restarted.ipv4Client, restarted.ipv6Client = m.ipv4Client, m.ipv6Client
+	removeStaleRules(restarted)
+	if got := restarted.preview(); !reflect.DeepEqual(got, baseline) {
+		t.Fatalf("rules after removing the stale ones = %v, want %v", got, baseline)
+	}
+}
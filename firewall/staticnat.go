@@ -0,0 +1,35 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+)
+
+// StaticNat - a one-to-one nat of a public address of the host to the mesh address of an ext client:
+// traffic to the public address is forwarded to the ext client and its traffic leaves from the public address
+type StaticNat struct {
+	Public net.IP
+	Mesh   net.IP
+}
+
+// appliedStaticNat - the mesh addresses of the nat mappings last applied, by public address
+var appliedStaticNat appliedState[map[string]string]
+
+// SetStaticNat - replaces the one-to-one nat mappings, nil removes them
+func SetStaticNat(mappings []StaticNat) error {
+	if fwCrtl == nil {
+		return errors.New("firewall is not initialized yet")
+	}
+	wanted := make(map[string]string, len(mappings))
+	for _, m := range mappings {
+		wanted[m.Public.String()] = m.Mesh.String()
+	}
+	changed, err := appliedStaticNat.apply(wanted, func() error {
+		return fwCrtl.SetStaticNat(mappings)
+	})
+	if err != nil || !changed {
+		return err
+	}
+	// flows offloaded to the fast path keep the translation they were offloaded with
+	return resetFastPath()
+}
@@ -0,0 +1,119 @@
+package firewall
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// staticNatAddrs - public addresses of the static nat mappings added by netclient to their interface,
+// by address; addresses configured by the admin are used as they are and never removed
+var staticNatAddrs = map[string]string{}
+
+// staticNatInterface - the interface holding or routing the public address of a mapping
+func staticNatInterface(public net.IP) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(public) && iface.Name != ncutils.GetInterfaceName() {
+				return iface.Name, nil
+			}
+		}
+	}
+	if name, ok := staticNatAddrs[public.String()]; ok {
+		return name, nil
+	}
+	routes, err := netlink.RouteGet(public)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range routes {
+		iface, err := net.InterfaceByIndex(r.LinkIndex)
+		if err == nil && iface.Name != ncutils.GetInterfaceName() && iface.Flags&net.FlagLoopback == 0 {
+			return iface.Name, nil
+		}
+	}
+	return "", errors.New("no interface found for public address " + public.String())
+}
+
+// announceStaticNat - adds the public addresses to their interfaces, announcing ipv4 addresses with
+// gratuitous arp, and removes the addresses added before which are no longer mapped
+func announceStaticNat(wanted map[string]string) {
+	if config.Netclient().FirewallDryRun {
+		return
+	}
+	for addr, iface := range staticNatAddrs {
+		if wanted[addr] == iface {
+			continue
+		}
+		if err := staticNatAddr(netlink.AddrDel, addr, iface); err != nil {
+			logger.Log(0, "failed to remove static nat address", addr, err.Error())
+		}
+		delete(staticNatAddrs, addr)
+	}
+	for addr, iface := range wanted {
+		if _, ok := staticNatAddrs[addr]; ok || hasAddress(iface, addr) {
+			continue
+		}
+		if err := staticNatAddr(netlink.AddrAdd, addr, iface); err != nil {
+			logger.Log(0, "failed to add static nat address", addr, err.Error())
+			continue
+		}
+		staticNatAddrs[addr] = iface
+		if net.ParseIP(addr).To4() == nil {
+			// the kernel announces ipv6 addresses with unsolicited neighbor advertisements
+			continue
+		}
+		if _, err := exec.LookPath("arping"); err == nil {
+			if err := exec.Command("arping", "-U", "-c", "1", "-I", iface, addr).Run(); err != nil {
+				logger.Log(1, "failed to announce static nat address", addr, err.Error())
+			}
+		}
+	}
+}
+
+// staticNatAddr - adds or deletes a public address as a host address of the interface
+func staticNatAddr(op func(netlink.Link, *netlink.Addr) error, addr, iface string) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(addr)
+	nlAddr := &netlink.Addr{IPNet: &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}}
+	if ip.To4() == nil {
+		nlAddr.IPNet.Mask = net.CIDRMask(128, 128)
+		nlAddr.Flags = unix.IFA_F_NODAD
+	}
+	return op(link, nlAddr)
+}
+
+// hasAddress - checks if the interface holds the address
+func hasAddress(iface, addr string) bool {
+	i, err := net.InterfaceByName(iface)
+	if err != nil {
+		return false
+	}
+	addrs, err := i.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(net.ParseIP(addr)) {
+			return true
+		}
+	}
+	return false
+}
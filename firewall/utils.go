@@ -1,19 +1,73 @@
 package firewall
 
 import (
+	"fmt"
+	"net"
 	"net/netip"
+	"strconv"
+	"strings"
 )
 
-// isAddrIpv4 - CIDR notation (198.0.0.1/24) return if ipnet is ipv4 or ipv6
+// isAddrIpv4 - CIDR notation (198.0.0.1/24) or plain address, return if it is ipv4 or ipv6
 func isAddrIpv4(addr string) bool {
-	isIpv4 := true
-	prefix, err := netip.ParsePrefix(addr)
+	prefix, err := parsePrefix(addr)
 	if err != nil {
-		return isIpv4
+		return true
 	}
+	return prefix.Addr().Is4()
+}
+
+// parsePrefix - parses an address or a cidr as received from the server into a prefix: a plain
+// address becomes a host prefix, an ipv4-mapped ipv6 address or prefix is unmapped to ipv4 and the
+// zone of an ipv6 address is stripped
+func parsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	addrPart, bitsPart, hasBits := strings.Cut(s, "/")
+	if zone := strings.IndexByte(addrPart, '%'); zone >= 0 {
+		addrPart = addrPart[:zone]
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(addrPart, "["), "]"))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q: %w", s, err)
+	}
+	bits := addr.BitLen()
+	if hasBits {
+		n, err := strconv.Atoi(bitsPart)
+		if err != nil || n < 0 || n > addr.BitLen() {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix length in %q", s)
+		}
+		bits = n
+	}
+	if addr.Is4In6() {
+		if bits < 96 {
+			return netip.Prefix{}, fmt.Errorf("ipv4-mapped prefix %q is shorter than /96", s)
+		}
+		addr, bits = addr.Unmap(), bits-96
+	}
+	return netip.PrefixFrom(addr, bits), nil
+}
+
+// toIPNet - parses an address or a cidr like parsePrefix into its network, empty when invalid
+func toIPNet(s string) net.IPNet {
+	prefix, err := parsePrefix(s)
+	if err != nil {
+		return net.IPNet{}
+	}
+	prefix = prefix.Masked()
+	return net.IPNet{IP: net.IP(prefix.Addr().AsSlice()), Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen())}
+}
 
-	if prefix.Addr().Unmap().Is6() {
-		isIpv4 = false
+// normalizeRanges - the canonical cidr form of addresses or cidrs for rule specifications, an invalid
+// entry is kept as is for the firewall to reject it
+func normalizeRanges(ranges []string) []string {
+	normalized := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		prefix, err := parsePrefix(r)
+		if err != nil {
+			normalized = append(normalized, r)
+			continue
+		}
+		normalized = append(normalized, prefix.Masked().String())
 	}
-	return isIpv4
+	return normalized
 }
@@ -0,0 +1,56 @@
+package firewall
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePrefix(t *testing.T) {
+	valid := map[string]string{
+		"10.0.0.1":                "10.0.0.1/32",
+		"10.0.0.1/24":             "10.0.0.1/24",
+		" 10.0.0.0/8 ":            "10.0.0.0/8",
+		"fd00::1":                 "fd00::1/128",
+		"fd00::/64":               "fd00::/64",
+		"[fd00::1]":               "fd00::1/128",
+		"fe80::1%wg0":             "fe80::1/128",
+		"fe80::1%wg0/64":          "fe80::1/64",
+		"::ffff:10.0.0.1":         "10.0.0.1/32",
+		"::ffff:10.0.0.0/104":     "10.0.0.0/8",
+		"::ffff:192.168.1.1/128":  "192.168.1.1/32",
+		"0.0.0.0/0":               "0.0.0.0/0",
+		"::/0":                    "::/0",
+		"::ffff:0.0.0.0/96":       "0.0.0.0/0",
+		"2001:db8::ffff:10.0.0.1": "2001:db8::ffff:a00:1/128",
+	}
+	for s, want := range valid {
+		got, err := parsePrefix(s)
+		if err != nil || got.String() != want {
+			t.Errorf("parsePrefix(%q) = %v, %v, want %s", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "host", "10.0.0.1/33", "10.0.0.1/", "10.0.0.1/-1", "fd00::/129", "::ffff:10.0.0.0/64", "10.0.0.1%wg0x/24/1"} {
+		if got, err := parsePrefix(s); err == nil {
+			t.Errorf("parsePrefix(%q) = %v, want an error", s, got)
+		}
+	}
+}
+
+func TestAddressNormalization(t *testing.T) {
+	for addr, want := range map[string]bool{"10.0.0.1": true, "::ffff:10.0.0.1/120": true, "fd00::1": false, "fe80::1%wg0/64": false} {
+		if got := isAddrIpv4(addr); got != want {
+			t.Errorf("isAddrIpv4(%q) = %v, want %v", addr, got, want)
+		}
+	}
+	if got := toIPNet("::ffff:10.1.2.3/112"); got.String() != "10.1.0.0/16" || len(got.IP) != 4 {
+		t.Errorf("toIPNet() = %v, want the unmapped network 10.1.0.0/16", got)
+	}
+	if got := toIPNet("invalid"); got.IP != nil {
+		t.Errorf("toIPNet() = %v, want an empty network", got)
+	}
+	got := normalizeRanges([]string{"10.1.2.3/16", "::ffff:172.16.0.1", "fd00::1/64", "invalid"})
+	want := []string{"10.1.0.0/16", "172.16.0.1/32", "fd00::/64", "invalid"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeRanges() = %v, want %v", got, want)
+	}
+}
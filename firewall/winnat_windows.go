@@ -0,0 +1,129 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/exp/slog"
+)
+
+// winNatTable - table of the rule infos of WinNAT networks, their chain holds the nat name and their rule
+// the internal prefix followed by the egress ranges
+const winNatTable = "winnat"
+
+// winNatRule - the WinNAT network translating the traffic of a netmaker network leaving through the
+// interfaces of the egress ranges
+func winNatRule(network net.IPNet, ranges []string) ruleInfo {
+	return ruleInfo{
+		rule:  append([]string{network.String()}, ranges...),
+		table: winNatTable,
+		chain: netshRulePrefix + "nat-" + shortHash(network.String()),
+	}
+}
+
+// addWinNat - replaces the WinNAT network of the rule and enables forwarding on the netmaker interface and
+// the interfaces routing the egress ranges, windows only forwards between interfaces with forwarding on;
+// WinNAT translates all traffic of the internal prefix leaving through an external interface, so when the
+// egress ranges are attached to one interface the nat is restricted to that interface's prefix
+func addWinNat(rule ruleInfo) error {
+	newNat := fmt.Sprintf("New-NetNat -Name %s -InternalIPInterfaceAddressPrefix %s", psQuote(rule.chain), psQuote(rule.rule[0]))
+	if external := winNatExternalPrefix(rule.rule[1:]); external != "" {
+		newNat += " -ExternalIPInterfaceAddressPrefix " + psQuote(external)
+	} else {
+		slog.Debug("egress ranges are not attached to a single interface, the nat is not restricted to their interface", "nat", rule.chain, "ranges", rule.rule[1:])
+	}
+	script := []string{
+		"$ErrorActionPreference = 'Stop'",
+		fmt.Sprintf("Get-NetNat -Name %s -ErrorAction SilentlyContinue | Remove-NetNat -Confirm:$false", psQuote(rule.chain)),
+		newNat + " | Out-Null",
+		fmt.Sprintf("Set-NetIPInterface -InterfaceAlias %s -Forwarding Enabled", psQuote(ncutils.GetInterfaceName())),
+	}
+	for _, egressRange := range rule.rule[1:] {
+		dst := toIPNet(egressRange)
+		if ones, _ := dst.Mask.Size(); ones == 0 {
+			dst.IP = net.ParseIP("1.1.1.1")
+		}
+		script = append(script, fmt.Sprintf("Find-NetRoute -RemoteIPAddress %s | Select-Object -First 1 | ForEach-Object { Set-NetIPInterface -InterfaceIndex $_.InterfaceIndex -AddressFamily IPv4 -Forwarding Enabled }",
+			psQuote(dst.IP.String())))
+	}
+	if out, err := powershell(strings.Join(script, "; ")); err != nil {
+		// most windows versions allow a single nat network per host
+		return fmt.Errorf("failed to add nat %s for %s, another nat network may exist (Get-NetNat): %w: %s", rule.chain, rule.rule[0], err, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// winNatExternalPrefix - the prefix of the local interface address the egress ranges are attached to, empty
+// when a range is not attached to a local interface or the ranges are attached to different interfaces
+func winNatExternalPrefix(ranges []string) string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	external := ""
+	for _, egressRange := range ranges {
+		dst := toIPNet(egressRange)
+		attached := ""
+		for _, addr := range addrs {
+			local, ok := addr.(*net.IPNet)
+			if !ok || local.IP.To4() == nil || !dst.Contains(local.IP) {
+				continue
+			}
+			if ones, _ := dst.Mask.Size(); ones == 0 {
+				continue
+			}
+			attached = (&net.IPNet{IP: local.IP.Mask(local.Mask), Mask: local.Mask}).String()
+			break
+		}
+		if attached == "" || (external != "" && attached != external) {
+			return ""
+		}
+		external = attached
+	}
+	return external
+}
+
+// removeWinNat - removes a WinNAT network
+func removeWinNat(name string) error {
+	out, err := powershell(fmt.Sprintf("Get-NetNat -Name %s -ErrorAction SilentlyContinue | Remove-NetNat -Confirm:$false", psQuote(name)))
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// listWinNats - names of the WinNAT networks added by netmaker
+func listWinNats() ([]string, error) {
+	out, err := powershell("Get-NetNat | ForEach-Object { $_.Name }")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nat networks: %w", err)
+	}
+	names := []string{}
+	for _, name := range strings.Split(out, "\n") {
+		if name = strings.TrimSpace(name); strings.HasPrefix(name, netshRulePrefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// deleteRule - removes the windows firewall rule or the WinNAT network of a rule info
+func deleteRule(rule ruleInfo) error {
+	if rule.table == winNatTable {
+		return removeWinNat(rule.chain)
+	}
+	return deleteNetshRule(rule.chain)
+}
+
+// powershell - runs a powershell script and returns its output
+func powershell(script string) (string, error) {
+	return ncutils.Exec(context.Background(), ncutils.NewCommand("powershell", "-NoProfile", "-NonInteractive", "-Command", script))
+}
+
+// psQuote - quotes a powershell string literal
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,120 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/daemon"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+// Adopt - takes an existing wireguard interface under netclient management, the host keeps the
+// interface's keys and listen port and its node in the network joined with the token keeps the
+// interface's addresses, so peers migrating from plain wireguard don't have to be renumbered
+func Adopt(iface, token string) error {
+	if len(config.GetNodes()) > 0 {
+		return errors.New("the wireguard keys are shared by all networks of the host, adopt requires a host not joined to any network")
+	}
+	client, err := wgctrl.New()
+	if err != nil {
+		return err
+	}
+	device, err := client.Device(iface)
+	client.Close()
+	if err != nil {
+		return fmt.Errorf("reading wireguard interface %s %w", iface, err)
+	}
+	addrs, err := interfaceAddrs(iface)
+	if err != nil {
+		return err
+	}
+	host := config.Netclient()
+	saved := *host
+	host.PrivateKey = device.PrivateKey
+	host.PublicKey = device.PublicKey
+	if device.ListenPort != 0 {
+		host.ListenPort = device.ListenPort
+	}
+	// register before touching the interface, a failed adopt leaves the host and the interface as they were
+	if err := Register(token, true); err != nil {
+		host.PrivateKey = saved.PrivateKey
+		host.PublicKey = saved.PublicKey
+		host.ListenPort = saved.ListenPort
+		if werr := config.WriteNetclientConfig(); werr != nil {
+			slog.Error("failed to restore netclient config", "error", werr)
+		}
+		return err
+	}
+	if err := config.WriteNetclientConfig(); err != nil {
+		return err
+	}
+	// the netmaker interface takes over the listen port
+	wireguard.DeleteOldInterface(iface)
+	pull, _, _, err := Pull(false)
+	if err != nil {
+		return err
+	}
+	for _, node := range config.GetNodes() {
+		node := node
+		changed := false
+		for _, addr := range addrs {
+			if node.NetworkRange.IP != nil && node.NetworkRange.Contains(addr) && !node.Address.IP.Equal(addr) {
+				node.Address.IP = addr
+				changed = true
+			}
+			if node.NetworkRange6.IP != nil && node.NetworkRange6.Contains(addr) && !node.Address6.IP.Equal(addr) {
+				node.Address6.IP = addr
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		slog.Info("keeping address of adopted interface", "network", node.Network, "address", node.Address.IP, "address6", node.Address6.IP)
+		config.UpdateNodeMap(node.Network, node)
+		if err := setupMQTTSingleton(config.GetServer(node.Server), true); err != nil {
+			return err
+		}
+		if err := PublishNodeUpdate(&node); err != nil {
+			return err
+		}
+	}
+	if err := config.WriteNodeConfig(); err != nil {
+		return err
+	}
+	managed := make(map[string]bool, len(pull.Peers))
+	for _, peer := range pull.Peers {
+		managed[peer.PublicKey.String()] = true
+	}
+	for _, peer := range device.Peers {
+		if !managed[peer.PublicKey.String()] {
+			slog.Warn("peer is not a netmaker host yet, adopt its interface on that host too", "peer", peer.PublicKey.String(), "endpoint", peer.Endpoint)
+		}
+	}
+	return daemon.Restart()
+}
+
+// interfaceAddrs - returns the addresses of an interface
+func interfaceAddrs(iface string) ([]net.IP, error) {
+	link, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := link.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+		if err != nil {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
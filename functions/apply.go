@@ -0,0 +1,31 @@
+package functions
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// applyTimeout - bounds the application of a single update from a server
+const applyTimeout = time.Minute * 2
+
+var (
+	daemonCtx      = context.Background()
+	daemonCtxMutex sync.Mutex
+)
+
+// setApplyContext - sets the context of the running daemon goroutines, which is cancelled
+// when the daemon resets or shuts down
+func setApplyContext(ctx context.Context) {
+	daemonCtxMutex.Lock()
+	defer daemonCtxMutex.Unlock()
+	daemonCtx = ctx
+}
+
+// applyContext - returns the context for applying an update to the interface, routes, firewall
+// and dns, it is cancelled on daemon reset or shutdown and after applyTimeout
+func applyContext() (context.Context, context.CancelFunc) {
+	daemonCtxMutex.Lock()
+	defer daemonCtxMutex.Unlock()
+	return context.WithTimeout(daemonCtx, applyTimeout)
+}
@@ -0,0 +1,135 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// appCgroup - cgroup the processes of the configured applications are moved into
+	appCgroup = "netclient-apps"
+	// appClassID - net_cls class id of appCgroup on cgroup v1 hosts, 0x00100001
+	appClassID = 1048577
+	// appScanInterval - interval new processes of the configured applications are picked up
+	appScanInterval = time.Second * 5
+)
+
+// routeApplications - moves the processes of the configured applications into a dedicated cgroup
+// and marks its traffic, so only this traffic is routed through the netmaker routing tables in
+// include mode, or it bypasses them in exclude mode
+func routeApplications(ctx context.Context) error {
+	appRouting := config.Netclient().AppRouting
+	slog.Warn("application routing is experimental", "mode", appRouting.Mode, "applications", appRouting.Applications)
+	procs, match, err := setupAppCgroup()
+	if err != nil {
+		return fmt.Errorf("application routing: %w", err)
+	}
+	if err := firewall.SetAppMark(match, wireguard.AppRouteMark); err != nil {
+		return fmt.Errorf("application routing: %w", err)
+	}
+	defer func() {
+		if err := firewall.SetAppMark(nil, wireguard.AppRouteMark); err != nil {
+			slog.Error("failed to remove application routing marks", "error", err)
+		}
+	}()
+	if err := wireguard.SetAppRouteBypass(appRouting.Mode == config.AppRoutingExclude); err != nil {
+		return fmt.Errorf("application routing: %w", err)
+	}
+	defer func() {
+		if err := wireguard.SetAppRouteBypass(false); err != nil {
+			slog.Error("failed to remove application routing rules", "error", err)
+		}
+	}()
+	ticker := time.NewTicker(appScanInterval)
+	defer ticker.Stop()
+	for {
+		classifyApplications(procs, appRouting.Applications)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// setupAppCgroup - creates the cgroup of application routing, returns its cgroup.procs file and
+// the iptables match for its traffic
+func setupAppCgroup() (string, []string, error) {
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err == nil {
+		dir := filepath.Join("/sys/fs/cgroup", appCgroup)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", nil, err
+		}
+		return filepath.Join(dir, "cgroup.procs"), []string{"-m", "cgroup", "--path", appCgroup}, nil
+	}
+	if _, err := os.Stat("/sys/fs/cgroup/net_cls"); err != nil {
+		return "", nil, errors.New("neither cgroup v2 nor the net_cls cgroup controller is available")
+	}
+	dir := filepath.Join("/sys/fs/cgroup/net_cls", appCgroup)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "net_cls.classid"), []byte(strconv.Itoa(appClassID)), 0644); err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, "cgroup.procs"), []string{"-m", "cgroup", "--cgroup", strconv.Itoa(appClassID)}, nil
+}
+
+// classifyApplications - moves the running processes of the applications into the cgroup
+func classifyApplications(procs string, applications []string) {
+	data, err := os.ReadFile(procs)
+	if err != nil {
+		slog.Error("failed to read application cgroup", "error", err)
+		return
+	}
+	classified := make(map[string]bool)
+	for _, pid := range strings.Fields(string(data)) {
+		classified[pid] = true
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		slog.Error("failed to list processes", "error", err)
+		return
+	}
+	for _, entry := range entries {
+		pid := entry.Name()
+		if _, err := strconv.Atoi(pid); err != nil || classified[pid] {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+		if err != nil || !isRoutedApplication(strings.TrimSpace(string(comm)), applications) {
+			continue
+		}
+		// processes may exit between the scan and the write
+		if err := os.WriteFile(procs, []byte(pid), 0644); err != nil {
+			slog.Debug("failed to classify process", "pid", pid, "error", err)
+			continue
+		}
+		slog.Info("routing application", "name", strings.TrimSpace(string(comm)), "pid", pid)
+	}
+}
+
+// isRoutedApplication - the kernel truncates process names to 15 characters
+func isRoutedApplication(name string, applications []string) bool {
+	for _, app := range applications {
+		app = filepath.Base(app)
+		if len(app) > 15 {
+			app = app[:15]
+		}
+		if name == app {
+			return true
+		}
+	}
+	return false
+}
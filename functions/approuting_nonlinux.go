@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package functions
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+)
+
+// routeApplications - application routing relies on cgroups, only available on linux
+func routeApplications(ctx context.Context) error {
+	slog.Warn("application routing is only supported on linux")
+	<-ctx.Done()
+	return nil
+}
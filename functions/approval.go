@@ -0,0 +1,213 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+)
+
+// PendingChange - a disruptive server initiated change waiting for local approval
+type PendingChange struct {
+	ID          string    `json:"id"`
+	Server      string    `json:"server"`
+	Description string    `json:"description"`
+	Received    time.Time `json:"received"`
+	Expires     time.Time `json:"expires"`
+	approved    chan struct{}
+	// discarded - closed when a newer change of the same state replaces the change
+	discarded chan struct{}
+}
+
+// queuedChange - an egress state waiting for approval
+type queuedChange struct {
+	snapshot string
+	change   *PendingChange
+}
+
+var (
+	pendingChanges = make(map[string]*PendingChange)
+	pendingMutex   sync.Mutex
+	// appliedEgress/queuedEgress hold snapshots of the egress state per server
+	appliedEgress = make(map[string]string)
+	queuedEgress  = make(map[string]queuedChange)
+	egressMutex   sync.Mutex
+)
+
+// requireApproval - if sign-off mode is enabled, holds back the change until it is approved
+// locally with `netclient approve <change-id>`, dropping it once the approval timeout passes.
+// Returns false if the change has been queued and the caller must not apply it now.
+func requireApproval(server, description string, apply func()) bool {
+	if !config.Netclient().RequireApproval {
+		return true
+	}
+	queueChange(server, description, apply, nil)
+	return false
+}
+
+// queueChange - queues a change until it is approved, discarded or its approval timeout passes, expired
+// is called when the change is dropped without being applied
+func queueChange(server, description string, apply, expired func()) *PendingChange {
+	change := &PendingChange{
+		ID:          ncutils.RandomString(8),
+		Server:      server,
+		Description: description,
+		Received:    time.Now(),
+		Expires:     time.Now().Add(config.GetApprovalTimeout()),
+		approved:    make(chan struct{}),
+		discarded:   make(chan struct{}),
+	}
+	pendingMutex.Lock()
+	pendingChanges[change.ID] = change
+	pendingMutex.Unlock()
+	slog.Warn("server change requires local approval", "id", change.ID, "server", server,
+		"change", description, "expires", change.Expires.Format(time.RFC3339))
+	go func() {
+		timer := time.NewTimer(time.Until(change.Expires))
+		defer timer.Stop()
+		applied := false
+		select {
+		case <-change.approved:
+			slog.Info("applying approved change", "id", change.ID, "change", description)
+			apply()
+			applied = true
+		case <-change.discarded:
+			slog.Info("change was replaced by a newer change, discarding", "id", change.ID, "change", description)
+		case <-timer.C:
+			slog.Warn("change was not approved in time, discarding", "id", change.ID, "change", description)
+		}
+		pendingMutex.Lock()
+		delete(pendingChanges, change.ID)
+		pendingMutex.Unlock()
+		if !applied && expired != nil {
+			expired()
+		}
+	}()
+	return change
+}
+
+// discardChange - drops a pending change that is not approved yet
+func discardChange(change *PendingChange) {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	if _, ok := pendingChanges[change.ID]; !ok {
+		return
+	}
+	select {
+	case <-change.approved:
+	case <-change.discarded:
+	default:
+		close(change.discarded)
+	}
+}
+
+// ApproveChange - approves a pending change
+func ApproveChange(id string) error {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	change, ok := pendingChanges[id]
+	if !ok {
+		return errors.New("no pending change with id " + id)
+	}
+	select {
+	case <-change.approved:
+		return errors.New("change " + id + " is already approved")
+	default:
+		close(change.approved)
+	}
+	return nil
+}
+
+// GetPendingChanges - returns the changes waiting for approval, oldest first
+func GetPendingChanges() []PendingChange {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	changes := []PendingChange{}
+	for _, change := range pendingChanges {
+		changes = append(changes, *change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Received.Before(changes[j].Received)
+	})
+	return changes
+}
+
+// handleEgressUpdate - applies egress routes and firewall rules from the server,
+// changes to a previously applied egress state require approval in sign-off mode and are refused in lockdown mode
+func handleEgressUpdate(ctx context.Context, server string, routes []models.EgressNetworkRoutes, fwUpdate *models.FwUpdate) error {
+	snapshot, err := json.Marshal(struct {
+		Routes   []models.EgressNetworkRoutes
+		FwUpdate *models.FwUpdate
+	}{routes, fwUpdate})
+	if err != nil {
+		slog.Error("failed to snapshot egress update", "error", err)
+		return nil
+	}
+	apply := func(ctx context.Context) error {
+		setEgressRoutes(routes)
+		exportMeshRoutes(routes)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		handleFwUpdate(ctx, server, fwUpdate)
+		if err := ctx.Err(); err != nil {
+			// the firewall may be partially applied, apply the state again with the next update
+			return err
+		}
+		egressMutex.Lock()
+		appliedEgress[server] = string(snapshot)
+		if queuedEgress[server].snapshot == string(snapshot) {
+			delete(queuedEgress, server)
+		}
+		egressMutex.Unlock()
+		return nil
+	}
+	egressMutex.Lock()
+	applied, seen := appliedEgress[server]
+	queued := queuedEgress[server]
+	egressMutex.Unlock()
+	// the first update after startup restores the current state and is not a change
+	if !seen || applied == string(snapshot) {
+		return apply(ctx)
+	}
+	if queued.snapshot == string(snapshot) {
+		// identical change is already waiting for approval
+		return nil
+	}
+	if refusedInLockdown(server, "change egress routes and firewall rules") {
+		return nil
+	}
+	if !config.Netclient().RequireApproval {
+		return apply(ctx)
+	}
+	approved := func() {
+		ctx, cancel := applyContext()
+		defer cancel()
+		if err := apply(ctx); err != nil {
+			slog.Error("failed to apply approved egress change", "server", server, "error", err)
+		}
+	}
+	egressMutex.Lock()
+	defer egressMutex.Unlock()
+	// only the latest egress state of the server may be approved, the older one would overwrite it
+	if older, ok := queuedEgress[server]; ok {
+		discardChange(older.change)
+	}
+	var change *PendingChange
+	change = queueChange(server, "change egress routes and firewall rules", approved, func() {
+		egressMutex.Lock()
+		if queuedEgress[server].change == change {
+			delete(queuedEgress, server)
+		}
+		egressMutex.Unlock()
+	})
+	queuedEgress[server] = queuedChange{snapshot: string(snapshot), change: change}
+	return nil
+}
@@ -0,0 +1,380 @@
+package functions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devilcove/httpclient"
+	"github.com/google/uuid"
+	"github.com/gravitl/netclient/auth"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+)
+
+// BackupVersion - version of the config backup schema
+const BackupVersion = 2
+
+// MinBackupServerVersion - oldest netmaker server storing config backups, older servers are skipped
+const MinBackupServerVersion = "v0.22.0"
+
+// backupStateFile - file of the netclient directory holding the full backup each server holds, so a
+// restarted daemon keeps uploading differential backups
+const backupStateFile = "config-backup.json"
+
+// backupFiles - files in the netclient path holding the identity and the local settings of the host
+var backupFiles = []string{"netclient.yml", "servers.yml", "nodes.yml", config.PolicyFile}
+
+// errNoBackup - the server holds no backup of the host
+var errNoBackup = errors.New("no backup found")
+
+// ConfigBackup - the config files of the host, stored encrypted on its servers: a full backup holds all
+// files, a differential backup the files changed or removed since the full backup it is based on
+type ConfigBackup struct {
+	Version int       `json:"version"`
+	HostID  string    `json:"host_id"`
+	Created time.Time `json:"created"`
+	// Base - creation time of the full backup a differential backup applies to, zero for a full backup
+	Base    time.Time         `json:"base"`
+	Files   map[string][]byte `json:"files"`
+	Removed []string          `json:"removed,omitempty"`
+}
+
+// backupPayload - the encrypted backup as exchanged with the server
+type backupPayload struct {
+	Backup []byte `json:"backup"`
+}
+
+// backupState - the backup of the host a server holds
+type backupState struct {
+	// Base - checksums by file name of the files of the full backup
+	Base map[string]string `json:"base"`
+	// Created - creation time of the full backup
+	Created time.Time `json:"created"`
+	// Uploaded - checksum of the config files at the last upload, full or differential
+	Uploaded string `json:"uploaded"`
+}
+
+// backupConfig - checks the config files at the backup interval and uploads their changes encrypted to each
+// server, a failed upload to a server is retried at the next interval
+func backupConfig(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(config.GetBackupInterval())
+	defer ticker.Stop()
+	states := readBackupStates()
+	unsupported := make(map[string]bool)
+	for {
+		for _, err := range uploadBackups(states, unsupported) {
+			slog.Error("failed to back up config", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("config backup routine closed")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// uploadBackups - uploads the config files to the servers they changed for since the last upload: a full
+// backup to a server not holding one of this daemon yet, otherwise a differential backup against it;
+// servers older than MinBackupServerVersion are skipped; returns the errors of the servers the upload failed for
+func uploadBackups(states map[string]*backupState, unsupported map[string]bool) []error {
+	files, err := readBackupFiles()
+	if err != nil {
+		return []error{err}
+	}
+	sums := make(map[string]string, len(files))
+	for name, data := range files {
+		checksum := sha256.Sum256(data)
+		sums[name] = hex.EncodeToString(checksum[:])
+	}
+	data, err := json.Marshal(sums)
+	if err != nil {
+		return []error{err}
+	}
+	checksum := sha256.Sum256(data)
+	sum := hex.EncodeToString(checksum[:])
+	passphrase := ""
+	errs := []error{}
+	for _, server := range config.Servers {
+		server := server
+		if !isVersionAtLeast(server.Version, MinBackupServerVersion) {
+			if !unsupported[server.Name] {
+				slog.Warn("server does not store config backups, skipping it", "server", server.Name,
+					"version", server.Version, "required", MinBackupServerVersion)
+				unsupported[server.Name] = true
+			}
+			continue
+		}
+		state := states[server.Name]
+		if state != nil && state.Uploaded == sum {
+			continue
+		}
+		if passphrase == "" {
+			if passphrase, err = readPassphrase(config.Netclient().BackupPassphraseFile); err != nil {
+				return append(errs, err)
+			}
+		}
+		backup := newBackup(files, sums, state)
+		if err := putBackup(&server, backup, passphrase); err != nil {
+			errs = append(errs, fmt.Errorf("server %s: %w", server.Name, err))
+			continue
+		}
+		if backup.Base.IsZero() {
+			states[server.Name] = &backupState{Base: sums, Created: backup.Created, Uploaded: sum}
+		} else {
+			state.Uploaded = sum
+		}
+		if err := writeBackupStates(states); err != nil {
+			slog.Warn("failed to save config backup state", "error", err)
+		}
+		slog.Info("config backed up", "server", server.Name, "differential", !backup.Base.IsZero(), "checksum", sum[:12])
+	}
+	return errs
+}
+
+// readBackupStates - reads the full backups the servers hold, none when the state file is missing or invalid
+func readBackupStates() map[string]*backupState {
+	states := make(map[string]*backupState)
+	data, err := os.ReadFile(filepath.Join(config.GetNetclientPath(), backupStateFile))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed to read config backup state, uploading full backups", "error", err)
+		}
+		return states
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		slog.Warn("invalid config backup state, uploading full backups", "error", err)
+		return make(map[string]*backupState)
+	}
+	return states
+}
+
+// writeBackupStates - persists the full backups the servers hold
+func writeBackupStates(states map[string]*backupState) error {
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(config.GetNetclientPath(), backupStateFile), data, 0600)
+}
+
+// newBackup - the backup of the files for a server: differential with the files changed or removed since
+// the full backup the server holds, full when it holds none or all files changed
+func newBackup(files map[string][]byte, sums map[string]string, state *backupState) ConfigBackup {
+	backup := ConfigBackup{
+		Version: BackupVersion,
+		HostID:  config.Netclient().ID.String(),
+		Created: time.Now(),
+		Files:   files,
+	}
+	if state == nil {
+		return backup
+	}
+	changed := make(map[string][]byte)
+	for name, data := range files {
+		if state.Base[name] != sums[name] {
+			changed[name] = data
+		}
+	}
+	if len(changed) == len(files) {
+		return backup
+	}
+	for name := range state.Base {
+		if _, ok := files[name]; !ok {
+			backup.Removed = append(backup.Removed, name)
+		}
+	}
+	backup.Base = state.Created
+	backup.Files = changed
+	return backup
+}
+
+// putBackup - encrypts the backup and stores it on a server, a differential backup is kept next to the
+// full backup it is based on
+func putBackup(server *config.Server, backup ConfigBackup, passphrase string) error {
+	data, err := json.Marshal(backup)
+	if err != nil {
+		return err
+	}
+	encrypted, err := ncutils.PassphraseEncrypt(data, passphrase)
+	if err != nil {
+		return err
+	}
+	token, err := auth.Authenticate(server, config.Netclient())
+	if err != nil {
+		return err
+	}
+	endpoint := httpclient.JSONEndpoint[models.SuccessResponse, models.ErrorResponse]{
+		URL:           "https://" + server.API,
+		Route:         backupRoute(config.Netclient().ID.String(), !backup.Base.IsZero()),
+		Method:        http.MethodPut,
+		Data:          backupPayload{Backup: encrypted},
+		Authorization: "Bearer " + token,
+		ErrorResponse: models.ErrorResponse{},
+	}
+	if _, errData, err := endpoint.GetJSON(models.SuccessResponse{}, models.ErrorResponse{}); err != nil {
+		if errors.Is(err, httpclient.ErrStatus) {
+			return fmt.Errorf("%w: %s", err, errData.Message)
+		}
+		return err
+	}
+	return nil
+}
+
+// backupRoute - route of the full or the differential backup of a host
+func backupRoute(hostID string, differential bool) string {
+	if differential {
+		return fmt.Sprintf("/api/v1/host/%s/backup/diff", hostID)
+	}
+	return fmt.Sprintf("/api/v1/host/%s/backup", hostID)
+}
+
+// readBackupFiles - reads the config files to back up, missing optional files are skipped
+func readBackupFiles() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, name := range backupFiles {
+		data, err := os.ReadFile(filepath.Join(config.GetNetclientPath(), name))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && name != "netclient.yml" {
+				continue
+			}
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// readPassphrase - reads the backup passphrase from a file
+func readPassphrase(file string) (string, error) {
+	if file == "" {
+		return "", errors.New("no backup passphrase file configured")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup passphrase: %w", err)
+	}
+	passphrase := strings.TrimSpace(string(data))
+	if passphrase == "" {
+		return "", errors.New("backup passphrase file is empty")
+	}
+	return passphrase, nil
+}
+
+// RestoreFromServer - downloads the config backup of a host from a server with the credentials of a
+// user, decrypts it with the passphrase and writes the config files, existing config of another host
+// is only replaced with force
+func RestoreFromServer(api, user, pass, hostID, passphrase string, force bool) (*ConfigBackup, error) {
+	if current := config.Netclient().ID; !force && current != uuid.Nil && current.String() != hostID {
+		return nil, fmt.Errorf("config of host %s exists, use --force to replace it", config.Netclient().ID.String())
+	}
+	login := httpclient.JSONEndpoint[userLoginResponse, models.ErrorResponse]{
+		URL:           "https://" + api,
+		Route:         "/api/users/adm/authenticate",
+		Method:        http.MethodPost,
+		Data:          models.UserAuthParams{UserName: user, Password: pass},
+		ErrorResponse: models.ErrorResponse{},
+	}
+	loginResponse, errData, err := login.GetJSON(userLoginResponse{}, models.ErrorResponse{})
+	if err != nil {
+		if errors.Is(err, httpclient.ErrStatus) {
+			return nil, fmt.Errorf("login failed: %s", errData.Message)
+		}
+		return nil, err
+	}
+	token := loginResponse.Response.AuthToken
+	backup, err := downloadBackup(api, token, hostID, passphrase, false)
+	if errors.Is(err, errNoBackup) {
+		return nil, fmt.Errorf("%w for host %s, config backups need netmaker %s or newer", err, hostID, MinBackupServerVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+	diff, err := downloadBackup(api, token, hostID, passphrase, true)
+	switch {
+	case errors.Is(err, errNoBackup):
+	case err != nil:
+		return nil, err
+	case !diff.Base.Equal(backup.Created):
+		// left from before the last full backup
+		slog.Warn("ignoring differential backup of another full backup", "created", diff.Created)
+	default:
+		for name, content := range diff.Files {
+			backup.Files[name] = content
+		}
+		for _, name := range diff.Removed {
+			delete(backup.Files, name)
+		}
+		backup.Created = diff.Created
+	}
+	if err := os.MkdirAll(config.GetNetclientPath(), 0700); err != nil {
+		return nil, err
+	}
+	for _, name := range backupFiles {
+		content, ok := backup.Files[name]
+		if !ok {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(config.GetNetclientPath(), name), content, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return backup, nil
+}
+
+// downloadBackup - downloads and decrypts the full or the differential backup of a host from a server
+func downloadBackup(api, token, hostID, passphrase string, differential bool) (*ConfigBackup, error) {
+	download := httpclient.JSONEndpoint[backupPayload, models.ErrorResponse]{
+		URL:           "https://" + api,
+		Route:         backupRoute(hostID, differential),
+		Method:        http.MethodGet,
+		Authorization: "Bearer " + token,
+		ErrorResponse: models.ErrorResponse{},
+	}
+	payload, errData, err := download.GetJSON(backupPayload{}, models.ErrorResponse{})
+	if err != nil {
+		if errors.Is(err, httpclient.ErrStatus) {
+			if errData.Code == http.StatusNotFound {
+				return nil, errNoBackup
+			}
+			return nil, fmt.Errorf("failed to download backup: %s", errData.Message)
+		}
+		return nil, err
+	}
+	data, err := ncutils.PassphraseDecrypt(payload.Backup, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	var backup ConfigBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("invalid backup: %w", err)
+	}
+	if backup.Version > BackupVersion {
+		return nil, fmt.Errorf("backup version %d is newer than supported version %d", backup.Version, BackupVersion)
+	}
+	if backup.HostID != hostID {
+		return nil, fmt.Errorf("backup belongs to host %s", backup.HostID)
+	}
+	if backup.Files == nil {
+		backup.Files = make(map[string][]byte)
+	}
+	return &backup, nil
+}
+
+// userLoginResponse - response of the server to a user login
+type userLoginResponse struct {
+	Response models.SuccessfulUserLoginResponse
+}
@@ -0,0 +1,27 @@
+package functions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestNewBackup(t *testing.T) {
+	is := is.New(t)
+	files := map[string][]byte{"netclient.yml": []byte("a"), "nodes.yml": []byte("b")}
+	sums := map[string]string{"netclient.yml": "sum-a", "nodes.yml": "sum-b"}
+	full := newBackup(files, sums, nil)
+	is.True(full.Base.IsZero()) // a server without a full backup gets one
+	is.Equal(len(full.Files), 2)
+
+	state := &backupState{Base: map[string]string{"netclient.yml": "sum-a", "nodes.yml": "old", "policy.yml": "sum-p"}, Created: time.Now()}
+	diff := newBackup(files, sums, state)
+	is.True(diff.Base.Equal(state.Created))
+	is.Equal(len(diff.Files), 1) // only the changed file
+	is.Equal(string(diff.Files["nodes.yml"]), "b")
+	is.Equal(diff.Removed, []string{"policy.yml"})
+
+	state.Base = map[string]string{"netclient.yml": "old", "nodes.yml": "old"}
+	is.True(newBackup(files, sums, state).Base.IsZero()) // all files changed, a new full backup
+}
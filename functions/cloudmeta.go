@@ -0,0 +1,117 @@
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// CloudTokenKey - name of the instance tag/attribute holding the enrollment token
+const CloudTokenKey = "netmaker-token"
+
+var errNoCloudToken = errors.New("no " + CloudTokenKey + " found in cloud instance metadata")
+
+var metadataClient = http.Client{Timeout: time.Second * 2}
+
+// GetCloudEnrollmentToken - reads the enrollment token from the instance metadata of the cloud provider
+// (aws instance tag, gcp instance attribute or azure vm tag named netmaker-token),
+// so images do not need a baked-in token
+func GetCloudEnrollmentToken() (string, error) {
+	providers := []struct {
+		name  string
+		fetch func() (string, error)
+	}{
+		{"aws", awsMetadataToken},
+		{"gcp", gcpMetadataToken},
+		{"azure", azureMetadataToken},
+	}
+	for _, provider := range providers {
+		token, err := provider.fetch()
+		if err != nil {
+			slog.Debug("no enrollment token from cloud metadata", "provider", provider.name, "error", err)
+			continue
+		}
+		if token = strings.TrimSpace(token); token != "" {
+			slog.Info("using enrollment token from cloud metadata", "provider", provider.name)
+			return token, nil
+		}
+	}
+	return "", errNoCloudToken
+}
+
+func awsMetadataToken() (string, error) {
+	// IMDSv2 session token
+	req, err := http.NewRequest(http.MethodPut, "http://169.254.169.254/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	session, err := metadataRequest(req)
+	if err != nil {
+		return "", err
+	}
+	// requires "allow tags in instance metadata" on the instance
+	req, err = http.NewRequest(http.MethodGet, "http://169.254.169.254/latest/meta-data/tags/instance/"+CloudTokenKey, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", session)
+	return metadataRequest(req)
+}
+
+func gcpMetadataToken() (string, error) {
+	req, err := http.NewRequest(http.MethodGet,
+		"http://metadata.google.internal/computeMetadata/v1/instance/attributes/"+CloudTokenKey, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return metadataRequest(req)
+}
+
+func azureMetadataToken() (string, error) {
+	req, err := http.NewRequest(http.MethodGet,
+		"http://169.254.169.254/metadata/instance/compute/tagsList?api-version=2021-02-01", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	body, err := metadataRequest(req)
+	if err != nil {
+		return "", err
+	}
+	tags := []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &tags); err != nil {
+		return "", err
+	}
+	for _, tag := range tags {
+		if tag.Name == CloudTokenKey {
+			return tag.Value, nil
+		}
+	}
+	return "", errNoCloudToken
+}
+
+func metadataRequest(req *http.Request) (string, error) {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("metadata service returned " + resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
@@ -10,27 +10,7 @@ import (
 
 // Disconnect disconnects a node from the given network
 func Disconnect(network string) error {
-	nodes := config.GetNodes()
-	node, ok := nodes[network]
-	if !ok {
-		return errors.New("no such network")
-	}
-	if !node.Connected {
-		return errors.New("node is already disconnected")
-	}
-	node.Connected = false
-	config.UpdateNodeMap(node.Network, node)
-	if err := config.WriteNodeConfig(); err != nil {
-		return fmt.Errorf("error writing node config %w", err)
-	}
-	server := config.GetServer(node.Server)
-	if server == nil {
-		return errors.New("server cfg is nil")
-	}
-	if err := setupMQTTSingleton(server, true); err != nil {
-		return err
-	}
-	if err := PublishNodeUpdate(&node); err != nil {
+	if err := setConnected(network, false); err != nil {
 		return err
 	}
 	if err := daemon.Restart(); err != nil {
@@ -44,15 +24,32 @@ func Disconnect(network string) error {
 
 // Connect will attempt to connect a node on given network
 func Connect(network string) error {
+	if err := setConnected(network, true); err != nil {
+		return err
+	}
+	if err := daemon.Restart(); err != nil {
+		if err := daemon.Start(); err != nil {
+			return fmt.Errorf("daemon restart failed %w", err)
+		}
+	}
+	return nil
+}
+
+// setConnected - connects or disconnects the node of the network and publishes it to the server,
+// the daemon has to be restarted to apply it
+func setConnected(network string, connected bool) error {
 	nodes := config.GetNodes()
 	node, ok := nodes[network]
 	if !ok {
 		return errors.New("no such network")
 	}
-	if node.Connected {
-		return errors.New("node already connected")
+	if node.Connected == connected {
+		if connected {
+			return errors.New("node already connected")
+		}
+		return errors.New("node is already disconnected")
 	}
-	node.Connected = true
+	node.Connected = connected
 	config.UpdateNodeMap(node.Network, node)
 	if err := config.WriteNodeConfig(); err != nil {
 		return fmt.Errorf("error writing node config %w", err)
@@ -64,13 +61,5 @@ func Connect(network string) error {
 	if err := setupMQTTSingleton(server, true); err != nil {
 		return err
 	}
-	if err := PublishNodeUpdate(&node); err != nil {
-		return err
-	}
-	if err := daemon.Restart(); err != nil {
-		if err := daemon.Start(); err != nil {
-			return fmt.Errorf("daemon restart failed %w", err)
-		}
-	}
-	return nil
+	return PublishNodeUpdate(&node)
 }
@@ -0,0 +1,123 @@
+package functions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+)
+
+// CrashDir - directory (below the netclient path) crash reports are written to
+const CrashDir = "crash"
+
+// CrashReport - redacted report written when netclient panics
+type CrashReport struct {
+	Time    time.Time `json:"time"`
+	Version string    `json:"version"`
+	OS      string    `json:"os"`
+	Arch    string    `json:"arch"`
+	Panic   string    `json:"panic"`
+	Stack   string    `json:"stack"`
+	Logs    []string  `json:"logs"`
+}
+
+var (
+	secretPattern = regexp.MustCompile(`(?i)("?(password|pass|token|privatekey|private_key|secret|traffickeys?|authorization)"?\s*[:=]\s*)("[^"]*"|[^\s,}]+)`)
+	// base64 encoded 32 byte (wireguard/nacl) keys
+	keyPattern = regexp.MustCompile(`[A-Za-z0-9+/]{43}=`)
+)
+
+// crashReported - panic value re-raised by RecoverCrash, so a supervisor recovering it
+// does not report the crash twice
+type crashReported struct {
+	value interface{}
+}
+
+func (c crashReported) Error() string {
+	return fmt.Sprint(c.value)
+}
+
+// RecoverCrash - writes a crash report when the calling goroutine panics, uploads it if
+// a crash report url is configured and re-panics so the process still exits; use as
+// defer RecoverCrash()
+func RecoverCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if _, ok := r.(crashReported); ok {
+		panic(r)
+	}
+	reportCrash(r)
+	panic(crashReported{value: r})
+}
+
+// reportCrash - writes and uploads a crash report for a recovered panic
+func reportCrash(r interface{}) {
+	report := CrashReport{
+		Time:    time.Now(),
+		Version: config.Version,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Panic:   redact(fmt.Sprint(r)),
+		Stack:   string(debug.Stack()),
+		Logs:    ncutils.RecentLogs.Lines(),
+	}
+	for i := range report.Logs {
+		report.Logs[i] = redact(report.Logs[i])
+	}
+	if file, err := writeCrashReport(&report); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write crash report:", err)
+	} else {
+		fmt.Fprintln(os.Stderr, "crash report written to", file)
+	}
+	if url := config.Netclient().CrashReportURL; url != "" {
+		if err := uploadCrashReport(url, &report); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to upload crash report:", err)
+		}
+	}
+}
+
+func redact(s string) string {
+	s = secretPattern.ReplaceAllString(s, `$1"<redacted>"`)
+	return keyPattern.ReplaceAllString(s, "<key>")
+}
+
+func writeCrashReport(report *CrashReport) (string, error) {
+	dir := filepath.Join(config.GetNetclientPath(), CrashDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "crash-"+report.Time.Format("20060102-150405")+".json")
+	return file, os.WriteFile(file, data, 0600)
+}
+
+func uploadCrashReport(url string, report *CrashReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: time.Second * 5}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("crash report upload returned %s", resp.Status)
+	}
+	return nil
+}
@@ -48,7 +48,12 @@ type cachedMessage struct {
 
 // Daemon runs netclient daemon
 func Daemon() {
-	slog.Info("starting netclient daemon", "version", config.Version)
+	defer RecoverCrash()
+	slog.Info("starting netclient daemon", "version", config.Version, "crypto", config.CryptoMode())
+	if err := config.CheckCryptoMode(); err != nil {
+		slog.Error("unable to start daemon", "error", err)
+		os.Exit(1)
+	}
 	daemon.RemoveAllLockFiles()
 	go deleteAllDNS()
 	if err := ncutils.SavePID(); err != nil {
@@ -65,7 +70,8 @@ func Daemon() {
 	signal.Notify(reset, syscall.SIGHUP)
 	// initialize firewall manager
 	var err error
-	config.FwClose, err = firewall.Init()
+	fwCtx, fwCancel := context.WithCancel(context.Background())
+	config.FwClose, err = firewall.Init(fwCtx)
 	if err != nil {
 		logger.Log(0, "failed to intialize firewall: ", err.Error())
 	}
@@ -75,11 +81,14 @@ func Daemon() {
 	wg0 := sync.WaitGroup{}
 	wg0.Add(1)
 	go HttpServer(ctx0, &wg0)
+	go handleDebugSignals(ctx0)
 
 	for {
 		select {
 		case <-quit:
 			slog.Info("shutting down netclient daemon")
+			// abort in-flight firewall changes, the rules are flushed below
+			fwCancel()
 			closeRoutines([]context.CancelFunc{
 				cancel,
 			}, &wg)
@@ -100,6 +109,8 @@ func Daemon() {
 }
 
 func closeRoutines(closers []context.CancelFunc, wg *sync.WaitGroup) {
+	setDaemonNotReady()
+	holdPendingPeerUpdates()
 	for i := range closers {
 		closers[i]()
 	}
@@ -117,6 +128,8 @@ func closeRoutines(closers []context.CancelFunc, wg *sync.WaitGroup) {
 // startGoRoutines starts the daemon goroutines
 func startGoRoutines(wg *sync.WaitGroup) context.CancelFunc {
 	ctx, cancel := context.WithCancel(context.Background())
+	setDaemonNotReady()
+	setApplyContext(ctx)
 	if _, err := config.ReadNetclientConfig(); err != nil {
 		slog.Error("error reading netclient config file", "error", err)
 	}
@@ -126,14 +139,22 @@ func startGoRoutines(wg *sync.WaitGroup) context.CancelFunc {
 		slog.Warn("error reading server map from disk", "error", err)
 	}
 	updateConfig := false
-	if freeport, err := ncutils.GetFreePort(config.Netclient().ListenPort); err != nil {
-		log.Fatal("no free ports available for use by netclient")
+	if isOwnListenPort(config.Netclient().ListenPort) {
+		// the port is held by the interface left over from the previous run, keep it so nat mappings survive the restart
+		slog.Info("reusing listen port of existing netmaker interface", "port", config.Netclient().ListenPort)
+	} else if freeport, err := config.GetFreeListenPort(config.Netclient().ListenPort); err != nil {
+		log.Fatal("no free ports available for use by netclient: ", err)
 	} else if freeport != config.Netclient().ListenPort {
 		slog.Info("port has changed", "old port", config.Netclient().ListenPort, "new port", freeport)
 		config.Netclient().ListenPort = freeport
 		updateConfig = true
 	}
 	config.SetServerCtx()
+	if server := config.GetServer(config.CurrServer); server != nil {
+		waitForNetwork(server.API)
+	} else {
+		waitForNetwork("")
+	}
 	config.HostPublicIP, config.WgPublicListenPort, config.HostNatType = holePunchWgPort()
 	slog.Info("wireguard public listen port: ", "port", config.WgPublicListenPort)
 
@@ -159,6 +180,11 @@ func startGoRoutines(wg *sync.WaitGroup) context.CancelFunc {
 	if pullErr != nil {
 		slog.Error("fail to pull config from server", "error", pullErr.Error())
 	}
+	for network, node := range config.GetNodes() {
+		node := node
+		applyUserNetwork(&node)
+		config.UpdateNodeMap(network, node)
+	}
 	nc := wireguard.NewNCIface(config.Netclient(), config.GetNodes())
 	if err := nc.Create(); err != nil {
 		slog.Error("error creating netclient interface", "error", err)
@@ -166,7 +192,30 @@ func startGoRoutines(wg *sync.WaitGroup) context.CancelFunc {
 	if err := nc.Configure(); err != nil {
 		slog.Error("error configuring netclient interface", "error", err)
 	}
+	setLinkDNS(ctx)
 	wireguard.SetPeers(true)
+	if err := applyPeerBlocks(); err != nil {
+		slog.Error("failed to apply rules of blocked peers", "error", err)
+	}
+	if err := applyOutboundOnly(); err != nil {
+		slog.Error("failed to apply outbound only mode", "error", err)
+	}
+	if err := applyInterNetworkRouting(); err != nil {
+		slog.Error("failed to apply inter-network routing", "error", err)
+	}
+	if err := applyMSSClamp(); err != nil {
+		slog.Error("failed to apply MSS clamping", "error", err)
+	}
+	if err := applyEgressPolicies(); err != nil {
+		slog.Error("failed to apply egress policies", "error", err)
+	}
+	if err := applyDefaultPolicy(); err != nil {
+		slog.Error("failed to apply the default policy", "error", err)
+	}
+	if err := applyExtClientNat(); err != nil {
+		slog.Error("failed to apply ext client nat", "error", err)
+	}
+	setDaemonReady()
 	if pullErr == nil {
 		go handleEndpointDetection(pullresp.Peers, pullresp.HostNetworkInfo)
 	}
@@ -175,31 +224,66 @@ func startGoRoutines(wg *sync.WaitGroup) context.CancelFunc {
 		return cancel
 	}
 	logger.Log(1, "started daemon for server ", server.Name)
-	wg.Add(1)
-	go messageQueue(ctx, wg, server)
-	wg.Add(1)
-	go Checkin(ctx, wg)
-	wg.Add(1)
-	go networking.StartIfaceDetection(ctx, wg, config.Netclient().ListenPort)
+	startServerGroup(ctx, wg, server)
+	listenPort := config.Netclient().ListenPort
+	subsystems := map[string]func(context.Context) error{
+		"ifacedetection": withWaitGroup(func(ctx context.Context, wg *sync.WaitGroup) {
+			networking.StartIfaceDetection(ctx, wg, listenPort)
+		}),
+	}
 	if server.IsPro {
-		wg.Add(1)
-		go watchPeerConnections(ctx, wg)
+		subsystems["peerconnections"] = withWaitGroup(watchPeerConnections)
+	}
+	if config.Netclient().StatsFile != "" {
+		subsystems["metrics"] = withWaitGroup(exportStats)
 	}
-	wg.Add(1)
-	go mqFallback(ctx, wg)
+	if config.Netclient().FlowAccounting {
+		subsystems["flows"] = withWaitGroup(accountFlows)
+	}
+	if len(config.Netclient().EgressHealthChecks) > 0 {
+		subsystems["egresshealth"] = withWaitGroup(checkEgressHealth)
+	}
+	if config.Netclient().WoLRelay {
+		subsystems["wolrelay"] = withWaitGroup(wolRelay)
+	}
+	if config.Netclient().RelaySelection {
+		subsystems["relayselection"] = selectRelays
+	}
+	subsystems["expose"] = exposeServices
+	subsystems["accessschedules"] = enforceAccessSchedules
+	subsystems["extclientexpiry"] = expireExtClients
+	subsystems["peerhistory"] = recordPeerHistory
+	if config.Netclient().AppRouting.Enabled() {
+		subsystems["approuting"] = routeApplications
+	}
+	if config.Netclient().MinimalRoutes.Enabled {
+		subsystems["minimalroutes"] = learnMinimalRoutes
+	}
+	if config.Netclient().PolicyHook.Enabled() {
+		subsystems["policyhook"] = runPolicyHook
+	}
+	if config.Netclient().FastPath {
+		subsystems["fastpath"] = runFastPath
+	}
+	if config.GetFirewallCheckInterval() > 0 {
+		subsystems["firewallcheck"] = withWaitGroup(verifyFirewall)
+	}
+	if config.GetBackupInterval() > 0 {
+		subsystems["backup"] = withWaitGroup(backupConfig)
+	}
+	startGroup(ctx, wg, daemonGroup, subsystems)
 
 	return cancel
 }
 
 // sets up Message Queue and subsribes/publishes updates to/from server
 // the client should subscribe to ALL nodes that exist on server locally
-func messageQueue(ctx context.Context, wg *sync.WaitGroup, server *config.Server) {
-	defer wg.Done()
+func messageQueue(ctx context.Context, server *config.Server) error {
 	slog.Info("netclient message queue started for server:", "server", server.Name)
 	err := setupMQTT(server)
 	if err != nil {
 		slog.Error("unable to connect to broker", "server", server.Broker, "error", err)
-		return
+		return err
 	}
 	defer func() {
 		if Mqclient != nil {
@@ -208,6 +292,7 @@ func messageQueue(ctx context.Context, wg *sync.WaitGroup, server *config.Server
 	}()
 	<-ctx.Done()
 	slog.Info("shutting down message queue", "server", server.Name)
+	return nil
 }
 
 // setupMQTT creates a connection to broker
@@ -230,10 +315,12 @@ func setupMQTT(server *config.Server) error {
 	opts.SetWriteTimeout(time.Minute)
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
 		slog.Info("mqtt connect handler")
+		cancelSessionResume()
 		nodes := config.GetNodes()
 		for _, node := range nodes {
 			node := node
 			setSubscriptions(client, &node)
+			setServiceSubscription(client, &node)
 		}
 		setHostSubscription(client, server.Name)
 		checkin()
@@ -242,9 +329,9 @@ func setupMQTT(server *config.Server) error {
 	opts.SetResumeSubs(true)
 	opts.SetConnectionLostHandler(func(c mqtt.Client, e error) {
 		slog.Warn("detected broker connection lost for", "server", server.Broker)
-		// restart daemon for new udp hole punch if MQTT connection is lost (can happen on network change)
+		// restart daemon for new udp hole punch if MQTT connection is not resumed (can happen on network change)
 		if !config.Netclient().IsStatic {
-			daemon.Restart()
+			scheduleSessionResume(server)
 		}
 	})
 	Mqclient = mqtt.NewClient(opts)
@@ -367,7 +454,7 @@ func decryptMsg(serverName string, msg []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return DeChunk(msg, serverPubKey, diskKey)
+	return ncutils.DeChunk(msg, serverPubKey, diskKey)
 }
 
 func read(network, which string) string {
@@ -410,6 +497,7 @@ func unsubscribeNode(client mqtt.Client, node *config.Node) {
 	if ok {
 		slog.Info("unsubscribed from updates for node", "node", node.ID, "network", node.Network)
 	}
+	unsubscribeServices(client, node)
 }
 
 // unsubscribe client broker communications for host topics
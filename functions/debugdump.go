@@ -0,0 +1,86 @@
+package functions
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"gopkg.in/yaml.v3"
+)
+
+// DebugDir - directory (below the netclient path) debug dumps are written to
+const DebugDir = "debug"
+
+// DebugDump - redacted snapshot of the running daemon for incident diagnostics
+type DebugDump struct {
+	Time       time.Time   `json:"time"`
+	Version    string      `json:"version"`
+	OS         string      `json:"os"`
+	Arch       string      `json:"arch"`
+	Goroutines string      `json:"goroutines"`
+	Config     string      `json:"config"`
+	State      DaemonState `json:"state"`
+	Logs       []string    `json:"logs"`
+}
+
+// writeDebugDump - writes the goroutines, redacted config, peers and recent logs of the daemon
+func writeDebugDump() (string, error) {
+	var goroutines bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+		return "", err
+	}
+	host := *config.Netclient()
+	host.PrivateKey = wgtypes.Key{}
+	host.TrafficKeyPrivate = nil
+	host.HostPass = ""
+	cfg, err := yaml.Marshal(host)
+	if err != nil {
+		return "", err
+	}
+	dump := DebugDump{
+		Time:       time.Now(),
+		Version:    config.Version,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Goroutines: goroutines.String(),
+		Config:     redact(string(cfg)),
+		State:      currentState(ApplyStatus{}),
+		Logs:       ncutils.RecentLogs.Lines(),
+	}
+	for i := range dump.Logs {
+		dump.Logs[i] = redact(dump.Logs[i])
+	}
+	dir := filepath.Join(config.GetNetclientPath(), DebugDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "debug-"+dump.Time.Format("20060102-150405")+".json")
+	return file, os.WriteFile(file, data, 0600)
+}
+
+// debugLevelRestore - log level before debug logging was toggled on
+var debugLevelRestore = slog.LevelError
+
+// toggleDebugLogging - switches the log level to debug, or back to the previous level
+func toggleDebugLogging() {
+	if ncutils.LogLevel.Level() != slog.LevelDebug {
+		debugLevelRestore = ncutils.LogLevel.Level()
+		ncutils.LogLevel.Set(slog.LevelDebug)
+		slog.Warn("debug logging enabled")
+		return
+	}
+	slog.Warn("debug logging disabled", "level", debugLevelRestore)
+	ncutils.LogLevel.Set(debugLevelRestore)
+}
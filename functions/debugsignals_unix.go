@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package functions
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/exp/slog"
+)
+
+// handleDebugSignals - SIGUSR1 writes a debug dump, SIGUSR2 toggles debug logging
+func handleDebugSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			if sig == syscall.SIGUSR2 {
+				toggleDebugLogging()
+				continue
+			}
+			file, err := writeDebugDump()
+			if err != nil {
+				slog.Error("failed to write debug dump", "error", err)
+				continue
+			}
+			slog.Warn("debug dump written", "file", file)
+		}
+	}
+}
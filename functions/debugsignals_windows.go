@@ -0,0 +1,6 @@
+package functions
+
+import "context"
+
+// handleDebugSignals - windows has no user signals
+func handleDebugSignals(ctx context.Context) {}
@@ -0,0 +1,62 @@
+package functions
+
+import (
+	"net"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"golang.org/x/exp/slog"
+)
+
+// reasons recorded for networks removed by their server
+const (
+	removedNodeDeleted = "node deleted by the server"
+	removedHostDeleted = "host deleted from the server"
+	removedNotOnServer = "node no longer known to the server"
+)
+
+// decommissionNetwork - cleans up a network whose node the server removed: the interface, routes,
+// dns and firewall state of the network are dropped and the interface is reconfigured for the
+// remaining networks, the server is not contacted as it already forgot the node
+func decommissionNetwork(client mqtt.Client, network, reason string) error {
+	node, ok := config.GetNodes()[network]
+	if !ok {
+		return nil
+	}
+	if client != nil {
+		unsubscribeNode(client, &node)
+	}
+	removeNetworkState(node, reason)
+	return recreateInterface()
+}
+
+// removeNetworkState - removes the local state of a network removed by its server and records why,
+// the interface is left to the caller
+func removeNetworkState(node config.Node, reason string) {
+	slog.Warn("network was removed by the server, cleaning up", "network", node.Network, "server", node.Server, "reason", reason)
+	for _, peer := range config.Netclient().HostPeers {
+		if inNetwork(peer.AllowedIPs, []net.IPNet{node.NetworkRange, node.NetworkRange6}) && !inOtherNetwork(node, peer.AllowedIPs) {
+			firewall.RemovePeerRoutes(node.Server, peer.PublicKey.String())
+		}
+	}
+	firewall.FlushNetworkRules(node.Server, node.Network)
+	config.RecordRemovedNetwork(node, reason)
+	if err := deleteLocalNetwork(&node); err != nil {
+		slog.Warn("failed to remove local network", "network", node.Network, "error", err)
+	}
+	if server := config.GetServer(node.Server); server != nil && len(server.Nodes) == 0 {
+		firewall.DeleteEgressGwRoutes(node.Server)
+	}
+}
+
+// inOtherNetwork - checks if any of the allowed ips is an address in another joined network than
+// the one of node
+func inOtherNetwork(node config.Node, allowed []net.IPNet) bool {
+	for _, other := range config.GetNodes() {
+		if other.Network != node.Network && inNetwork(allowed, []net.IPNet{other.NetworkRange, other.NetworkRange6}) {
+			return true
+		}
+	}
+	return false
+}
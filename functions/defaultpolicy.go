@@ -0,0 +1,39 @@
+package functions
+
+import (
+	"net"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"golang.org/x/exp/slog"
+)
+
+// applyDefaultPolicy - installs the rules of the default-deny networks of the host config, it runs after
+// each peer update as the server may change the ranges of the networks
+func applyDefaultPolicy() error {
+	policy := config.Netclient().DefaultPolicy
+	nodes := config.GetNodes()
+	for network, p := range policy {
+		if p != config.DefaultPolicyAllow && p != config.DefaultPolicyDeny {
+			slog.Warn("unknown default policy, using allow", "network", network, "policy", p)
+		}
+		if _, ok := nodes[network]; !ok {
+			slog.Warn("default policy set for a network the host is not joined to", "network", network)
+		}
+	}
+	ranges := []net.IPNet{}
+	for network, node := range nodes {
+		if !policy.Deny(network) {
+			continue
+		}
+		for _, r := range []net.IPNet{node.NetworkRange, node.NetworkRange6} {
+			if r.IP != nil {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+	if err := firewall.SetDropLogging(config.Netclient().LogDrops); err != nil {
+		slog.Warn("failed to set drop logging", "error", err)
+	}
+	return firewall.SetDefaultDeny(ranges)
+}
@@ -0,0 +1,174 @@
+package functions
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/daemon"
+	"golang.org/x/exp/slog"
+)
+
+// actions of the changes computed from a desired state
+const (
+	ActionJoin       = "join"
+	ActionLeave      = "leave"
+	ActionConnect    = "connect"
+	ActionDisconnect = "disconnect"
+	ActionSet        = "set"
+)
+
+// DesiredState - declarative description of the networks and local settings of this host,
+// applied with `netclient apply -f <file>`
+type DesiredState struct {
+	// Networks networks this host should be part of, keyed by network name
+	Networks map[string]DesiredNetwork `json:"networks" yaml:"networks"`
+	// Prune leaves the networks this host is part of which are not listed in Networks
+	Prune bool `json:"prune" yaml:"prune"`
+	// Settings local settings keyed as in netclient.yml, settings not listed are left as they are
+	Settings map[string]any `json:"settings" yaml:"settings"`
+}
+
+// DesiredNetwork - desired state of a network
+type DesiredNetwork struct {
+	// Token enrollment token used to join the network when this host is not part of it yet
+	Token string `json:"token" yaml:"token"`
+	// Connected whether the node of this host is connected, defaults to true
+	Connected *bool `json:"connected" yaml:"connected"`
+}
+
+// IsConnected - returns the desired connection state of the network
+func (n DesiredNetwork) IsConnected() bool {
+	return n.Connected == nil || *n.Connected
+}
+
+// Change - a change between the current and the desired state
+type Change struct {
+	Action string `json:"action"`
+	// Target network or setting key the change applies to
+	Target string `json:"target"`
+	// Error why the change could not be applied, empty on success
+	Error string `json:"error,omitempty"`
+}
+
+// applyRequest - request to apply a desired state through the local api
+type applyRequest struct {
+	State  DesiredState `json:"state"`
+	DryRun bool         `json:"dry_run"`
+}
+
+// ApplyDesiredState - has the running daemon apply the desired state, returns the changes made or
+// only computed on a dry run
+func ApplyDesiredState(state DesiredState, dryRun bool) ([]Change, error) {
+	return callDaemon[[]Change](http.MethodPost, "/apply", applyRequest{State: state, DryRun: dryRun})
+}
+
+// planDesiredState - computes the changes to reach the desired state: joins, connection changes,
+// leaves and settings, in the order they are applied
+func planDesiredState(state DesiredState) ([]Change, error) {
+	changes := []Change{}
+	nodes := config.GetNodes()
+	networks := make([]string, 0, len(state.Networks))
+	for network := range state.Networks {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	for _, network := range networks {
+		desired := state.Networks[network]
+		node, ok := nodes[network]
+		if !ok {
+			if desired.Token == "" {
+				return nil, fmt.Errorf("network %s is not joined and has no enrollment token", network)
+			}
+			changes = append(changes, Change{Action: ActionJoin, Target: network})
+			continue
+		}
+		if node.Connected != desired.IsConnected() {
+			action := ActionDisconnect
+			if desired.IsConnected() {
+				action = ActionConnect
+			}
+			changes = append(changes, Change{Action: action, Target: network})
+		}
+	}
+	if state.Prune {
+		joined := []string{}
+		for network := range nodes {
+			if _, ok := state.Networks[network]; !ok {
+				joined = append(joined, network)
+			}
+		}
+		sort.Strings(joined)
+		for _, network := range joined {
+			changes = append(changes, Change{Action: ActionLeave, Target: network})
+		}
+	}
+	keys := make([]string, 0, len(state.Settings))
+	for key := range state.Settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		equal, err := config.Netclient().SettingEqual(key, state.Settings[key])
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			changes = append(changes, Change{Action: ActionSet, Target: key})
+		}
+	}
+	return changes, nil
+}
+
+// applyDesiredState - computes the changes to reach the desired state and applies them unless it is a
+// dry run, a failed change does not stop the following ones, the daemon restarts after any change
+func applyDesiredState(state DesiredState, dryRun bool) ([]Change, error) {
+	changes, err := planDesiredState(state)
+	if err != nil || dryRun || len(changes) == 0 {
+		return changes, err
+	}
+	var host *config.Config
+	settingsChanged := false
+	for i, change := range changes {
+		var err error
+		switch change.Action {
+		case ActionJoin:
+			err = Register(state.Networks[change.Target].Token, true)
+		case ActionConnect:
+			err = setConnected(change.Target, true)
+		case ActionDisconnect:
+			err = setConnected(change.Target, false)
+		case ActionLeave:
+			_, err = LeaveNetwork(change.Target, true)
+		case ActionSet:
+			// settings come last, copy the config once the network changes are done
+			if host == nil {
+				current := *config.Netclient()
+				host = &current
+			}
+			err = host.SetSetting(change.Target, state.Settings[change.Target])
+			settingsChanged = settingsChanged || err == nil
+		}
+		if err != nil {
+			changes[i].Error = err.Error()
+			slog.Error("failed to apply change", "action", change.Action, "target", change.Target, "error", err)
+			continue
+		}
+		slog.Info("applied change", "action", change.Action, "target", change.Target)
+	}
+	if settingsChanged {
+		config.UpdateNetclient(*host)
+		if err := config.WriteNetclientConfig(); err != nil {
+			return changes, fmt.Errorf("failed to write settings %w", err)
+		}
+	}
+	go func() {
+		time.Sleep(3 * time.Second)
+		if err := daemon.Restart(); err != nil {
+			slog.Error("daemon restart failed", "error", err)
+		}
+	}()
+	return changes, nil
+}
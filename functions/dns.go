@@ -1,15 +1,19 @@
 package functions
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/txeh"
 	"github.com/guumaster/hostctl/pkg/file"
 	"github.com/guumaster/hostctl/pkg/types"
+	"golang.org/x/exp/slog"
 )
 
 const etcHostsComment = "netmaker"
@@ -44,7 +48,60 @@ func removeHostDNS(network string) error {
 	return nil
 }
 
+// deleteAllDNS - removes the /etc/hosts entries of all servers
 func deleteAllDNS() error {
+	return writeExtClientDNS("", nil)
+}
+
+// dnsComment - the comment of the /etc/hosts entries of a server
+func dnsComment(server string) string {
+	return etcHostsComment + ":" + server
+}
+
+// isDNSComment - checks if the comment marks an /etc/hosts entry of the server, of any server if empty;
+// entries written before they were scoped to their server belong to no server and are only removed with
+// the entries of all servers, as the startup cleanup does
+func isDNSComment(comment, server string) bool {
+	if server == "" {
+		return comment == etcHostsComment || strings.HasPrefix(comment, etcHostsComment+":")
+	}
+	return comment == dnsComment(server)
+}
+
+// setExtClientDNS - on ingress gateways, adds /etc/hosts entries of the form
+// <extclient>.<network> for the ext clients attached to this host, the entries of the server are
+// removed once it is no ingress gateway or the setting is turned off
+func setExtClientDNS(server string, peerIDs models.PeerMap) {
+	records := []string{}
+	if !config.Netclient().ExtClientDNS || !isIngressGateway(server) {
+		peerIDs = nil
+	}
+	for _, peer := range peerIDs {
+		if !peer.IsExtClient || peer.Name == "" || peer.Address == "" {
+			continue
+		}
+		address, _, _ := strings.Cut(peer.Address, "/")
+		records = append(records, address+" "+strings.ToLower(peer.Name+"."+peer.Network))
+	}
+	sort.Strings(records)
+	data, err := json.Marshal(records)
+	if err != nil {
+		return
+	}
+	if read(server, lastDNSUpdate) == string(data) {
+		return
+	}
+	if err := writeExtClientDNS(server, records); err != nil {
+		slog.Error("failed to update ext client dns entries", "server", server, "error", err)
+		return
+	}
+	insert(server, lastDNSUpdate, string(data))
+	slog.Info("updated ext client dns entries", "server", server, "count", len(records))
+}
+
+// writeExtClientDNS - replaces the /etc/hosts entries of the server with the records, the entries of
+// the other servers are left untouched
+func writeExtClientDNS(server string, records []string) error {
 	temp := os.TempDir()
 	lockfile := temp + "/netclient-lock"
 	if err := config.Lock(lockfile); err != nil {
@@ -55,16 +112,28 @@ func deleteAllDNS() error {
 	if err != nil {
 		return err
 	}
-	lines := hosts.GetHostFileLines()
-	addressesToDelete := []string{}
-	for _, line := range *lines {
-		if line.Comment == etcHostsComment {
-			addressesToDelete = append(addressesToDelete, line.Address)
+	stale := map[string][]string{}
+	for _, line := range *hosts.GetHostFileLines() {
+		if isDNSComment(line.Comment, server) {
+			stale[line.Comment] = append(stale[line.Comment], line.Address)
 		}
 	}
-	hosts.RemoveAddresses(addressesToDelete, etcHostsComment)
-	if err := hosts.Save(); err != nil {
-		return err
+	for comment, addresses := range stale {
+		hosts.RemoveAddresses(addresses, comment)
 	}
-	return nil
+	for _, record := range records {
+		address, name, _ := strings.Cut(record, " ")
+		hosts.AddHost(address, name, dnsComment(server))
+	}
+	return hosts.Save()
+}
+
+// isIngressGateway - checks if any node of the host on the given server is an ingress gateway
+func isIngressGateway(server string) bool {
+	for _, node := range config.GetNodes() {
+		if node.Server == server && node.IsIngressGateway {
+			return true
+		}
+	}
+	return false
 }
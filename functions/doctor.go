@@ -0,0 +1,166 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/stun"
+)
+
+// maxClockSkew - skew to the server beyond which authentication tokens may be rejected
+const maxClockSkew = time.Minute
+
+// CheckResult - outcome of a doctor check
+type CheckResult string
+
+const (
+	// CheckPass - the check passed
+	CheckPass CheckResult = "PASS"
+	// CheckWarn - the check found a problem that may affect some setups
+	CheckWarn CheckResult = "WARN"
+	// CheckFail - the check found a problem
+	CheckFail CheckResult = "FAIL"
+	// CheckSkip - the check does not apply to this host
+	CheckSkip CheckResult = "SKIP"
+)
+
+// Check - result of a local health check run by netclient doctor
+type Check struct {
+	Name   string      `json:"name"`
+	Result CheckResult `json:"result"`
+	Detail string      `json:"detail"`
+	Hint   string      `json:"hint,omitempty"`
+}
+
+// Doctor - runs the local health checks
+func Doctor() []Check {
+	checks := platformChecks()
+	checks = append(checks, checkStun(), checkClockSkew())
+	checks = append(checks, checkDNSServers()...)
+	return checks
+}
+
+// checkStun - checks the public endpoint of the listen port through stun
+func checkStun() Check {
+	check := Check{Name: "port reachability"}
+	port := config.Netclient().ListenPort
+	stunPort := port
+	if isOwnListenPort(port) || !isPortFree(port) {
+		// the port is in use by the interface, the nat type is the same for any port
+		stunPort = 0
+	}
+	publicIP, publicPort, natType := stun.HolePunch(stunPort)
+	if publicIP == nil {
+		check.Result = CheckFail
+		check.Detail = "no stun server answered"
+		check.Hint = "allow outbound udp to the stun servers, peers can then learn the public endpoint of this host"
+		return check
+	}
+	check.Detail = fmt.Sprintf("public address %s, nat type %s", net.JoinHostPort(publicIP.String(), strconv.Itoa(publicPort)), natType)
+	switch {
+	case stunPort != 0 && publicPort != port:
+		check.Result = CheckWarn
+		check.Hint = fmt.Sprintf("the nat maps listen port %d to %d, forward udp port %d to this host or rely on a relay", port, publicPort, port)
+	case config.Netclient().EndpointIP != nil && !config.Netclient().EndpointIP.Equal(publicIP):
+		check.Result = CheckWarn
+		check.Hint = "the configured endpoint " + config.Netclient().EndpointIP.String() + " differs from the public address"
+	default:
+		check.Result = CheckPass
+	}
+	return check
+}
+
+func isPortFree(port int) bool {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// checkClockSkew - compares the local clock to the date reported by the server
+func checkClockSkew() Check {
+	check := Check{Name: "clock skew"}
+	server := config.GetServer(config.CurrServer)
+	if server == nil {
+		check.Result = CheckSkip
+		check.Detail = "not registered with a server"
+		return check
+	}
+	client := http.Client{Timeout: time.Second * 10}
+	start := time.Now()
+	resp, err := client.Head("https://" + server.API)
+	if err != nil {
+		check.Result = CheckFail
+		check.Detail = "server unreachable: " + err.Error()
+		check.Hint = "check connectivity to " + server.API
+		return check
+	}
+	resp.Body.Close()
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		check.Result = CheckSkip
+		check.Detail = "server did not report its time"
+		return check
+	}
+	// the date header has a resolution of a second, compare to the middle of the request
+	local := start.Add(time.Since(start) / 2)
+	skew := local.Sub(serverTime).Round(time.Second)
+	check.Detail = "local clock is " + skew.String() + " off the server"
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		check.Result = CheckFail
+		check.Hint = "synchronize the clock with ntp (e.g. timedatectl set-ntp true), authentication tokens are time limited"
+		return check
+	}
+	check.Result = CheckPass
+	return check
+}
+
+// checkDNSServers - checks the dns servers of the networks with dns enabled answer queries
+func checkDNSServers() []Check {
+	checks := []Check{}
+	for _, node := range config.GetNodes() {
+		if !node.DNSOn {
+			continue
+		}
+		check := Check{Name: "dns " + node.Network}
+		server := config.GetServer(node.Server)
+		if server == nil || net.ParseIP(server.CoreDNSAddr) == nil {
+			check.Result = CheckWarn
+			check.Detail = "the server did not provide a dns address"
+			check.Hint = "enable dns on the server or disable it for the network"
+			checks = append(checks, check)
+			continue
+		}
+		addr := net.JoinHostPort(server.CoreDNSAddr, "53")
+		resolver := net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		_, err := resolver.LookupHost(ctx, node.Network)
+		cancel()
+		var dnsErr *net.DNSError
+		if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			check.Result = CheckFail
+			check.Detail = "dns server " + addr + " did not answer: " + err.Error()
+			check.Hint = "check the netmaker interface is up and the peers of the dns server are reachable"
+		} else {
+			check.Result = CheckPass
+			check.Detail = "dns server " + addr + " answers"
+		}
+		checks = append(checks, check)
+		checks = append(checks, checkResolverConfig(node.Network, server.CoreDNSAddr)...)
+	}
+	return checks
+}
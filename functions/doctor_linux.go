@@ -0,0 +1,132 @@
+package functions
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netclient/wireguard"
+)
+
+func platformChecks() []Check {
+	return []Check{checkWireGuard(), checkIptables(), checkForwarding()}
+}
+
+// checkWireGuard - checks kernel wireguard or the userspace fallback is available
+func checkWireGuard() Check {
+	check := Check{Name: "wireguard"}
+	kernel, tun := wireguard.KernelSupport()
+	switch {
+	case kernel:
+		check.Result = CheckPass
+		check.Detail = "kernel wireguard available"
+	case tun:
+		check.Result = CheckWarn
+		check.Detail = "kernel wireguard not available, using userspace wireguard"
+		check.Hint = "install the wireguard kernel module (linux 5.6+ or wireguard-dkms) for better performance"
+	default:
+		check.Result = CheckFail
+		check.Detail = "neither kernel wireguard nor the tun device are available"
+		check.Hint = "load the wireguard module (modprobe wireguard) or the tun module (modprobe tun)"
+	}
+	return check
+}
+
+// checkIptables - checks iptables works and is not split between the legacy and nft backends
+func checkIptables() Check {
+	check := Check{Name: "iptables"}
+	if !ncutils.IsIPTablesPresent() {
+		if ncutils.IsNFTablesPresent() {
+			check.Result = CheckPass
+			check.Detail = "iptables not found, using nftables"
+			return check
+		}
+		check.Result = CheckFail
+		check.Detail = "neither iptables nor nftables found"
+		check.Hint = "install iptables or nftables, gateways need them"
+		return check
+	}
+	// single stack hosts only have one of the binaries, the other address family is not managed
+	binary := "iptables"
+	if _, err := exec.LookPath(binary); err != nil {
+		binary = "ip6tables"
+	}
+	version, err := ncutils.Exec(context.Background(), ncutils.NewCommand(binary, "-V"))
+	if err != nil {
+		check.Result = CheckFail
+		check.Detail = binary + " -V failed: " + err.Error()
+		return check
+	}
+	version = strings.TrimSpace(version)
+	if binary != "iptables" {
+		version += ", iptables not found, ipv4 rules are not managed"
+	} else if _, err := exec.LookPath("ip6tables"); err != nil {
+		version += ", ip6tables not found, ipv6 rules are not managed"
+	}
+	if _, err := ncutils.Exec(context.Background(), ncutils.NewCommand(binary, "-S", "FORWARD")); err != nil {
+		check.Result = CheckFail
+		check.Detail = version + ", listing rules failed: " + err.Error()
+		check.Hint = "run netclient as root and check the iptables kernel modules are loaded"
+		return check
+	}
+	check.Detail = version
+	if strings.Contains(version, "nf_tables") {
+		// rules left in the legacy backend are still enforced but invisible to the nft backend
+		if out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("iptables-legacy", "-S")); err == nil &&
+			strings.Count(out, "\n") > 3 {
+			check.Result = CheckWarn
+			check.Hint = "iptables-legacy also has rules, tools mixing both backends may bypass netmaker rules"
+			return check
+		}
+	}
+	check.Result = CheckPass
+	return check
+}
+
+// checkForwarding - checks ip forwarding, needed on gateways
+func checkForwarding() Check {
+	check := Check{Name: "ip forwarding"}
+	v4, _ := os.ReadFile("/proc/sys/net/ipv4/ip_forward")
+	v6, _ := os.ReadFile("/proc/sys/net/ipv6/conf/all/forwarding")
+	off := []string{}
+	if strings.TrimSpace(string(v4)) != "1" {
+		off = append(off, "net.ipv4.ip_forward")
+	}
+	if strings.TrimSpace(string(v6)) != "1" {
+		off = append(off, "net.ipv6.conf.all.forwarding")
+	}
+	if len(off) == 0 {
+		check.Result = CheckPass
+		check.Detail = "enabled"
+		return check
+	}
+	check.Result = CheckWarn
+	check.Detail = strings.Join(off, ", ") + " disabled"
+	check.Hint = "needed for egress, ingress and relay gateways: sysctl -w " + strings.Join(off, "=1 ") + "=1"
+	return check
+}
+
+// checkResolverConfig - checks systemd-resolved routes the network domain to the dns server
+func checkResolverConfig(network, dnsAddr string) []Check {
+	if _, err := os.Stat(resolvedRuntimeDir); err != nil {
+		return nil
+	}
+	check := Check{Name: "dns integration " + network}
+	out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("resolvectl", "dns", ncutils.GetInterfaceName()))
+	if err != nil {
+		check.Result = CheckWarn
+		check.Detail = "resolvectl failed: " + err.Error()
+		return []Check{check}
+	}
+	if !strings.Contains(out, dnsAddr) {
+		check.Result = CheckFail
+		check.Detail = "systemd-resolved does not use " + dnsAddr + " for the netmaker interface"
+		check.Hint = "restart the daemon (netclient daemon restart) to reconfigure systemd-resolved"
+		return []Check{check}
+	}
+	check.Result = CheckPass
+	check.Detail = "systemd-resolved uses " + dnsAddr + " for the netmaker interface"
+	return []Check{check}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package functions
+
+func platformChecks() []Check {
+	return nil
+}
+
+func checkResolverConfig(network, dnsAddr string) []Check {
+	return nil
+}
@@ -0,0 +1,38 @@
+package functions
+
+import (
+	"net/http"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"golang.org/x/exp/slog"
+)
+
+// dropLogRequest - request to switch the logging of dropped packets through the local api
+type dropLogRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetDropLogging - has the running daemon log, or stop logging, the packets dropped by the netmaker rules
+func SetDropLogging(enabled bool) error {
+	_, err := callDaemon[any](http.MethodPost, "/firewall/droplog", dropLogRequest{Enabled: enabled})
+	return err
+}
+
+// setDropLogging - switches the logging of dropped packets and persists it
+func setDropLogging(enabled bool) error {
+	if err := firewall.SetDropLogging(enabled); err != nil {
+		return err
+	}
+	host := config.Netclient()
+	if host.LogDrops == enabled {
+		return nil
+	}
+	host.LogDrops = enabled
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		return err
+	}
+	slog.Info("drop logging changed", "enabled", enabled)
+	return nil
+}
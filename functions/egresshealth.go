@@ -0,0 +1,310 @@
+package functions
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netclient/wireguard"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// HealthCheckInterval - interval between egress range health probes
+const HealthCheckInterval = time.Second * 30
+
+// EgressHealth - health check state of an egress range
+type EgressHealth struct {
+	Range        string    `json:"range"`
+	Gateway      string    `json:"gateway"`
+	Target       string    `json:"target"`
+	Protocol     string    `json:"protocol"`
+	Healthy      bool      `json:"healthy"`
+	Demoted      bool      `json:"demoted"`
+	Failures     int       `json:"failures"`
+	LastCheck    time.Time `json:"lastcheck"`
+	DemotedUntil time.Time `json:"demoteduntil"`
+}
+
+var (
+	// egressHealth - health check state of the egress ranges, by range and gateway
+	egressHealth        = make(map[string]*EgressHealth)
+	currentEgressRoutes []models.EgressNetworkRoutes
+	egressHealthMutex   sync.Mutex
+)
+
+// egressHealthKey - key of the health check state of an egress range through a gateway
+func egressHealthKey(egressRange string, gateway net.IP) string {
+	return egressRange + "@" + gateway.String()
+}
+
+// GetEgressHealth - returns the health check state of the egress ranges
+func GetEgressHealth() []EgressHealth {
+	egressHealthMutex.Lock()
+	defer egressHealthMutex.Unlock()
+	health := []EgressHealth{}
+	for _, state := range egressHealth {
+		health = append(health, *state)
+	}
+	sort.Slice(health, func(i, j int) bool {
+		if health[i].Range != health[j].Range {
+			return health[i].Range < health[j].Range
+		}
+		return health[i].Gateway < health[j].Gateway
+	})
+	return health
+}
+
+// setEgressRoutes - installs the egress routes except for the ranges of gateways demoted by failing
+// health checks, and moves the ranges failed over to another gateway back to that gateway's peer, as a
+// peer update restores the allowed ips designated by the server
+func setEgressRoutes(routes []models.EgressNetworkRoutes) {
+	egressHealthMutex.Lock()
+	currentEgressRoutes = routes
+	filtered := filterDemotedRanges(routes)
+	failedOver := make(map[string]net.IP)
+	for egressRange := range config.Netclient().EgressHealthChecks {
+		gateways := egressGateways(egressRange)
+		if active := activeEgressGateway(egressRange); active != nil && !active.Equal(gateways[0]) {
+			failedOver[egressRange] = active
+		}
+	}
+	egressHealthMutex.Unlock()
+	if len(filtered) > 0 {
+		wireguard.SetEgressRoutes(filtered)
+	}
+	for egressRange, gateway := range failedOver {
+		if err := moveEgressRange(egressRange, gateway); err != nil {
+			slog.Warn("failed to keep egress range on its failover gateway", "range", egressRange, "gateway", gateway.String(), "error", err)
+		}
+	}
+}
+
+// filterDemotedRanges - returns a copy of the routes without the ranges of demoted gateways, caller must
+// hold egressHealthMutex
+func filterDemotedRanges(routes []models.EgressNetworkRoutes) []models.EgressNetworkRoutes {
+	filtered := []models.EgressNetworkRoutes{}
+	for _, route := range routes {
+		ranges := []string{}
+		for _, egressRange := range route.EgressRanges {
+			if state, ok := egressHealth[egressHealthKey(egressRange, route.NodeAddr.IP)]; ok && state.Demoted {
+				continue
+			}
+			ranges = append(ranges, egressRange)
+		}
+		filtered = append(filtered, models.EgressNetworkRoutes{NodeAddr: route.NodeAddr, EgressRanges: ranges})
+	}
+	return filtered
+}
+
+// egressGateways - returns the gateways of the egress range in the order of the server, caller must hold
+// egressHealthMutex
+func egressGateways(egressRange string) []net.IP {
+	gateways := []net.IP{}
+	for _, route := range currentEgressRoutes {
+		for _, r := range route.EgressRanges {
+			if r == egressRange {
+				gateways = append(gateways, route.NodeAddr.IP)
+				break
+			}
+		}
+	}
+	return gateways
+}
+
+// activeEgressGateway - returns the gateway carrying the egress range, the first one not demoted, nil
+// when all are demoted; caller must hold egressHealthMutex
+func activeEgressGateway(egressRange string) net.IP {
+	for _, gateway := range egressGateways(egressRange) {
+		if state, ok := egressHealth[egressHealthKey(egressRange, gateway)]; !ok || !state.Demoted {
+			return gateway
+		}
+	}
+	return nil
+}
+
+// checkEgressHealth - periodically probes the configured egress ranges through their active gateway,
+// failing the range over to the next gateway when the active one is demoted, and retrying demoted
+// gateways after a hold down
+func checkEgressHealth(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("egress health check routine closed")
+			return
+		case <-ticker.C:
+			for egressRange, check := range config.Netclient().EgressHealthChecks {
+				probeEgressRange(egressRange, check)
+			}
+		}
+	}
+}
+
+// probeEgressRange - runs a health check of the egress range through its active gateway
+func probeEgressRange(egressRange string, check config.HealthCheck) {
+	egressHealthMutex.Lock()
+	gateways := egressGateways(egressRange)
+	for key, state := range egressHealth {
+		if state.Range == egressRange && !containsIP(gateways, net.ParseIP(state.Gateway)) {
+			delete(egressHealth, key)
+		}
+	}
+	active := activeEgressGateway(egressRange)
+	retried := false
+	for _, gateway := range gateways {
+		state, ok := egressHealth[egressHealthKey(egressRange, gateway)]
+		if !ok || !state.Demoted || time.Now().Before(state.DemotedUntil) {
+			continue
+		}
+		slog.Info("retrying demoted egress gateway", "range", egressRange, "gateway", state.Gateway)
+		state.Demoted, state.Failures = false, 0
+		retried = true
+	}
+	if retried {
+		egressHealthMutex.Unlock()
+		switchEgressGateway(egressRange, active)
+		return
+	}
+	if active == nil {
+		egressHealthMutex.Unlock()
+		return
+	}
+	key := egressHealthKey(egressRange, active)
+	state, ok := egressHealth[key]
+	if !ok {
+		state = &EgressHealth{Range: egressRange, Gateway: active.String(), Healthy: true}
+		egressHealth[key] = state
+	}
+	state.Target, state.Protocol = check.Target, check.Protocol
+	egressHealthMutex.Unlock()
+
+	healthy := probe(check)
+
+	egressHealthMutex.Lock()
+	state.LastCheck = time.Now()
+	if healthy {
+		if !state.Healthy {
+			slog.Info("egress range health check recovered", "range", egressRange, "gateway", state.Gateway)
+		}
+		state.Healthy, state.Failures = true, 0
+		egressHealthMutex.Unlock()
+		return
+	}
+	state.Healthy = false
+	state.Failures++
+	slog.Warn("egress range health check failed", "range", egressRange, "gateway", state.Gateway,
+		"target", check.Target, "failures", state.Failures)
+	if state.Failures < check.GetFailures() {
+		egressHealthMutex.Unlock()
+		return
+	}
+	state.Demoted = true
+	state.DemotedUntil = time.Now().Add(config.DefaultHealthCheckHoldDown)
+	slog.Warn("demoting egress gateway", "range", egressRange, "gateway", state.Gateway,
+		"until", state.DemotedUntil.Format(time.RFC3339))
+	egressHealthMutex.Unlock()
+	switchEgressGateway(egressRange, active)
+}
+
+// switchEgressGateway - moves the egress range from the gateway it was routed through to the active
+// gateway of the range: the route is replaced and the range is moved to the allowed ips of the peer of
+// the active gateway, which carries the traffic of the range
+func switchEgressGateway(egressRange string, from net.IP) {
+	egressHealthMutex.Lock()
+	to := activeEgressGateway(egressRange)
+	egressHealthMutex.Unlock()
+	if from != nil && from.Equal(to) {
+		return
+	}
+	if from != nil {
+		wireguard.RemoveEgressRange(egressRange, from)
+	}
+	if to == nil {
+		slog.Warn("no healthy gateway left for egress range", "range", egressRange)
+		return
+	}
+	wireguard.AddEgressRange(egressRange, to)
+	if err := moveEgressRange(egressRange, to); err != nil {
+		slog.Error("failed to move egress range to gateway", "range", egressRange, "gateway", to.String(), "error", err)
+		return
+	}
+	previous := ""
+	if from != nil {
+		previous = from.String()
+	}
+	slog.Info("egress range switched gateway", "range", egressRange, "gateway", to.String(), "previous", previous)
+}
+
+// moveEgressRange - has the peer of the gateway carry the traffic of the egress range, wireguard moves an
+// allowed ip added to a peer away from the peer holding it
+func moveEgressRange(egressRange string, gateway net.IP) error {
+	wgclient, err := wgctrl.New()
+	if err != nil {
+		return err
+	}
+	defer wgclient.Close()
+	device, err := wgclient.Device(ncutils.GetInterfaceName())
+	if err != nil {
+		return err
+	}
+	for _, peer := range device.Peers {
+		for _, allowed := range peer.AllowedIPs {
+			if ones, bits := allowed.Mask.Size(); ones != bits || !allowed.IP.Equal(gateway) {
+				continue
+			}
+			return wireguard.UpdatePeer(&wgtypes.PeerConfig{
+				PublicKey:  peer.PublicKey,
+				UpdateOnly: true,
+				AllowedIPs: []net.IPNet{config.ToIPNet(egressRange)},
+			})
+		}
+	}
+	return fmt.Errorf("no peer found for gateway %s", gateway)
+}
+
+// containsIP - checks if the address is in the list
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// probe - runs a single health check probe
+func probe(check config.HealthCheck) bool {
+	switch check.Protocol {
+	case config.HealthCheckTCP:
+		conn, err := net.DialTimeout("tcp", check.Target, time.Second*3)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	default:
+		pinger, err := ping.NewPinger(check.Target)
+		if err != nil {
+			slog.Error("invalid health check target", "target", check.Target, "error", err)
+			return false
+		}
+		pinger.SetPrivileged(true)
+		pinger.Count = 3
+		pinger.Timeout = time.Second * 3
+		if err := pinger.Run(); err != nil {
+			return false
+		}
+		return pinger.Statistics().PacketsRecv > 0
+	}
+}
@@ -0,0 +1,33 @@
+package functions
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+)
+
+func TestEgressGatewayFailover(t *testing.T) {
+	is := is.New(t)
+	t.Cleanup(func() {
+		egressHealth = make(map[string]*EgressHealth)
+		currentEgressRoutes = nil
+	})
+	primary, backup := net.ParseIP("100.64.0.1"), net.ParseIP("100.64.0.2")
+	currentEgressRoutes = []models.EgressNetworkRoutes{
+		{NodeAddr: net.IPNet{IP: primary, Mask: net.CIDRMask(32, 32)}, EgressRanges: []string{"10.0.0.0/24", "10.1.0.0/24"}},
+		{NodeAddr: net.IPNet{IP: backup, Mask: net.CIDRMask(32, 32)}, EgressRanges: []string{"10.0.0.0/24"}},
+	}
+	is.True(activeEgressGateway("10.0.0.0/24").Equal(primary))
+
+	egressHealth[egressHealthKey("10.0.0.0/24", primary)] = &EgressHealth{Range: "10.0.0.0/24", Gateway: primary.String(), Demoted: true}
+	is.True(activeEgressGateway("10.0.0.0/24").Equal(backup))  // failed over to the backup gateway
+	is.True(activeEgressGateway("10.1.0.0/24").Equal(primary)) // the other range of the gateway is kept
+	filtered := filterDemotedRanges(currentEgressRoutes)
+	is.Equal(filtered[0].EgressRanges, []string{"10.1.0.0/24"})
+	is.Equal(filtered[1].EgressRanges, []string{"10.0.0.0/24"})
+
+	egressHealth[egressHealthKey("10.0.0.0/24", backup)] = &EgressHealth{Range: "10.0.0.0/24", Gateway: backup.String(), Demoted: true}
+	is.Equal(activeEgressGateway("10.0.0.0/24"), nil) // no healthy gateway left
+}
@@ -0,0 +1,129 @@
+package functions
+
+import (
+	"net"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// applyEgressPolicies - marks the traffic of the egress policies of the host config and routes it via
+// their gateways. WireGuard sends a packet to the peer allowed its destination whatever the route says,
+// so the destinations are added to the allowed ips of the peer of the gateway, moving them away from the
+// gateway the server assigned; it runs after each peer update as the update restores the allowed ips
+func applyEgressPolicies() error {
+	policies := config.Netclient().EgressPolicies
+	if len(policies) == 0 {
+		if err := firewall.SetEgressMarks(nil); err != nil {
+			return err
+		}
+		return wireguard.SetEgressPolicyRoutes(nil)
+	}
+	allowed, err := interfacePeers()
+	if err != nil {
+		return err
+	}
+	marks := []firewall.EgressMark{}
+	routes := []wireguard.EgressPolicyRoute{}
+	for i, policy := range policies {
+		gateway := net.ParseIP(policy.Gateway)
+		if gateway == nil {
+			slog.Warn("egress policy has an invalid gateway", "policy", policy.Name, "gateway", policy.Gateway)
+			continue
+		}
+		gatewayPeer := peerOf(allowed, gateway)
+		if gatewayPeer == nil {
+			slog.Warn("egress policy gateway is not a peer", "policy", policy.Name, "gateway", policy.Gateway)
+			continue
+		}
+		mark := firewall.EgressMark{Mark: wireguard.EgressPolicyMark(i), Mask: wireguard.EgressPolicyMarkMask}
+		moved := []net.IPNet{}
+		for _, src := range policy.Sources {
+			_, cidr, err := net.ParseCIDR(src)
+			if err != nil {
+				slog.Warn("egress policy has an invalid source", "policy", policy.Name, "source", src)
+				continue
+			}
+			mark.Sources = append(mark.Sources, *cidr)
+		}
+		for _, dst := range policy.Destinations {
+			_, cidr, err := net.ParseCIDR(dst)
+			if err != nil || (cidr.IP.To4() == nil) != (gateway.To4() == nil) {
+				slog.Warn("egress policy has an invalid destination", "policy", policy.Name, "destination", dst)
+				continue
+			}
+			if !coversRange(gatewayPeer.AllowedIPs, *cidr) {
+				moved = append(moved, *cidr)
+			}
+			mark.Destinations = append(mark.Destinations, *cidr)
+		}
+		if len(mark.Destinations) == 0 {
+			continue
+		}
+		if len(moved) > 0 {
+			if err := wireguard.UpdatePeer(&wgtypes.PeerConfig{
+				PublicKey:  gatewayPeer.PublicKey,
+				UpdateOnly: true,
+				AllowedIPs: moved,
+			}); err != nil {
+				slog.Warn("failed to allow the egress policy destinations to the gateway", "policy", policy.Name,
+					"gateway", policy.Gateway, "error", err)
+				continue
+			}
+		}
+		marks = append(marks, mark)
+		routes = append(routes, wireguard.EgressPolicyRoute{
+			Mark:         mark.Mark,
+			Table:        policy.GetTable(i),
+			Gateway:      gateway,
+			Destinations: mark.Destinations,
+		})
+	}
+	if err := wireguard.SetEgressPolicyRoutes(routes); err != nil {
+		return err
+	}
+	return firewall.SetEgressMarks(marks)
+}
+
+// interfacePeers - the peers of the netmaker interface
+func interfacePeers() ([]wgtypes.Peer, error) {
+	wgclient, err := wgctrl.New()
+	if err != nil {
+		return nil, err
+	}
+	defer wgclient.Close()
+	device, err := wgclient.Device(ncutils.GetInterfaceName())
+	if err != nil {
+		return nil, err
+	}
+	return device.Peers, nil
+}
+
+// peerOf - the peer allowed the address, nil if none
+func peerOf(peers []wgtypes.Peer, ip net.IP) *wgtypes.Peer {
+	for i := range peers {
+		for _, r := range peers[i].AllowedIPs {
+			if ones, bits := r.Mask.Size(); ones == bits && r.IP.Equal(ip) {
+				return &peers[i]
+			}
+		}
+	}
+	return nil
+}
+
+// coversRange - checks if one of the ranges contains r
+func coversRange(ranges []net.IPNet, r net.IPNet) bool {
+	ones, _ := r.Mask.Size()
+	for _, allowed := range ranges {
+		allowedOnes, _ := allowed.Mask.Size()
+		if allowed.Contains(r.IP) && allowedOnes <= ones {
+			return true
+		}
+	}
+	return false
+}
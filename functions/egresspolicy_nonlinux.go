@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package functions
+
+import (
+	"github.com/gravitl/netclient/config"
+	"golang.org/x/exp/slog"
+)
+
+// applyEgressPolicies - policy routing of egress traffic relies on fwmarks and ip rules, only available on linux
+func applyEgressPolicies() error {
+	if len(config.Netclient().EgressPolicies) > 0 {
+		slog.Warn("egress policies are only supported on linux")
+	}
+	return nil
+}
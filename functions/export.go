@@ -0,0 +1,115 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ExportWgQuick - renders the host's configuration for a network as a standalone wg-quick config,
+// PostUp/PostDown reproduce the forwarding and egress nat rules of gateways, routes to peers and
+// egress ranges are added by wg-quick from the allowed ips
+func ExportWgQuick(network string) (string, error) {
+	node, ok := config.GetNodes()[network]
+	if !ok {
+		return "", errors.New("no such network " + network)
+	}
+	host := config.Netclient()
+	addrs := []net.IPNet{}
+	mesh := []net.IPNet{}
+	if node.Address.IP != nil {
+		addrs = append(addrs, net.IPNet{IP: node.Address.IP, Mask: node.NetworkRange.Mask})
+		mesh = append(mesh, node.NetworkRange)
+	}
+	if node.Address6.IP != nil {
+		addrs = append(addrs, net.IPNet{IP: node.Address6.IP, Mask: node.NetworkRange6.Mask})
+		mesh = append(mesh, node.NetworkRange6)
+	}
+	peers := []wgtypes.PeerConfig{}
+	for _, peer := range host.HostPeers {
+		if peer.Remove || !inNetwork(peer.AllowedIPs, mesh) {
+			continue
+		}
+		// drop addresses the peer holds in other networks
+		allowed := []net.IPNet{}
+		for _, ip := range peer.AllowedIPs {
+			if !isMeshAddr(ip, mesh) && isOtherMeshAddr(ip, network) {
+				continue
+			}
+			allowed = append(allowed, ip)
+		}
+		peer.AllowedIPs = allowed
+		peers = append(peers, peer)
+	}
+	extra := []string{}
+	if table := config.GetRouteTable(network); table != 0 {
+		extra = append(extra, "Table = "+strconv.Itoa(table))
+	}
+	if node.IsEgressGateway || node.IsIngressGateway {
+		extra = append(extra,
+			"PostUp = sysctl -w net.ipv4.ip_forward=1 net.ipv6.conf.all.forwarding=1",
+			"PostUp = iptables -I FORWARD -i %i -j ACCEPT; iptables -I FORWARD -o %i -j ACCEPT",
+			"PostDown = iptables -D FORWARD -i %i -j ACCEPT; iptables -D FORWARD -o %i -j ACCEPT",
+			"PostUp = ip6tables -I FORWARD -i %i -j ACCEPT; ip6tables -I FORWARD -o %i -j ACCEPT",
+			"PostDown = ip6tables -D FORWARD -i %i -j ACCEPT; ip6tables -D FORWARD -o %i -j ACCEPT",
+		)
+	}
+	if node.IsEgressGateway {
+		for _, egressRange := range node.EgressGatewayRanges {
+			_, cidr, err := net.ParseCIDR(egressRange)
+			if err != nil {
+				continue
+			}
+			cmd, source := "iptables", node.NetworkRange
+			if cidr.IP.To4() == nil {
+				cmd, source = "ip6tables", node.NetworkRange6
+			}
+			if source.IP == nil {
+				continue
+			}
+			rule := fmt.Sprintf("-t nat %%s POSTROUTING -s %s -d %s -j MASQUERADE", source.String(), cidr.String())
+			extra = append(extra,
+				"PostUp = "+cmd+" "+fmt.Sprintf(rule, "-A"),
+				"PostDown = "+cmd+" "+fmt.Sprintf(rule, "-D"),
+			)
+		}
+	}
+	return ncutils.WgQuickConfig(host.PrivateKey, host.ListenPort, host.MTU, addrs, peers, extra...), nil
+}
+
+// inNetwork - checks if any of the allowed ips is an address in the network ranges
+func inNetwork(allowed []net.IPNet, ranges []net.IPNet) bool {
+	for _, ip := range allowed {
+		if isMeshAddr(ip, ranges) {
+			return true
+		}
+	}
+	return false
+}
+
+func isMeshAddr(ip net.IPNet, ranges []net.IPNet) bool {
+	for _, r := range ranges {
+		if r.IP != nil && r.Contains(ip.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOtherMeshAddr - checks if the address belongs to another network of the host
+func isOtherMeshAddr(ip net.IPNet, network string) bool {
+	for _, node := range config.GetNodes() {
+		if node.Network == network {
+			continue
+		}
+		if isMeshAddr(ip, []net.IPNet{node.NetworkRange, node.NetworkRange6}) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"golang.org/x/exp/slog"
+)
+
+// exposeDialTimeout - time to connect to the local service of an exposed port
+const exposeDialTimeout = time.Second * 10
+
+// exposeSyncInterval - how often forwarders that could not be started are retried
+const exposeSyncInterval = time.Second * 30
+
+var (
+	// exposeCtx - context of the running expose subsystem, nil when not running
+	exposeCtx context.Context
+	// forwarders - cancel funcs of the running forwarders keyed by listen address
+	forwarders = make(map[string]context.CancelFunc)
+	// failedForwarders - listen addresses of the exposed services whose forwarder failed to start
+	failedForwarders = make(map[string]bool)
+	exposeMutex      sync.Mutex
+	errNotExposed    = errors.New("nothing is exposed on this address")
+)
+
+// Expose - exposes a local service on the mesh addresses through the running daemon
+func Expose(target, listen string) error {
+	_, err := callDaemon[any](http.MethodPost, "/expose", config.ExposedService{Target: target, Listen: listen})
+	return err
+}
+
+// Unexpose - stops exposing a local service through the running daemon
+func Unexpose(listen string) error {
+	_, err := callDaemon[any](http.MethodDelete, "/expose", config.ExposedService{Listen: listen})
+	return err
+}
+
+// ListExposed - returns the local services exposed by the running daemon
+func ListExposed() ([]config.ExposedService, error) {
+	return callDaemon[[]config.ExposedService](http.MethodGet, "/expose", nil)
+}
+
+// normalizeExposed - validates an exposed service, the listen address defaults to the port of the target
+func normalizeExposed(exposed config.ExposedService) (config.ExposedService, error) {
+	_, targetPort, err := net.SplitHostPort(exposed.Target)
+	if err != nil {
+		return exposed, fmt.Errorf("invalid target %s: %w", exposed.Target, err)
+	}
+	if exposed.Listen == "" {
+		exposed.Listen = ":" + targetPort
+	}
+	host, port, err := net.SplitHostPort(exposed.Listen)
+	if err != nil {
+		return exposed, fmt.Errorf("invalid listen address %s: %w", exposed.Listen, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return exposed, errors.New("invalid listen port " + port)
+	}
+	if host != "" && !isMeshAddress(net.ParseIP(host)) {
+		return exposed, errors.New(host + " is not a mesh address of this host")
+	}
+	return exposed, nil
+}
+
+// addExposed - starts the forwarder of an exposed service and adds the service to the host config,
+// a service whose forwarder fails to start is not added
+func addExposed(exposed config.ExposedService) error {
+	exposed, err := normalizeExposed(exposed)
+	if err != nil {
+		return err
+	}
+	exposeMutex.Lock()
+	defer exposeMutex.Unlock()
+	host := config.Netclient()
+	for _, e := range host.Exposed {
+		if e.Listen == exposed.Listen {
+			return errors.New(exposed.Listen + " is already exposed for " + e.Target)
+		}
+	}
+	var cancel context.CancelFunc
+	if exposeCtx != nil {
+		if cancel, err = startForwarder(exposeCtx, exposed); err != nil {
+			return err
+		}
+	}
+	host.Exposed = append(host.Exposed, exposed)
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		if cancel != nil {
+			cancel()
+		}
+		host.Exposed = host.Exposed[:len(host.Exposed)-1]
+		config.UpdateNetclient(*host)
+		return err
+	}
+	if cancel != nil {
+		forwarders[exposed.Listen] = cancel
+	}
+	slog.Info("exposing local service", "target", exposed.Target, "listen", exposed.Listen)
+	return updateExposedPorts()
+}
+
+// removeExposed - removes an exposed service from the host config and stops its forwarder
+func removeExposed(listen string) error {
+	host := config.Netclient()
+	exposed := []config.ExposedService{}
+	for _, e := range host.Exposed {
+		if e.Listen != listen {
+			exposed = append(exposed, e)
+		}
+	}
+	if len(exposed) == len(host.Exposed) {
+		return errNotExposed
+	}
+	host.Exposed = exposed
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		return err
+	}
+	slog.Info("stopped exposing local service", "listen", listen)
+	syncForwarders()
+	return updateExposedPorts()
+}
+
+// updateExposedPorts - lets the exposed ports through the rules of outbound only mode
+func updateExposedPorts() error {
+	if !config.Netclient().OutboundOnly {
+		return nil
+	}
+	return applyOutboundOnly()
+}
+
+// exposeServices - runs the forwarders of the exposed services of the host config until the context is
+// cancelled, forwarders failing to start (e.g. the mesh addresses are not up yet) are retried
+func exposeServices(ctx context.Context) error {
+	exposeMutex.Lock()
+	exposeCtx = ctx
+	exposeMutex.Unlock()
+	ticker := time.NewTicker(exposeSyncInterval)
+	defer ticker.Stop()
+	for {
+		syncForwarders()
+		select {
+		case <-ctx.Done():
+			exposeMutex.Lock()
+			for listen, cancel := range forwarders {
+				cancel()
+				delete(forwarders, listen)
+			}
+			exposeCtx = nil
+			exposeMutex.Unlock()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncForwarders - starts and stops forwarders to match the exposed services of the host config
+func syncForwarders() {
+	exposeMutex.Lock()
+	defer exposeMutex.Unlock()
+	if exposeCtx == nil {
+		return
+	}
+	wanted := make(map[string]config.ExposedService)
+	for _, exposed := range config.Netclient().Exposed {
+		wanted[exposed.Listen] = exposed
+	}
+	for listen, cancel := range forwarders {
+		if _, ok := wanted[listen]; !ok {
+			cancel()
+			delete(forwarders, listen)
+		}
+	}
+	for listen := range failedForwarders {
+		if _, ok := wanted[listen]; !ok {
+			delete(failedForwarders, listen)
+		}
+	}
+	for listen, exposed := range wanted {
+		if _, ok := forwarders[listen]; ok {
+			continue
+		}
+		cancel, err := startForwarder(exposeCtx, exposed)
+		if err != nil {
+			if !failedForwarders[listen] {
+				slog.Error("failed to start forwarder, retrying", "listen", listen, "error", err)
+			}
+			failedForwarders[listen] = true
+			continue
+		}
+		if failedForwarders[listen] {
+			slog.Info("started forwarder", "listen", listen)
+			delete(failedForwarders, listen)
+		}
+		forwarders[listen] = cancel
+	}
+}
+
+// startForwarder - listens on the mesh addresses of the exposed service and forwards connections from
+// peers to the local service
+func startForwarder(ctx context.Context, exposed config.ExposedService) (context.CancelFunc, error) {
+	host, port, err := net.SplitHostPort(exposed.Listen)
+	if err != nil {
+		return nil, err
+	}
+	addrs := []string{host}
+	if host == "" {
+		addrs = meshAddresses()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", net.JoinHostPort(addr, port))
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to expose %s on %s: %w", exposed.Target, addr, err)
+		}
+		go func() {
+			<-ctx.Done()
+			l.Close()
+		}()
+		go forwardConnections(l, exposed.Target)
+	}
+	return cancel, nil
+}
+
+// forwardConnections - accepts connections from peers on the listener and forwards them to the target
+func forwardConnections(l net.Listener, target string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		remote, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if !isPeerAddress(net.ParseIP(remote)) {
+			slog.Debug("refusing exposed service connection from non peer", "from", remote, "listen", l.Addr().String())
+			conn.Close()
+			continue
+		}
+		go forwardConnection(conn, target)
+	}
+}
+
+func forwardConnection(conn net.Conn, target string) {
+	defer conn.Close()
+	upstream, err := net.DialTimeout("tcp", target, exposeDialTimeout)
+	if err != nil {
+		slog.Debug("failed to connect to exposed service", "target", target, "error", err)
+		return
+	}
+	defer upstream.Close()
+	done := make(chan struct{})
+	go func() {
+		io.Copy(upstream, conn)
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(conn, upstream)
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+	<-done
+}
+
+// meshAddresses - the addresses of this host in its networks
+func meshAddresses() []string {
+	addrs := []string{}
+	for _, node := range config.GetNodes() {
+		for _, addr := range []net.IPNet{node.Address, node.Address6} {
+			if addr.IP != nil {
+				addrs = append(addrs, addr.IP.String())
+			}
+		}
+	}
+	return addrs
+}
+
+func isMeshAddress(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, addr := range meshAddresses() {
+		if ip.Equal(net.ParseIP(addr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPeerAddress - checks the address is the mesh address of a current peer that is not denied
+func isPeerAddress(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, peer := range config.Netclient().HostPeers {
+		if peer.Remove || config.IsDeniedPeer(peer.PublicKey.String()) {
+			continue
+		}
+		for _, allowed := range peer.AllowedIPs {
+			ones, bits := allowed.Mask.Size()
+			if ones == bits && allowed.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+)
+
+// extClientExpiryUpdate - expiry metadata servers announcing ext client expiry add to the peer update,
+// keyed by the public keys of the ext clients attached to this host
+type extClientExpiryUpdate struct {
+	ExtClientExpiry map[string]time.Time `json:"ext_client_expiry"`
+}
+
+// extClientExpiryChanged - wakes up the expiry of ext clients after new metadata from a server
+var extClientExpiryChanged = make(chan struct{}, 1)
+
+// updateExtClientExpiry - stores the ext client expiry announced in a peer update of the server,
+// updates of servers without expiry metadata leave it untouched
+func updateExtClientExpiry(server string, data []byte) {
+	var update extClientExpiryUpdate
+	if err := json.Unmarshal(data, &update); err != nil || update.ExtClientExpiry == nil {
+		return
+	}
+	host := config.Netclient()
+	if reflect.DeepEqual(host.ExtClientExpiry[server], update.ExtClientExpiry) {
+		return
+	}
+	// replace the map instead of modifying it, it is read concurrently by the expiry of ext clients
+	expiry := make(map[string]map[string]time.Time, len(host.ExtClientExpiry)+1)
+	for s, expiries := range host.ExtClientExpiry {
+		expiry[s] = expiries
+	}
+	if len(update.ExtClientExpiry) == 0 {
+		delete(expiry, server)
+	} else {
+		expiry[server] = update.ExtClientExpiry
+	}
+	host.ExtClientExpiry = expiry
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		slog.Error("failed to save ext client expiry", "server", server, "error", err)
+	}
+	select {
+	case extClientExpiryChanged <- struct{}{}:
+	default:
+	}
+}
+
+// expiredExtClients - returns the servers of the ext clients expired at t, by public key
+func expiredExtClients(t time.Time) map[string]string {
+	expired := make(map[string]string)
+	for server, expiries := range config.Netclient().ExtClientExpiry {
+		for key, expiry := range expiries {
+			if !t.Before(expiry) {
+				expired[key] = server
+			}
+		}
+	}
+	return expired
+}
+
+// nextExtClientExpiry - returns the time until the next ext client expires
+func nextExtClientExpiry() time.Duration {
+	next := time.Time{}
+	now := time.Now()
+	for _, expiries := range config.Netclient().ExtClientExpiry {
+		for _, expiry := range expiries {
+			if expiry.After(now) && (next.IsZero() || expiry.Before(next)) {
+				next = expiry
+			}
+		}
+	}
+	if next.IsZero() {
+		return accessScheduleRecheck
+	}
+	if wait := time.Until(next); wait < accessScheduleRecheck {
+		return wait
+	}
+	return accessScheduleRecheck
+}
+
+// expireExtClients - removes ext clients from the interface, blocks their addresses and removes their
+// routing rules on the gateway at their expiry, instead of waiting for the server to remove them
+func expireExtClients(ctx context.Context) error {
+	expired := make(map[string]string)
+	for {
+		current := expiredExtClients(time.Now())
+		changed := false
+		for key, server := range current {
+			if _, ok := expired[key]; ok {
+				continue
+			}
+			slog.Warn("ext client expired, removing it", "server", server, "peer", key,
+				"expiry", config.Netclient().ExtClientExpiry[server][key])
+			firewall.RemovePeerRoutes(server, key)
+			changed = true
+		}
+		for key, server := range expired {
+			if _, ok := current[key]; !ok {
+				slog.Info("ext client no longer expired", "server", server, "peer", key)
+				changed = true
+			}
+		}
+		expired = current
+		if changed {
+			if err := wireguard.SetPeers(false); err != nil {
+				slog.Error("failed to update peers for expired ext clients", "error", err)
+			}
+			if err := applyPeerBlocks(); err != nil {
+				slog.Error("failed to update firewall for expired ext clients", "error", err)
+			}
+		}
+		timer := time.NewTimer(nextExtClientExpiry())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		case <-extClientExpiryChanged:
+			timer.Stop()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package functions
+
+import (
+	"net"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"golang.org/x/exp/slog"
+)
+
+// applyExtClientNat - installs the one-to-one nat of public addresses to ext clients configured in the host
+// config when the host is an ingress gateway, invalid mappings are skipped with a warning
+func applyExtClientNat() error {
+	mappings := []firewall.StaticNat{}
+	if isIngressGatewayHost() {
+		for public, mesh := range config.Netclient().ExtClientNat {
+			m := firewall.StaticNat{Public: net.ParseIP(public), Mesh: net.ParseIP(mesh)}
+			if m.Public == nil || m.Mesh == nil || (m.Public.To4() == nil) != (m.Mesh.To4() == nil) {
+				slog.Warn("ignoring ext client nat, expected addresses of the same family", "public", public, "extclient", mesh)
+				continue
+			}
+			if !isNetworkAddress(m.Mesh) {
+				slog.Warn("ignoring ext client nat, the ext client address is not in a network of the host", "public", public, "extclient", mesh)
+				continue
+			}
+			mappings = append(mappings, m)
+		}
+	} else if len(config.Netclient().ExtClientNat) > 0 {
+		slog.Warn("ext client nat is configured but the host is not an ingress gateway")
+	}
+	if len(mappings) > 0 {
+		slog.Info("applying ext client nat", "mappings", len(mappings))
+	}
+	return firewall.SetStaticNat(mappings)
+}
+
+// isIngressGatewayHost - checks if any node of the host is an ingress gateway
+func isIngressGatewayHost() bool {
+	for _, node := range config.GetNodes() {
+		if node.IsIngressGateway {
+			return true
+		}
+	}
+	return false
+}
+
+// isNetworkAddress - checks if ip belongs to the network range of any node of the host
+func isNetworkAddress(ip net.IP) bool {
+	for _, node := range config.GetNodes() {
+		if node.NetworkRange.Contains(ip) || node.NetworkRange6.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package functions
+
+import (
+	"os"
+	"runtime"
+	"sort"
+
+	"github.com/gravitl/netclient/config"
+)
+
+// FactsVersion - version of the facts schema, incremented on incompatible changes
+const FactsVersion = 1
+
+// Facts - structured description of this host for configuration management tools
+// (ansible facts, puppet facter, chef ohai)
+type Facts struct {
+	Version      int               `json:"facts_version"`
+	Host         FactsHost         `json:"host"`
+	Versions     FactsVersions     `json:"versions"`
+	Networks     []FactsNetwork    `json:"networks"`
+	Capabilities FactsCapabilities `json:"capabilities"`
+}
+
+// FactsHost - identity of the host
+type FactsHost struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Hostname   string `json:"hostname"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	PublicKey  string `json:"public_key"`
+	Interface  string `json:"interface"`
+	ListenPort int    `json:"listen_port"`
+	Endpoint   string `json:"endpoint,omitempty"`
+	Static     bool   `json:"static"`
+	NatType    string `json:"nat_type,omitempty"`
+	Server     string `json:"server"`
+}
+
+// FactsVersions - versions of netclient and of the servers it is registered with
+type FactsVersions struct {
+	Netclient string            `json:"netclient"`
+	Go        string            `json:"go"`
+	Servers   map[string]string `json:"servers"`
+}
+
+// FactsNetwork - a network of the host with its addresses and roles
+type FactsNetwork struct {
+	Network         string   `json:"network"`
+	Server          string   `json:"server"`
+	NodeID          string   `json:"node_id"`
+	Connected       bool     `json:"connected"`
+	Address         string   `json:"address,omitempty"`
+	Address6        string   `json:"address6,omitempty"`
+	Range           string   `json:"range,omitempty"`
+	Range6          string   `json:"range6,omitempty"`
+	EgressGateway   bool     `json:"egress_gateway"`
+	EgressRanges    []string `json:"egress_ranges,omitempty"`
+	IngressGateway  bool     `json:"ingress_gateway"`
+	InternetGateway bool     `json:"internet_gateway"`
+	Relay           bool     `json:"relay"`
+	Relayed         bool     `json:"relayed"`
+	RouteTable      int      `json:"route_table,omitempty"`
+}
+
+// FactsCapabilities - features of the platform netclient runs on
+type FactsCapabilities struct {
+	// WireGuard implementation in use: kernel, userspace or unavailable
+	WireGuard    string `json:"wireguard"`
+	Firewall     string `json:"firewall"`
+	IPForwarding bool   `json:"ip_forwarding"`
+	IPv6         bool   `json:"ipv6"`
+	InitSystem   string `json:"init_system"`
+	Crypto       string `json:"crypto"`
+	Docker       bool   `json:"docker"`
+	Kubernetes   bool   `json:"kubernetes"`
+}
+
+// GetFacts - gathers the facts of this host from its configuration
+func GetFacts() Facts {
+	host := config.Netclient()
+	hostname, _ := os.Hostname()
+	facts := Facts{
+		Version: FactsVersion,
+		Host: FactsHost{
+			ID:         host.ID.String(),
+			Name:       host.Name,
+			Hostname:   hostname,
+			OS:         runtime.GOOS,
+			Arch:       runtime.GOARCH,
+			PublicKey:  host.PublicKey.String(),
+			Interface:  host.Interface,
+			ListenPort: host.ListenPort,
+			Static:     host.IsStatic,
+			NatType:    host.NatType,
+			Server:     config.CurrServer,
+		},
+		Versions: FactsVersions{
+			Netclient: config.Version,
+			Go:        runtime.Version(),
+			Servers:   make(map[string]string),
+		},
+		Networks: []FactsNetwork{},
+		Capabilities: FactsCapabilities{
+			WireGuard:    wireGuardImplementation(),
+			Firewall:     host.FirewallInUse,
+			IPForwarding: host.IPForwarding,
+			InitSystem:   host.InitType.String(),
+			Crypto:       config.CryptoMode(),
+			Docker:       host.IsDocker,
+			Kubernetes:   host.IsK8S,
+		},
+	}
+	if host.EndpointIP != nil {
+		facts.Host.Endpoint = host.EndpointIP.String()
+	}
+	for name, server := range config.Servers {
+		facts.Versions.Servers[name] = server.Version
+	}
+	for _, node := range config.GetNodes() {
+		network := FactsNetwork{
+			Network:         node.Network,
+			Server:          node.Server,
+			NodeID:          node.ID.String(),
+			Connected:       node.Connected,
+			EgressGateway:   node.IsEgressGateway,
+			EgressRanges:    node.EgressGatewayRanges,
+			IngressGateway:  node.IsIngressGateway,
+			InternetGateway: node.IsInternetGateway,
+			Relay:           node.IsRelay,
+			Relayed:         node.IsRelayed,
+			RouteTable:      config.GetRouteTable(node.Network),
+		}
+		if node.Address.IP != nil {
+			network.Address = node.Address.String()
+		}
+		if node.Address6.IP != nil {
+			network.Address6 = node.Address6.String()
+			facts.Capabilities.IPv6 = true
+		}
+		if node.NetworkRange.IP != nil {
+			network.Range = node.NetworkRange.String()
+		}
+		if node.NetworkRange6.IP != nil {
+			network.Range6 = node.NetworkRange6.String()
+		}
+		facts.Networks = append(facts.Networks, network)
+	}
+	sort.Slice(facts.Networks, func(i, j int) bool {
+		return facts.Networks[i].Network < facts.Networks[j].Network
+	})
+	return facts
+}
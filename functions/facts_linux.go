@@ -0,0 +1,16 @@
+package functions
+
+import "github.com/gravitl/netclient/wireguard"
+
+// wireGuardImplementation - the wireguard implementation available to the interface
+func wireGuardImplementation() string {
+	kernel, tun := wireguard.KernelSupport()
+	switch {
+	case kernel:
+		return "kernel"
+	case tun:
+		return "userspace"
+	default:
+		return "unavailable"
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package functions
+
+import "runtime"
+
+// wireGuardImplementation - the wireguard implementation of the platform, wireguard-nt on windows and
+// the kernel module on freebsd, wireguard-go elsewhere
+func wireGuardImplementation() string {
+	switch runtime.GOOS {
+	case "windows", "freebsd":
+		return "kernel"
+	default:
+		return "userspace"
+	}
+}
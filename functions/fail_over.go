@@ -26,6 +26,8 @@ var (
 	// LastHandShakeThreshold - threshold for considering inactive connection
 	LastHandShakeThreshold = time.Minute * 3
 	peerConnTicker         *time.Ticker
+	// relayRequested - public keys of the peers pinned to a relay the server was asked to fail over
+	relayRequested sync.Map
 )
 
 // processPeerSignal - processes the peer signals for any updates from peers
@@ -69,6 +71,10 @@ func handlePeerFailOver(signal models.Signal) error {
 		}
 	}
 
+	if path := config.GetPeerPath(signal.FromHostPubKey); path == config.PeerPathDirect || path == config.PeerPathLAN {
+		slog.Debug("peer path pinned, not failing over", "peer", signal.FromHostPubKey, "path", path)
+		return nil
+	}
 	if config.Netclient().NatType == models.NAT_Types.BehindNAT {
 		err := failOverMe(signal.Server, signal.ToNodeID, signal.FromNodeID)
 		if err != nil {
@@ -108,6 +114,13 @@ func watchPeerConnections(ctx context.Context, waitg *sync.WaitGroup) {
 						if peer.IsExtClient {
 							continue
 						}
+						switch config.GetPeerPath(pubKey) {
+						case config.PeerPathDirect, config.PeerPathLAN:
+							continue
+						case config.PeerPathRelay:
+							requestRelay(node, peer.ID, pubKey)
+							continue
+						}
 						connected, _ := metrics.PeerConnStatus(peer.Address, peer.ListenPort, 2)
 						if connected {
 							// peer is connected,so continue
@@ -144,6 +157,19 @@ func watchPeerConnections(ctx context.Context, waitg *sync.WaitGroup) {
 	}
 }
 
+// requestRelay - asks the server once to reach a peer pinned to a relay through the failover node
+func requestRelay(node config.Node, peerNodeID, peerPubKey string) {
+	if _, ok := relayRequested.Load(peerPubKey); ok {
+		return
+	}
+	if err := failOverMe(node.Server, node.ID.String(), peerNodeID); err != nil {
+		slog.Warn("failed to relay peer pinned to a relay", "peer", peerPubKey, "error", err)
+		return
+	}
+	slog.Info("relaying peer pinned to a relay", "peer", peerPubKey)
+	relayRequested.Store(peerPubKey, struct{}{})
+}
+
 func isPeerExist(peerKey string) bool {
 	_, err := wireguard.GetPeer(ncutils.GetInterfaceName(), peerKey)
 	return err == nil
@@ -0,0 +1,69 @@
+package functions
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/exp/slog"
+)
+
+// fastPathInterval - time between checks of the devices of the fast path
+const fastPathInterval = time.Minute
+
+// runFastPath - keeps the fast path over the netmaker interface and the other interfaces of the host
+// while it is a gateway, when it fails to load the traffic keeps the regular path and the load is retried
+func runFastPath(ctx context.Context) error {
+	defer firewall.SetFastPath(nil)
+	ticker := time.NewTicker(fastPathInterval)
+	defer ticker.Stop()
+	failed := false
+	for {
+		if err := firewall.SetFastPath(fastPathDevices()); err != nil {
+			if !failed {
+				slog.Warn("fast path unavailable, forwarded traffic keeps the regular firewall path", "error", err)
+			}
+			failed = true
+		} else if failed {
+			slog.Info("fast path loaded")
+			failed = false
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// fastPathDevices - the netmaker interface and the interfaces that are up, none unless a node of the
+// host forwards traffic as a gateway or relay
+func fastPathDevices() []string {
+	gateway := false
+	for _, node := range config.GetNodes() {
+		if node.IsEgressGateway || node.IsIngressGateway || node.IsRelay || node.IsInternetGateway {
+			gateway = true
+			break
+		}
+	}
+	if !gateway {
+		return nil
+	}
+	ifaceName := ncutils.GetInterfaceName()
+	devices := []string{ifaceName}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		slog.Error("failed to list interfaces", "error", err)
+		return nil
+	}
+	for _, iface := range ifaces {
+		if iface.Name == ifaceName || iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		devices = append(devices, iface.Name)
+	}
+	return devices
+}
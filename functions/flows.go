@@ -0,0 +1,48 @@
+package functions
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/metrics"
+	"golang.org/x/exp/slog"
+)
+
+// FlowInterval - interval at which tracked connections are summarized per peer
+const FlowInterval = time.Second * 30
+
+// accountFlows - on gateway nodes, periodically summarizes the traffic of tracked connections per peer
+func accountFlows(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if err := metrics.EnableFlowAccounting(); err != nil {
+		slog.Warn("failed to enable conntrack accounting, flows are counted without bytes", "error", err)
+	}
+	ticker := time.NewTicker(FlowInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("flow accounting routine closed")
+			return
+		case <-ticker.C:
+			if !isGateway() {
+				continue
+			}
+			if _, err := metrics.AccountFlows(config.Netclient().HostPeers); err != nil {
+				slog.Debug("failed to account flows", "error", err)
+			}
+		}
+	}
+}
+
+// isGateway - checks if any node of the host is an ingress or egress gateway
+func isGateway() bool {
+	for _, node := range config.GetNodes() {
+		if node.IsIngressGateway || node.IsEgressGateway {
+			return true
+		}
+	}
+	return false
+}
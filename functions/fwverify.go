@@ -0,0 +1,50 @@
+package functions
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"golang.org/x/exp/slog"
+)
+
+// verifyFirewall - periodically checks that other tools (docker, kube-proxy, fail2ban) did not remove
+// or bypass the netmaker firewall rules, problems are logged when they first appear
+func verifyFirewall(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(config.GetFirewallCheckInterval())
+	defer ticker.Stop()
+	lastIssues := ""
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("firewall verification routine closed")
+			return
+		case <-ticker.C:
+			issues, err := firewall.VerifyChains()
+			if err != nil {
+				slog.Error("failed to verify firewall chains", "error", err)
+			}
+			if current := strings.Join(issues, "\n"); current != lastIssues {
+				for _, issue := range issues {
+					slog.Warn("firewall chains modified by another tool", "issue", issue)
+				}
+				lastIssues = current
+			}
+		}
+	}
+}
+
+// FirewallPreview - the firewall rules the running daemon would have installed, in dry run mode
+func FirewallPreview() ([]firewall.PreviewRule, error) {
+	return callDaemon[[]firewall.PreviewRule](http.MethodGet, "/firewall/preview", nil)
+}
+
+// FirewallRules - the rules of the rule tables maintained by the running daemon
+func FirewallRules() ([]firewall.ManagedRule, error) {
+	return callDaemon[[]firewall.ManagedRule](http.MethodGet, "/firewall/rules", nil)
+}
@@ -3,10 +3,13 @@ package functions
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +18,8 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netclient/daemon"
+	"github.com/gravitl/netclient/firewall"
+	"github.com/gravitl/netclient/metrics"
 	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
@@ -46,6 +51,11 @@ func HttpServer(ctx context.Context, wg *sync.WaitGroup) {
 	}
 	config.SetGUI(DefaultHttpServerAddr, port)
 	config.WriteGUIConfig()
+	if err := config.GenerateAPITokens(); err != nil {
+		logger.Log(0, "failed to generate api tokens", err.Error())
+		logger.Log(0, "unable to start http server", "exiting")
+		return
+	}
 
 	router := SetupRouter()
 	svr := &http.Server{
@@ -69,21 +79,106 @@ func HttpServer(ctx context.Context, wg *sync.WaitGroup) {
 func SetupRouter() *gin.Engine {
 	router := gin.Default()
 	router.GET("/status", status)
-	router.POST("/register", register)
-	router.GET("/network/:net", getNetwork)
-	router.GET("/allnetworks", getAllNetworks)
-	router.GET("/netclient", getNetclient)
-	router.POST("/connect/:net", connect)
-	router.POST("/leave/:net", leave)
-	router.GET("/servers", servers)
-	router.POST("/uninstall", uninstall)
-	router.GET("/pull/:net", pull)
-	router.POST("nodepeers", nodePeers)
-	router.POST("/join", join)
-	router.POST("/sso", sso)
+	router.GET("/network/:net", authorize(config.CommandStatus), getNetwork)
+	router.GET("/allnetworks", authorize(config.CommandStatus), getAllNetworks)
+	router.GET("/netclient", authorize(config.CommandStatus), getNetclient)
+	router.GET("/servers", authorize(config.CommandStatus), servers)
+	router.GET("/servers/status", authorize(config.CommandStatus), serverGroupStatus)
+	router.GET("/supervisor", authorize(config.CommandStatus), supervisorStatus)
+	router.POST("/register", authorize(config.CommandNetwork), register)
+	router.POST("/connect/:net", authorizeNetwork(), connect)
+	router.POST("/leave/:net", authorize(config.CommandNetwork), leave)
+	router.GET("/pull/:net", authorize(config.CommandNetwork), pull)
+	router.POST("/repair/:net", authorize(config.CommandNetwork), repair)
+	router.POST("/warm", authorize(config.CommandNetwork), warm)
+	router.POST("nodepeers", authorize(config.CommandNetwork), nodePeers)
+	router.POST("/join", authorize(config.CommandNetwork), join)
+	router.POST("/sso", authorize(config.CommandNetwork), sso)
+	router.POST("/uninstall", authorize(config.CommandAdmin), uninstall)
+	router.GET("/approvals", authorize(config.CommandStatus), approvals)
+	router.GET("/egresshealth", authorize(config.CommandStatus), egressHealthStatus)
+	router.GET("/firewall/preview", authorize(config.CommandStatus), firewallPreview)
+	router.GET("/firewall/rules", authorize(config.CommandStatus), firewallRules)
+	router.GET("/flows", authorize(config.CommandStatus), flowStatus)
+	router.GET("/services", authorize(config.CommandStatus), services)
+	router.POST("/approve/:id", authorize(config.CommandAdmin), approve)
+	router.POST("/lockdown", authorize(config.CommandAdmin), lockdown)
+	router.POST("/firewall/droplog", authorize(config.CommandFirewall), dropLog)
+	router.POST("/peers/block", authorize(config.CommandFirewall), blockPeer)
+	router.GET("/expose", authorize(config.CommandStatus), exposed)
+	router.POST("/expose", authorize(config.CommandFirewall), expose)
+	router.DELETE("/expose", authorize(config.CommandFirewall), unexpose)
+	router.POST("/peers/unblock", authorize(config.CommandFirewall), unblockPeer)
+	router.POST("/peers/schedule", authorize(config.CommandFirewall), scheduleAccess)
+	router.POST("/peers/path", authorize(config.CommandNetwork), pinPeerPath)
+	router.DELETE("/peers/schedule", authorize(config.CommandFirewall), unscheduleAccess)
+	router.POST("/apply", authorize(config.CommandAdmin), applyState)
 	return router
 }
 
+// overlayUserKey - context key of the os user whose config overlay authorized the request
+const overlayUserKey = "overlayuser"
+
+// peerUID - the uid of the os user owning the socket the request was sent from
+func peerUID(c *gin.Context) (int, error) {
+	server, ok := c.Request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return -1, errors.New("local address of the request is unknown")
+	}
+	return ncutils.GetTCPPeerUID(c.Request.RemoteAddr, server.String())
+}
+
+// authorize - middleware allowing a request if its bearer token grants the role required by the
+// command class, or if the local policy grants the class to the os user owning the calling socket
+func authorize(class config.CommandClass) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if config.GetAPIRole(token) >= class.RequiredRole() {
+			c.Next()
+			return
+		}
+		if uid, err := peerUID(c); err == nil {
+			allowed, err := config.IsAllowedByPolicy(strconv.Itoa(uid), class)
+			if err != nil {
+				logger.Log(1, "failed to evaluate local policy", err.Error())
+			}
+			if allowed {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "not authorized for " + string(class) + " commands"})
+	}
+}
+
+// authorizeNetwork - like authorize for network commands, additionally allowing os users to control
+// the networks the local policy assigns to their config overlay
+func authorizeNetwork() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if config.GetAPIRole(token) >= config.CommandNetwork.RequiredRole() {
+			c.Next()
+			return
+		}
+		if uid, err := peerUID(c); err == nil {
+			if allowed, _ := config.IsAllowedByPolicy(strconv.Itoa(uid), config.CommandNetwork); allowed {
+				c.Next()
+				return
+			}
+			username, allowed, err := config.IsNetworkAllowedByPolicy(strconv.Itoa(uid), c.Params.ByName("net"))
+			if err != nil {
+				logger.Log(1, "failed to evaluate local policy", err.Error())
+			}
+			if allowed {
+				c.Set(overlayUserKey, username)
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "not authorized for network " + c.Params.ByName("net")})
+	}
+}
+
 func status(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
@@ -166,6 +261,12 @@ func connect(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "unable to read request"})
 		return
 	}
+	if username := c.GetString(overlayUserKey); username != "" {
+		if err := updateUserOverlay(username, net, connect.Connect); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	if connect.Connect {
 		if err := Connect(net); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
@@ -205,6 +306,14 @@ func servers(c *gin.Context) {
 	c.JSON(http.StatusOK, servers)
 }
 
+func serverGroupStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, GetServerGroups())
+}
+
+func supervisorStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, GetSupervisedGroups())
+}
+
 func uninstall(c *gin.Context) {
 	errs, err := Uninstall()
 	if err == nil {
@@ -218,8 +327,249 @@ func uninstall(c *gin.Context) {
 	c.JSON(http.StatusInternalServerError, gin.H{"error": builder.String()})
 }
 
+// updateUserOverlay - records a network change made by an os user in the user's config overlay
+func updateUserOverlay(username, network string, connected bool) error {
+	overlay, err := config.ReadUserOverlay(username)
+	if err != nil {
+		return err
+	}
+	overlay.Networks[network] = connected
+	if err := config.WriteUserOverlay(username, overlay); err != nil {
+		return err
+	}
+	if config.Netclient().UserNetworks == nil {
+		config.Netclient().UserNetworks = make(map[string]bool)
+	}
+	config.Netclient().UserNetworks[network] = connected
+	return nil
+}
+
+// applyUserNetwork - keeps the connection state an os user chose for the node's network through the
+// user's config overlay over the one in the machine config or sent by the server
+func applyUserNetwork(node *config.Node) {
+	if connected, ok := config.Netclient().UserNetworks[node.Network]; ok {
+		node.Connected = connected
+	}
+}
+
+func approvals(c *gin.Context) {
+	c.JSON(http.StatusOK, GetPendingChanges())
+}
+
+func egressHealthStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, GetEgressHealth())
+}
+
+func firewallPreview(c *gin.Context) {
+	rules, err := firewall.Preview()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// firewallRules - the managed firewall rules, optionally filtered by the server, network, ruletable
+// and peer query parameters
+func firewallRules(c *gin.Context) {
+	filter := firewall.RuleFilter{}
+	for _, field := range firewall.RuleFilterFields {
+		if value, ok := c.GetQuery(field); ok {
+			filter[field] = value
+		}
+	}
+	rules, err := firewall.ListRules(filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func flowStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, metrics.TopTalkers())
+}
+
+func services(c *gin.Context) {
+	c.JSON(http.StatusOK, GetServices())
+}
+
+func approve(c *gin.Context) {
+	if err := ApproveChange(c.Params.ByName("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+func lockdown(c *gin.Context) {
+	var req lockdownRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := setLockdown(req.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+func dropLog(c *gin.Context) {
+	var req dropLogRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := setDropLogging(req.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+func blockPeer(c *gin.Context) {
+	setPeerBlockedHandler(c, true)
+}
+
+func unblockPeer(c *gin.Context) {
+	setPeerBlockedHandler(c, false)
+}
+
+func setPeerBlockedHandler(c *gin.Context, blocked bool) {
+	var req peerBlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := setPeerBlocked(req.PublicKey, blocked); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+func pinPeerPath(c *gin.Context) {
+	var req peerPathRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := setPeerPath(req.PublicKey, req.Path); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+func scheduleAccess(c *gin.Context) {
+	var schedule config.AccessSchedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := addAccessSchedule(schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+func unscheduleAccess(c *gin.Context) {
+	var req peerBlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := removeAccessSchedules(req.PublicKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+func applyState(c *gin.Context) {
+	var req applyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	changes, err := applyDesiredState(req.State, req.DryRun)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, changes)
+}
+
+func repair(c *gin.Context) {
+	var req repairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	discrepancies, err := repairNetwork(c.Params.ByName("net"), req.DryRun)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, discrepancies)
+}
+
+func warm(c *gin.Context) {
+	var req warmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	warmed, err := warmPeers(req.Target, time.Duration(req.Timeout)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, warmed)
+}
+
+func exposed(c *gin.Context) {
+	c.JSON(http.StatusOK, config.Netclient().Exposed)
+}
+
+func expose(c *gin.Context) {
+	var req config.ExposedService
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := addExposed(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+func unexpose(c *gin.Context) {
+	var req config.ExposedService
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := removeExposed(req.Listen); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errNotExposed) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
 func pull(c *gin.Context) {
 	net := c.Params.ByName("net")
+	if !isDaemonReady() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "daemon is starting"})
+		return
+	}
 	_, _, _, err := Pull(true)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
@@ -0,0 +1,57 @@
+package functions
+
+import (
+	"net"
+	"sort"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"golang.org/x/exp/slog"
+)
+
+// applyInterNetworkRouting - installs the forward rules routing traffic between the joined networks
+// when enabled in the host config: the allowed pairs are accepted, the other pairs of networks are dropped.
+// It runs after each peer update as the server may change the ranges of the networks
+func applyInterNetworkRouting() error {
+	routing := config.Netclient().InterNetwork
+	if !routing.Enabled {
+		return firewall.SetInterNetworkRules(nil)
+	}
+	nodes := config.GetNodes()
+	networks := []string{}
+	for network := range nodes {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	for _, pair := range routing.Allow {
+		for _, network := range []string{pair.From, pair.To} {
+			if _, ok := nodes[network]; !ok {
+				slog.Warn("inter-network routing allows a network the host is not joined to", "network", network)
+			}
+		}
+	}
+	rules := []firewall.InterNetworkRule{}
+	for _, from := range networks {
+		for _, to := range networks {
+			if from == to {
+				continue
+			}
+			allow := routing.Allowed(from, to)
+			for _, ranges := range [][2]net.IPNet{
+				{nodes[from].NetworkRange, nodes[to].NetworkRange},
+				{nodes[from].NetworkRange6, nodes[to].NetworkRange6},
+			} {
+				if ranges[0].IP == nil || ranges[1].IP == nil {
+					continue
+				}
+				rules = append(rules, firewall.InterNetworkRule{Src: ranges[0], Dst: ranges[1], Allow: allow})
+			}
+			if allow && !nodes[from].IsEgressGateway {
+				// the peers of a network only send traffic for the ranges the server advertises to them
+				slog.Warn("peers reach the other network only if the host is an egress gateway for its range",
+					"from", from, "to", to)
+			}
+		}
+	}
+	return firewall.SetInterNetworkRules(rules)
+}
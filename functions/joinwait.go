@@ -0,0 +1,93 @@
+package functions
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+)
+
+// joinPollInterval - interval the node configuration and interface are checked while waiting
+const joinPollInterval = time.Second
+
+// IsJoined - checks if this host has a node in the network
+func IsJoined(network string) bool {
+	_, ok := config.GetNodes()[network]
+	return ok
+}
+
+// WaitForJoin - waits until the daemon added the node of the network, or of any network not in known
+// if network is empty, and its addresses are configured on the interface, returns the network joined
+func WaitForJoin(ctx context.Context, network string, known config.NodeMap) (string, error) {
+	ticker := time.NewTicker(joinPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := config.ReadNodeConfig(); err == nil {
+			for name, node := range config.GetNodes() {
+				if network != "" && name != network {
+					continue
+				}
+				if _, ok := known[name]; ok && network == "" {
+					continue
+				}
+				if nodeAddressesConfigured(node) {
+					return name, nil
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForLeave - waits until the addresses of a node which left its network are removed from the interface
+func WaitForLeave(ctx context.Context, node config.Node) error {
+	ticker := time.NewTicker(joinPollInterval)
+	defer ticker.Stop()
+	for {
+		addrs := interfaceAddresses()
+		if (node.Address.IP == nil || !addrs[node.Address.IP.String()]) &&
+			(node.Address6.IP == nil || !addrs[node.Address6.IP.String()]) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// nodeAddressesConfigured - checks the addresses of the node are on the netmaker interface
+func nodeAddressesConfigured(node config.Node) bool {
+	if node.Address.IP == nil && node.Address6.IP == nil {
+		return false
+	}
+	addrs := interfaceAddresses()
+	return (node.Address.IP == nil || addrs[node.Address.IP.String()]) &&
+		(node.Address6.IP == nil || addrs[node.Address6.IP.String()])
+}
+
+// interfaceAddresses - returns the addresses of the netmaker interface, none if it does not exist
+func interfaceAddresses() map[string]bool {
+	addrs := make(map[string]bool)
+	iface, err := net.InterfaceByName(ncutils.GetInterfaceName())
+	if err != nil {
+		return addrs
+	}
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return addrs
+	}
+	for _, addr := range ifaceAddrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			addrs[ipnet.IP.String()] = true
+		}
+	}
+	return addrs
+}
@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/devilcove/httpclient"
 	"github.com/gravitl/netclient/auth"
 	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
+	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
@@ -28,14 +31,23 @@ type peerOut struct {
 	PublicKey  string   `json:"public_key"`
 	Endpoint   string   `json:"endpoint"`
 	AllowedIps []string `json:"allowed_ips"`
+	// LastHandshake - last handshake seen on the local interface, absolute and relative
+	LastHandshake string `json:"last_handshake,omitempty"`
+	// Path - path pinned locally with `netclient peer pin`, empty when selected automatically
+	Path string `json:"path,omitempty"`
 }
 
 // List - list network details for specified networks
 // long flag passed passed to cmd line will list additional details about network including peers
-func List(net string, long bool) {
+// timestamps are rendered in the local timezone unless utc is set
+func List(net string, long, utc bool) {
 	listOutput := []output{}
 	found := false
 	nodes := config.GetNodes()
+	handshakes := map[string]time.Time{}
+	if long {
+		handshakes = lastHandshakes()
+	}
 	for _, node := range nodes {
 		if node.Network != net && net != "" {
 			continue
@@ -65,6 +77,12 @@ func List(net string, long bool) {
 				if peer.Endpoint != nil {
 					p.Endpoint = peer.Endpoint.String()
 				}
+				if path := config.GetPeerPath(p.PublicKey); path != config.PeerPathAuto {
+					p.Path = path
+				}
+				if handshake, ok := handshakes[p.PublicKey]; ok {
+					p.LastHandshake = ncutils.FormatTime(handshake, utc)
+				}
 
 				for _, cidr := range peer.AllowedIPs {
 					p.AllowedIps = append(p.AllowedIps, cidr.String())
@@ -75,6 +93,11 @@ func List(net string, long bool) {
 		listOutput = append(listOutput, output)
 	}
 	if !found {
+		if removed, ok := config.GetRemovedNetwork(net); ok {
+			fmt.Printf("\nnetwork %s was removed by server %s on %s: %s\n", net, removed.Server,
+				ncutils.FormatTime(removed.Time, utc), removed.Reason)
+			return
+		}
 		fmt.Println("\nno such network")
 	} else {
 		out, err := json.MarshalIndent(listOutput, "", " ")
@@ -85,6 +108,24 @@ func List(net string, long bool) {
 	}
 }
 
+// lastHandshakes - last handshake times of the peers on the netmaker interface, by public key
+func lastHandshakes() map[string]time.Time {
+	handshakes := map[string]time.Time{}
+	wgclient, err := wgctrl.New()
+	if err != nil {
+		return handshakes
+	}
+	defer wgclient.Close()
+	device, err := wgclient.Device(ncutils.GetInterfaceName())
+	if err != nil {
+		return handshakes
+	}
+	for _, peer := range device.Peers {
+		handshakes[peer.PublicKey.String()] = peer.LastHandshakeTime
+	}
+	return handshakes
+}
+
 // GetNodePeers returns the peers for a given node
 func GetNodePeers(node config.Node) ([]wgtypes.PeerConfig, error) {
 
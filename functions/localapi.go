@@ -0,0 +1,60 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/devilcove/httpclient"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+)
+
+// localAPIError - error returned by the local http server
+type localAPIError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// callDaemon - sends a request to the http server of the running daemon and decodes the json response
+func callDaemon[T any](method, route string, data any) (T, error) {
+	var response T
+	address, port := DefaultHttpServerAddr, DefaultHttpServerPort
+	if !ncutils.IsWindows() {
+		gui, err := config.ReadGUIConfig()
+		if err != nil {
+			return response, fmt.Errorf("unable to locate daemon http server, is the daemon running? %w", err)
+		}
+		address, port = gui.Address, gui.Port
+	}
+	// the token file is readable by root only, the daemon authorizes other users by the local policy
+	authorization := ""
+	if token, err := config.ReadAPIToken(); err == nil {
+		authorization = "Bearer " + token
+	}
+	response, errResponse, err := httpclient.GetJSON(data, response, localAPIError{}, method,
+		"http://"+address+":"+port+route, authorization, nil)
+	if err != nil {
+		if errors.Is(err, httpclient.ErrStatus) {
+			return response, fmt.Errorf("daemon returned error: %s%s", errResponse.Error, errResponse.Message)
+		}
+		return response, err
+	}
+	return response, nil
+}
+
+// ListPendingChanges - returns the changes waiting for approval in the running daemon
+func ListPendingChanges() ([]PendingChange, error) {
+	return callDaemon[[]PendingChange](http.MethodGet, "/approvals", nil)
+}
+
+// SupervisorStatus - returns the state of the supervised goroutine groups of the running daemon
+func SupervisorStatus() ([]GroupStatus, error) {
+	return callDaemon[[]GroupStatus](http.MethodGet, "/supervisor", nil)
+}
+
+// Approve - approves a pending change in the running daemon
+func Approve(id string) error {
+	_, err := callDaemon[any](http.MethodPost, "/approve/"+id, nil)
+	return err
+}
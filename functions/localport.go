@@ -27,12 +27,30 @@ func GetLocalListenPort(ifacename string) (int, error) {
 	return device.ListenPort, nil
 }
 
+// isOwnListenPort - checks if the port is in use by the netmaker interface itself
+func isOwnListenPort(port int) bool {
+	client, err := wgctrl.New()
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+	device, err := client.Device(ncutils.GetInterfaceName())
+	if err != nil {
+		return false
+	}
+	return port != 0 && device.ListenPort == port
+}
+
 func getInterfaces() (*[]models.Iface, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil, err
 	}
 	var data = []models.Iface{}
+	if ncutils.IsWSLNAT() {
+		// addresses behind the windows host nat are not reachable by peers
+		return &data, nil
+	}
 	var link models.Iface
 	for _, iface := range ifaces {
 		iface := iface
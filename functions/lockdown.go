@@ -0,0 +1,44 @@
+package functions
+
+import (
+	"net/http"
+
+	"github.com/gravitl/netclient/config"
+	"golang.org/x/exp/slog"
+)
+
+// lockdownRequest - request to switch lockdown mode through the local api
+type lockdownRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SetLockdown - has the running daemon switch lockdown mode, in which it refuses remote configuration
+// changes from the servers except peer updates
+func SetLockdown(enabled bool) error {
+	_, err := callDaemon[any](http.MethodPost, "/lockdown", lockdownRequest{Enabled: enabled})
+	return err
+}
+
+// setLockdown - switches lockdown mode and persists it
+func setLockdown(enabled bool) error {
+	host := config.Netclient()
+	if host.Lockdown == enabled {
+		return nil
+	}
+	host.Lockdown = enabled
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		return err
+	}
+	slog.Warn("lockdown mode changed locally", "enabled", enabled)
+	return nil
+}
+
+// refusedInLockdown - checks if a remote change must be refused as lockdown mode is enabled, logs it if so
+func refusedInLockdown(server, description string) bool {
+	if !config.Netclient().Lockdown {
+		return false
+	}
+	slog.Warn("lockdown mode, refusing remote change", "server", server, "change", description)
+	return true
+}
@@ -0,0 +1,175 @@
+package functions
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	// minimalRoutesInterval - time between samples of the traffic of the peers in minimal routes mode
+	minimalRoutesInterval = time.Second * 10
+	// minimalRoutesActivity - bytes a peer has to exchange between two samples to be learned, above
+	// the few keepalives and handshakes of an idle peer
+	minimalRoutesActivity = 1024
+)
+
+// routedPeer - a peer with host routes in minimal routes mode
+type routedPeer struct {
+	addrs    []net.IP
+	bytes    int64
+	lastSeen time.Time
+}
+
+// learnMinimalRoutes - installs host routes to the peers which exchange traffic with the host, the
+// pinned peers and the egress gateways, and removes the routes of the peers idle for longer than the
+// idle timeout. Traffic to the peers not learned yet takes the low priority routes to the network
+// ranges, so a peer is learned on demand by the first traffic to or from it. The learned routes are
+// removed once the daemon stops or resets, which is when the mode is turned off
+func learnMinimalRoutes(ctx context.Context) error {
+	slog.Info("minimal routes mode, routing the peers communicated with only")
+	peers := make(map[string]*routedPeer)
+	ticker := time.NewTicker(minimalRoutesInterval)
+	defer ticker.Stop()
+	for {
+		if err := sampleMinimalRoutes(peers, time.Now()); err != nil {
+			slog.Debug("failed to sample peers for minimal routes", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			for key, p := range peers {
+				removeHostRoutes(p.addrs)
+				delete(peers, key)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sampleMinimalRoutes - updates the activity of the peers and their host routes
+func sampleMinimalRoutes(peers map[string]*routedPeer, now time.Time) error {
+	wgclient, err := wgctrl.New()
+	if err != nil {
+		return err
+	}
+	defer wgclient.Close()
+	device, err := wgclient.Device(ncutils.GetInterfaceName())
+	if err != nil {
+		return err
+	}
+	routes, stale := updateRoutedPeers(peers, device.Peers, config.Netclient().MinimalRoutes, now)
+	removeHostRoutes(stale)
+	for _, addr := range routes {
+		if err := wireguard.AddHostRoute(addr); err != nil {
+			slog.Error("failed to add host route", "address", addr, "error", err)
+		}
+	}
+	return nil
+}
+
+// updateRoutedPeers - updates the activity of the peers from a sample of the interface, returns the
+// addresses to route and the addresses whose routes are removed
+func updateRoutedPeers(peers map[string]*routedPeer, sample []wgtypes.Peer, settings config.MinimalRoutes,
+	now time.Time) (routes, stale []net.IP) {
+	pinned := make(map[string]bool)
+	for _, addr := range settings.Pinned {
+		if ip := net.ParseIP(addr); ip != nil {
+			pinned[ip.String()] = true
+		}
+	}
+	present := make(map[string]bool)
+	for _, peer := range sample {
+		key := peer.PublicKey.String()
+		present[key] = true
+		addrs := []net.IP{}
+		keep := false
+		for _, allowed := range peer.AllowedIPs {
+			if !isNetworkIP(allowed.IP) {
+				// the routes to the ranges of egress gateways lead through their addresses
+				keep = true
+				continue
+			}
+			if ones, bits := allowed.Mask.Size(); ones == bits {
+				addrs = append(addrs, allowed.IP)
+				keep = keep || pinned[allowed.IP.String()]
+			}
+		}
+		bytes := peer.ReceiveBytes + peer.TransmitBytes
+		p, ok := peers[key]
+		if !ok {
+			p = &routedPeer{bytes: bytes}
+			peers[key] = p
+		}
+		if bytes-p.bytes > minimalRoutesActivity {
+			p.lastSeen = now
+		}
+		p.bytes = bytes
+		active := keep || (!p.lastSeen.IsZero() && now.Sub(p.lastSeen) < settings.GetIdleTimeout())
+		if !active {
+			if len(p.addrs) > 0 {
+				slog.Info("peer is idle, removing its host routes", "peer", key)
+			}
+			stale = append(stale, p.addrs...)
+			p.addrs = nil
+			continue
+		}
+		if len(p.addrs) == 0 {
+			slog.Info("routing peer", "peer", key, "addresses", addrs)
+		}
+		stale = append(stale, missingAddrs(p.addrs, addrs)...)
+		routes = append(routes, addrs...)
+		p.addrs = addrs
+	}
+	for key, p := range peers {
+		if !present[key] {
+			stale = append(stale, p.addrs...)
+			delete(peers, key)
+		}
+	}
+	return routes, stale
+}
+
+// removeHostRoutes - removes the host routes to the addresses
+func removeHostRoutes(addrs []net.IP) {
+	for _, addr := range addrs {
+		if err := wireguard.RemoveHostRoute(addr); err != nil {
+			slog.Debug("failed to remove host route", "address", addr, "error", err)
+		}
+	}
+}
+
+// missingAddrs - the addresses of old missing from current
+func missingAddrs(old, current []net.IP) []net.IP {
+	missing := []net.IP{}
+	for _, addr := range old {
+		found := false
+		for _, c := range current {
+			if c.Equal(addr) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, addr)
+		}
+	}
+	return missing
+}
+
+// isNetworkIP - checks if ip belongs to the network range of any joined network
+func isNetworkIP(ip net.IP) bool {
+	for _, node := range config.GetNodes() {
+		if node.NetworkRange.Contains(ip) || node.NetworkRange6.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
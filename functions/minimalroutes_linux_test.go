@@ -0,0 +1,62 @@
+package functions
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestUpdateRoutedPeers(t *testing.T) {
+	is := is.New(t)
+	_, network, _ := net.ParseCIDR("10.10.10.0/24")
+	config.UpdateNodeMap("minimal", config.Node{CommonNode: models.CommonNode{NetworkRange: *network}})
+	t.Cleanup(func() { config.DeleteNode("minimal") })
+	peerOf := func(addr string, bytes int64) wgtypes.Peer {
+		key, _ := wgtypes.GenerateKey()
+		_, allowed, _ := net.ParseCIDR(addr)
+		return wgtypes.Peer{PublicKey: key, AllowedIPs: []net.IPNet{*allowed}, ReceiveBytes: bytes}
+	}
+	active := peerOf("10.10.10.2/32", 0)
+	idle := peerOf("10.10.10.3/32", 0)
+	pinned := peerOf("10.10.10.4/32", 0)
+	gateway := peerOf("10.10.10.5/32", 0)
+	_, egress, _ := net.ParseCIDR("192.168.0.0/24")
+	gateway.AllowedIPs = append(gateway.AllowedIPs, *egress)
+	settings := config.MinimalRoutes{Enabled: true, IdleTimeout: 60, Pinned: []string{"10.10.10.4"}}
+	peers := make(map[string]*routedPeer)
+	now := time.Now()
+
+	routes, stale := updateRoutedPeers(peers, []wgtypes.Peer{active, idle, pinned, gateway}, settings, now)
+	is.Equal(len(stale), 0)
+	is.Equal(len(routes), 2) // pinned peer and egress gateway
+	is.True(routes[0].Equal(net.ParseIP("10.10.10.4")))
+	is.True(routes[1].Equal(net.ParseIP("10.10.10.5")))
+
+	t.Run("peer is learned on traffic", func(t *testing.T) {
+		active.ReceiveBytes = minimalRoutesActivity * 2
+		now = now.Add(minimalRoutesInterval)
+		routes, stale = updateRoutedPeers(peers, []wgtypes.Peer{active, idle, pinned, gateway}, settings, now)
+		is.Equal(len(stale), 0)
+		is.Equal(len(routes), 3)
+		is.True(routes[0].Equal(net.ParseIP("10.10.10.2")))
+	})
+	t.Run("idle peer is removed", func(t *testing.T) {
+		now = now.Add(time.Minute * 2)
+		routes, stale = updateRoutedPeers(peers, []wgtypes.Peer{active, idle, pinned, gateway}, settings, now)
+		is.Equal(len(routes), 2)
+		is.Equal(len(stale), 1)
+		is.True(stale[0].Equal(net.ParseIP("10.10.10.2")))
+	})
+	t.Run("removed peer is removed", func(t *testing.T) {
+		routes, stale = updateRoutedPeers(peers, []wgtypes.Peer{active, idle, gateway}, settings, now)
+		is.Equal(len(routes), 1)
+		is.Equal(len(stale), 1)
+		is.True(stale[0].Equal(net.ParseIP("10.10.10.4")))
+		is.Equal(len(peers), 3)
+	})
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package functions
+
+import (
+	"context"
+
+	"golang.org/x/exp/slog"
+)
+
+// learnMinimalRoutes - minimal routes mode relies on netlink, only available on linux
+func learnMinimalRoutes(ctx context.Context) error {
+	slog.Warn("minimal routes mode is only supported on linux")
+	<-ctx.Done()
+	return nil
+}
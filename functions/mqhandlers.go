@@ -30,6 +30,7 @@ var All mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
 
 // NodeUpdate -- mqtt message handler for /update/<NodeID> topic
 func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
+	defer RecoverCrash()
 	network := parseNetworkFromTopic(msg.Topic())
 	slog.Info("processing node update for network", "network", network)
 	node := config.GetNode(network)
@@ -44,6 +45,9 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 		slog.Error("error unmarshalling node update data", "error", err)
 		return
 	}
+	if refusedInLockdown(server.Name, "update node of network "+network) {
+		return
+	}
 	newNode := config.Node{}
 	newNode.CommonNode = serverNode.CommonNode
 
@@ -61,14 +65,17 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 	switch newNode.Action {
 	case models.NODE_DELETE:
 		slog.Info("received delete request for", "node", newNode.ID, "network", newNode.Network)
-		unsubscribeNode(client, &newNode)
-		if _, err = LeaveNetwork(newNode.Network, true); err != nil {
-			if !strings.Contains("rpc error", err.Error()) {
-				slog.Error("failed to leave network, please check that local files for network were removed", "network", newNode.Network, "error", err)
+		deleteNode := func() {
+			// the server already deleted the node, only the local state is left to clean up
+			if err := decommissionNetwork(client, newNode.Network, removedNodeDeleted); err != nil {
+				slog.Error("failed to reconfigure interface after node deletion", "network", newNode.Network, "error", err)
 				return
 			}
+			slog.Info("node was deleted", "node", newNode.ID, "network", newNode.Network)
+		}
+		if requireApproval(server.Name, "delete node from network "+newNode.Network, deleteNode) {
+			deleteNode()
 		}
-		slog.Info("node was deleted", "node", newNode.ID, "network", newNode.Network)
 		return
 	case models.NODE_FORCE_UPDATE:
 		ifaceDelta = true
@@ -77,6 +84,7 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 	}
 	// Save new config
 	newNode.Action = models.NODE_NOOP
+	applyUserNetwork(&newNode)
 	config.UpdateNodeMap(network, newNode)
 	if err := config.WriteNodeConfig(); err != nil {
 		slog.Warn("failed to write node config", "error", err)
@@ -86,6 +94,9 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 		slog.Error("could not configure netmaker interface", "error", err)
 		return
 	}
+	dnsCtx, cancel := applyContext()
+	setLinkDNS(dnsCtx)
+	cancel()
 	time.Sleep(time.Second)
 	if ifaceDelta { // if a change caused an ifacedelta we need to notify the server to update the peers
 		doneErr := publishSignal(&newNode, DONE)
@@ -99,6 +110,7 @@ func NodeUpdate(client mqtt.Client, msg mqtt.Message) {
 
 // HostPeerUpdate - mq handler for host peer update peers/host/<HOSTID>/<SERVERNAME>
 func HostPeerUpdate(client mqtt.Client, msg mqtt.Message) {
+	defer RecoverCrash()
 	var peerUpdate models.HostPeerUpdate
 	var err error
 	if len(config.GetNodes()) == 0 {
@@ -122,6 +134,8 @@ func HostPeerUpdate(client mqtt.Client, msg mqtt.Message) {
 		slog.Error("error unmarshalling peer data", "error", err)
 		return
 	}
+	updateExtClientExpiry(serverName, data)
+	updateSearchDomains(serverName, data)
 	if server.IsPro && peerConnTicker != nil {
 		peerConnTicker.Reset(peerConnectionCheckInterval)
 	}
@@ -132,7 +146,7 @@ func HostPeerUpdate(client mqtt.Client, msg mqtt.Message) {
 			slog.Error("error checking version less than", "error", err)
 			return
 		}
-		if vlt && config.Netclient().Host.AutoUpdate {
+		if vlt && config.Netclient().Host.AutoUpdate && !refusedInLockdown(serverName, "upgrade to "+peerUpdate.ServerVersion) {
 			slog.Info("updating client to server's version", "version", peerUpdate.ServerVersion)
 			if err := UseVersion(peerUpdate.ServerVersion, false); err != nil {
 				slog.Error("error updating client to server's version", "error", err)
@@ -148,18 +162,51 @@ func HostPeerUpdate(client mqtt.Client, msg mqtt.Message) {
 		server.Version = peerUpdate.ServerVersion
 		config.WriteServerConfig()
 	}
+	queuePeerUpdate(serverName, peerUpdate)
+}
+
+// ApplyPeerUpdate - applies a (coalesced) peer update to the interface, routes, firewall and dns,
+// stages not started yet are skipped once the context is done
+func ApplyPeerUpdate(ctx context.Context, serverName string, peerUpdate models.HostPeerUpdate) error {
+	peers, err := filterPeerUpdate(serverName, peerUpdate.Peers)
+	if err != nil {
+		return err
+	}
+	peerUpdate.Peers = peers
 	config.UpdateHostPeers(peerUpdate.Peers)
 	_ = config.WriteNetclientConfig()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	_ = wireguard.SetPeers(peerUpdate.ReplacePeers)
-	if len(peerUpdate.EgressRoutes) > 0 {
-		wireguard.SetEgressRoutes(peerUpdate.EgressRoutes)
+	if err := applyPeerBlocks(); err != nil {
+		slog.Error("failed to apply rules of blocked peers", "error", err)
+	}
+	if err := applyInterNetworkRouting(); err != nil {
+		slog.Error("failed to apply inter-network routing", "error", err)
+	}
+	if err := applyMSSClamp(); err != nil {
+		slog.Error("failed to apply MSS clamping", "error", err)
+	}
+	if err := applyEgressPolicies(); err != nil {
+		slog.Error("failed to apply egress policies", "error", err)
+	}
+	if err := applyDefaultPolicy(); err != nil {
+		slog.Error("failed to apply the default policy", "error", err)
 	}
 	go handleEndpointDetection(peerUpdate.Peers, peerUpdate.HostNetworkInfo)
-	handleFwUpdate(serverName, &peerUpdate.FwUpdate)
+	if err := handleEgressUpdate(ctx, serverName, peerUpdate.EgressRoutes, &peerUpdate.FwUpdate); err != nil {
+		return err
+	}
+	setExtClientDNS(serverName, peerUpdate.PeerIDs)
+	applyExtClientRateLimits(serverName, peerUpdate.PeerIDs)
+	setRelayPeers(serverName, peerUpdate.PeerIDs)
+	return nil
 }
 
 // HostUpdate - mq handler for host update host/update/<HOSTID>/<SERVERNAME>
 func HostUpdate(client mqtt.Client, msg mqtt.Message) {
+	defer RecoverCrash()
 	var hostUpdate models.HostUpdate
 	var err error
 	serverName := parseServerFromTopic(msg.Topic())
@@ -182,6 +229,11 @@ func HostUpdate(client mqtt.Client, msg mqtt.Message) {
 		return
 	}
 	slog.Info("processing host update", "server", serverName, "action", hostUpdate.Action)
+	if hostUpdate.Action != models.RequestAck && hostUpdate.Action != models.SignalHost &&
+		refusedInLockdown(serverName, string(hostUpdate.Action)) {
+		clearRetainedMsg(client, msg.Topic())
+		return
+	}
 	var resetInterface, restartDaemon, sendHostUpdate, clearMsg bool
 	switch hostUpdate.Action {
 	case models.Upgrade:
@@ -216,6 +268,7 @@ func HostUpdate(client mqtt.Client, msg mqtt.Message) {
 			CommonNode: commonNode,
 		}
 		config.UpdateNodeMap(hostUpdate.Node.Network, nodeCfg)
+		config.ClearRemovedNetwork(hostUpdate.Node.Network)
 		server := config.GetServer(serverName)
 		if server == nil {
 			return
@@ -230,14 +283,32 @@ func HostUpdate(client mqtt.Client, msg mqtt.Message) {
 			slog.Error("failed to response with ACK to server", "server", serverName, "error", err)
 		}
 		setSubscriptions(client, &nodeCfg)
+		setServiceSubscription(client, &nodeCfg)
 		resetInterface = true
 	case models.DeleteHost:
 		clearRetainedMsg(client, msg.Topic())
-		unsubscribeHost(client, serverName)
-		deleteHostCfg(client, serverName)
-		config.WriteNodeConfig()
-		config.WriteServerConfig()
-		restartDaemon = true
+		deleteHost := func() {
+			unsubscribeHost(client, serverName)
+			for _, node := range config.GetNodes() {
+				if node.Server == serverName {
+					unsubscribeNode(client, &node)
+					removeNetworkState(node, removedHostDeleted)
+				}
+			}
+			deleteHostCfg(client, serverName)
+			config.WriteNodeConfig()
+			config.WriteServerConfig()
+			if err := config.WriteNetclientConfig(); err != nil {
+				slog.Error("failed to write host config", "error", err)
+			}
+			if err := daemon.Restart(); err != nil {
+				slog.Error("failed to restart daemon", "error", err)
+			}
+		}
+		if requireApproval(serverName, "delete host from server "+serverName, deleteHost) {
+			deleteHost()
+		}
+		return
 	case models.UpdateHost:
 		resetInterface, restartDaemon, sendHostUpdate = config.UpdateHost(&hostUpdate.Host)
 		if sendHostUpdate {
@@ -259,7 +330,9 @@ func HostUpdate(client mqtt.Client, msg mqtt.Message) {
 		UpdateKeys()
 	case models.RequestPull:
 		clearRetainedMsg(client, msg.Topic())
-		Pull(true)
+		if !holdPull() {
+			Pull(true)
+		}
 	default:
 		slog.Error("unknown host action", "action", hostUpdate.Action)
 		return
@@ -286,6 +359,9 @@ func HostUpdate(client mqtt.Client, msg mqtt.Message) {
 			slog.Error("could not configure netmaker interface", "error", err)
 			return
 		}
+		dnsCtx, cancel := applyContext()
+		setLinkDNS(dnsCtx)
+		cancel()
 		if err = wireguard.SetPeers(false); err != nil {
 			slog.Error("failed to set peers", err)
 		}
@@ -300,6 +376,10 @@ func handleEndpointDetection(peers []wgtypes.PeerConfig, peerInfo models.HostInf
 		if wireguard.EndpointDetectedAlready(peerPubKey) {
 			continue
 		}
+		if path := config.GetPeerPath(peerPubKey); path == config.PeerPathDirect || path == config.PeerPathRelay {
+			slog.Debug("peer path pinned, skipping endpoint detection", "peer", peerPubKey, "path", path)
+			continue
+		}
 		if peerInfo, ok := peerInfo[peerPubKey]; ok {
 			if peerInfo.IsStatic {
 				// peer is a static host shouldn't disturb the configuration set by the user
@@ -382,10 +462,12 @@ func isAddressInPeers(ip net.IP, cidrs []net.IPNet) bool {
 	return false
 }
 
-func handleFwUpdate(server string, payload *models.FwUpdate) {
+func handleFwUpdate(ctx context.Context, server string, payload *models.FwUpdate) {
 
 	if payload.IsEgressGw {
-		firewall.SetEgressRoutes(server, payload.EgressInfo)
+		if err := firewall.SetEgressRoutes(ctx, server, payload.EgressInfo); err != nil {
+			slog.Error("failed to set egress firewall rules", "server", server, "error", err)
+		}
 	} else {
 		firewall.DeleteEgressGwRoutes(server)
 	}
@@ -395,6 +477,7 @@ func handleFwUpdate(server string, payload *models.FwUpdate) {
 // MQTT Fallback Mechanism
 func mqFallback(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
+	defer RecoverCrash()
 	mqFallbackTicker := time.NewTicker(time.Second * 30)
 	for {
 		select {
@@ -403,7 +486,7 @@ func mqFallback(ctx context.Context, wg *sync.WaitGroup) {
 			slog.Info("mqfallback routine stop")
 			return
 		case <-mqFallbackTicker.C: // Execute pull every 30 seconds
-			if (Mqclient != nil && Mqclient.IsConnectionOpen() && Mqclient.IsConnected()) || config.CurrServer == "" {
+			if (Mqclient != nil && Mqclient.IsConnectionOpen() && Mqclient.IsConnected()) || config.CurrServer == "" || !isDaemonReady() {
 				continue
 			}
 			// Call netclient http config pull
@@ -432,6 +515,10 @@ func mqFallback(ctx context.Context, wg *sync.WaitGroup) {
 
 // MQTT Fallback Config Pull
 func mqFallbackPull(pullResponse models.HostPull, resetInterface, replacePeers bool) {
+	if !isDaemonReady() {
+		slog.Info("daemon is starting, skipping fallback pull")
+		return
+	}
 	serverName := config.CurrServer
 	server := config.GetServer(serverName)
 	if server == nil {
@@ -445,7 +532,7 @@ func mqFallbackPull(pullResponse models.HostPull, resetInterface, replacePeers b
 			slog.Error("error checking version less than", "error", err)
 			return
 		}
-		if vlt && config.Netclient().Host.AutoUpdate {
+		if vlt && config.Netclient().Host.AutoUpdate && !refusedInLockdown(serverName, "upgrade to "+pullResponse.ServerConfig.Version) {
 			slog.Info("updating client to server's version", "version", pullResponse.ServerConfig.Version)
 			if err := UseVersion(pullResponse.ServerConfig.Version, false); err != nil {
 				slog.Error("error updating client to server's version", "error", err)
@@ -463,12 +550,15 @@ func mqFallbackPull(pullResponse models.HostPull, resetInterface, replacePeers b
 	config.UpdateHostPeers(pullResponse.Peers)
 	_ = config.WriteNetclientConfig()
 	_ = wireguard.SetPeers(replacePeers)
-	if len(pullResponse.EgressRoutes) > 0 {
-		wireguard.SetEgressRoutes(pullResponse.EgressRoutes)
-	}
 
 	go handleEndpointDetection(pullResponse.Peers, pullResponse.HostNetworkInfo)
-	handleFwUpdate(serverName, &pullResponse.FwUpdate)
+	ctx, cancel := applyContext()
+	defer cancel()
+	if err := handleEgressUpdate(ctx, serverName, pullResponse.EgressRoutes, &pullResponse.FwUpdate); err != nil {
+		slog.Error("failed to apply egress update", "server", serverName, "error", err)
+		writeState(serverName, err)
+		return
+	}
 
 	if resetInterface {
 		nc := wireguard.GetInterface()
@@ -477,9 +567,12 @@ func mqFallbackPull(pullResponse models.HostPull, resetInterface, replacePeers b
 		nc.Create()
 		if err := nc.Configure(); err != nil {
 			slog.Error("could not configure netmaker interface", "error", err)
+			writeState(serverName, err)
 			return
 		}
+		setLinkDNS(ctx)
 		_ = wireguard.SetPeers(false)
 		slog.Info("mqfallback reset interface")
 	}
+	writeState(serverName, nil)
 }
@@ -27,8 +27,6 @@ const (
 	ACK = 1
 	// DONE - done signal for MQ
 	DONE = 2
-	// CheckInInterval - interval in minutes for mq checkins
-	CheckInInterval = 1
 )
 
 // Checkin  -- go routine that checks for public or local ip changes, publishes changes
@@ -37,14 +35,16 @@ const (
 func Checkin(ctx context.Context, wg *sync.WaitGroup) {
 	logger.Log(2, "starting checkin goroutine")
 	defer wg.Done()
-	ticker := time.NewTicker(time.Minute * CheckInInterval)
-	defer ticker.Stop()
+	defer RecoverCrash()
+	timer := time.NewTimer(nextCheckin())
+	defer timer.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			logger.Log(0, "checkin routine closed")
 			return
-		case <-ticker.C:
+		case <-timer.C:
+			timer.Reset(nextCheckin())
 			if config.CurrServer == "" {
 				continue
 			}
@@ -58,6 +58,14 @@ func Checkin(ctx context.Context, wg *sync.WaitGroup) {
 	}
 }
 
+// nextCheckin - returns the time until the next checkin with the current server
+func nextCheckin() time.Duration {
+	if server := config.GetServer(config.CurrServer); server != nil {
+		return server.NextCheckin()
+	}
+	return config.DefaultCheckinInterval
+}
+
 func checkinFallback() {
 	// check/update host settings; publish if changed
 	if err := UpdateHostSettings(true); err != nil {
@@ -235,7 +243,7 @@ func publish(serverName, dest string, msg []byte, qos byte) error {
 	if err != nil {
 		return err
 	}
-	encrypted, err := Chunk(msg, serverPubKey, privateKey)
+	encrypted, err := ncutils.Chunk(msg, serverPubKey, privateKey)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,26 @@
+package functions
+
+import (
+	"net"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+)
+
+// applyMSSClamp - installs the rules clamping the MSS of tcp connections forwarded to the ranges of the
+// networks enabled in the host config, it runs after each peer update as the server may change the ranges
+func applyMSSClamp() error {
+	clamp := config.Netclient().MSSClamp
+	ranges := []net.IPNet{}
+	for _, node := range config.GetNodes() {
+		if !clamp.Enabled(node.Server, node.Network) {
+			continue
+		}
+		for _, r := range []net.IPNet{node.NetworkRange, node.NetworkRange6} {
+			if r.IP != nil {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+	return firewall.SetMSSClamp(ranges)
+}
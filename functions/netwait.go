@@ -0,0 +1,67 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"golang.org/x/exp/slog"
+)
+
+// waitForNetwork - waits until the host has a default route and can resolve the server,
+// so endpoint detection and registration do not run against a network that is still coming up (e.g. on boot)
+func waitForNetwork(server string) error {
+	timeout := config.GetNetworkWaitTimeout()
+	if timeout == 0 {
+		return nil
+	}
+	deadline := time.Now().Add(timeout)
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = networkReady(server); err == nil {
+			if attempt > 1 {
+				slog.Info("network is online", "attempts", attempt)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		if attempt == 1 {
+			slog.Info("waiting for network to come online", "reason", err.Error(), "timeout", timeout.String())
+		}
+		time.Sleep(time.Second)
+	}
+	slog.Warn("network not online before timeout, continuing", "error", err)
+	return err
+}
+
+// networkReady - checks for a usable default route and, if given, dns resolution of the server
+func networkReady(server string) error {
+	if _, err := getDefaultInterface(); err != nil {
+		return err
+	}
+	// connecting a udp socket only selects a route and source address, nothing is sent
+	conn, err := net.Dial("udp", "1.1.1.1:53")
+	if err != nil {
+		return err
+	}
+	local, _ := conn.LocalAddr().(*net.UDPAddr)
+	conn.Close()
+	if local == nil || local.IP.IsUnspecified() || local.IP.IsLoopback() {
+		return errors.New("no usable source address")
+	}
+	if server == "" {
+		return nil
+	}
+	host := server
+	if h, _, err := net.SplitHostPort(server); err == nil {
+		host = h
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	_, err = net.DefaultResolver.LookupHost(ctx, host)
+	return err
+}
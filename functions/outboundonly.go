@@ -0,0 +1,52 @@
+package functions
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/exp/slog"
+)
+
+// applyOutboundOnly - installs the rules of outbound only mode when enabled in the host config,
+// invalid ports are skipped with a warning
+func applyOutboundOnly() error {
+	host := config.Netclient()
+	if !host.OutboundOnly {
+		return firewall.SetOutboundOnly(false, nil)
+	}
+	allowed := []firewall.Port{}
+	for _, p := range host.InboundPorts {
+		port, err := firewall.ParsePort(p)
+		if err != nil {
+			slog.Warn("ignoring inbound port", "error", err)
+			continue
+		}
+		allowed = append(allowed, port)
+	}
+	if host.OpenServicePorts {
+		for _, service := range host.Services {
+			port, err := firewall.ParsePort(strconv.Itoa(service.Port) + "/" + service.GetProtocol())
+			if err != nil {
+				slog.Warn("ignoring port of service", "service", service.Name, "error", err)
+				continue
+			}
+			allowed = append(allowed, port)
+		}
+	}
+	for _, exposed := range host.Exposed {
+		if _, port, err := net.SplitHostPort(exposed.Listen); err == nil {
+			if port, err := firewall.ParsePort(port + "/tcp"); err == nil {
+				allowed = append(allowed, port)
+			}
+		}
+	}
+	if host.WoLRelay {
+		// wake-on-lan packets are relayed from the mesh addresses
+		allowed = append(allowed, firewall.Port{Port: ncutils.WoLPort, Protocol: "udp"})
+	}
+	slog.Info("outbound only mode, rejecting inbound mesh traffic", "allowed", host.InboundPorts)
+	return firewall.SetOutboundOnly(true, allowed)
+}
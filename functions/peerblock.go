@@ -0,0 +1,96 @@
+package functions
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// peerBlockRequest - request to block or unblock a peer through the local api
+type peerBlockRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// BlockPeer - blocks a peer in the running daemon
+func BlockPeer(pubKey string) error {
+	_, err := callDaemon[any](http.MethodPost, "/peers/block", peerBlockRequest{PublicKey: pubKey})
+	return err
+}
+
+// UnblockPeer - unblocks a peer in the running daemon
+func UnblockPeer(pubKey string) error {
+	_, err := callDaemon[any](http.MethodPost, "/peers/unblock", peerBlockRequest{PublicKey: pubKey})
+	return err
+}
+
+// setPeerBlocked - blocks or unblocks a peer: a blocked peer is removed from the interface and traffic
+// from and to its addresses is dropped, until it is unblocked
+func setPeerBlocked(pubKey string, blocked bool) error {
+	key, err := wgtypes.ParseKey(pubKey)
+	if err != nil {
+		return errors.New("invalid public key " + pubKey)
+	}
+	pubKey = key.String()
+	if config.IsBlockedPeer(pubKey) == blocked {
+		if blocked {
+			return errors.New("peer is already blocked")
+		}
+		return errors.New("peer is not blocked")
+	}
+	host := config.Netclient()
+	keys := []string{}
+	for _, k := range host.BlockedPeers {
+		if k != pubKey {
+			keys = append(keys, k)
+		}
+	}
+	if blocked {
+		keys = append(keys, pubKey)
+	}
+	host.BlockedPeers = keys
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		return err
+	}
+	if blocked {
+		slog.Warn("blocking peer", "peer", pubKey)
+	} else {
+		slog.Info("unblocking peer", "peer", pubKey)
+	}
+	if err := wireguard.SetPeers(false); err != nil {
+		return err
+	}
+	return applyPeerBlocks()
+}
+
+// applyPeerBlocks - installs the drop rules for the current addresses of the blocked peers, the peers
+// outside of their access schedules and expired ext clients, it runs after each peer update as the
+// server may change the addresses of a blocked peer
+func applyPeerBlocks() error {
+	blocked := make(map[string][]net.IPNet)
+	for _, key := range config.Netclient().BlockedPeers {
+		blocked[key] = nil
+	}
+	now := time.Now()
+	for _, key := range scheduledOutPeers(now) {
+		blocked[key] = nil
+	}
+	for key := range expiredExtClients(now) {
+		blocked[key] = nil
+	}
+	for _, peer := range config.Netclient().HostPeers {
+		addrs, ok := blocked[peer.PublicKey.String()]
+		if !ok || peer.Remove {
+			continue
+		}
+		blocked[peer.PublicKey.String()] = append(addrs, peer.AllowedIPs...)
+	}
+	return firewall.SetBlockedPeers(blocked)
+}
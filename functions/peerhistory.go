@@ -0,0 +1,216 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	// PeerHistoryFile - file in the netclient directory keeping the connectivity transitions of the peers
+	PeerHistoryFile = "peerhistory.json"
+	// peerHistoryInterval - time between samples of the connectivity of the peers
+	peerHistoryInterval = time.Second * 30
+	// peerHistorySize - transitions kept per peer, the oldest are dropped first
+	peerHistorySize = 256
+)
+
+// states of a peer in its connectivity history
+const (
+	PeerStateUp      = "up"
+	PeerStateDown    = "down"
+	PeerStateRemoved = "removed"
+)
+
+// PeerEvent - a connectivity transition of a peer: its state and whether it is reached directly
+// or through a relay, identified by its public key
+type PeerEvent struct {
+	Time  time.Time `json:"time"`
+	State string    `json:"state"`
+	Path  string    `json:"path,omitempty"`
+	Via   string    `json:"via,omitempty"`
+}
+
+// peerHistory - the transitions of a peer and its last known mesh addresses, which find the
+// relay of the peer once the server moves it behind one
+type peerHistory struct {
+	Addresses []net.IP    `json:"addresses"`
+	Events    []PeerEvent `json:"events"`
+}
+
+// record - appends the event unless it matches the last one, returns if it was appended
+func (h *peerHistory) record(event PeerEvent) bool {
+	if n := len(h.Events); n > 0 {
+		last := h.Events[n-1]
+		if last.State == event.State && last.Path == event.Path && last.Via == event.Via {
+			return false
+		}
+	}
+	h.Events = append(h.Events, event)
+	if len(h.Events) > peerHistorySize {
+		h.Events = h.Events[len(h.Events)-peerHistorySize:]
+	}
+	return true
+}
+
+// GetPeerHistory - the recorded connectivity transitions of a peer, oldest first
+func GetPeerHistory(pubKey string) ([]PeerEvent, error) {
+	key, err := wgtypes.ParseKey(pubKey)
+	if err != nil {
+		return nil, errors.New("invalid public key " + pubKey)
+	}
+	history, err := readPeerHistory()
+	if err != nil {
+		return nil, err
+	}
+	h, ok := history[key.String()]
+	if !ok {
+		return nil, errors.New("no history recorded for peer " + key.String())
+	}
+	return h.Events, nil
+}
+
+// recordPeerHistory - periodically samples the peers on the interface and records the transitions
+// between up and down, by the age of the last handshake, and between direct and relayed paths
+func recordPeerHistory(ctx context.Context) error {
+	history, err := readPeerHistory()
+	if err != nil {
+		slog.Warn("failed to read the peer history, starting a new one", "error", err)
+		history = make(map[string]*peerHistory)
+	}
+	ticker := time.NewTicker(peerHistoryInterval)
+	defer ticker.Stop()
+	for {
+		changed, err := samplePeers(history, time.Now())
+		if err != nil {
+			slog.Debug("failed to sample peers", "error", err)
+		}
+		if changed {
+			if err := writePeerHistory(history); err != nil {
+				slog.Warn("failed to write the peer history", "error", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// samplePeers - records the current state of the known peers, returns if any transition was recorded
+func samplePeers(history map[string]*peerHistory, now time.Time) (bool, error) {
+	wgclient, err := wgctrl.New()
+	if err != nil {
+		return false, err
+	}
+	defer wgclient.Close()
+	device, err := wgclient.Device(ncutils.GetInterfaceName())
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	present := make(map[string]bool)
+	for _, peer := range device.Peers {
+		key := peer.PublicKey.String()
+		present[key] = true
+		h, ok := history[key]
+		if !ok {
+			h = &peerHistory{}
+			history[key] = h
+		}
+		if addrs := peerMeshAddresses(peer.AllowedIPs); len(addrs) > 0 {
+			h.Addresses = addrs
+		}
+		if h.record(PeerEvent{Time: now, State: peerState(peer, now), Path: config.PeerPathDirect}) {
+			changed = true
+		}
+	}
+	for key, h := range history {
+		if present[key] {
+			continue
+		}
+		event := PeerEvent{Time: now, State: PeerStateRemoved}
+		if relay := relayOf(h.Addresses, device.Peers); relay != nil {
+			event.State, event.Path, event.Via = peerState(*relay, now), config.PeerPathRelay, relay.PublicKey.String()
+		}
+		if h.record(event) {
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// peerState - up when the peer completed a handshake recently
+func peerState(peer wgtypes.Peer, now time.Time) string {
+	if peer.LastHandshakeTime.IsZero() || now.Sub(peer.LastHandshakeTime) > LastHandShakeThreshold {
+		return PeerStateDown
+	}
+	return PeerStateUp
+}
+
+// peerMeshAddresses - the allowed ips of a peer within the joined networks
+func peerMeshAddresses(allowedIPs []net.IPNet) []net.IP {
+	addrs := []net.IP{}
+	for _, allowed := range allowedIPs {
+		for _, node := range config.GetNodes() {
+			if node.NetworkRange.Contains(allowed.IP) || node.NetworkRange6.Contains(allowed.IP) {
+				addrs = append(addrs, allowed.IP)
+				break
+			}
+		}
+	}
+	return addrs
+}
+
+// relayOf - the peer holding one of the addresses as a host route, i.e. relaying the peer owning them
+func relayOf(addrs []net.IP, peers []wgtypes.Peer) *wgtypes.Peer {
+	for i := range peers {
+		for _, allowed := range peers[i].AllowedIPs {
+			ones, bits := allowed.Mask.Size()
+			if ones != bits {
+				continue
+			}
+			for _, addr := range addrs {
+				if addr.Equal(allowed.IP) {
+					return &peers[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readPeerHistory - reads the peer history file, empty when it does not exist yet
+func readPeerHistory() (map[string]*peerHistory, error) {
+	history := make(map[string]*peerHistory)
+	data, err := os.ReadFile(config.GetNetclientPath() + PeerHistoryFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return history, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// writePeerHistory - replaces the peer history file
+func writePeerHistory(history map[string]*peerHistory) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(config.GetNetclientPath()+PeerHistoryFile, data, 0600)
+}
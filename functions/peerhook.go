@@ -0,0 +1,184 @@
+package functions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// hookPeer - a peer of a peer update as seen by the peer hook
+type hookPeer struct {
+	PublicKey           string   `json:"public_key"`
+	Endpoint            string   `json:"endpoint,omitempty"`
+	AllowedIPs          []string `json:"allowed_ips"`
+	PersistentKeepalive int      `json:"persistent_keepalive,omitempty"`
+	Remove              bool     `json:"remove,omitempty"`
+}
+
+// hookUpdate - the peer update handed to the peer hook and expected back from it, peers missing
+// from the answer are vetoed
+type hookUpdate struct {
+	Server string     `json:"server"`
+	Peers  []hookPeer `json:"peers"`
+}
+
+// filterPeerUpdate - hands the peers of an update from server to the configured peer hook and
+// applies its answer: peers may be changed, peers left out are vetoed and keep their current
+// config, if any. If the hook fails the update is rejected, or passed unfiltered with FailOpen
+func filterPeerUpdate(server string, peers []wgtypes.PeerConfig) ([]wgtypes.PeerConfig, error) {
+	hook := config.Netclient().PeerHook
+	if !hook.Enabled() {
+		return peers, nil
+	}
+	filtered, err := runPeerHook(hook, server, peers)
+	if err != nil {
+		if hook.FailOpen {
+			slog.Warn("peer hook failed, applying the update unfiltered", "server", server, "error", err)
+			return peers, nil
+		}
+		return nil, fmt.Errorf("peer hook rejected the update: %w", err)
+	}
+	return filtered, nil
+}
+
+// runPeerHook - runs the hook on the peers and merges its answer into them
+func runPeerHook(hook config.PeerHook, server string, peers []wgtypes.PeerConfig) ([]wgtypes.PeerConfig, error) {
+	update := hookUpdate{Server: server, Peers: []hookPeer{}}
+	for _, peer := range peers {
+		update.Peers = append(update.Peers, toHookPeer(peer))
+	}
+	data, err := json.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hook.GetTimeout())
+	defer cancel()
+	out, err := callPeerHookCommand(ctx, hook, data)
+	if err != nil {
+		return nil, err
+	}
+	answer := hookUpdate{}
+	if err := json.Unmarshal(out, &answer); err != nil {
+		return nil, fmt.Errorf("invalid answer of the peer hook: %w", err)
+	}
+	return mergeHookPeers(peers, answer.Peers)
+}
+
+// callPeerHookCommand - runs the executable with the update on stdin and returns its stdout
+func callPeerHookCommand(ctx context.Context, hook config.PeerHook, data []byte) ([]byte, error) {
+	// go plugins need a cgo build of netclient, which the releases are not
+	if strings.HasSuffix(hook.Command, ".so") {
+		return nil, fmt.Errorf("peer hook %s is a go plugin, which is not supported: configure an executable", hook.Command)
+	}
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("peer hook timed out after %s", hook.GetTimeout())
+		}
+		return nil, fmt.Errorf("peer hook %s: %w %s", hook.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// toHookPeer - converts a peer config to its form seen by the hook
+func toHookPeer(peer wgtypes.PeerConfig) hookPeer {
+	p := hookPeer{
+		PublicKey:  peer.PublicKey.String(),
+		AllowedIPs: []string{},
+		Remove:     peer.Remove,
+	}
+	if peer.Endpoint != nil {
+		p.Endpoint = peer.Endpoint.String()
+	}
+	for _, allowed := range peer.AllowedIPs {
+		p.AllowedIPs = append(p.AllowedIPs, allowed.String())
+	}
+	if peer.PersistentKeepaliveInterval != nil {
+		p.PersistentKeepalive = int(peer.PersistentKeepaliveInterval.Seconds())
+	}
+	return p
+}
+
+// mergeHookPeers - applies the answer of the hook to the peers of the update, keeping their order
+func mergeHookPeers(peers []wgtypes.PeerConfig, answer []hookPeer) ([]wgtypes.PeerConfig, error) {
+	changes := make(map[string]hookPeer)
+	for _, p := range answer {
+		if _, err := wgtypes.ParseKey(p.PublicKey); err != nil {
+			return nil, fmt.Errorf("invalid public key %q in the answer of the peer hook", p.PublicKey)
+		}
+		changes[p.PublicKey] = p
+	}
+	current := make(map[string]wgtypes.PeerConfig)
+	for _, peer := range config.Netclient().HostPeers {
+		current[peer.PublicKey.String()] = peer
+	}
+	filtered := []wgtypes.PeerConfig{}
+	seen := make(map[string]bool)
+	for _, peer := range peers {
+		key := peer.PublicKey.String()
+		seen[key] = true
+		p, ok := changes[key]
+		if !ok {
+			if old, ok := current[key]; ok {
+				slog.Info("peer hook vetoed the update of peer, keeping its current config", "peer", key)
+				filtered = append(filtered, old)
+			} else {
+				slog.Info("peer hook vetoed peer", "peer", key)
+			}
+			continue
+		}
+		changed, err := applyHookPeer(peer, p)
+		if err != nil {
+			return nil, fmt.Errorf("peer hook answer for %s: %w", key, err)
+		}
+		filtered = append(filtered, changed)
+	}
+	for key := range changes {
+		if !seen[key] {
+			slog.Warn("peer hook returned a peer not in the update, ignoring it", "peer", key)
+		}
+	}
+	return filtered, nil
+}
+
+// applyHookPeer - sets the endpoint, allowed ips, keepalive and remove flag of the hook's answer on the peer
+func applyHookPeer(peer wgtypes.PeerConfig, p hookPeer) (wgtypes.PeerConfig, error) {
+	peer.Endpoint = nil
+	if p.Endpoint != "" {
+		endpoint, err := net.ResolveUDPAddr("udp", p.Endpoint)
+		if err != nil {
+			return peer, fmt.Errorf("invalid endpoint %s: %w", p.Endpoint, err)
+		}
+		peer.Endpoint = endpoint
+	}
+	allowedIPs := []net.IPNet{}
+	for _, allowed := range p.AllowedIPs {
+		ip, cidr, err := net.ParseCIDR(allowed)
+		if err != nil {
+			return peer, fmt.Errorf("invalid allowed ip %s: %w", allowed, err)
+		}
+		allowedIPs = append(allowedIPs, net.IPNet{IP: ip, Mask: cidr.Mask})
+	}
+	peer.AllowedIPs = allowedIPs
+	peer.PersistentKeepaliveInterval = nil
+	if p.PersistentKeepalive > 0 {
+		keepalive := time.Second * time.Duration(p.PersistentKeepalive)
+		peer.PersistentKeepaliveInterval = &keepalive
+	}
+	peer.Remove = p.Remove
+	return peer, nil
+}
@@ -0,0 +1,57 @@
+package functions
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// peerPathRequest - request to pin the path of a peer through the local api
+type peerPathRequest struct {
+	PublicKey string `json:"public_key"`
+	Path      string `json:"path"`
+}
+
+// PinPeerPath - pins the path of a peer in the running daemon, auto restores the automatic selection
+func PinPeerPath(pubKey, path string) error {
+	_, err := callDaemon[any](http.MethodPost, "/peers/path", peerPathRequest{PublicKey: pubKey, Path: path})
+	return err
+}
+
+// setPeerPath - pins the path to a peer: direct keeps the server advertised endpoint, lan the endpoint
+// detected on a shared lan, relay reaches the peer through the failover node; auto unpins the peer
+func setPeerPath(pubKey, path string) error {
+	key, err := wgtypes.ParseKey(pubKey)
+	if err != nil {
+		return errors.New("invalid public key " + pubKey)
+	}
+	if err := config.ValidatePeerPath(path); err != nil {
+		return err
+	}
+	pubKey = key.String()
+	host := config.Netclient()
+	paths := make(map[string]string)
+	for k, v := range host.PeerPaths {
+		if k != pubKey {
+			paths[k] = v
+		}
+	}
+	if path != config.PeerPathAuto {
+		paths[pubKey] = path
+	}
+	host.PeerPaths = paths
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		return err
+	}
+	relayRequested.Delete(pubKey)
+	slog.Info("pinned peer path", "peer", pubKey, "path", path)
+	if path == config.PeerPathLAN && !wireguard.EndpointDetectedAlready(pubKey) {
+		slog.Warn("no lan endpoint detected for peer yet, using the advertised endpoint until one is", "peer", pubKey)
+	}
+	return wireguard.SetPeers(false)
+}
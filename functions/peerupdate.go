@@ -0,0 +1,120 @@
+package functions
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+)
+
+// maxPeerUpdateWindows - a burst is applied at the latest after this many coalescing windows
+const maxPeerUpdateWindows = 5
+
+// pendingPeerUpdate - peer updates of a server received within the coalescing window
+type pendingPeerUpdate struct {
+	update   models.HostPeerUpdate
+	received int
+	first    time.Time
+	timer    *time.Timer
+}
+
+var (
+	pendingPeerUpdates = make(map[string]*pendingPeerUpdate)
+	peerUpdateMutex    sync.Mutex
+)
+
+// queuePeerUpdate - coalesces bursts of peer updates from a server and applies them once
+// no further update arrived for the coalescing window, bounded by maxPeerUpdateWindows
+func queuePeerUpdate(server string, update models.HostPeerUpdate) {
+	window := config.GetPeerUpdateWindow()
+	if window == 0 {
+		applyPeerUpdate(server, update)
+		return
+	}
+	peerUpdateMutex.Lock()
+	defer peerUpdateMutex.Unlock()
+	pending, ok := pendingPeerUpdates[server]
+	if !ok {
+		pending = &pendingPeerUpdate{
+			update:   update,
+			received: 1,
+			first:    time.Now(),
+		}
+		pending.timer = time.AfterFunc(window, func() {
+			flushPeerUpdate(server, pending)
+		})
+		pendingPeerUpdates[server] = pending
+		return
+	}
+	pending.update = mergePeerUpdates(pending.update, update)
+	pending.received++
+	if time.Since(pending.first)+window < window*maxPeerUpdateWindows {
+		pending.timer.Reset(window)
+	}
+}
+
+// flushPeerUpdate - applies the coalesced peer update if it is still pending
+func flushPeerUpdate(server string, pending *pendingPeerUpdate) {
+	defer RecoverCrash()
+	peerUpdateMutex.Lock()
+	if pendingPeerUpdates[server] != pending {
+		peerUpdateMutex.Unlock()
+		return
+	}
+	delete(pendingPeerUpdates, server)
+	peerUpdateMutex.Unlock()
+	if pending.received > 1 {
+		slog.Info("applying coalesced peer updates", "server", server, "updates", pending.received)
+	}
+	applyPeerUpdate(server, pending.update)
+}
+
+// holdPendingPeerUpdates - stops the coalescing timers and holds back their peer updates, so none
+// fires while the daemon resets
+func holdPendingPeerUpdates() {
+	peerUpdateMutex.Lock()
+	updates := make(map[string]models.HostPeerUpdate, len(pendingPeerUpdates))
+	for server, pending := range pendingPeerUpdates {
+		pending.timer.Stop()
+		updates[server] = pending.update
+	}
+	pendingPeerUpdates = make(map[string]*pendingPeerUpdate)
+	peerUpdateMutex.Unlock()
+	holdOlderPeerUpdates(updates)
+}
+
+// applyPeerUpdate - applies a peer update bounded by the apply context of the daemon, held back
+// while the daemon is not initialized
+func applyPeerUpdate(server string, update models.HostPeerUpdate) {
+	if holdPeerUpdate(server, update) {
+		return
+	}
+	ctx, cancel := applyContext()
+	defer cancel()
+	err := ApplyPeerUpdate(ctx, server, update)
+	if err != nil {
+		slog.Error("peer update was not fully applied", "server", server, "error", err)
+	}
+	writeState(server, err)
+}
+
+// mergePeerUpdates - merges two consecutive peer updates, the newer update carries the full
+// peer state except for removals only announced by the older one
+func mergePeerUpdates(older, newer models.HostPeerUpdate) models.HostPeerUpdate {
+	if newer.ReplacePeers {
+		return newer
+	}
+	newer.ReplacePeers = older.ReplacePeers
+	seen := make(map[string]bool, len(newer.Peers))
+	for _, peer := range newer.Peers {
+		seen[peer.PublicKey.String()] = true
+	}
+	for _, peer := range older.Peers {
+		if peer.Remove && !seen[peer.PublicKey.String()] {
+			newer.Peers = append(newer.Peers, peer)
+		}
+	}
+	return newer
+}
@@ -0,0 +1,17 @@
+package functions
+
+import (
+	"context"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"golang.org/x/exp/slog"
+)
+
+// runPolicyHook - hands new connections from the mesh to the configured policy engine, it is restarted
+// by the supervisor when the engine exits
+func runPolicyHook(ctx context.Context) error {
+	hook := config.Netclient().PolicyHook
+	slog.Info("starting policy hook", "engine", hook.Engine, "queue", hook.Queue, "failopen", hook.FailOpen)
+	return firewall.RunPolicyHook(ctx, hook)
+}
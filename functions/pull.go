@@ -44,6 +44,8 @@ func Pull(restart bool) (models.HostPull, bool, bool, error) {
 		return models.HostPull{}, resetInterface, replacePeers, err
 	}
 
+	// in lockdown mode the nodes and host are kept, only the peers are applied
+	lockdown := refusedInLockdown(serverName, "update host and nodes from pull")
 	// MQTT Fallback Reset Interface
 	for _, pullNode := range pullResponse.Nodes {
 		nodeMap := config.GetNodes()
@@ -64,11 +66,38 @@ func Pull(restart bool) (models.HostPull, bool, bool, error) {
 	if len(config.GetNodes()) != len(pullResponse.Nodes) {
 		resetInterface = true
 	}
+	if lockdown {
+		resetInterface = false
+	}
+	// nodes of this server missing from the pull were removed while the host was not listening
+	for network, node := range config.GetNodes() {
+		if node.Server != serverName {
+			continue
+		}
+		found := false
+		for _, pullNode := range pullResponse.Nodes {
+			if pullNode.Network == network {
+				found = true
+				break
+			}
+		}
+		if !found && !refusedInLockdown(serverName, "remove network "+network) {
+			removeNetworkState(node, removedNotOnServer)
+		}
+	}
+	if peers, err := filterPeerUpdate(serverName, pullResponse.Peers); err != nil {
+		logger.Log(0, "keeping the current peers:", err.Error())
+		pullResponse.Peers = config.Netclient().HostPeers
+	} else {
+		pullResponse.Peers = peers
+	}
 	replacePeers = wireguard.ShouldReplace(pullResponse.Peers)
 	config.UpdateHostPeers(pullResponse.Peers)
 	config.UpdateServerConfig(&pullResponse.ServerConfig)
-	config.SetNodes(pullResponse.Nodes)
-	config.UpdateHost(&pullResponse.Host)
+	if !lockdown {
+		config.SetNodes(pullResponse.Nodes)
+		config.UpdateHost(&pullResponse.Host)
+	}
 	fmt.Printf("completed pull for server %s\n", serverName)
 	_ = config.WriteServerConfig()
 	_ = config.WriteNetclientConfig()
@@ -0,0 +1,42 @@
+package functions
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+)
+
+// applyExtClientRateLimits - on ingress gateways, limits the traffic each ext client of the server forwards
+// through the host to the ceiling of the host config
+func applyExtClientRateLimits(server string, peerIDs models.PeerMap) {
+	limit := config.Netclient().ExtClientRateLimit
+	limits := []firewall.RateLimit{}
+	if limit.Enabled() && isIngressGateway(server) {
+		for _, peer := range peerIDs {
+			if !peer.IsExtClient || peer.Address == "" {
+				continue
+			}
+			address, _, _ := strings.Cut(peer.Address, "/")
+			ip := net.ParseIP(address)
+			if ip == nil {
+				continue
+			}
+			addr := net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}
+			if addr.IP == nil {
+				addr = net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+			}
+			limits = append(limits, firewall.RateLimit{
+				Addr:               addr,
+				PacketsPerSecond:   limit.PacketsPerSecond,
+				KilobytesPerSecond: limit.KilobytesPerSecond,
+			})
+		}
+	}
+	if err := firewall.SetRateLimits(server, limits); err != nil {
+		slog.Error("failed to apply ext client rate limits", "server", server, "error", err)
+	}
+}
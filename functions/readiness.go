@@ -0,0 +1,91 @@
+package functions
+
+import (
+	"sync"
+
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	// daemonReady - the interface, routes and firewall state of the daemon are set up; while the daemon
+	// starts or resets they are being torn down and rebuilt, a peer update or pull applied meanwhile would
+	// configure an interface about to be closed or be overwritten by the initialization, so it is held back
+	daemonReady      bool
+	heldPeerUpdates  = make(map[string]models.HostPeerUpdate)
+	heldPull         bool
+	daemonReadyMutex sync.Mutex
+)
+
+// setDaemonNotReady - holds back the peer updates and pulls until setDaemonReady, while the daemon (re)initializes
+func setDaemonNotReady() {
+	daemonReadyMutex.Lock()
+	defer daemonReadyMutex.Unlock()
+	daemonReady = false
+}
+
+// setDaemonReady - marks the daemon initialized and applies the peer updates and pull held back meanwhile
+func setDaemonReady() {
+	daemonReadyMutex.Lock()
+	held, pull := heldPeerUpdates, heldPull
+	heldPeerUpdates = make(map[string]models.HostPeerUpdate)
+	heldPull = false
+	daemonReady = true
+	daemonReadyMutex.Unlock()
+	for server, update := range held {
+		slog.Info("applying peer update received during startup", "server", server)
+		queuePeerUpdate(server, update)
+	}
+	if pull {
+		slog.Info("pulling as requested during startup")
+		go Pull(true)
+	}
+}
+
+// isDaemonReady - whether the daemon is initialized
+func isDaemonReady() bool {
+	daemonReadyMutex.Lock()
+	defer daemonReadyMutex.Unlock()
+	return daemonReady
+}
+
+// holdPeerUpdate - holds back the peer update if the daemon is not initialized, merged with the
+// updates of the server held before, returns false if the update can be applied
+func holdPeerUpdate(server string, update models.HostPeerUpdate) bool {
+	daemonReadyMutex.Lock()
+	defer daemonReadyMutex.Unlock()
+	if daemonReady {
+		return false
+	}
+	if older, ok := heldPeerUpdates[server]; ok {
+		update = mergePeerUpdates(older, update)
+	}
+	heldPeerUpdates[server] = update
+	slog.Info("daemon is starting, holding back peer update", "server", server)
+	return true
+}
+
+// holdOlderPeerUpdates - holds back peer updates received before the updates held so far, the coalesced
+// updates still pending when the daemon resets
+func holdOlderPeerUpdates(updates map[string]models.HostPeerUpdate) {
+	daemonReadyMutex.Lock()
+	defer daemonReadyMutex.Unlock()
+	for server, update := range updates {
+		if newer, ok := heldPeerUpdates[server]; ok {
+			update = mergePeerUpdates(update, newer)
+		}
+		heldPeerUpdates[server] = update
+	}
+}
+
+// holdPull - holds back a pull requested if the daemon is not initialized, returns false if the pull can run
+func holdPull() bool {
+	daemonReadyMutex.Lock()
+	defer daemonReadyMutex.Unlock()
+	if daemonReady {
+		return false
+	}
+	heldPull = true
+	slog.Info("daemon is starting, holding back pull")
+	return true
+}
@@ -0,0 +1,43 @@
+package functions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+	"github.com/matryer/is"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestHoldPeerUpdates(t *testing.T) {
+	is := is.New(t)
+	t.Cleanup(func() {
+		heldPeerUpdates = make(map[string]models.HostPeerUpdate)
+		pendingPeerUpdates = make(map[string]*pendingPeerUpdate)
+	})
+	removed, _ := wgtypes.GenerateKey()
+	kept, _ := wgtypes.GenerateKey()
+	setDaemonNotReady()
+	t.Run("pending update is held on reset", func(t *testing.T) {
+		pending := &pendingPeerUpdate{
+			update: models.HostPeerUpdate{Peers: []wgtypes.PeerConfig{{PublicKey: removed, Remove: true}}},
+			timer: time.AfterFunc(time.Hour, func() {
+				t.Error("coalesced peer update applied after reset")
+			}),
+		}
+		pendingPeerUpdates["server"] = pending
+		applyPeerUpdate("server", models.HostPeerUpdate{Peers: []wgtypes.PeerConfig{{PublicKey: kept}}})
+		holdPendingPeerUpdates()
+		is.Equal(len(pendingPeerUpdates), 0)
+		is.Equal(pending.timer.Stop(), false) // timer was stopped
+		held := heldPeerUpdates["server"]
+		is.Equal(len(held.Peers), 2)
+		is.Equal(held.Peers[0].PublicKey, kept)
+		is.Equal(held.Peers[1].PublicKey, removed)
+	})
+	t.Run("pull is held until ready", func(t *testing.T) {
+		is.True(holdPull())
+		is.True(heldPull)
+		heldPull = false
+	})
+}
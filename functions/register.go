@@ -22,12 +22,13 @@ import (
 func Register(token string, isGui bool) error {
 	data, err := b64.StdEncoding.DecodeString(token)
 	if err != nil {
-		logger.FatalLog("could not read enrollment token")
+		return fmt.Errorf("could not read enrollment token %w", err)
 	}
 	var serverData models.EnrollmentToken
 	if err = json.Unmarshal(data, &serverData); err != nil {
-		logger.FatalLog("could not read enrollment token")
+		return fmt.Errorf("could not read enrollment token %w", err)
 	}
+	waitForNetwork(serverData.Server)
 	host := config.Netclient()
 	ip, err := getInterfaces()
 	if err != nil {
@@ -46,7 +47,7 @@ func Register(token string, isGui bool) error {
 	}
 	shouldUpdateHost, err := doubleCheck(host, serverData.Server)
 	if err != nil {
-		logger.FatalLog(fmt.Sprintf("error when checking host values - %v", err.Error()))
+		return fmt.Errorf("error when checking host values - %w", err)
 	}
 	if shouldUpdateHost { // get most up to date values before submitting to server
 		host = config.Netclient()
@@ -62,7 +63,7 @@ func Register(token string, isGui bool) error {
 	registerResponse, errData, err := api.GetJSON(models.RegisterResponse{}, models.ErrorResponse{})
 	if err != nil {
 		if errors.Is(err, httpclient.ErrStatus) {
-			logger.FatalLog("error registering with server", strconv.Itoa(errData.Code), errData.Message)
+			return fmt.Errorf("error registering with server %s %s", strconv.Itoa(errData.Code), errData.Message)
 		}
 		return err
 	}
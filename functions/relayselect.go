@@ -0,0 +1,227 @@
+package functions
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netclient/wireguard"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	// relaySelectionInterval - time between measurements of the relays of the relayed peers
+	relaySelectionInterval = time.Minute * 5
+	// relaySwitchGain - fraction of the round trip time through the current relay another relay has to
+	// undercut to take over, so close measurements do not move peers back and forth
+	relaySwitchGain = 0.8
+)
+
+var (
+	// relayPeerIDs - the peers of the last peer update of each server, by server
+	relayPeerIDs = make(map[string]models.PeerMap)
+	// selectedRelays - public key of the relay selected for each relayed address
+	selectedRelays = make(map[string]string)
+	// relayCandidates - public keys of the peers seen relaying, they stay candidates after the
+	// addresses they relayed moved to other relays
+	relayCandidates  = make(map[string]bool)
+	relaySelectMutex sync.Mutex
+)
+
+// setRelayPeers - records the peers of a server to tell the addresses of relayed peers from the own
+// addresses of their relays, and moves the relayed addresses back to the selected relays as the peer
+// update restores the relays designated by the server
+func setRelayPeers(server string, peerIDs models.PeerMap) {
+	relaySelectMutex.Lock()
+	defer relaySelectMutex.Unlock()
+	relayPeerIDs[server] = peerIDs
+	if !config.Netclient().RelaySelection {
+		return
+	}
+	relayed, _, err := relayedAddresses()
+	if err != nil {
+		return
+	}
+	for addr, current := range relayed {
+		if selected, ok := selectedRelays[addr]; ok && selected != current {
+			if err := moveRelayedAddress(addr, selected); err != nil {
+				slog.Warn("failed to restore the selected relay", "address", addr, "relay", selected, "error", err)
+			}
+		}
+	}
+}
+
+// selectRelays - periodically measures the round trip time to each relay peer and moves the relayed
+// peers to the relay with the lowest latency
+func selectRelays(ctx context.Context) error {
+	ticker := time.NewTicker(relaySelectionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		relaySelectMutex.Lock()
+		evaluateRelays(ctx)
+		relaySelectMutex.Unlock()
+	}
+}
+
+// evaluateRelays - measures and selects the relays of the relayed addresses, caller must hold relaySelectMutex;
+// the relays are probed out of band by pinging their own address, which is routed to the relay directly,
+// so the traffic of the relayed peers only moves to the relay selected
+func evaluateRelays(ctx context.Context) {
+	relayed, relays, err := relayedAddresses()
+	if err != nil {
+		slog.Debug("failed to find relayed peers", "error", err)
+		return
+	}
+	if len(relays) < 2 || len(relayed) == 0 {
+		return
+	}
+	rtts := make(map[string]time.Duration)
+	for relay, addr := range relays {
+		if ctx.Err() != nil {
+			return
+		}
+		if rtt, ok := pingRTT(addr); ok {
+			rtts[relay] = rtt
+		} else {
+			slog.Debug("relay did not answer the probe", "relay", relay, "address", addr)
+		}
+	}
+	best := ""
+	for relay, rtt := range rtts {
+		if bestRTT, ok := rtts[best]; !ok || rtt < bestRTT {
+			best = relay
+		}
+	}
+	if best == "" {
+		return
+	}
+	for addr, current := range relayed {
+		selected := best
+		if currentRTT, ok := rtts[current]; ok && float64(rtts[best]) > float64(currentRTT)*relaySwitchGain {
+			selected = current
+		}
+		if selected != current {
+			if err := moveRelayedAddress(addr, selected); err != nil {
+				slog.Warn("failed to select relay", "address", addr, "relay", selected, "error", err)
+				continue
+			}
+			slog.Info("selected lower latency relay", "address", addr, "relay", selected, "rtt", rtts[selected],
+				"previous", current, "previousrtt", rtts[current])
+		}
+		selectedRelays[addr] = selected
+	}
+	for addr := range selectedRelays {
+		if _, ok := relayed[addr]; !ok {
+			delete(selectedRelays, addr)
+		}
+	}
+}
+
+// relayedAddresses - the addresses of peers reached through another peer, with the public key of that
+// relay, and the own address of each relay peer by public key; a host route on a peer is a relayed address
+// when the server announced it as the address of another peer; peers pinned to a direct or lan path are
+// left out, caller must hold relaySelectMutex
+func relayedAddresses() (map[string]string, map[string]string, error) {
+	owners := make(map[string]string)
+	for _, peerIDs := range relayPeerIDs {
+		for key, peer := range peerIDs {
+			if peer.IsExtClient || peer.Address == "" {
+				continue
+			}
+			address, _, _ := strings.Cut(peer.Address, "/")
+			owners[address] = key
+		}
+	}
+	wgclient, err := wgctrl.New()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wgclient.Close()
+	device, err := wgclient.Device(ncutils.GetInterfaceName())
+	if err != nil {
+		return nil, nil, err
+	}
+	relayed := make(map[string]string)
+	ownAddresses := make(map[string]string)
+	for _, peer := range device.Peers {
+		key := peer.PublicKey.String()
+		for _, allowed := range peer.AllowedIPs {
+			if ones, bits := allowed.Mask.Size(); ones != bits {
+				continue
+			}
+			owner, ok := owners[allowed.IP.String()]
+			if !ok {
+				continue
+			}
+			if owner == key {
+				ownAddresses[key] = allowed.IP.String()
+				continue
+			}
+			relayCandidates[key] = true
+			switch config.GetPeerPath(owner) {
+			case config.PeerPathDirect, config.PeerPathLAN:
+				continue
+			}
+			relayed[allowed.IP.String()] = key
+		}
+	}
+	relays := make(map[string]string)
+	for key := range relayCandidates {
+		addr, ok := ownAddresses[key]
+		if !ok {
+			// the relay left the interface, or cannot be probed without its own address
+			delete(relayCandidates, key)
+			continue
+		}
+		relays[key] = addr
+	}
+	return relayed, relays, nil
+}
+
+// moveRelayedAddress - routes a relayed address through the relay, wireguard moves an allowed ip
+// added to a peer away from the peer holding it
+func moveRelayedAddress(addr, relay string) error {
+	key, err := wgtypes.ParseKey(relay)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(addr)
+	mask := net.CIDRMask(32, 32)
+	if ip.To4() == nil {
+		mask = net.CIDRMask(128, 128)
+	}
+	return wireguard.UpdatePeer(&wgtypes.PeerConfig{
+		PublicKey:  key,
+		UpdateOnly: true,
+		AllowedIPs: []net.IPNet{{IP: ip, Mask: mask}},
+	})
+}
+
+// pingRTT - the average round trip time of a few pings to addr
+func pingRTT(addr string) (time.Duration, bool) {
+	pinger, err := ping.NewPinger(addr)
+	if err != nil {
+		return 0, false
+	}
+	pinger.SetPrivileged(true)
+	pinger.Count = 3
+	pinger.Timeout = time.Second * 3
+	if err := pinger.Run(); err != nil {
+		return 0, false
+	}
+	stats := pinger.Statistics()
+	return stats.AvgRtt, stats.PacketsRecv > 0
+}
@@ -0,0 +1,47 @@
+package functions
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+)
+
+// repairRequest - request to repair a network through the local api
+type repairRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// Repair - has the running daemon verify the addresses, routes and sysctls of a network against
+// the desired state and fix the discrepancies without a reconnect, only reports them on dryRun
+func Repair(network string, dryRun bool) ([]wireguard.Discrepancy, error) {
+	return callDaemon[[]wireguard.Discrepancy](http.MethodPost, "/repair/"+network, repairRequest{DryRun: dryRun})
+}
+
+// repairNetwork - verifies and repairs the state of a connected network
+func repairNetwork(network string, dryRun bool) ([]wireguard.Discrepancy, error) {
+	node, ok := config.GetNodes()[network]
+	if !ok {
+		return nil, fmt.Errorf("not joined to network %s", network)
+	}
+	if !node.Connected {
+		return nil, fmt.Errorf("network %s is disconnected", network)
+	}
+	discrepancies, err := wireguard.VerifyNetwork(node, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range discrepancies {
+		if dryRun {
+			continue
+		}
+		if d.Error != "" {
+			slog.Warn("failed to repair", "network", network, "kind", d.Kind, "detail", d.Detail, "error", d.Error)
+			continue
+		}
+		slog.Info("repaired", "network", network, "kind", d.Kind, "detail", d.Detail)
+	}
+	return discrepancies, nil
+}
@@ -0,0 +1,130 @@
+package functions
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	resolvedRuntimeDir = "/run/systemd/resolve"
+	resolvedDest       = "org.freedesktop.resolve1"
+	resolvedPath       = "/org/freedesktop/resolve1"
+	resolvedManager    = "org.freedesktop.resolve1.Manager"
+)
+
+// setLinkDNS - when systemd-resolved is running, points the netmaker interface at the dns servers
+// of the networks with dns enabled and routes only their domains (~<network>) and search domains
+// to it over d-bus, leaving resolv.conf and the dns settings of other links untouched
+func setLinkDNS(ctx context.Context) {
+	if _, err := os.Stat(resolvedRuntimeDir); err != nil {
+		return
+	}
+	if _, err := exec.LookPath("busctl"); err != nil {
+		return
+	}
+	iface, err := net.InterfaceByName(ncutils.GetInterfaceName())
+	if err != nil {
+		slog.Debug("netmaker interface not found, skipping systemd-resolved dns", "error", err)
+		return
+	}
+	servers := map[string]net.IP{}
+	domains := []string{}
+	// domains of the link, routing only domains (~<network>) or search domains
+	routingOnly := map[string]bool{}
+	for _, node := range config.GetNodes() {
+		if !node.DNSOn {
+			continue
+		}
+		server := config.GetServer(node.Server)
+		if server == nil {
+			continue
+		}
+		ip := net.ParseIP(server.CoreDNSAddr)
+		if ip == nil {
+			continue
+		}
+		servers[ip.String()] = ip
+		domains = append(domains, node.Network)
+		if _, ok := routingOnly[node.Network]; !ok {
+			routingOnly[node.Network] = true
+		}
+		// search domains are used for routing too
+		for _, domain := range config.GetSearchDomains(node.Network) {
+			routingOnly[domain] = false
+		}
+	}
+	index := strconv.Itoa(iface.Index)
+	if len(servers) == 0 {
+		if err := busctl(ctx, "RevertLink", "i", index); err != nil {
+			slog.Warn("failed to revert systemd-resolved dns for netmaker interface", "error", err)
+		}
+		return
+	}
+	sort.Strings(domains)
+	dnsArgs := []string{index, strconv.Itoa(len(servers))}
+	for _, ip := range servers {
+		family, addr := "2", ip.To4()
+		if addr == nil {
+			family, addr = "10", ip.To16()
+		}
+		dnsArgs = append(dnsArgs, family, strconv.Itoa(len(addr)))
+		for _, b := range addr {
+			dnsArgs = append(dnsArgs, strconv.Itoa(int(b)))
+		}
+	}
+	linkDomains := make([]string, 0, len(routingOnly))
+	for domain := range routingOnly {
+		linkDomains = append(linkDomains, domain)
+	}
+	sort.Strings(linkDomains)
+	domainArgs := []string{index, strconv.Itoa(len(linkDomains))}
+	for _, domain := range linkDomains {
+		// the netmaker link is not used for queries outside of its domains
+		domainArgs = append(domainArgs, domain, strconv.FormatBool(routingOnly[domain]))
+	}
+	if err := busctl(ctx, "SetLinkDNS", "ia(iay)", dnsArgs...); err != nil {
+		slog.Warn("failed to set systemd-resolved dns for netmaker interface", "error", err)
+		return
+	}
+	if err := busctl(ctx, "SetLinkDomains", "ia(sb)", domainArgs...); err != nil {
+		slog.Warn("failed to set systemd-resolved routing domains for netmaker interface", "error", err)
+		return
+	}
+	security := config.GetDNSSecurity(domains)
+	if security.DNSOverTLS != "" {
+		if err := busctl(ctx, "SetLinkDNSOverTLS", "is", index, security.DNSOverTLS); err != nil {
+			slog.Warn("failed to set systemd-resolved dns over tls for netmaker interface", "error", err)
+		}
+	}
+	if security.DNSSEC != "" {
+		if err := busctl(ctx, "SetLinkDNSSEC", "is", index, security.DNSSEC); err != nil {
+			slog.Warn("failed to set systemd-resolved dnssec for netmaker interface", "error", err)
+		}
+	}
+	if err := busctl(ctx, "SetLinkDefaultRoute", "ib", index, "false"); err != nil {
+		// older versions of systemd-resolved lack the method, routing domains are still honoured
+		slog.Debug("failed to unset systemd-resolved default route for netmaker interface", "error", err)
+	}
+	slog.Info("configured systemd-resolved dns for netmaker interface", "domains", linkDomains)
+}
+
+// busctl - calls a method of the systemd-resolved manager over d-bus
+func busctl(ctx context.Context, method, signature string, args ...string) error {
+	cmdArgs := append([]string{"call", resolvedDest, resolvedPath, resolvedManager, method, signature}, args...)
+	cmd := ncutils.NewCommand("busctl", cmdArgs...)
+	cmd.Timeout = time.Second * 10
+	out, err := ncutils.Exec(ctx, cmd)
+	if err != nil {
+		slog.Debug("busctl call failed", "method", method, "output", out)
+	}
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package functions
+
+import "context"
+
+// setLinkDNS - systemd-resolved is only available on linux
+func setLinkDNS(ctx context.Context) {}
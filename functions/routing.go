@@ -0,0 +1,143 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// RoutingDaemonBird - export mesh routes to bird through a static protocol include file
+	RoutingDaemonBird = "bird"
+	// RoutingDaemonFRR - export mesh routes to frr as static routes through vtysh
+	RoutingDaemonFRR = "frr"
+	// DefaultBirdConfig - default include file for the bird static protocol
+	DefaultBirdConfig = "/etc/bird/netmaker.conf"
+	// frrRouteTag - tag of the static routes added to frr, can be matched in route-maps
+	frrRouteTag = "5210"
+)
+
+var (
+	exportedRoutes []string
+	exportMutex    sync.Mutex
+)
+
+// exportMeshRoutes - exports the mesh network ranges and egress ranges to the configured local routing daemon,
+// the routing daemon's own configuration decides whether they are redistributed (e.g. into bgp)
+func exportMeshRoutes(egressRoutes []models.EgressNetworkRoutes) {
+	daemon := config.Netclient().RoutingDaemon
+	if daemon == "" {
+		return
+	}
+	routes := meshRoutes(egressRoutes)
+	exportMutex.Lock()
+	defer exportMutex.Unlock()
+	if strings.Join(routes, ",") == strings.Join(exportedRoutes, ",") {
+		return
+	}
+	var err error
+	switch daemon {
+	case RoutingDaemonBird:
+		err = exportToBird(routes)
+	case RoutingDaemonFRR:
+		err = exportToFRR(routes, exportedRoutes)
+	default:
+		err = errors.New("unsupported routing daemon " + daemon)
+	}
+	if err != nil {
+		slog.Error("failed to export mesh routes", "routing daemon", daemon, "error", err)
+		return
+	}
+	exportedRoutes = routes
+	slog.Info("exported mesh routes", "routing daemon", daemon, "count", len(routes))
+}
+
+// meshRoutes - returns the sorted prefixes reachable through the netmaker interface
+func meshRoutes(egressRoutes []models.EgressNetworkRoutes) []string {
+	unique := make(map[string]struct{})
+	for _, node := range config.GetNodes() {
+		for _, network := range []net.IPNet{node.NetworkRange, node.NetworkRange6} {
+			if network.IP != nil {
+				unique[network.String()] = struct{}{}
+			}
+		}
+	}
+	for _, egress := range egressRoutes {
+		for _, egressRange := range egress.EgressRanges {
+			network := config.ToIPNet(egressRange)
+			if network.IP == nil || network.String() == "0.0.0.0/0" || network.String() == "::/0" {
+				continue
+			}
+			unique[network.String()] = struct{}{}
+		}
+	}
+	routes := []string{}
+	for route := range unique {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func exportToBird(routes []string) error {
+	path := config.Netclient().RoutingDaemonConfig
+	if path == "" {
+		path = DefaultBirdConfig
+	}
+	iface := ncutils.GetInterfaceName()
+	v4, v6 := strings.Builder{}, strings.Builder{}
+	for _, route := range routes {
+		if strings.Contains(route, ":") {
+			fmt.Fprintf(&v6, "\troute %s via \"%s\";\n", route, iface)
+		} else {
+			fmt.Fprintf(&v4, "\troute %s via \"%s\";\n", route, iface)
+		}
+	}
+	content := "# generated by netclient, do not edit\n" +
+		"protocol static netmaker4 {\n\tipv4;\n" + v4.String() + "}\n" +
+		"protocol static netmaker6 {\n\tipv6;\n" + v6.String() + "}\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return err
+	}
+	if out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("birdc", "configure")); err != nil {
+		return fmt.Errorf("birdc configure: %w %s", err, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+func exportToFRR(routes, previous []string) error {
+	iface := ncutils.GetInterfaceName()
+	args := []string{"-c", "configure terminal"}
+	current := make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		current[route] = struct{}{}
+		args = append(args, "-c", frrRouteCommand("", route, iface))
+	}
+	for _, route := range previous {
+		if _, ok := current[route]; !ok {
+			args = append(args, "-c", frrRouteCommand("no ", route, iface))
+		}
+	}
+	if out, err := ncutils.Exec(context.Background(), ncutils.NewCommand("vtysh", args...)); err != nil {
+		return fmt.Errorf("vtysh: %w %s", err, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+func frrRouteCommand(prefix, route, iface string) string {
+	family := "ip"
+	if strings.Contains(route, ":") {
+		family = "ipv6"
+	}
+	return fmt.Sprintf("%s%s route %s %s tag %s", prefix, family, route, iface, frrRouteTag)
+}
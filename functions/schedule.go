@@ -0,0 +1,153 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// accessScheduleRecheck - upper bound between evaluations of the access schedules, timers do not
+// follow clock changes and suspends
+const accessScheduleRecheck = time.Minute * 15
+
+// accessSchedulesChanged - wakes up the enforcement of the access schedules after a change
+var accessSchedulesChanged = make(chan struct{}, 1)
+
+// SetAccessSchedule - adds an access schedule in the running daemon
+func SetAccessSchedule(schedule config.AccessSchedule) error {
+	_, err := callDaemon[any](http.MethodPost, "/peers/schedule", schedule)
+	return err
+}
+
+// RemoveAccessSchedules - removes the access schedules of a peer in the running daemon
+func RemoveAccessSchedules(pubKey string) error {
+	_, err := callDaemon[any](http.MethodDelete, "/peers/schedule", peerBlockRequest{PublicKey: pubKey})
+	return err
+}
+
+// addAccessSchedule - adds a window to the access schedules of a peer
+func addAccessSchedule(schedule config.AccessSchedule) error {
+	key, err := wgtypes.ParseKey(schedule.Peer)
+	if err != nil {
+		return errors.New("invalid public key " + schedule.Peer)
+	}
+	schedule.Peer = key.String()
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	host := config.Netclient()
+	host.AccessSchedules = append(host.AccessSchedules, schedule)
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		return err
+	}
+	slog.Info("added access schedule", "peer", schedule.Peer, "days", schedule.Days, "start", schedule.Start, "end", schedule.End)
+	notifyAccessSchedules()
+	return nil
+}
+
+// removeAccessSchedules - removes all access schedules of a peer, the peer is allowed at all times again
+func removeAccessSchedules(pubKey string) error {
+	key, err := wgtypes.ParseKey(pubKey)
+	if err != nil {
+		return errors.New("invalid public key " + pubKey)
+	}
+	host := config.Netclient()
+	schedules := []config.AccessSchedule{}
+	for _, schedule := range host.AccessSchedules {
+		if schedule.Peer != key.String() {
+			schedules = append(schedules, schedule)
+		}
+	}
+	if len(schedules) == len(host.AccessSchedules) {
+		return errors.New("peer has no access schedules")
+	}
+	host.AccessSchedules = schedules
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		return err
+	}
+	slog.Info("removed access schedules", "peer", key.String())
+	notifyAccessSchedules()
+	return nil
+}
+
+func notifyAccessSchedules() {
+	select {
+	case accessSchedulesChanged <- struct{}{}:
+	default:
+	}
+}
+
+// scheduledOutPeers - returns the sorted public keys of the peers outside of their access schedules at t
+func scheduledOutPeers(t time.Time) []string {
+	seen := make(map[string]bool)
+	peers := []string{}
+	for _, schedule := range config.Netclient().AccessSchedules {
+		if seen[schedule.Peer] {
+			continue
+		}
+		seen[schedule.Peer] = true
+		if config.IsScheduledOut(schedule.Peer, t) {
+			peers = append(peers, schedule.Peer)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// nextScheduleCheck - returns the time until the next window of the access schedules starts or ends
+func nextScheduleCheck() time.Duration {
+	next := config.NextScheduleChange(time.Now())
+	if next.IsZero() {
+		return accessScheduleRecheck
+	}
+	if wait := time.Until(next); wait < accessScheduleRecheck {
+		return wait
+	}
+	return accessScheduleRecheck
+}
+
+// enforceAccessSchedules - removes peers from the interface and blocks them when they leave the windows
+// of their access schedules and restores them when they enter one, the peers denied at startup are
+// already excluded by the initial peer configuration of the daemon
+func enforceAccessSchedules(ctx context.Context) error {
+	for _, schedule := range config.Netclient().AccessSchedules {
+		if err := schedule.Validate(); err != nil {
+			slog.Warn("invalid access schedule, the peer is blocked", "peer", schedule.Peer, "error", err)
+		}
+	}
+	denied := strings.Join(scheduledOutPeers(time.Now()), ",")
+	timer := time.NewTimer(nextScheduleCheck())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		case <-accessSchedulesChanged:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+		if current := strings.Join(scheduledOutPeers(time.Now()), ","); current != denied {
+			denied = current
+			slog.Info("access schedules changed, updating peers", "denied", denied)
+			if err := wireguard.SetPeers(false); err != nil {
+				slog.Error("failed to update peers for access schedules", "error", err)
+			}
+			if err := applyPeerBlocks(); err != nil {
+				slog.Error("failed to update firewall for access schedules", "error", err)
+			}
+		}
+		timer.Reset(nextScheduleCheck())
+	}
+}
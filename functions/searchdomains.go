@@ -0,0 +1,77 @@
+package functions
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/gravitl/netclient/config"
+	"golang.org/x/exp/slog"
+)
+
+// searchDomainsUpdate - dns search domains servers supporting them add to the peer update, keyed by network
+type searchDomainsUpdate struct {
+	SearchDomains map[string][]string `json:"dns_search_domains"`
+}
+
+// updateSearchDomains - stores the search domains the server pushed for its networks and reapplies the
+// dns of the interface if they changed, updates without search domains leave them untouched
+func updateSearchDomains(server string, data []byte) {
+	var update searchDomainsUpdate
+	if err := json.Unmarshal(data, &update); err != nil || update.SearchDomains == nil {
+		return
+	}
+	host := config.Netclient()
+	domains := make(map[string][]string, len(host.ServerSearchDomains))
+	for network, networkDomains := range host.ServerSearchDomains {
+		domains[network] = networkDomains
+	}
+	for network, node := range config.GetNodes() {
+		if node.Server != server {
+			continue
+		}
+		delete(domains, network)
+		if networkDomains := update.SearchDomains[network]; len(networkDomains) > 0 {
+			domains[network] = networkDomains
+		}
+	}
+	if reflect.DeepEqual(domains, host.ServerSearchDomains) || (len(domains) == 0 && len(host.ServerSearchDomains) == 0) {
+		return
+	}
+	if refusedInLockdown(server, "change dns search domains") {
+		return
+	}
+	host.ServerSearchDomains = domains
+	config.UpdateNetclient(*host)
+	if err := config.WriteNetclientConfig(); err != nil {
+		slog.Error("failed to save dns search domains", "server", server, "error", err)
+	}
+	slog.Info("dns search domains updated", "server", server, "domains", update.SearchDomains)
+	ctx, cancel := applyContext()
+	defer cancel()
+	setLinkDNS(ctx)
+}
+
+// removeSearchDomains - removes the search domains of a network the host left
+func removeSearchDomains(network string) {
+	host := config.Netclient()
+	_, local := host.SearchDomains[network]
+	_, pushed := host.ServerSearchDomains[network]
+	if !local && !pushed {
+		return
+	}
+	searchDomains := make(map[string][]string, len(host.SearchDomains))
+	for n, domains := range host.SearchDomains {
+		if n != network {
+			searchDomains[n] = domains
+		}
+	}
+	serverSearchDomains := make(map[string][]string, len(host.ServerSearchDomains))
+	for n, domains := range host.ServerSearchDomains {
+		if n != network {
+			serverSearchDomains[n] = domains
+		}
+	}
+	host.SearchDomains = searchDomains
+	host.ServerSearchDomains = serverSearchDomains
+	config.UpdateNetclient(*host)
+}
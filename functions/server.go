@@ -36,6 +36,24 @@ func SwitchServer(server string) error {
 	return daemon.Restart()
 }
 
+// SetCheckin - sets the checkin interval and jitter (seconds) of a server and reloads the daemon
+func SetCheckin(name string, interval, jitter int) error {
+	server := config.GetServer(name)
+	if server == nil {
+		return errors.New("server config not found")
+	}
+	if interval < 0 {
+		return errors.New("checkin interval can not be negative")
+	}
+	server.CheckinInterval = interval
+	server.CheckinJitter = jitter
+	config.UpdateServer(name, *server)
+	if err := config.WriteServerConfig(); err != nil {
+		return err
+	}
+	return daemon.Restart()
+}
+
 // ListServers - lists all registered servers
 func ListServers() error {
 	fmt.Print("registered servers:\n\n")
@@ -0,0 +1,49 @@
+package functions
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+)
+
+// serverGroupPrefix - prefix of the supervised group names of server connections
+const serverGroupPrefix = "server:"
+
+// ServerGroupStatus - state of the goroutines serving the connection to a server
+type ServerGroupStatus struct {
+	Server    string                   `json:"server"`
+	Members   map[string]*MemberStatus `json:"members"`
+	UpdatedAt time.Time                `json:"updated_at"`
+}
+
+// startServerGroup - starts the goroutines serving a server connection (mqtt, checkin, fallback pull)
+// as a supervised group of their own, so a failing server does not affect the goroutines of other servers
+func startServerGroup(ctx context.Context, wg *sync.WaitGroup, server *config.Server) {
+	startGroup(ctx, wg, serverGroupPrefix+server.Name, map[string]func(context.Context) error{
+		"mqtt": func(ctx context.Context) error {
+			return messageQueue(ctx, server)
+		},
+		"checkin":  withWaitGroup(Checkin),
+		"fallback": withWaitGroup(mqFallback),
+	})
+}
+
+// GetServerGroups - returns the state of the server groups, keyed by server name as before the
+// supervisor also ran the daemon subsystems
+func GetServerGroups() []ServerGroupStatus {
+	groups := []ServerGroupStatus{}
+	for _, group := range GetSupervisedGroups() {
+		if !strings.HasPrefix(group.Name, serverGroupPrefix) {
+			continue
+		}
+		groups = append(groups, ServerGroupStatus{
+			Server:    strings.TrimPrefix(group.Name, serverGroupPrefix),
+			Members:   group.Members,
+			UpdatedAt: group.UpdatedAt,
+		})
+	}
+	return groups
+}
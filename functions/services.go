@@ -0,0 +1,198 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gravitl/netclient/config"
+	"golang.org/x/exp/slog"
+)
+
+// serviceTopic - retained topic of the services a host advertises in a network: services/<server>/<network>/<hostid>
+const serviceTopic = "services/%s/%s/%s"
+
+// serviceAdvertisement - services advertised by a host in a network, published retained and unencrypted as
+// it is read by all hosts of the network, the advertisement only refers to the mesh addresses of its
+// sender: addresses are resolved from the peer holding the public key, not taken from the message
+type serviceAdvertisement struct {
+	HostName  string           `json:"host_name"`
+	PublicKey string           `json:"public_key"`
+	Services  []config.Service `json:"services"`
+	Updated   time.Time        `json:"updated"`
+}
+
+// DiscoveredService - a service advertised in a network with the mesh addresses of its host
+type DiscoveredService struct {
+	config.Service
+	Network   string    `json:"network"`
+	Host      string    `json:"host"`
+	PublicKey string    `json:"public_key"`
+	Addresses []string  `json:"addresses"`
+	Updated   time.Time `json:"updated"`
+}
+
+var (
+	// serviceRegistry - advertisements received, keyed by network and host id
+	serviceRegistry = make(map[string]map[string]serviceAdvertisement)
+	serviceMutex    sync.Mutex
+)
+
+// ListServices - returns the services known to the running daemon
+func ListServices() ([]DiscoveredService, error) {
+	return callDaemon[[]DiscoveredService](http.MethodGet, "/services", nil)
+}
+
+// setServiceSubscription - subscribes to the service advertisements of the node's network and
+// advertises the services of this host in it
+func setServiceSubscription(client mqtt.Client, node *config.Node) {
+	topic := fmt.Sprintf(serviceTopic, node.Server, node.Network, "+")
+	if token := client.Subscribe(topic, 0, mqtt.MessageHandler(ServiceAdvertisement)); token.WaitTimeout(MQ_TIMEOUT*time.Second) && token.Error() != nil {
+		slog.Error("unable to subscribe to service advertisements", "network", node.Network, "error", token.Error())
+		return
+	}
+	if err := publishServices(client, node); err != nil {
+		slog.Error("failed to advertise services", "network", node.Network, "error", err)
+	}
+}
+
+// unsubscribeServices - stops receiving the service advertisements of the node's network and
+// withdraws the services of this host from it
+func unsubscribeServices(client mqtt.Client, node *config.Node) {
+	client.Publish(fmt.Sprintf(serviceTopic, node.Server, node.Network, config.Netclient().ID.String()), 1, true, []byte{})
+	if token := client.Unsubscribe(fmt.Sprintf(serviceTopic, node.Server, node.Network, "+")); token.WaitTimeout(MQ_TIMEOUT*time.Second) && token.Error() != nil {
+		slog.Error("unable to unsubscribe from service advertisements", "network", node.Network, "error", token.Error())
+	}
+	serviceMutex.Lock()
+	delete(serviceRegistry, node.Network)
+	serviceMutex.Unlock()
+}
+
+// publishServices - publishes the retained advertisement of the services of this host in the node's network,
+// an empty message withdraws a previous advertisement
+func publishServices(client mqtt.Client, node *config.Node) error {
+	host := config.Netclient()
+	payload := []byte{}
+	if len(host.Services) > 0 {
+		var err error
+		payload, err = json.Marshal(serviceAdvertisement{
+			HostName:  host.Name,
+			PublicKey: host.PublicKey.String(),
+			Services:  host.Services,
+			Updated:   time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	token := client.Publish(fmt.Sprintf(serviceTopic, node.Server, node.Network, host.ID.String()), 1, true, payload)
+	if !token.WaitTimeout(MQ_TIMEOUT * time.Second) {
+		return fmt.Errorf("connection timeout")
+	}
+	return token.Error()
+}
+
+// ServiceAdvertisement - mq handler for service advertisements services/<server>/<network>/<hostid>
+func ServiceAdvertisement(client mqtt.Client, msg mqtt.Message) {
+	defer RecoverCrash()
+	parts := strings.Split(msg.Topic(), "/")
+	if len(parts) != 4 {
+		return
+	}
+	network, hostID := parts[2], parts[3]
+	serviceMutex.Lock()
+	defer serviceMutex.Unlock()
+	if len(msg.Payload()) == 0 {
+		delete(serviceRegistry[network], hostID)
+		return
+	}
+	var ad serviceAdvertisement
+	if err := json.Unmarshal(msg.Payload(), &ad); err != nil {
+		slog.Warn("invalid service advertisement", "topic", msg.Topic(), "error", err)
+		return
+	}
+	if serviceRegistry[network] == nil {
+		serviceRegistry[network] = make(map[string]serviceAdvertisement)
+	}
+	serviceRegistry[network][hostID] = ad
+	slog.Debug("received service advertisement", "network", network, "host", ad.HostName, "services", len(ad.Services))
+}
+
+// GetServices - returns the services advertised in the networks of this host, services of hosts that are
+// not peers (anymore) are left out
+func GetServices() []DiscoveredService {
+	serviceMutex.Lock()
+	defer serviceMutex.Unlock()
+	services := []DiscoveredService{}
+	for network, ads := range serviceRegistry {
+		node := config.GetNode(network)
+		for _, ad := range ads {
+			addrs := serviceAddresses(node, ad.PublicKey)
+			if len(addrs) == 0 {
+				continue
+			}
+			for _, service := range ad.Services {
+				service.Protocol = service.GetProtocol()
+				services = append(services, DiscoveredService{
+					Service:   service,
+					Network:   network,
+					Host:      ad.HostName,
+					PublicKey: ad.PublicKey,
+					Addresses: addrs,
+					Updated:   ad.Updated,
+				})
+			}
+		}
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Network != services[j].Network {
+			return services[i].Network < services[j].Network
+		}
+		if services[i].Name != services[j].Name {
+			return services[i].Name < services[j].Name
+		}
+		return services[i].Host < services[j].Host
+	})
+	return services
+}
+
+// serviceAddresses - mesh addresses in the node's network of this host or the peer with the public key
+func serviceAddresses(node config.Node, pubKey string) []string {
+	addrs := []string{}
+	if pubKey == config.Netclient().PublicKey.String() {
+		for _, addr := range []net.IPNet{node.Address, node.Address6} {
+			if addr.IP != nil {
+				addrs = append(addrs, addr.IP.String())
+			}
+		}
+		return addrs
+	}
+	for _, peer := range config.Netclient().HostPeers {
+		if peer.Remove || peer.PublicKey.String() != pubKey {
+			continue
+		}
+		for _, allowed := range peer.AllowedIPs {
+			ones, bits := allowed.Mask.Size()
+			if ones != bits {
+				// egress ranges routed by the peer, not its own address
+				continue
+			}
+			if node.NetworkRange.Contains(allowed.IP) || node.NetworkRange6.Contains(allowed.IP) {
+				addrs = append(addrs, allowed.IP.String())
+			}
+		}
+	}
+	return addrs
+}
+
+// Endpoint - returns the endpoint of the service at one of its addresses as host:port
+func (s DiscoveredService) Endpoint(addr string) string {
+	return net.JoinHostPort(addr, strconv.Itoa(s.Port))
+}
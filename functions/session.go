@@ -0,0 +1,59 @@
+package functions
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/daemon"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	resumeTimer *time.Timer
+	resumeMutex sync.Mutex
+)
+
+// scheduleSessionResume - keeps the current NAT/session state for the configured grace period
+// after the broker connection is lost; the daemon is only restarted (which re-punches the
+// wireguard port and renegotiates endpoints) if the connection has not come back by then
+func scheduleSessionResume(server *config.Server) {
+	grace := config.GetSessionGracePeriod()
+	if grace == 0 {
+		if err := daemon.Restart(); err != nil {
+			slog.Error("failed to restart daemon", "error", err)
+		}
+		return
+	}
+	resumeMutex.Lock()
+	defer resumeMutex.Unlock()
+	if resumeTimer != nil {
+		// a resume is already pending for this outage
+		return
+	}
+	slog.Info("keeping session state while waiting for broker", "server", server.Name, "grace period", grace.String())
+	resumeTimer = time.AfterFunc(grace, func() {
+		resumeMutex.Lock()
+		resumeTimer = nil
+		resumeMutex.Unlock()
+		if Mqclient != nil && Mqclient.IsConnectionOpen() {
+			return
+		}
+		slog.Warn("broker connection not resumed within grace period, restarting daemon", "server", server.Name)
+		if err := daemon.Restart(); err != nil {
+			slog.Error("failed to restart daemon", "error", err)
+		}
+	})
+}
+
+// cancelSessionResume - stops a pending session resume, called when the broker connection is back
+func cancelSessionResume() {
+	resumeMutex.Lock()
+	defer resumeMutex.Unlock()
+	if resumeTimer == nil {
+		return
+	}
+	resumeTimer.Stop()
+	resumeTimer = nil
+	slog.Info("broker connection resumed within grace period, keeping session state")
+}
@@ -0,0 +1,227 @@
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/firewall"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// StateVersion - version of the state file schema, incremented on incompatible changes
+	StateVersion = 2
+	// StateFile - name of the state file in the netclient path
+	StateFile = "state.json"
+)
+
+// DaemonState - snapshot of the applied state written after each apply, for monitoring
+// and for the cli when the daemon is down
+type DaemonState struct {
+	Version   int                    `json:"version"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	Host      StateHost              `json:"host"`
+	Networks  []StateNetwork         `json:"networks"`
+	Peers     []StatePeer            `json:"peers"`
+	Rules     []firewall.ManagedRule `json:"rules"`
+	LastApply ApplyStatus            `json:"last_apply"`
+}
+
+// StateHost - the host in the state file
+type StateHost struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Interface  string `json:"interface"`
+	ListenPort int    `json:"listen_port"`
+	Server     string `json:"server"`
+}
+
+// StateNetwork - a network of the host in the state file
+type StateNetwork struct {
+	Network   string `json:"network"`
+	Server    string `json:"server"`
+	NodeID    string `json:"node_id"`
+	Connected bool   `json:"connected"`
+	Address   string `json:"address,omitempty"`
+	Address6  string `json:"address6,omitempty"`
+}
+
+// StatePeer - a configured peer in the state file
+type StatePeer struct {
+	PublicKey  string   `json:"public_key"`
+	Endpoint   string   `json:"endpoint,omitempty"`
+	AllowedIPs []string `json:"allowed_ips"`
+}
+
+// ApplyStatus - result of the last apply of a server update
+type ApplyStatus struct {
+	Server  string    `json:"server"`
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+var stateMutex sync.Mutex
+
+// StatePath - returns the path of the state file
+func StatePath() string {
+	return filepath.Join(config.GetNetclientPath(), StateFile)
+}
+
+// writeState - records the result of an apply and atomically replaces the state file
+func writeState(server string, applyErr error) {
+	status := ApplyStatus{Server: server, Time: time.Now(), Success: applyErr == nil}
+	if applyErr != nil {
+		status.Error = applyErr.Error()
+	}
+	state := currentState(status)
+	if err := state.Validate(); err != nil {
+		slog.Error("not writing invalid state file", "error", err)
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		slog.Error("failed to encode state file", "error", err)
+		return
+	}
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if err := writeFileAtomic(StatePath(), data, 0644); err != nil {
+		slog.Error("failed to write state file", "error", err)
+	}
+}
+
+func currentState(status ApplyStatus) DaemonState {
+	host := config.Netclient()
+	state := DaemonState{
+		Version:   StateVersion,
+		UpdatedAt: time.Now(),
+		Host: StateHost{
+			ID:         host.ID.String(),
+			Name:       host.Name,
+			Interface:  host.Interface,
+			ListenPort: host.ListenPort,
+			Server:     config.CurrServer,
+		},
+		Networks:  []StateNetwork{},
+		Peers:     []StatePeer{},
+		Rules:     []firewall.ManagedRule{},
+		LastApply: status,
+	}
+	if rules, err := firewall.ListRules(nil); err == nil {
+		state.Rules = rules
+	}
+	for _, node := range config.GetNodes() {
+		network := StateNetwork{
+			Network:   node.Network,
+			Server:    node.Server,
+			NodeID:    node.ID.String(),
+			Connected: node.Connected,
+		}
+		if node.Address.IP != nil {
+			network.Address = node.Address.String()
+		}
+		if node.Address6.IP != nil {
+			network.Address6 = node.Address6.String()
+		}
+		state.Networks = append(state.Networks, network)
+	}
+	sort.Slice(state.Networks, func(i, j int) bool {
+		return state.Networks[i].Network < state.Networks[j].Network
+	})
+	for _, peer := range host.HostPeers {
+		if peer.Remove {
+			continue
+		}
+		statePeer := StatePeer{PublicKey: peer.PublicKey.String(), AllowedIPs: []string{}}
+		if peer.Endpoint != nil {
+			statePeer.Endpoint = peer.Endpoint.String()
+		}
+		for _, ip := range peer.AllowedIPs {
+			statePeer.AllowedIPs = append(statePeer.AllowedIPs, ip.String())
+		}
+		state.Peers = append(state.Peers, statePeer)
+	}
+	sort.Slice(state.Peers, func(i, j int) bool {
+		return state.Peers[i].PublicKey < state.Peers[j].PublicKey
+	})
+	return state
+}
+
+// Validate - checks the state against the schema of StateVersion
+func (s *DaemonState) Validate() error {
+	if s.Version != StateVersion {
+		return fmt.Errorf("unsupported state version %d, expected %d", s.Version, StateVersion)
+	}
+	if s.UpdatedAt.IsZero() {
+		return errors.New("state is missing updated_at")
+	}
+	if s.Host.ID == "" {
+		return errors.New("state is missing the host id")
+	}
+	if s.Networks == nil || s.Peers == nil || s.Rules == nil {
+		return errors.New("state is missing networks, peers or rules")
+	}
+	for _, network := range s.Networks {
+		if network.Network == "" || network.Server == "" {
+			return errors.New("state has a network without name or server")
+		}
+	}
+	for _, peer := range s.Peers {
+		if peer.PublicKey == "" {
+			return errors.New("state has a peer without public key")
+		}
+	}
+	if s.LastApply.Time.IsZero() || (!s.LastApply.Success && s.LastApply.Error == "") {
+		return errors.New("state has an invalid last apply status")
+	}
+	return nil
+}
+
+// ReadState - reads and validates the state file written by the daemon
+func ReadState() (*DaemonState, error) {
+	data, err := os.ReadFile(StatePath())
+	if err != nil {
+		return nil, err
+	}
+	var state DaemonState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid state file %w", err)
+	}
+	if err := state.Validate(); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// writeFileAtomic - writes to a temp file in the same directory and renames it over path,
+// so readers never see a partial file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
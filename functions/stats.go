@@ -0,0 +1,34 @@
+package functions
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/metrics"
+	"golang.org/x/exp/slog"
+)
+
+// StatsInterval - interval at which interface statistics are exported
+const StatsInterval = time.Second * 30
+
+// exportStats - periodically writes interface statistics to the configured stats file
+func exportStats(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	path := config.Netclient().StatsFile
+	slog.Info("exporting interface statistics", "file", path)
+	ticker := time.NewTicker(StatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("stats export routine closed")
+			return
+		case <-ticker.C:
+			if err := metrics.WriteTextfile(path); err != nil {
+				slog.Debug("failed to export interface statistics", "error", err)
+			}
+		}
+	}
+}
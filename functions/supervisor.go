@@ -0,0 +1,165 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	minRestartBackoff = time.Second * 5
+	maxRestartBackoff = time.Minute * 5
+	// daemonGroup - group of the daemon subsystems not bound to a server
+	daemonGroup = "daemon"
+)
+
+// GroupStatus - state of a group of supervised goroutines
+type GroupStatus struct {
+	Name      string                   `json:"name"`
+	Members   map[string]*MemberStatus `json:"members"`
+	UpdatedAt time.Time                `json:"updated_at"`
+}
+
+// MemberStatus - state of a supervised goroutine
+type MemberStatus struct {
+	Running     bool      `json:"running"`
+	Restarts    int       `json:"restarts"`
+	Panics      int       `json:"panics"`
+	Backoff     string    `json:"backoff,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastRestart time.Time `json:"last_restart,omitempty"`
+}
+
+var (
+	supervisedGroups = make(map[string]*GroupStatus)
+	supervisorMutex  sync.Mutex
+)
+
+// startGroup - starts and supervises a group of goroutines until the context is cancelled,
+// a member that panics or stops early is restarted with backoff while the others keep running
+func startGroup(ctx context.Context, wg *sync.WaitGroup, group string, members map[string]func(context.Context) error) {
+	supervisorMutex.Lock()
+	supervisedGroups[group] = &GroupStatus{
+		Name:      group,
+		Members:   make(map[string]*MemberStatus),
+		UpdatedAt: time.Now(),
+	}
+	supervisorMutex.Unlock()
+	for name, run := range members {
+		wg.Add(1)
+		go supervise(ctx, wg, group, name, run)
+	}
+}
+
+// withWaitGroup - adapts a daemon goroutine to a supervised member
+func withWaitGroup(f func(context.Context, *sync.WaitGroup)) func(context.Context) error {
+	return func(ctx context.Context) error {
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		f(ctx, &wg)
+		return nil
+	}
+}
+
+// supervise - runs a member until the context is cancelled
+func supervise(ctx context.Context, wg *sync.WaitGroup, group, name string, run func(context.Context) error) {
+	defer wg.Done()
+	backoff := minRestartBackoff
+	for {
+		setMemberStatus(group, name, func(m *MemberStatus) {
+			m.Running = true
+			m.Backoff = ""
+		})
+		started := time.Now()
+		panicked, err := runRecovered(ctx, run)
+		if ctx.Err() != nil {
+			setMemberStatus(group, name, func(m *MemberStatus) {
+				m.Running = false
+			})
+			return
+		}
+		if err == nil {
+			err = errors.New("stopped unexpectedly")
+		}
+		if time.Since(started) > maxRestartBackoff {
+			backoff = minRestartBackoff
+		}
+		slog.Warn("supervised goroutine stopped, restarting", "group", group, "goroutine", name, "backoff", backoff, "error", err)
+		setMemberStatus(group, name, func(m *MemberStatus) {
+			m.Running = false
+			m.Restarts++
+			if panicked {
+				m.Panics++
+			}
+			m.Backoff = backoff.String()
+			m.LastError = err.Error()
+			m.LastRestart = time.Now()
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+// runRecovered - runs a member, turning a panic into an error after reporting the crash
+func runRecovered(ctx context.Context, run func(context.Context) error) (panicked bool, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(crashReported); !ok {
+			reportCrash(r)
+		}
+		panicked, err = true, fmt.Errorf("panic: %v", r)
+	}()
+	return false, run(ctx)
+}
+
+func setMemberStatus(group, name string, update func(*MemberStatus)) {
+	supervisorMutex.Lock()
+	defer supervisorMutex.Unlock()
+	status, ok := supervisedGroups[group]
+	if !ok {
+		return
+	}
+	member, ok := status.Members[name]
+	if !ok {
+		member = &MemberStatus{}
+		status.Members[name] = member
+	}
+	update(member)
+	status.UpdatedAt = time.Now()
+}
+
+// GetSupervisedGroups - returns the state of the supervised goroutine groups, sorted by name
+func GetSupervisedGroups() []GroupStatus {
+	supervisorMutex.Lock()
+	defer supervisorMutex.Unlock()
+	groups := []GroupStatus{}
+	for _, group := range supervisedGroups {
+		status := GroupStatus{
+			Name:      group.Name,
+			Members:   make(map[string]*MemberStatus, len(group.Members)),
+			UpdatedAt: group.UpdatedAt,
+		}
+		for name, member := range group.Members {
+			member := *member
+			status.Members[name] = &member
+		}
+		groups = append(groups, status)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
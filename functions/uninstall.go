@@ -11,6 +11,7 @@ import (
 	"github.com/gravitl/netclient/auth"
 	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netclient/daemon"
+	"github.com/gravitl/netclient/firewall"
 	"github.com/gravitl/netclient/wireguard"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
@@ -59,22 +60,16 @@ func LeaveNetwork(network string, isDaemon bool) ([]error, error) {
 	if err := deleteNodeFromServer(&node); err != nil {
 		faults = append(faults, fmt.Errorf("error deleting nodes from server %w", err))
 	}
+	// the rules of the gateways of the other networks of the server stay in place
+	firewall.FlushNetworkRules(node.Server, node.Network)
 	// remove node from config
 	if err := deleteLocalNetwork(&node); err != nil {
 		faults = append(faults, fmt.Errorf("error deleting wireguard interface %w", err))
 	}
 	// re-configure interface if daemon is calling leave
 	if isDaemon {
-		nc := wireguard.GetInterface()
-		nc.Close()
-		nc = wireguard.NewNCIface(config.Netclient(), config.GetNodes())
-		nc.Create()
-		if err := nc.Configure(); err != nil {
-			faults = append(faults, fmt.Errorf("failed to configure interface during node removal - %v", err.Error()))
-		} else {
-			if err = wireguard.SetPeers(true); err != nil {
-				faults = append(faults, fmt.Errorf("issue setting peers after node removal - %v", err.Error()))
-			}
+		if err := recreateInterface(); err != nil {
+			faults = append(faults, err)
 		}
 	} else { // was called from CLI so restart daemon
 		if err := daemon.Restart(); err != nil {
@@ -88,6 +83,25 @@ func LeaveNetwork(network string, isDaemon bool) ([]error, error) {
 	return faults, nil
 }
 
+// recreateInterface - recreates the netmaker interface for the remaining networks after a node removal
+func recreateInterface() error {
+	nc := wireguard.GetInterface()
+	nc.Close()
+	nc = wireguard.NewNCIface(config.Netclient(), config.GetNodes())
+	nc.Create()
+	if err := nc.Configure(); err != nil {
+		return fmt.Errorf("failed to configure interface during node removal - %v", err.Error())
+	}
+	// the interface was recreated, restore the dns of the remaining networks
+	dnsCtx, cancel := applyContext()
+	setLinkDNS(dnsCtx)
+	cancel()
+	if err := wireguard.SetPeers(true); err != nil {
+		return fmt.Errorf("issue setting peers after node removal - %v", err.Error())
+	}
+	return nil
+}
+
 func deleteNodeFromServer(node *config.Node) error {
 	server := config.GetServer(node.Server)
 	if server == nil {
@@ -131,6 +145,7 @@ func deleteLocalNetwork(node *config.Node) error {
 	}
 	//remove node from nodes map
 	config.DeleteNode(node.Network)
+	removeSearchDomains(node.Network)
 	server := config.GetServer(node.Server)
 	if server != nil {
 		//remove node from server node map
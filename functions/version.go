@@ -11,6 +11,11 @@ const MinVersion = "v0.18.0"
 
 // IsVersionCompatible checks that the version passed is compabtible (>=) with MinVersion
 func IsVersionComptatible(ver string) bool {
+	return isVersionAtLeast(ver, MinVersion)
+}
+
+// isVersionAtLeast - checks the version passed is the minimum version or newer
+func isVersionAtLeast(ver, min string) bool {
 	// during development, assume developers know what they are doing
 	if ver == "dev" {
 		return true
@@ -22,7 +27,7 @@ func IsVersionComptatible(ver string) bool {
 	if err != nil {
 		return false
 	}
-	constraint, err := version.NewConstraint(">= " + MinVersion)
+	constraint, err := version.NewConstraint(">= " + min)
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,143 @@
+package functions
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netclient/wireguard"
+	"golang.org/x/exp/slog"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// DefaultWarmTimeout - time to wait for the connection to a peer to come up when priming it
+const DefaultWarmTimeout = time.Second * 10
+
+// warmRequest - request to prime the connections to a peer or the peers of a network through the local api
+type warmRequest struct {
+	Target  string `json:"target"`
+	Timeout int    `json:"timeout"`
+}
+
+// WarmedPeer - outcome of priming the connection to a peer
+type WarmedPeer struct {
+	PublicKey string        `json:"public_key"`
+	Address   string        `json:"address"`
+	Endpoint  string        `json:"endpoint,omitempty"`
+	Connected bool          `json:"connected"`
+	Handshake time.Time     `json:"handshake"`
+	RTT       time.Duration `json:"rtt,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Warm - has the running daemon prime the connections to a peer, by public key, or to the peers of
+// a network, waiting up to timeout for each to come up
+func Warm(target string, timeout time.Duration) ([]WarmedPeer, error) {
+	return callDaemon[[]WarmedPeer](http.MethodPost, "/warm", warmRequest{Target: target, Timeout: int(timeout.Seconds())})
+}
+
+// warmPeers - primes the connections to the peers of target in parallel: traffic to the mesh address of
+// a peer makes wireguard perform the handshake, traversing the nats on the way, before the first real
+// traffic needs it
+func warmPeers(target string, timeout time.Duration) ([]WarmedPeer, error) {
+	if timeout <= 0 {
+		timeout = DefaultWarmTimeout
+	}
+	peers := warmTargets(target)
+	if len(peers) == 0 {
+		return nil, errors.New("no peer or network " + target)
+	}
+	warmed := make([]WarmedPeer, len(peers))
+	wg := sync.WaitGroup{}
+	for i := range peers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			warmed[i] = warmPeer(peers[i], timeout)
+		}(i)
+	}
+	wg.Wait()
+	return warmed, nil
+}
+
+// warmTargets - the peer with the public key target or the peers of the network target
+func warmTargets(target string) []wgtypes.PeerConfig {
+	peers := []wgtypes.PeerConfig{}
+	key, keyErr := wgtypes.ParseKey(target)
+	node, isNetwork := config.GetNodes()[target]
+	for _, peer := range config.Netclient().HostPeers {
+		if peer.Remove || config.IsDeniedPeer(peer.PublicKey.String()) {
+			continue
+		}
+		if keyErr == nil && peer.PublicKey == key {
+			return []wgtypes.PeerConfig{peer}
+		}
+		if !isNetwork {
+			continue
+		}
+		for _, allowed := range peer.AllowedIPs {
+			if node.NetworkRange.Contains(allowed.IP) || node.NetworkRange6.Contains(allowed.IP) {
+				peers = append(peers, peer)
+				break
+			}
+		}
+	}
+	return peers
+}
+
+// warmPeer - pings the mesh address of a peer until it answers or timeout passes
+func warmPeer(peer wgtypes.PeerConfig, timeout time.Duration) WarmedPeer {
+	warmed := WarmedPeer{PublicKey: peer.PublicKey.String()}
+	address := warmAddress(peer)
+	if address == nil {
+		warmed.Error = "peer has no mesh address"
+		return warmed
+	}
+	warmed.Address = address.String()
+	pinger, err := ping.NewPinger(warmed.Address)
+	if err != nil {
+		warmed.Error = err.Error()
+		return warmed
+	}
+	pinger.SetPrivileged(true)
+	pinger.Interval = time.Millisecond * 500
+	pinger.Timeout = timeout
+	pinger.OnRecv = func(*ping.Packet) {
+		pinger.Stop()
+	}
+	if err := pinger.Run(); err != nil {
+		warmed.Error = err.Error()
+		return warmed
+	}
+	stats := pinger.Statistics()
+	warmed.Connected = stats.PacketsRecv > 0
+	warmed.RTT = stats.AvgRtt
+	if current, err := wireguard.GetPeer(ncutils.GetInterfaceName(), warmed.PublicKey); err == nil {
+		warmed.Handshake = current.LastHandshakeTime
+		if current.Endpoint != nil {
+			warmed.Endpoint = current.Endpoint.String()
+		}
+	}
+	if !warmed.Connected {
+		warmed.Error = "no answer within " + timeout.String()
+		slog.Warn("failed to warm connection to peer", "peer", warmed.PublicKey, "address", warmed.Address)
+	}
+	return warmed
+}
+
+// warmAddress - the first address of the peer within the joined networks
+func warmAddress(peer wgtypes.PeerConfig) net.IP {
+	for _, allowed := range peer.AllowedIPs {
+		for _, node := range config.GetNodes() {
+			if node.NetworkRange.Contains(allowed.IP) || node.NetworkRange6.Contains(allowed.IP) {
+				return allowed.IP
+			}
+		}
+	}
+	return nil
+}
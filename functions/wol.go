@@ -0,0 +1,121 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.org/x/exp/slog"
+)
+
+// WakeOnLan - sends a magic packet for the mac address, through the wol relay of the
+// gateway (mesh address of a netclient with wolrelay enabled) or as local broadcast if gateway is empty
+func WakeOnLan(mac, gateway string) error {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return err
+	}
+	packet := ncutils.MagicPacket(hwAddr)
+	if gateway == "" {
+		return broadcastMagicPacket(packet, "")
+	}
+	if net.ParseIP(gateway) == nil {
+		return errors.New("gateway must be the mesh ip address of the relaying host")
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(gateway, strconv.Itoa(ncutils.WoLPort)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(packet)
+	return err
+}
+
+// wolRelay - listens on the mesh addresses of the host and rebroadcasts received magic packets on the local lans
+func wolRelay(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	conns := []*net.UDPConn{}
+	for _, node := range config.GetNodes() {
+		if node.Address.IP == nil {
+			continue
+		}
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: node.Address.IP, Port: ncutils.WoLPort})
+		if err != nil {
+			slog.Error("failed to start wol relay", "network", node.Network, "error", err)
+			continue
+		}
+		conns = append(conns, conn)
+		go relayMagicPackets(conn)
+	}
+	slog.Info("wol relay started", "listeners", len(conns))
+	<-ctx.Done()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	slog.Info("wol relay closed")
+}
+
+func relayMagicPackets(conn *net.UDPConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		mac, ok := ncutils.ParseMagicPacket(buf[:n])
+		if !ok {
+			slog.Debug("ignoring invalid wol packet", "from", from.String())
+			continue
+		}
+		slog.Info("relaying wake-on-lan packet", "mac", mac.String(), "from", from.String())
+		if err := broadcastMagicPacket(buf[:n], ncutils.GetInterfaceName()); err != nil {
+			slog.Error("failed to relay wol packet", "mac", mac.String(), "error", err)
+		}
+	}
+}
+
+// broadcastMagicPacket - sends the packet to the broadcast address of every ipv4 lan of the host
+func broadcastMagicPacket(packet []byte, skipIface string) error {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
+	sent := false
+	for _, iface := range ifaces {
+		if iface.Name == skipIface || iface.Flags&net.FlagUp == 0 ||
+			iface.Flags&net.FlagBroadcast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			broadcast := make(net.IP, 4)
+			for i := range broadcast {
+				broadcast[i] = ipnet.IP.To4()[i] | ^ipnet.Mask[len(ipnet.Mask)-4+i]
+			}
+			conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: broadcast, Port: ncutils.WoLPort})
+			if err != nil {
+				slog.Debug("failed to broadcast wol packet", "iface", iface.Name, "error", err)
+				continue
+			}
+			if _, err := conn.Write(packet); err == nil {
+				sent = true
+			}
+			conn.Close()
+		}
+	}
+	if !sent {
+		return errors.New("no broadcast capable interface found")
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"runtime"
 
+	"github.com/devilcove/httpclient"
 	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netclient/functions"
 	"github.com/gravitl/netmaker/logger"
@@ -35,6 +36,11 @@ func main() {
 		}
 		url = "http://" + http.Address + ":" + http.Port
 	}
+	if token, err := config.ReadAPIToken(); err != nil {
+		logger.Log(0, "unable to read netclient api token, requests may be rejected", err.Error())
+	} else {
+		headers = append(headers, httpclient.Header{Name: "Authorization", Value: "Bearer " + token})
+	}
 	// Create an instance of the guiApp structure
 	guiApp := NewApp()
 	guiApp.GoGetNetclientConfig()
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// MaxTopTalkers - number of peers kept in the top talkers summary
+const MaxTopTalkers = 10
+
+// PeerFlows - traffic of the connections currently tracked for a peer
+type PeerFlows struct {
+	PublicKey string `json:"public_key"`
+	Flows     int    `json:"flows"`
+	Bytes     uint64 `json:"bytes"`
+}
+
+// flow - a tracked connection with the bytes seen in both directions
+type flow struct {
+	src   netip.Addr
+	dst   netip.Addr
+	bytes uint64
+}
+
+var (
+	topTalkers     []PeerFlows
+	topTalkersLock sync.Mutex
+)
+
+// AccountFlows - attributes the tracked connections to the peers owning their source (or else
+// destination) address and stores the peers with the most traffic as top talkers
+func AccountFlows(peers []wgtypes.PeerConfig) ([]PeerFlows, error) {
+	flows, err := trackedFlows()
+	if err != nil {
+		return nil, err
+	}
+	totals := map[string]*PeerFlows{}
+	for _, f := range flows {
+		key := peerOf(peers, f.src)
+		if key == "" {
+			key = peerOf(peers, f.dst)
+		}
+		if key == "" {
+			continue
+		}
+		total, ok := totals[key]
+		if !ok {
+			total = &PeerFlows{PublicKey: key}
+			totals[key] = total
+		}
+		total.Flows++
+		total.Bytes += f.bytes
+	}
+	result := make([]PeerFlows, 0, len(totals))
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Bytes > result[j].Bytes
+	})
+	if len(result) > MaxTopTalkers {
+		result = result[:MaxTopTalkers]
+	}
+	topTalkersLock.Lock()
+	topTalkers = result
+	topTalkersLock.Unlock()
+	return result, nil
+}
+
+// TopTalkers - returns the peers with the most traffic of the last flow accounting
+func TopTalkers() []PeerFlows {
+	topTalkersLock.Lock()
+	defer topTalkersLock.Unlock()
+	return append([]PeerFlows{}, topTalkers...)
+}
+
+// peerOf - returns the public key of the peer whose allowed ips contain the address
+func peerOf(peers []wgtypes.PeerConfig, addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	for _, peer := range peers {
+		for _, allowed := range peer.AllowedIPs {
+			ip, ok := netip.AddrFromSlice(allowed.IP)
+			if !ok {
+				continue
+			}
+			ones, _ := allowed.Mask.Size()
+			prefix, err := ip.Unmap().Prefix(ones)
+			if err != nil {
+				continue
+			}
+			if prefix.Contains(addr) {
+				return peer.PublicKey.String()
+			}
+		}
+	}
+	return ""
+}
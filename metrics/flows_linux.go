@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"bufio"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	conntrackTable = "/proc/net/nf_conntrack"
+	conntrackAcct  = "/proc/sys/net/netfilter/nf_conntrack_acct"
+)
+
+// EnableFlowAccounting - turns on conntrack byte counters, needed for per flow byte counts
+func EnableFlowAccounting() error {
+	return os.WriteFile(conntrackAcct, []byte("1"), 0644)
+}
+
+// trackedFlows - reads the connections currently tracked by conntrack
+func trackedFlows() ([]flow, error) {
+	f, err := os.Open(conntrackTable)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	flows := []flow{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var current flow
+		for _, field := range strings.Fields(scanner.Text()) {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "src":
+				// the first src/dst pair is the original direction
+				if !current.src.IsValid() {
+					current.src, _ = netip.ParseAddr(value)
+				}
+			case "dst":
+				if !current.dst.IsValid() {
+					current.dst, _ = netip.ParseAddr(value)
+				}
+			case "bytes":
+				bytes, _ := strconv.ParseUint(value, 10, 64)
+				current.bytes += bytes
+			}
+		}
+		flows = append(flows, current)
+	}
+	return flows, scanner.Err()
+}
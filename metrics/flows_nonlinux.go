@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package metrics
+
+import "errors"
+
+var errFlowsNotSupported = errors.New("flow accounting not supported on this os")
+
+// EnableFlowAccounting - flow accounting is only supported on linux
+func EnableFlowAccounting() error {
+	return errFlowsNotSupported
+}
+
+// trackedFlows - flow accounting is only supported on linux
+func trackedFlows() ([]flow, error) {
+	return nil, errFlowsNotSupported
+}
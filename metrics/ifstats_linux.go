@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// interfaceErrors - reads the rx/tx error counters of the interface from sysfs
+func interfaceErrors(iface string) (rx, tx uint64, err error) {
+	if rx, err = readStatistic(iface, "rx_errors"); err != nil {
+		return 0, 0, err
+	}
+	if tx, err = readStatistic(iface, "tx_errors"); err != nil {
+		return 0, 0, err
+	}
+	return rx, tx, nil
+}
+
+func readStatistic(iface, name string) (uint64, error) {
+	data, err := os.ReadFile("/sys/class/net/" + iface + "/statistics/" + name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
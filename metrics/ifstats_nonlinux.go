@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package metrics
+
+import "errors"
+
+// interfaceErrors - interface error counters are only collected on linux
+func interfaceErrors(iface string) (rx, tx uint64, err error) {
+	return 0, 0, errors.New("interface error counters not supported on this os")
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gravitl/netclient/ncutils"
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+// WriteTextfile - writes interface and per peer statistics of the netmaker interface
+// in the prometheus text format, to be picked up by e.g. the node_exporter textfile collector
+func WriteTextfile(path string) error {
+	wgclient, err := wgctrl.New()
+	if err != nil {
+		return err
+	}
+	defer wgclient.Close()
+	iface := ncutils.GetInterfaceName()
+	device, err := wgclient.Device(iface)
+	if err != nil {
+		return err
+	}
+	var rx, tx int64
+	peers := strings.Builder{}
+	for _, peer := range device.Peers {
+		key := peer.PublicKey.String()
+		rx += peer.ReceiveBytes
+		tx += peer.TransmitBytes
+		fmt.Fprintf(&peers, "netclient_peer_receive_bytes_total{interface=%q,public_key=%q} %d\n", iface, key, peer.ReceiveBytes)
+		fmt.Fprintf(&peers, "netclient_peer_transmit_bytes_total{interface=%q,public_key=%q} %d\n", iface, key, peer.TransmitBytes)
+		handshake := int64(0)
+		if !peer.LastHandshakeTime.IsZero() {
+			handshake = peer.LastHandshakeTime.Unix()
+		}
+		fmt.Fprintf(&peers, "netclient_peer_last_handshake_seconds{interface=%q,public_key=%q} %d\n", iface, key, handshake)
+	}
+	out := strings.Builder{}
+	fmt.Fprintf(&out, "# HELP netclient_receive_bytes_total bytes received on the netmaker interface\n")
+	fmt.Fprintf(&out, "# TYPE netclient_receive_bytes_total counter\n")
+	fmt.Fprintf(&out, "netclient_receive_bytes_total{interface=%q} %d\n", iface, rx)
+	fmt.Fprintf(&out, "# HELP netclient_transmit_bytes_total bytes transmitted on the netmaker interface\n")
+	fmt.Fprintf(&out, "# TYPE netclient_transmit_bytes_total counter\n")
+	fmt.Fprintf(&out, "netclient_transmit_bytes_total{interface=%q} %d\n", iface, tx)
+	if rxErrors, txErrors, err := interfaceErrors(iface); err == nil {
+		fmt.Fprintf(&out, "# HELP netclient_receive_errors_total receive errors on the netmaker interface\n")
+		fmt.Fprintf(&out, "# TYPE netclient_receive_errors_total counter\n")
+		fmt.Fprintf(&out, "netclient_receive_errors_total{interface=%q} %d\n", iface, rxErrors)
+		fmt.Fprintf(&out, "# HELP netclient_transmit_errors_total transmit errors on the netmaker interface\n")
+		fmt.Fprintf(&out, "# TYPE netclient_transmit_errors_total counter\n")
+		fmt.Fprintf(&out, "netclient_transmit_errors_total{interface=%q} %d\n", iface, txErrors)
+	}
+	fmt.Fprintf(&out, "# HELP netclient_peer_receive_bytes_total bytes received from the peer\n")
+	fmt.Fprintf(&out, "# TYPE netclient_peer_receive_bytes_total counter\n")
+	fmt.Fprintf(&out, "# HELP netclient_peer_transmit_bytes_total bytes transmitted to the peer\n")
+	fmt.Fprintf(&out, "# TYPE netclient_peer_transmit_bytes_total counter\n")
+	fmt.Fprintf(&out, "# HELP netclient_peer_last_handshake_seconds unix time of the last handshake with the peer\n")
+	fmt.Fprintf(&out, "# TYPE netclient_peer_last_handshake_seconds gauge\n")
+	out.WriteString(peers.String())
+	if talkers := TopTalkers(); len(talkers) > 0 {
+		fmt.Fprintf(&out, "# HELP netclient_peer_flow_bytes bytes of the connections currently tracked for the peer\n")
+		fmt.Fprintf(&out, "# TYPE netclient_peer_flow_bytes gauge\n")
+		fmt.Fprintf(&out, "# HELP netclient_peer_flows connections currently tracked for the peer\n")
+		fmt.Fprintf(&out, "# TYPE netclient_peer_flows gauge\n")
+		for _, talker := range talkers {
+			fmt.Fprintf(&out, "netclient_peer_flow_bytes{interface=%q,public_key=%q} %d\n", iface, talker.PublicKey, talker.Bytes)
+			fmt.Fprintf(&out, "netclient_peer_flows{interface=%q,public_key=%q} %d\n", iface, talker.PublicKey, talker.Flows)
+		}
+	}
+	// write to a temp file and rename so collectors never read a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".netclient-stats-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(out.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,227 @@
+// Package mobile exposes the core netclient logic (join, configuration, peer updates) as a library
+// that can be bound with gomobile for android and ios apps. The app owns the tunnel
+// (VpnService / NEPacketTunnelProvider) and persists the client state returned by State.
+package mobile
+
+import (
+	"crypto/rand"
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+
+	"github.com/devilcove/httpclient"
+	"github.com/google/uuid"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/crypto/nacl/box"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// defaultMTU - mtu of the tunnel
+const defaultMTU = 1420
+
+// Client - a netclient host as seen by a mobile app
+type Client struct {
+	state state
+}
+
+// state - everything the client needs to survive an app restart
+type state struct {
+	Host              models.Host          `json:"host"`
+	PrivateKey        wgtypes.Key          `json:"privatekey"`
+	TrafficKeyPrivate []byte               `json:"traffickeyprivate"`
+	Server            models.ServerConfig  `json:"server"`
+	Nodes             []models.Node        `json:"nodes"`
+	Peers             []wgtypes.PeerConfig `json:"peers"`
+}
+
+// NewClient - creates a client with new wireguard and traffic keys
+func NewClient(name string) (*Client, error) {
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	trafficPrivate, err := ncutils.ConvertKeyToBytes(priv)
+	if err != nil {
+		return nil, err
+	}
+	trafficPublic, err := ncutils.ConvertKeyToBytes(pub)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{}
+	c.state.PrivateKey = privateKey
+	c.state.TrafficKeyPrivate = trafficPrivate
+	c.state.Host = models.Host{
+		ID:               id,
+		Name:             name,
+		OS:               runtime.GOOS,
+		HostPass:         ncutils.RandomString(32),
+		PublicKey:        privateKey.PublicKey(),
+		TrafficKeyPublic: trafficPublic,
+		ListenPort:       ncutils.NetclientDefaultPort,
+		MTU:              defaultMTU,
+		MacAddress:       ncutils.RandomMacAddress(),
+	}
+	return c, nil
+}
+
+// Restore - recreates a client from the state saved by the app
+func Restore(saved string) (*Client, error) {
+	c := &Client{}
+	if err := json.Unmarshal([]byte(saved), &c.state); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// State - returns the client state the app should persist, it contains private keys
+func (c *Client) State() (string, error) {
+	data, err := json.Marshal(c.state)
+	return string(data), err
+}
+
+// Join - registers the host with the server of the enrollment token and pulls its configuration
+func (c *Client) Join(token string) error {
+	data, err := b64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return fmt.Errorf("could not read enrollment token %w", err)
+	}
+	var serverData models.EnrollmentToken
+	if err := json.Unmarshal(data, &serverData); err != nil {
+		return fmt.Errorf("could not read enrollment token %w", err)
+	}
+	api := httpclient.JSONEndpoint[models.RegisterResponse, models.ErrorResponse]{
+		URL:           "https://" + serverData.Server,
+		Route:         "/api/v1/host/register/" + token,
+		Method:        http.MethodPost,
+		Data:          c.state.Host,
+		Response:      models.RegisterResponse{},
+		ErrorResponse: models.ErrorResponse{},
+	}
+	response, errData, err := api.GetJSON(models.RegisterResponse{}, models.ErrorResponse{})
+	if err != nil {
+		if errors.Is(err, httpclient.ErrStatus) {
+			return fmt.Errorf("error registering with server %d %s", errData.Code, errData.Message)
+		}
+		return err
+	}
+	c.state.Server = response.ServerConf
+	return c.Pull()
+}
+
+// Pull - fetches the latest host, node and peer configuration from the server
+func (c *Client) Pull() error {
+	if c.state.Server.API == "" {
+		return errors.New("not registered with a server")
+	}
+	token, err := c.authenticate()
+	if err != nil {
+		return err
+	}
+	endpoint := httpclient.JSONEndpoint[models.HostPull, models.ErrorResponse]{
+		URL:           "https://" + c.state.Server.API,
+		Route:         "/api/v1/host",
+		Method:        http.MethodGet,
+		Authorization: "Bearer " + token,
+		Response:      models.HostPull{},
+		ErrorResponse: models.ErrorResponse{},
+	}
+	pull, errData, err := endpoint.GetJSON(models.HostPull{}, models.ErrorResponse{})
+	if err != nil {
+		if errors.Is(err, httpclient.ErrStatus) {
+			return fmt.Errorf("error pulling from server %d %s", errData.Code, errData.Message)
+		}
+		return err
+	}
+	// the server does not know the host password, keep ours
+	hostPass := c.state.Host.HostPass
+	c.state.Host = pull.Host
+	c.state.Host.HostPass = hostPass
+	c.state.Nodes = pull.Nodes
+	c.state.Peers = pull.Peers
+	c.state.Server = pull.ServerConfig
+	return nil
+}
+
+// ApplyUpdate - applies an encrypted peer update received from the broker on
+// peers/host/<host id>/<server>, call GetConfig afterwards to reconfigure the tunnel
+func (c *Client) ApplyUpdate(payload []byte) error {
+	privateKey, err := ncutils.ConvertBytesToKey(c.state.TrafficKeyPrivate)
+	if err != nil {
+		return err
+	}
+	serverKey, err := ncutils.ConvertBytesToKey(c.state.Server.TrafficKey)
+	if err != nil {
+		return err
+	}
+	data, err := ncutils.DeChunk(payload, serverKey, privateKey)
+	if err != nil {
+		return err
+	}
+	var update models.HostPeerUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		return err
+	}
+	c.state.Peers = update.Peers
+	return nil
+}
+
+// GetConfig - returns the tunnel configuration in the wg-quick format
+func (c *Client) GetConfig() string {
+	addrs := []net.IPNet{}
+	for _, node := range c.state.Nodes {
+		if node.Address.IP != nil {
+			addrs = append(addrs, net.IPNet{IP: node.Address.IP, Mask: node.NetworkRange.Mask})
+		}
+		if node.Address6.IP != nil {
+			addrs = append(addrs, net.IPNet{IP: node.Address6.IP, Mask: node.NetworkRange6.Mask})
+		}
+	}
+	return ncutils.WgQuickConfig(c.state.PrivateKey, c.state.Host.ListenPort, c.state.Host.MTU, addrs, c.state.Peers)
+}
+
+// authenticate - returns an api token for the host
+func (c *Client) authenticate() (string, error) {
+	endpoint := httpclient.Endpoint{
+		URL:    "https://" + c.state.Server.API,
+		Route:  "/api/hosts/adm/authenticate",
+		Method: http.MethodPost,
+		Data: models.AuthParams{
+			MacAddress: c.state.Host.MacAddress.String(),
+			ID:         c.state.Host.ID.String(),
+			Password:   c.state.Host.HostPass,
+		},
+	}
+	response, err := endpoint.GetResponse()
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		return "", fmt.Errorf("failed to authenticate %s %s", response.Status, string(body))
+	}
+	resp := struct {
+		Response struct {
+			AuthToken string
+		}
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&resp); err != nil {
+		return "", fmt.Errorf("error decoding response %w", err)
+	}
+	return resp.Response.AuthToken, nil
+}
@@ -1,4 +1,4 @@
-package functions
+package ncutils
 
 import (
 	"bytes"
@@ -7,6 +7,8 @@ import (
 	"io"
 
 	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
 )
 
 const (
@@ -35,6 +37,43 @@ func BoxDecrypt(encrypted []byte, senderPublicKey *[32]byte, recipientPrivateKey
 	return decrypted, nil
 }
 
+// PassphraseEncrypt - encrypts a message with a key derived from a passphrase,
+// the random salt and nonce are prepended to the sealed message
+func PassphraseEncrypt(message []byte, passphrase string) ([]byte, error) {
+	var salt [16]byte
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, salt[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+	key, err := passphraseKey(passphrase, salt[:])
+	if err != nil {
+		return nil, err
+	}
+	encrypted := append(salt[:], nonce[:]...)
+	return secretbox.Seal(encrypted, message, &nonce, key), nil
+}
+
+// PassphraseDecrypt - decrypts a message encrypted with PassphraseEncrypt
+func PassphraseDecrypt(encrypted []byte, passphrase string) ([]byte, error) {
+	if len(encrypted) < 16+24+secretbox.Overhead {
+		return nil, fmt.Errorf("encrypted message too short")
+	}
+	var nonce [24]byte
+	copy(nonce[:], encrypted[16:40])
+	key, err := passphraseKey(passphrase, encrypted[:16])
+	if err != nil {
+		return nil, err
+	}
+	decrypted, ok := secretbox.Open(nil, encrypted[40:], &nonce, key)
+	if !ok {
+		return nil, fmt.Errorf("could not decrypt message, wrong passphrase or corrupted data")
+	}
+	return decrypted, nil
+}
+
 // Chunk - chunks a message and encrypts each chunk
 func Chunk(message []byte, recipientPubKey *[32]byte, senderPrivateKey *[32]byte) ([]byte, error) {
 	var chunks [][]byte
@@ -81,6 +120,17 @@ func DeChunk(chunkedMsg []byte, senderPublicKey *[32]byte, recipientPrivateKey *
 
 var splitKey = []byte("|(,)(,)|")
 
+// passphraseKey - derives a secretbox key from a passphrase
+func passphraseKey(passphrase string, salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], derived)
+	return &key, nil
+}
+
 // ConvertMsgToBytes - converts a message (MQ) to it's chunked version
 // decode action
 func convertMsgToBytes(msg []byte) ([][]byte, error) {
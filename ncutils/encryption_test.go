@@ -0,0 +1,30 @@
+package ncutils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPassphraseEncrypt(t *testing.T) {
+	message := []byte("privatekey: secret")
+	encrypted, err := PassphraseEncrypt(message, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, message) {
+		t.Fatal("message is not encrypted")
+	}
+	decrypted, err := PassphraseDecrypt(encrypted, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, message) {
+		t.Errorf("got %q, want %q", decrypted, message)
+	}
+	if _, err := PassphraseDecrypt(encrypted, "wrong"); err == nil {
+		t.Error("decrypted with a wrong passphrase")
+	}
+	if _, err := PassphraseDecrypt(encrypted[:20], "correct horse"); err == nil {
+		t.Error("decrypted a truncated message")
+	}
+}
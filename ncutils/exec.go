@@ -0,0 +1,120 @@
+package ncutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultCommandTimeout - time an attempt of a command may run when no timeout is set
+	DefaultCommandTimeout = time.Minute * 2
+	// DefaultCommandRetries - retries of a command failing with a transient error
+	DefaultCommandRetries = 3
+	retryBackoff          = time.Millisecond * 200
+)
+
+// transientErrors - output of commands failing on a busy resource that succeed when retried
+var transientErrors = []string{
+	"Resource temporarily unavailable",
+	"holding the xtables lock",
+}
+
+// xtablesCommands - commands supporting --wait for the xtables lock
+var xtablesCommands = map[string]bool{
+	"iptables":          true,
+	"ip6tables":         true,
+	"iptables-nft":      true,
+	"ip6tables-nft":     true,
+	"iptables-legacy":   true,
+	"ip6tables-legacy":  true,
+	"iptables-restore":  true,
+	"ip6tables-restore": true,
+}
+
+// Command - an external command run by Exec
+type Command struct {
+	Name string
+	Args []string
+	// Timeout - bounds each attempt, DefaultCommandTimeout if 0
+	Timeout time.Duration
+	// Retries - attempts repeated after a transient failure
+	Retries int
+	// Stdin - written to the standard input of each attempt
+	Stdin string
+}
+
+// NewCommand - returns a command with the default timeout and retries
+func NewCommand(name string, args ...string) Command {
+	return Command{Name: name, Args: args, Retries: DefaultCommandRetries}
+}
+
+// String - the command line
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Exec - runs the command and returns its combined output; each attempt is bounded by the
+// timeout, transient failures (e.g. a busy xtables lock) are retried with backoff and
+// iptables commands wait for the xtables lock instead of failing right away
+func Exec(ctx context.Context, c Command) (string, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultCommandTimeout
+	}
+	args := c.Args
+	if xtablesCommands[filepath.Base(c.Name)] && !hasWaitFlag(args) {
+		args = append([]string{"--wait"}, args...)
+	}
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(attemptCtx, c.Name, args...)
+		if c.Stdin != "" {
+			cmd.Stdin = strings.NewReader(c.Stdin)
+		}
+		out, err := cmd.CombinedOutput()
+		timedOut := errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		if err == nil {
+			return string(out), nil
+		}
+		if ctx.Err() != nil {
+			return string(out), fmt.Errorf("%s: %w", c.String(), ctx.Err())
+		}
+		if timedOut {
+			return string(out), fmt.Errorf("%s: timed out after %s", c.String(), timeout)
+		}
+		if attempt >= c.Retries || !isTransient(string(out)) {
+			return string(out), err
+		}
+		select {
+		case <-ctx.Done():
+			return string(out), fmt.Errorf("%s: %w", c.String(), ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func hasWaitFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == "-w" || arg == "--wait" || strings.HasPrefix(arg, "--wait=") {
+			return true
+		}
+	}
+	return false
+}
+
+func isTransient(out string) bool {
+	for _, msg := range transientErrors {
+		if strings.Contains(out, msg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package ncutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecOutput(t *testing.T) {
+	out, err := Exec(context.Background(), NewCommand("sh", "-c", "echo out; echo err >&2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "out") || !strings.Contains(out, "err") {
+		t.Fatalf("output not captured: %q", out)
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	cmd := NewCommand("sleep", "5")
+	cmd.Timeout = time.Millisecond * 100
+	start := time.Now()
+	if _, err := Exec(context.Background(), cmd); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if time.Since(start) > time.Second*2 {
+		t.Fatal("command was not killed on timeout")
+	}
+}
+
+func TestExecRetriesTransientErrors(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "attempted")
+	// fails with a transient error on the first attempt only
+	script := "if [ -e " + marker + " ]; then echo ok; else touch " + marker +
+		"; echo 'Resource temporarily unavailable' >&2; exit 4; fi"
+	out, err := Exec(context.Background(), NewCommand("sh", "-c", script))
+	if err != nil {
+		t.Fatalf("transient error was not retried: %v %s", err, out)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatal("first attempt did not run")
+	}
+}
+
+func TestExecDoesNotRetryOtherErrors(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "attempts")
+	script := "echo x >> " + marker + "; exit 1"
+	if _, err := Exec(context.Background(), NewCommand("sh", "-c", script)); err == nil {
+		t.Fatal("expected error")
+	}
+	data, _ := os.ReadFile(marker)
+	if attempts := strings.Count(string(data), "x"); attempts != 1 {
+		t.Fatalf("command ran %d times, want 1", attempts)
+	}
+}
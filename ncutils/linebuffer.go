@@ -0,0 +1,45 @@
+package ncutils
+
+import (
+	"strings"
+	"sync"
+)
+
+// RecentLogs - the most recent log lines, included in crash reports
+var RecentLogs = NewLineBuffer(100)
+
+// LineBuffer - io.Writer keeping the last lines written to it
+type LineBuffer struct {
+	mutex   sync.Mutex
+	lines   []string
+	max     int
+	partial string
+}
+
+// NewLineBuffer - creates a line buffer keeping at most max lines
+func NewLineBuffer(max int) *LineBuffer {
+	return &LineBuffer{max: max}
+}
+
+// Write - implements io.Writer
+func (b *LineBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	data := b.partial + string(p)
+	lines := strings.Split(data, "\n")
+	b.partial = lines[len(lines)-1]
+	b.lines = append(b.lines, lines[:len(lines)-1]...)
+	if len(b.lines) > b.max {
+		b.lines = b.lines[len(b.lines)-b.max:]
+	}
+	return len(p), nil
+}
+
+// Lines - returns a copy of the buffered lines
+func (b *LineBuffer) Lines() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	lines := make([]string, len(b.lines))
+	copy(lines, b.lines)
+	return lines
+}
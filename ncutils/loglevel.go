@@ -0,0 +1,6 @@
+package ncutils
+
+import "golang.org/x/exp/slog"
+
+// LogLevel - level of the default logger, adjustable while running
+var LogLevel = &slog.LevelVar{}
@@ -3,6 +3,7 @@ package ncutils
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/base32"
@@ -64,6 +65,28 @@ func IsLinux() bool {
 	return runtime.GOOS == "linux"
 }
 
+// IsWSL - checks if running inside the Windows Subsystem for Linux
+func IsWSL() bool {
+	if !IsLinux() {
+		return false
+	}
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(release)), "microsoft")
+}
+
+// IsWSLNAT - checks if running in WSL with the default NAT networking, in mirrored networking mode
+// wsl adds a loopback0 interface
+func IsWSLNAT() bool {
+	if !IsWSL() {
+		return false
+	}
+	_, err := net.InterfaceByName("loopback0")
+	return err != nil
+}
+
 // IsFreeBSD - checks if is freebsd
 func IsFreeBSD() bool {
 	return runtime.GOOS == "freebsd"
@@ -95,15 +118,33 @@ func IsNFTablesPresent() bool {
 	return found
 }
 
-// IsIPTablesPresent - returns true if iptables is present, false otherwise
+// IsIPTablesPresent - returns true if iptables or ip6tables is present, false otherwise; a host with
+// only one of them is managed for that address family alone.
 // Does not consider OS, up to the caller to determine if the OS supports iptables/whether this check is valid.
 func IsIPTablesPresent() bool {
-	found := false
-	_, err := exec.LookPath("iptables")
-	if err == nil {
-		found = true
+	for _, binary := range []string{"iptables", "ip6tables"} {
+		if _, err := exec.LookPath(binary); err == nil {
+			return true
+		}
 	}
-	return found
+	return false
+}
+
+// IsFirewalldRunning - checks if firewalld is running, it rebuilds the iptables rules on every reload
+func IsFirewalldRunning() bool {
+	out, err := exec.Command("firewall-cmd", "--state").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "running"
+}
+
+// IsKernelModuleLoaded - checks if a freebsd kernel module, such as pf or ipfw, is loaded or compiled in
+func IsKernelModuleLoaded(module string) bool {
+	return exec.Command("kldstat", "-q", "-m", module).Run() == nil
+}
+
+// IsIPTablesNft - checks if iptables is the iptables-nft shim translating rules to nftables
+func IsIPTablesNft() bool {
+	out, err := exec.Command("iptables", "--version").Output()
+	return err == nil && strings.Contains(string(out), "nf_tables")
 }
 
 // IsKernel - checks if running kernel WireGuard
@@ -234,6 +275,25 @@ func GetFreePort(rangestart int) (int, error) {
 	return rangestart, errors.New("no free ports")
 }
 
+// ErrPortRangeExhausted - returned when every port of a restricted range is in use
+var ErrPortRangeExhausted = errors.New("no free ports in range")
+
+// GetFreePortInRange - gets a free port within [start, end], trying the preferred port first
+func GetFreePortInRange(preferred, start, end int) (int, error) {
+	if start <= 0 || end > 65535 || start > end {
+		return 0, fmt.Errorf("invalid port range %d-%d", start, end)
+	}
+	if preferred >= start && preferred <= end && IsPortFree(preferred) {
+		return preferred, nil
+	}
+	for x := start; x <= end; x++ {
+		if IsPortFree(x) {
+			return x, nil
+		}
+	}
+	return 0, ErrPortRangeExhausted
+}
+
 // IsPortFree - checks if port is free
 func IsPortFree(port int) (free bool) {
 	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
@@ -378,10 +438,10 @@ func RunCmds(commands []string, printerr bool) error {
 			continue
 		}
 		args := strings.Fields(command)
-		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		out, err := Exec(context.Background(), NewCommand(args[0], args[1:]...))
 		if err != nil && printerr {
 			logger.Log(0, "error running command:", command)
-			logger.Log(0, strings.TrimSuffix(string(out), "\n"))
+			logger.Log(0, strings.TrimSuffix(out, "\n"))
 		}
 	}
 	return err
@@ -1,7 +1,7 @@
 package ncutils
 
 import (
-	"os/exec"
+	"context"
 	"strings"
 
 	"github.com/gravitl/netmaker/logger"
@@ -18,14 +18,12 @@ func RunCmd(command string, printerr bool) (string, error) {
 	for i, arg := range args {
 		args[i] = strings.Replace(arg, WHITESPACE_PLACEHOLDER, " ", -1)
 	}
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Wait()
-	out, err := cmd.CombinedOutput()
+	out, err := Exec(context.Background(), NewCommand(args[0], args[1:]...))
 	if err != nil && printerr {
 		logger.Log(0, "error running command:", strings.Join(args, " "))
-		logger.Log(0, strings.TrimSuffix(string(out), "\n"))
+		logger.Log(0, strings.TrimSuffix(out, "\n"))
 	}
-	return string(out), err
+	return out, err
 }
 
 // RunCmdFormatted - run a command formatted for MacOS
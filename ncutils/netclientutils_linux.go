@@ -1,8 +1,8 @@
 package ncutils
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 
 	"github.com/gravitl/netmaker/logger"
@@ -12,14 +12,12 @@ import (
 // RunCmd - runs a local command
 func RunCmd(command string, printerr bool) (string, error) {
 	args := strings.Fields(command)
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Wait()
-	out, err := cmd.CombinedOutput()
+	out, err := Exec(context.Background(), NewCommand(args[0], args[1:]...))
 	if err != nil && printerr {
 		logger.Log(0, fmt.Sprintf("error running command: %s", command))
-		logger.Log(0, strings.TrimSuffix(string(out), "\n"))
+		logger.Log(0, strings.TrimSuffix(out, "\n"))
 	}
-	return string(out), err
+	return out, err
 }
 
 // RunCmdFormatted - does nothing for linux
@@ -8,3 +8,24 @@ func TestRadomMacAddress(t *testing.T) {
 		t.Error("empty mac Address")
 	}
 }
+
+func TestMagicPacket(t *testing.T) {
+	mac := RandomMacAddress()
+	parsed, ok := ParseMagicPacket(MagicPacket(mac))
+	if !ok || parsed.String() != mac.String() {
+		t.Error("magic packet round trip failed", mac, parsed)
+	}
+	if _, ok := ParseMagicPacket(MagicPacket(mac)[:100]); ok {
+		t.Error("truncated magic packet accepted")
+	}
+}
+
+func TestLineBuffer(t *testing.T) {
+	buf := NewLineBuffer(2)
+	buf.Write([]byte("one\ntwo\nthr"))
+	buf.Write([]byte("ee\n"))
+	lines := buf.Lines()
+	if len(lines) != 2 || lines[0] != "two" || lines[1] != "three" {
+		t.Error("unexpected lines", lines)
+	}
+}
@@ -1,6 +1,7 @@
 package ncutils
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"os"
@@ -19,15 +20,12 @@ const WIN_PATH = "C:\\Program Files (x86)\\Netclient\\"
 // RunCmd - runs a local command
 func RunCmd(command string, printerr bool) (string, error) {
 	args := strings.Fields(command)
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Wait()
-	//cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: "/C \"" + command + "\""}
-	out, err := cmd.CombinedOutput()
+	out, err := Exec(context.Background(), NewCommand(args[0], args[1:]...))
 	if err != nil && printerr {
 		logger.Log(0, "error running command:", command)
-		logger.Log(0, strings.TrimSuffix(string(out), "\n"))
+		logger.Log(0, strings.TrimSuffix(out, "\n"))
 	}
-	return string(out), err
+	return out, err
 }
 
 // RunCmd - runs a local command
@@ -0,0 +1,91 @@
+package ncutils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/nftables/binaryutil"
+)
+
+// GetTCPPeerUID - returns the uid owning the local tcp socket connected from peerAddr to serverAddr,
+// used to identify which user is calling the local http server over loopback; ipv4 peers of a server
+// listening on ipv6 are found by their v4-mapped addresses
+func GetTCPPeerUID(peerAddr, serverAddr string) (int, error) {
+	peer, err := net.ResolveTCPAddr("tcp", peerAddr)
+	if err != nil {
+		return -1, err
+	}
+	server, err := net.ResolveTCPAddr("tcp", serverAddr)
+	if err != nil {
+		return -1, err
+	}
+	for _, procFile := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		uid, err := socketUID(procFile, peer, server)
+		if err != nil || uid >= 0 {
+			return uid, err
+		}
+	}
+	return -1, fmt.Errorf("no socket found for %s", peerAddr)
+}
+
+// socketUID - the uid owning the socket of the proc file with the local and remote address, -1 if
+// there is none
+func socketUID(procFile string, local, remote *net.TCPAddr) (int, error) {
+	f, err := os.Open(procFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return -1, nil
+		}
+		return -1, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // skip header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		if !sameTCPAddr(fields[1], local) || !sameTCPAddr(fields[2], remote) {
+			continue
+		}
+		return strconv.Atoi(fields[7])
+	}
+	return -1, scanner.Err()
+}
+
+// sameTCPAddr - checks if the address of a proc file equals addr, net.IP.Equal matches ipv4
+// addresses with their v4-mapped form
+func sameTCPAddr(procAddr string, addr *net.TCPAddr) bool {
+	ip, port, err := parseProcAddr(procAddr)
+	return err == nil && port == addr.Port && ip.Equal(addr.IP)
+}
+
+// parseProcAddr - parses an address of /proc/net/tcp or /proc/net/tcp6, hex encoded 32 bit words
+// in host byte order followed by the hex encoded port
+func parseProcAddr(procAddr string) (net.IP, int, error) {
+	hexIP, hexPort, ok := strings.Cut(procAddr, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid address %s", procAddr)
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return nil, 0, err
+	}
+	words, err := hex.DecodeString(hexIP)
+	if err != nil || (len(words) != net.IPv4len && len(words) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid address %s", procAddr)
+	}
+	ip := make(net.IP, len(words))
+	for i := 0; i < len(words); i += 4 {
+		copy(ip[i:], binaryutil.NativeEndian.PutUint32(binary.BigEndian.Uint32(words[i:])))
+	}
+	return ip, int(port), nil
+}
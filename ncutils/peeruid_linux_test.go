@@ -0,0 +1,56 @@
+package ncutils
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/google/nftables/binaryutil"
+)
+
+func TestParseProcAddr(t *testing.T) {
+	if binaryutil.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("the addresses are written on a little endian host")
+	}
+	for procAddr, want := range map[string]*net.TCPAddr{
+		"0100007F:1F90":                         {IP: net.ParseIP("127.0.0.1"), Port: 8080},
+		"0000000000000000FFFF00000100007F:1F90": {IP: net.ParseIP("127.0.0.1"), Port: 8080},
+		"00000000000000000000000001000000:0050": {IP: net.ParseIP("::1"), Port: 80},
+	} {
+		if !sameTCPAddr(procAddr, want) {
+			ip, port, err := parseProcAddr(procAddr)
+			t.Errorf("%s parsed as %s port %d (%v), want %s", procAddr, ip, port, err, want)
+		}
+	}
+}
+
+func TestGetTCPPeerUID(t *testing.T) {
+	for _, network := range []string{"tcp4", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			// a server listening on all addresses sees the ipv4 client by its v4-mapped address
+			listener, err := net.Listen(network, ":0")
+			if err != nil {
+				t.Skip(err)
+			}
+			defer listener.Close()
+			port := listener.Addr().(*net.TCPAddr).Port
+			conn, err := net.Dial("tcp4", (&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}).String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			server, err := listener.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+			uid, err := GetTCPPeerUID(server.RemoteAddr().String(), server.LocalAddr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uid != os.Getuid() {
+				t.Errorf("got uid %d, want %d", uid, os.Getuid())
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package ncutils
+
+import "errors"
+
+// GetTCPPeerUID - not supported on this platform
+func GetTCPPeerUID(peerAddr, serverAddr string) (int, error) {
+	return -1, errors.New("peer uid lookup is not supported on this platform")
+}
@@ -0,0 +1,63 @@
+package ncutils
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeLayout - layout of absolute timestamps in command output, the numeric offset keeps
+// timestamps from hosts in different timezones comparable
+const TimeLayout = "2006-01-02 15:04:05 -0700 MST"
+
+// FormatTime - renders a timestamp as absolute time in the local timezone, or utc,
+// followed by the time relative to now, e.g. "2023-05-01 10:04:05 +0200 CEST (2m ago)"
+func FormatTime(t time.Time, utc bool) string {
+	if t.IsZero() {
+		return "never"
+	}
+	if utc {
+		t = t.UTC()
+	} else {
+		t = t.Local()
+	}
+	return t.Format(TimeLayout) + " (" + FormatRelative(time.Until(t)) + ")"
+}
+
+// FormatRelative - renders an offset to now as "2m ago" for the past or "in 2m" for the future
+func FormatRelative(d time.Duration) string {
+	if d > -time.Second && d < time.Second {
+		return "now"
+	}
+	if d < 0 {
+		return FormatDuration(-d) + " ago"
+	}
+	return "in " + FormatDuration(d)
+}
+
+// FormatDuration - renders a duration in its two most significant units, e.g. "3d4h" or "2m5s"
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	d = d.Round(time.Second)
+	days := d / (24 * time.Hour)
+	hours := d % (24 * time.Hour) / time.Hour
+	minutes := d % time.Hour / time.Minute
+	seconds := d % time.Minute / time.Second
+	switch {
+	case days > 0 && hours > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case days > 0:
+		return fmt.Sprintf("%dd", days)
+	case hours > 0 && minutes > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh", hours)
+	case minutes > 0 && seconds > 0:
+		return fmt.Sprintf("%dm%ds", minutes, seconds)
+	case minutes > 0:
+		return fmt.Sprintf("%dm", minutes)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
@@ -0,0 +1,52 @@
+package ncutils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                                    "0s",
+		42 * time.Second:                     "42s",
+		2 * time.Minute:                      "2m",
+		2*time.Minute + 5*time.Second:        "2m5s",
+		3*time.Hour + 10*time.Minute:         "3h10m",
+		3*time.Hour + 10*time.Second:         "3h",
+		50 * time.Hour:                       "2d2h",
+		-(90 * time.Second):                  "1m30s",
+		2*time.Minute + 500*time.Millisecond: "2m1s",
+	}
+	for d, want := range cases {
+		if got := FormatDuration(d); got != want {
+			t.Errorf("FormatDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestFormatRelative(t *testing.T) {
+	if got := FormatRelative(-2 * time.Minute); got != "2m ago" {
+		t.Errorf("got %q", got)
+	}
+	if got := FormatRelative(time.Hour); got != "in 1h" {
+		t.Errorf("got %q", got)
+	}
+	if got := FormatRelative(0); got != "now" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	if got := FormatTime(time.Time{}, true); got != "never" {
+		t.Errorf("zero time rendered as %q", got)
+	}
+	ts := time.Now().Add(-5 * time.Minute)
+	got := FormatTime(ts, true)
+	if !strings.HasPrefix(got, ts.UTC().Format(TimeLayout)) || !strings.HasSuffix(got, "(5m ago)") {
+		t.Errorf("FormatTime = %q", got)
+	}
+	if !strings.Contains(got, "+0000 UTC") {
+		t.Errorf("utc timestamp without utc offset: %q", got)
+	}
+}
@@ -0,0 +1,57 @@
+package ncutils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// WgQuickConfig - renders a wireguard configuration in the wg-quick format,
+// extra lines (e.g. Table, PostUp) are added to the [Interface] section
+func WgQuickConfig(privateKey wgtypes.Key, listenPort, mtu int, addresses []net.IPNet, peers []wgtypes.PeerConfig, extra ...string) string {
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "PrivateKey = %s\n", privateKey.String())
+	if len(addresses) > 0 {
+		addrs := make([]string, 0, len(addresses))
+		for _, addr := range addresses {
+			addrs = append(addrs, addr.String())
+		}
+		fmt.Fprintf(&b, "Address = %s\n", strings.Join(addrs, ", "))
+	}
+	if listenPort != 0 {
+		fmt.Fprintf(&b, "ListenPort = %d\n", listenPort)
+	}
+	if mtu != 0 {
+		fmt.Fprintf(&b, "MTU = %d\n", mtu)
+	}
+	for _, line := range extra {
+		b.WriteString(line + "\n")
+	}
+	for _, peer := range peers {
+		if peer.Remove {
+			continue
+		}
+		b.WriteString("\n[Peer]\n")
+		fmt.Fprintf(&b, "PublicKey = %s\n", peer.PublicKey.String())
+		if peer.PresharedKey != nil {
+			fmt.Fprintf(&b, "PresharedKey = %s\n", peer.PresharedKey.String())
+		}
+		if len(peer.AllowedIPs) > 0 {
+			allowed := make([]string, 0, len(peer.AllowedIPs))
+			for _, ip := range peer.AllowedIPs {
+				allowed = append(allowed, ip.String())
+			}
+			fmt.Fprintf(&b, "AllowedIPs = %s\n", strings.Join(allowed, ", "))
+		}
+		if peer.Endpoint != nil && peer.Endpoint.IP != nil {
+			fmt.Fprintf(&b, "Endpoint = %s\n", peer.Endpoint.String())
+		}
+		if peer.PersistentKeepaliveInterval != nil && *peer.PersistentKeepaliveInterval > 0 {
+			fmt.Fprintf(&b, "PersistentKeepalive = %d\n", int(peer.PersistentKeepaliveInterval.Seconds()))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package ncutils
+
+import (
+	"bytes"
+	"net"
+)
+
+// WoLPort - udp port magic packets are sent to
+const WoLPort = 9
+
+var wolSync = bytes.Repeat([]byte{0xff}, 6)
+
+// MagicPacket - builds a wake-on-lan magic packet for the mac address
+func MagicPacket(mac net.HardwareAddr) []byte {
+	packet := make([]byte, 0, 102)
+	packet = append(packet, wolSync...)
+	for i := 0; i < 16; i++ {
+		packet = append(packet, mac...)
+	}
+	return packet
+}
+
+// ParseMagicPacket - returns the target mac address of a valid magic packet
+func ParseMagicPacket(packet []byte) (net.HardwareAddr, bool) {
+	if len(packet) != 102 || !bytes.Equal(packet[:6], wolSync) {
+		return nil, false
+	}
+	mac := net.HardwareAddr(packet[6:12])
+	for i := 1; i < 16; i++ {
+		if !bytes.Equal(packet[6+i*6:12+i*6], mac) {
+			return nil, false
+		}
+	}
+	return mac, true
+}
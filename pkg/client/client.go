@@ -0,0 +1,146 @@
+// Package client lets other Go programs control the netclient host of this machine without
+// shelling out to the CLI. It works on the same configuration files as the CLI and the running
+// daemon picks up the changes, so only one Client should be used per process.
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/functions"
+	"github.com/gravitl/netmaker/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ErrNotInitialized - the host has no netclient configuration yet, run `netclient install` first
+var ErrNotInitialized = errors.New("netclient host is not initialized")
+
+// Client - controls the local netclient host
+type Client struct{}
+
+// Status - state of the host and its networks
+type Status struct {
+	HostID     string          `json:"host_id"`
+	HostName   string          `json:"host_name"`
+	Server     string          `json:"server"`
+	ListenPort int             `json:"listen_port"`
+	Networks   []NetworkStatus `json:"networks"`
+}
+
+// NetworkStatus - state of the host in a network
+type NetworkStatus struct {
+	Network   string `json:"network"`
+	Server    string `json:"server"`
+	NodeID    string `json:"node_id"`
+	Connected bool   `json:"connected"`
+	Address   string `json:"address,omitempty"`
+	Address6  string `json:"address6,omitempty"`
+}
+
+// New - loads the netclient configuration of the host
+func New() (*Client, error) {
+	if _, err := config.ReadNetclientConfig(); err != nil {
+		return nil, err
+	}
+	if (config.Netclient().PrivateKey == wgtypes.Key{}) {
+		return nil, ErrNotInitialized
+	}
+	_ = config.ReadServerConf()
+	_ = config.ReadNodeConfig()
+	config.SetServerCtx()
+	return &Client{}, nil
+}
+
+// Join - registers the host with an enrollment token, joining the networks of the token
+func (c *Client) Join(ctx context.Context, token string) error {
+	return run(ctx, func() error {
+		return functions.Register(token, false)
+	})
+}
+
+// Leave - removes the host from a network
+func (c *Client) Leave(ctx context.Context, network string) error {
+	return run(ctx, func() error {
+		faults, err := functions.LeaveNetwork(network, false)
+		if err != nil {
+			return err
+		}
+		if len(faults) > 0 {
+			msgs := make([]string, 0, len(faults))
+			for _, fault := range faults {
+				msgs = append(msgs, fault.Error())
+			}
+			return errors.New("left network with errors: " + strings.Join(msgs, "; "))
+		}
+		return nil
+	})
+}
+
+// Status - returns the state of the host and its networks
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	if err := ctx.Err(); err != nil {
+		return Status{}, err
+	}
+	host := config.Netclient()
+	status := Status{
+		HostID:     host.ID.String(),
+		HostName:   host.Name,
+		Server:     config.CurrServer,
+		ListenPort: host.ListenPort,
+		Networks:   []NetworkStatus{},
+	}
+	for _, node := range config.GetNodes() {
+		status.Networks = append(status.Networks, NetworkStatus{
+			Network:   node.Network,
+			Server:    node.Server,
+			NodeID:    node.ID.String(),
+			Connected: node.Connected,
+			Address:   addrString(node.Address),
+			Address6:  addrString(node.Address6),
+		})
+	}
+	sort.Slice(status.Networks, func(i, j int) bool {
+		return status.Networks[i].Network < status.Networks[j].Network
+	})
+	return status, nil
+}
+
+// ApplyPeerUpdate - applies a peer update from the server to the netmaker interface, for programs
+// that run the interface in-process instead of the netclient daemon
+func (c *Client) ApplyPeerUpdate(ctx context.Context, server string, update models.HostPeerUpdate) error {
+	return run(ctx, func() error {
+		if config.GetServer(server) == nil {
+			return errors.New("server config not found: " + server)
+		}
+		return functions.ApplyPeerUpdate(ctx, server, update)
+	})
+}
+
+// run - runs the operation, returning early with the context error if the context ends first,
+// the operation itself keeps running to completion so the configuration stays consistent
+func run(ctx context.Context, op func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- op()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func addrString(addr net.IPNet) string {
+	if addr.IP == nil {
+		return ""
+	}
+	return addr.String()
+}
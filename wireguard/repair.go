@@ -0,0 +1,101 @@
+package wireguard
+
+import (
+	"net"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// kinds of discrepancies found by VerifyNetwork
+const (
+	DiscrepancyInterface = "interface"
+	DiscrepancyAddress   = "address"
+	DiscrepancyRoute     = "route"
+	DiscrepancyRule      = "rule"
+	DiscrepancyPeer      = "peer"
+	DiscrepancySysctl    = "sysctl"
+)
+
+// Discrepancy - a difference between the desired and the actual state of the netmaker interface
+type Discrepancy struct {
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+// repaired - records the outcome of a repair on the discrepancy
+func (d *Discrepancy) repaired(err error) {
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+	d.Repaired = true
+}
+
+// networkPeers - the peers of the host to configure which have an address in the network of the node
+func networkPeers(node config.Node) []wgtypes.PeerConfig {
+	peers := []wgtypes.PeerConfig{}
+	for _, peer := range config.Netclient().HostPeers {
+		if peer.Remove || config.IsDeniedPeer(peer.PublicKey.String()) {
+			continue
+		}
+		for _, allowed := range peer.AllowedIPs {
+			if node.NetworkRange.Contains(allowed.IP) || node.NetworkRange6.Contains(allowed.IP) {
+				peers = append(peers, peer)
+				break
+			}
+		}
+	}
+	return peers
+}
+
+// peerGateway - the address of the peer in the network of the node for the address family of ip
+func peerGateway(node config.Node, peer wgtypes.PeerConfig, ip net.IP) net.IP {
+	network := node.NetworkRange
+	if ip.To4() == nil {
+		network = node.NetworkRange6
+	}
+	for _, allowed := range peer.AllowedIPs {
+		if network.Contains(allowed.IP) {
+			return allowed.IP
+		}
+	}
+	return nil
+}
+
+// isNetworkAddress - checks if ip belongs to the network range of any joined network
+func isNetworkAddress(ip net.IP) bool {
+	for _, node := range config.GetNodes() {
+		if node.NetworkRange.Contains(ip) || node.NetworkRange6.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPeers - checks that the peers of the network are configured on the interface,
+// missing peers are configured again unless dryRun
+func verifyPeers(node config.Node, dryRun bool) []Discrepancy {
+	discrepancies := []Discrepancy{}
+	missing := false
+	for _, peer := range networkPeers(node) {
+		if _, err := GetPeer(ncutils.GetInterfaceName(), peer.PublicKey.String()); err == nil {
+			continue
+		}
+		missing = true
+		discrepancies = append(discrepancies, Discrepancy{
+			Kind:   DiscrepancyPeer,
+			Detail: "peer " + peer.PublicKey.String() + " is not configured on the interface",
+		})
+	}
+	if missing && !dryRun {
+		err := SetPeers(false)
+		for i := range discrepancies {
+			discrepancies[i].repaired(err)
+		}
+	}
+	return discrepancies
+}
@@ -0,0 +1,232 @@
+package wireguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gravitl/netclient/config"
+	"github.com/gravitl/netclient/ncutils"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// VerifyNetwork - checks the link, addresses, routes, routing rules, peers and sysctls of the
+// network of node against the desired state and repairs the discrepancies unless dryRun,
+// without recreating the interface
+func VerifyNetwork(node config.Node, dryRun bool) ([]Discrepancy, error) {
+	ifaceName := ncutils.GetInterfaceName()
+	l, err := netlink.LinkByName(ifaceName)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s not found, restart the daemon to recreate it: %w", ifaceName, err)
+	}
+	discrepancies := []Discrepancy{}
+	if l.Attrs().Flags&net.FlagUp == 0 {
+		d := Discrepancy{Kind: DiscrepancyInterface, Detail: "interface " + ifaceName + " is down"}
+		if !dryRun {
+			d.repaired(netlink.LinkSetUp(l))
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	table := config.GetRouteTable(node.Network)
+	for _, addr := range []ifaceAddress{
+		{IP: node.Address.IP, Network: node.NetworkRange, Table: table},
+		{IP: node.Address6.IP, Network: node.NetworkRange6, Table: table},
+	} {
+		if addr.IP == nil || addr.Network.IP == nil {
+			continue
+		}
+		discrepancies = append(discrepancies, verifyAddress(l, addr, dryRun)...)
+	}
+	discrepancies = append(discrepancies, verifyPeers(node, dryRun)...)
+	discrepancies = append(discrepancies, verifyPeerRoutes(l, node, table, dryRun)...)
+	discrepancies = append(discrepancies, verifySysctls(ifaceName, node, dryRun)...)
+	return discrepancies, nil
+}
+
+// verifyAddress - checks the address, the route to its network and the routing rules of its table
+func verifyAddress(l netlink.Link, addr ifaceAddress, dryRun bool) []Discrepancy {
+	discrepancies := []Discrepancy{}
+	family := netlink.FAMILY_V4
+	if addr.IP.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+	wanted := &net.IPNet{IP: addr.IP, Mask: addr.Network.Mask}
+	current, err := netlink.AddrList(l, family)
+	if err != nil {
+		return []Discrepancy{{Kind: DiscrepancyAddress, Detail: "failed to list addresses", Error: err.Error()}}
+	}
+	var found *netlink.Addr
+	for i := range current {
+		if current[i].IP.Equal(addr.IP) {
+			found = &current[i]
+			break
+		}
+	}
+	if found == nil || found.IPNet.String() != wanted.String() {
+		d := Discrepancy{Kind: DiscrepancyAddress, Detail: "address " + wanted.String() + " is missing"}
+		if found != nil {
+			d.Detail = fmt.Sprintf("address %s is configured as %s", wanted.String(), found.IPNet.String())
+		}
+		if !dryRun {
+			nlAddr := &netlink.Addr{IPNet: wanted}
+			if addr.Table != 0 || config.Netclient().MinimalRoutes.Enabled {
+				nlAddr.Flags = unix.IFA_F_NOPREFIXROUTE
+			}
+			d.repaired(netlink.AddrReplace(l, nlAddr))
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	table := addr.Table
+	if table == 0 {
+		table = unix.RT_TABLE_MAIN
+	}
+	network := addr.Network
+	if !routeExists(l, family, &network, table) {
+		d := Discrepancy{Kind: DiscrepancyRoute, Detail: fmt.Sprintf("route to %s in table %d is missing", network.String(), table)}
+		if !dryRun {
+			d.repaired(netlink.RouteReplace(networkRoute(l, addr)))
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	if addr.Table != 0 {
+		discrepancies = append(discrepancies, verifyRouteRules(addr.Table, addr.IP, dryRun)...)
+	}
+	return discrepancies
+}
+
+// verifyRouteRules - checks the ip rules looking up the routing table of a network
+func verifyRouteRules(table int, ip net.IP, dryRun bool) []Discrepancy {
+	missing, err := missingRouteRules(table, ip)
+	if err != nil {
+		return []Discrepancy{{Kind: DiscrepancyRule, Detail: "failed to list routing rules", Error: err.Error()}}
+	}
+	discrepancies := []Discrepancy{}
+	for _, rule := range missing {
+		d := Discrepancy{Kind: DiscrepancyRule, Detail: fmt.Sprintf("routing rule to table %d is missing", table)}
+		if rule.Src != nil {
+			d.Detail = fmt.Sprintf("routing rule from %s to table %d is missing", rule.Src.String(), table)
+		}
+		if !dryRun {
+			d.repaired(netlink.RuleAdd(rule))
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies
+}
+
+// verifyPeerRoutes - checks the routes to the allowed ips of the peers outside of the network
+// ranges, such as egress ranges, through the address of the peer in the network
+func verifyPeerRoutes(l netlink.Link, node config.Node, table int, dryRun bool) []Discrepancy {
+	if table == 0 {
+		table = unix.RT_TABLE_MAIN
+	}
+	discrepancies := []Discrepancy{}
+	checked := make(map[string]bool)
+	for _, peer := range networkPeers(node) {
+		for _, allowed := range peer.AllowedIPs {
+			ones, _ := allowed.Mask.Size()
+			if ones == 0 || isNetworkAddress(allowed.IP) {
+				continue
+			}
+			dst := net.IPNet{IP: allowed.IP.Mask(allowed.Mask), Mask: allowed.Mask}
+			if checked[dst.String()] {
+				continue
+			}
+			checked[dst.String()] = true
+			gw := peerGateway(node, peer, allowed.IP)
+			if gw == nil {
+				continue
+			}
+			family := netlink.FAMILY_V4
+			if gw.To4() == nil {
+				family = netlink.FAMILY_V6
+			}
+			if routeExists(l, family, &dst, table) {
+				continue
+			}
+			d := Discrepancy{Kind: DiscrepancyRoute, Detail: fmt.Sprintf("route to %s via %s in table %d is missing", dst.String(), gw.String(), table)}
+			if !dryRun {
+				d.repaired(netlink.RouteReplace(&netlink.Route{
+					LinkIndex: l.Attrs().Index,
+					Gw:        gw,
+					Dst:       &dst,
+					Table:     table,
+				}))
+			}
+			discrepancies = append(discrepancies, d)
+		}
+	}
+	return discrepancies
+}
+
+// routeExists - checks if the route to dst over the link is present in the table
+func routeExists(l netlink.Link, family int, dst *net.IPNet, table int) bool {
+	routes, err := netlink.RouteListFiltered(family, &netlink.Route{LinkIndex: l.Attrs().Index, Dst: dst, Table: table},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_DST|netlink.RT_FILTER_TABLE)
+	return err == nil && len(routes) > 0
+}
+
+// verifySysctls - checks that reverse path filtering does not drop routed traffic arriving on the
+// interface and that forwarding is enabled on gateways, relays and hosts routing between their networks
+func verifySysctls(ifaceName string, node config.Node, dryRun bool) []Discrepancy {
+	discrepancies := []Discrepancy{}
+	// the effective mode is the maximum of the interface and the all setting, strict (1) drops
+	// traffic of egress ranges and relayed peers, loose (2) overrides it
+	if readSysctl("net.ipv4.conf.all.rp_filter") == "1" || readSysctl("net.ipv4.conf."+ifaceName+".rp_filter") == "1" {
+		d := Discrepancy{Kind: DiscrepancySysctl, Detail: "strict reverse path filtering (rp_filter=1) on " + ifaceName}
+		if !dryRun {
+			d.repaired(writeSysctl("net.ipv4.conf."+ifaceName+".rp_filter", "2"))
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	if !node.IsEgressGateway && !node.IsIngressGateway && !node.IsRelay && !node.IsInternetGateway &&
+		!config.Netclient().InterNetwork.Enabled {
+		return discrepancies
+	}
+	keys := []string{}
+	if node.Address.IP != nil {
+		keys = append(keys, "net.ipv4.ip_forward")
+	}
+	if node.Address6.IP != nil {
+		keys = append(keys, "net.ipv6.conf.all.forwarding")
+	}
+	for _, key := range keys {
+		if readSysctl(key) == "1" {
+			continue
+		}
+		d := Discrepancy{Kind: DiscrepancySysctl, Detail: key + " is disabled on a gateway"}
+		if !dryRun {
+			d.repaired(writeSysctl(key, "1"))
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies
+}
+
+// sysctlPath - the path of a sysctl key under /proc/sys
+func sysctlPath(key string) string {
+	return "/proc/sys/" + strings.ReplaceAll(key, ".", "/")
+}
+
+// readSysctl - reads a sysctl, empty if it can not be read
+func readSysctl(key string) string {
+	data, err := os.ReadFile(sysctlPath(key))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeSysctl - writes a sysctl
+func writeSysctl(key, value string) error {
+	if err := os.WriteFile(sysctlPath(key), []byte(value), 0644); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("setting %s requires root: %w", key, err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package wireguard
+
+import (
+	"errors"
+
+	"github.com/gravitl/netclient/config"
+)
+
+// VerifyNetwork - repairing the interface in place relies on netlink, only available on linux
+func VerifyNetwork(node config.Node, dryRun bool) ([]Discrepancy, error) {
+	return nil, errors.New("repair is only supported on linux, reconnect the network instead")
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
+	"golang.org/x/exp/slog"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
@@ -27,7 +28,7 @@ var wgMutex = sync.Mutex{} // used to mutex functions of the interface
 // NewNCIFace - creates a new Netclient interface in memory
 func NewNCIface(host *config.Config, nodes config.NodeMap) *NCIface {
 	firewallMark := 0
-	peers := config.Netclient().HostPeers
+	peers := excludeBlockedPeers(config.Netclient().HostPeers)
 	// on freebsd, calling wgcltl.Client.ConfigureDevice() with []Peers{} causes an ioctl error --> ioctl: bad address
 	if len(peers) == 0 {
 		peers = nil
@@ -38,12 +39,14 @@ func NewNCIface(host *config.Config, nodes config.NodeMap) *NCIface {
 			addrs = append(addrs, ifaceAddress{
 				IP:      node.Address.IP,
 				Network: node.NetworkRange,
+				Table:   config.GetRouteTable(node.Network),
 			})
 		}
 		if node.Address6.IP != nil {
 			addrs = append(addrs, ifaceAddress{
 				IP:      node.Address6.IP,
 				Network: node.NetworkRange6,
+				Table:   config.GetRouteTable(node.Network),
 			})
 		}
 
@@ -79,6 +82,7 @@ type ifaceAddress struct {
 	IP       net.IP
 	Network  net.IPNet
 	AddRoute bool
+	Table    int // routing table for the route to Network (linux), 0 is the main table
 }
 
 // Close closes a netclient interface
@@ -102,13 +106,25 @@ func (n *NCIface) Configure() error {
 	return apply(&n.Config)
 }
 
+// SetEgressRoutes - adds routes to the egress ranges through their gateways,
+// a range advertised by several egress gateways is routed through the first one only: wireguard
+// delivers packets to the single peer holding the range in its allowed ips, so installing
+// multipath (ECMP) routes over the netmaker interface would not spread the traffic
 func SetEgressRoutes(egressRoutes []models.EgressNetworkRoutes) {
 	addrs := []ifaceAddress{}
+	gateways := make(map[string]string)
 	for _, egressRoute := range egressRoutes {
 		for _, egressRange := range egressRoute.EgressRanges {
+			if gw, ok := gateways[egressRange]; ok {
+				slog.Debug("egress range has multiple gateways, using the first one", "range", egressRange,
+					"gateway", gw, "ignored", egressRoute.NodeAddr.IP.String())
+				continue
+			}
+			gateways[egressRange] = egressRoute.NodeAddr.IP.String()
 			addrs = append(addrs, ifaceAddress{
 				IP:      egressRoute.NodeAddr.IP,
 				Network: config.ToIPNet(egressRange),
+				Table:   config.GetRouteTableForAddr(egressRoute.NodeAddr.IP),
 			})
 
 		}
@@ -117,6 +133,24 @@ func SetEgressRoutes(egressRoutes []models.EgressNetworkRoutes) {
 	SetRoutes(addrs)
 }
 
+// AddEgressRange - adds the route to an egress range through the gateway to the netmaker interface
+func AddEgressRange(egressRange string, gateway net.IP) {
+	SetRoutes([]ifaceAddress{{
+		IP:      gateway,
+		Network: config.ToIPNet(egressRange),
+		Table:   config.GetRouteTableForAddr(gateway),
+	}})
+}
+
+// RemoveEgressRange - removes the route to an egress range through the gateway from the netmaker interface
+func RemoveEgressRange(egressRange string, gateway net.IP) {
+	RemoveRoutes([]ifaceAddress{{
+		IP:      gateway,
+		Network: config.ToIPNet(egressRange),
+		Table:   config.GetRouteTableForAddr(gateway),
+	}})
+}
+
 func GetInterface() *NCIface {
 	return &netmaker
 }
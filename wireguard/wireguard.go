@@ -50,7 +50,11 @@ func SetPeers(replace bool) error {
 		if !peer.Remove && checkForBetterEndpoint(&peer) {
 			peers[i] = peer
 		}
+		if !peer.Remove {
+			config.ApplyTagPolicies(&peers[i])
+		}
 	}
+	peers = excludeBlockedPeers(peers)
 	GetInterface().Config.Peers = peers
 	// on freebsd, calling wgcltl.Client.ConfigureDevice() with []Peers{} causes an ioctl error --> ioctl: bad address
 	if len(peers) == 0 {
@@ -65,6 +69,27 @@ func SetPeers(replace bool) error {
 
 // == private ==
 
+// excludeBlockedPeers - drops the locally blocked peers, the peers outside of their access
+// schedules and expired ext clients from the peers to configure,
+// blocked peers still present on the interface are removed from it
+func excludeBlockedPeers(peers []wgtypes.PeerConfig) []wgtypes.PeerConfig {
+	if !config.HasDeniedPeers() {
+		return peers
+	}
+	filtered := make([]wgtypes.PeerConfig, 0, len(peers))
+	for _, peer := range peers {
+		if !config.IsDeniedPeer(peer.PublicKey.String()) {
+			filtered = append(filtered, peer)
+			continue
+		}
+		// removing a peer unknown to the interface fails the whole configuration
+		if _, err := GetPeer(ncutils.GetInterfaceName(), peer.PublicKey.String()); err == nil {
+			filtered = append(filtered, wgtypes.PeerConfig{PublicKey: peer.PublicKey, Remove: true})
+		}
+	}
+	return filtered
+}
+
 // UpdatePeer replaces a wireguard peer
 // temporarily making public func to pass staticchecks
 // this function will be required in future when update node on server is refactored
@@ -88,8 +113,12 @@ func apply(c *wgtypes.Config) error {
 }
 
 // returns if better endpoint has been calculated for this peer already
-// if so sets it and returns true
+// if so sets it and returns true, peers pinned to their advertised endpoint or to a relay keep it
 func checkForBetterEndpoint(peer *wgtypes.PeerConfig) bool {
+	switch config.GetPeerPath(peer.PublicKey.String()) {
+	case config.PeerPathDirect, config.PeerPathRelay:
+		return false
+	}
 	if endpoint, ok := cache.EndpointCache.Load(peer.PublicKey.String()); ok && endpoint != nil {
 		var cacheEndpoint cache.EndpointCacheValue
 		cacheEndpoint, ok = endpoint.(cache.EndpointCacheValue)
@@ -1,9 +1,9 @@
 package wireguard
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 
 	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netmaker/logger"
@@ -22,31 +22,31 @@ func (nc *NCIface) ApplyAddrs() error {
 		if address.IP != nil {
 			if address.IP.To4() != nil {
 
-				cmd := exec.Command("ifconfig", nc.Name, "inet", "add", address.IP.String(), address.IP.String())
-				if out, err := cmd.CombinedOutput(); err != nil {
-					slog.Error("error adding address", "command", cmd.String(), "error", string(out))
+				cmd := ncutils.NewCommand("ifconfig", nc.Name, "inet", "add", address.IP.String(), address.IP.String())
+				if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
+					slog.Error("error adding address", "command", cmd.String(), "error", out)
 					continue
 				}
 			} else {
 
-				cmd := exec.Command("ifconfig", nc.Name, "inet6", "add", address.IP.String(), address.IP.String())
-				if out, err := cmd.CombinedOutput(); err != nil {
-					slog.Error("error adding address", "command", cmd.String(), "error", string(out))
+				cmd := ncutils.NewCommand("ifconfig", nc.Name, "inet6", "add", address.IP.String(), address.IP.String())
+				if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
+					slog.Error("error adding address", "command", cmd.String(), "error", out)
 					continue
 				}
 			}
 
 		}
 		if address.Network.IP.To4() != nil {
-			cmd := exec.Command("route", "add", "-net", "-inet", address.Network.String(), address.IP.String())
-			if out, err := cmd.CombinedOutput(); err != nil {
-				slog.Error("failed to add route", "command", cmd.String(), "error", string(out))
+			cmd := ncutils.NewCommand("route", "add", "-net", "-inet", address.Network.String(), address.IP.String())
+			if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
+				slog.Error("failed to add route", "command", cmd.String(), "error", out)
 				continue
 			}
 		} else {
-			cmd := exec.Command("route", "add", "-net", "-inet6", address.Network.String(), address.IP.String())
-			if out, err := cmd.CombinedOutput(); err != nil {
-				slog.Error("failed to add route", "command", cmd.String(), "error", string(out))
+			cmd := ncutils.NewCommand("route", "add", "-net", "-inet6", address.Network.String(), address.IP.String())
+			if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
+				slog.Error("failed to add route", "command", cmd.String(), "error", out)
 				continue
 			}
 		}
@@ -65,15 +65,15 @@ func SetRoutes(addrs []ifaceAddress) {
 		}
 
 		if addr.Network.IP.To4() != nil {
-			cmd := exec.Command("route", "add", "-net", "-inet", addr.Network.String(), addr.IP.String())
-			if out, err := cmd.CombinedOutput(); err != nil {
-				slog.Error("failed to add route with", "command", cmd.String(), "error", string(out))
+			cmd := ncutils.NewCommand("route", "add", "-net", "-inet", addr.Network.String(), addr.IP.String())
+			if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
+				slog.Error("failed to add route with", "command", cmd.String(), "error", out)
 				continue
 			}
 		} else {
-			cmd := exec.Command("route", "add", "-net", "-inet6", addr.Network.String(), addr.IP.String())
-			if out, err := cmd.CombinedOutput(); err != nil {
-				slog.Error("failed to add route with", "command", cmd.String(), "error", string(out))
+			cmd := ncutils.NewCommand("route", "add", "-net", "-inet6", addr.Network.String(), addr.IP.String())
+			if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
+				slog.Error("failed to add route with", "command", cmd.String(), "error", out)
 				continue
 			}
 		}
@@ -81,10 +81,27 @@ func SetRoutes(addrs []ifaceAddress) {
 	}
 }
 
+// RemoveRoutes - removes additional routes from the interface
+func RemoveRoutes(addrs []ifaceAddress) {
+	for _, addr := range addrs {
+		if addr.Network.IP == nil {
+			continue
+		}
+		family := "-inet"
+		if addr.Network.IP.To4() == nil {
+			family = "-inet6"
+		}
+		cmd := ncutils.NewCommand("route", "delete", "-net", family, addr.Network.String())
+		if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
+			slog.Error("failed to remove route with", "command", cmd.String(), "error", out)
+		}
+	}
+}
+
 func (nc *NCIface) SetMTU() error {
 	// set MTU for the interface
-	cmd := exec.Command("ifconfig", nc.Name, "mtu", fmt.Sprint(nc.MTU), "up")
-	if out, err := cmd.CombinedOutput(); err != nil {
+	cmd := ncutils.NewCommand("ifconfig", nc.Name, "mtu", fmt.Sprint(nc.MTU), "up")
+	if out, err := ncutils.Exec(context.Background(), cmd); err != nil {
 		logger.Log(0, fmt.Sprintf("failed to set mtu with command %s - %v", cmd.String(), out))
 		return err
 	}
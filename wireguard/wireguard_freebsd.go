@@ -105,6 +105,22 @@ func SetRoutes(addrs []ifaceAddress) {
 	}
 }
 
+// RemoveRoutes - removes additional routes from the interface
+func RemoveRoutes(addrs []ifaceAddress) {
+	for _, addr := range addrs {
+		if addr.Network.IP == nil {
+			continue
+		}
+		family := "-inet"
+		if addr.Network.IP.To4() == nil {
+			family = "-inet6"
+		}
+		if _, err := ncutils.RunCmd(fmt.Sprintf("route delete -net %s %s", family, addr.Network.String()), true); err != nil {
+			slog.Error("error removing route", "address", addr.Network.String(), "error", err.Error())
+		}
+	}
+}
+
 // NCIface.SetMTU - set MTU for netmaker interface
 func (nc *NCIface) SetMTU() error {
 	slog.Debug("setting mtu for netmaker interface")
@@ -1,15 +1,19 @@
 package wireguard
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 
+	"github.com/gravitl/netclient/config"
 	"github.com/gravitl/netclient/ncutils"
 	"github.com/gravitl/netmaker/logger"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/exp/slices"
 	"golang.org/x/exp/slog"
+	"golang.org/x/sys/unix"
 )
 
 // NCIface.Create - creates a linux WG interface based on a node's host config
@@ -43,9 +47,10 @@ func (nc *NCIface) Create() error {
 		}
 		return nil
 	} else if isTunModuleLoaded() {
-		if err := nc.createUserSpaceWG(); err != nil {
-			return err
+		if ncutils.IsWSL() {
+			slog.Info("kernel wireguard not available in wsl, using userspace wireguard")
 		}
+		return nc.createUserSpaceWG()
 	}
 	return fmt.Errorf("WireGuard not detected")
 }
@@ -73,6 +78,7 @@ func (l *netLink) Type() string {
 func (n *NCIface) Close() {
 	link := n.getKernelLink()
 	link.Close()
+	removeRouteRules()
 }
 
 // netLink.Close - required function to close linux interface
@@ -96,6 +102,14 @@ func (nc *NCIface) ApplyAddrs() error {
 		return err
 	}
 
+	for _, table := range config.Netclient().RouteTables {
+		tableRoutes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL,
+			&netlink.Route{LinkIndex: l.Attrs().Index, Table: table}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, tableRoutes...)
+	}
 	for i := range routes {
 		err = netlink.RouteDel(&routes[i])
 		if err != nil {
@@ -112,13 +126,29 @@ func (nc *NCIface) ApplyAddrs() error {
 		}
 	}
 
+	minimal := config.Netclient().MinimalRoutes.Enabled
 	for _, addr := range nc.Addresses {
 		if addr.IP != nil && addr.Network.IP != nil {
 			slog.Info("adding address", "address", addr.IP.String(), "network", addr.Network.String())
-			if err := netlink.AddrAdd(l, &netlink.Addr{IPNet: &net.IPNet{IP: addr.IP, Mask: addr.Network.Mask}}); err != nil {
+			nlAddr := &netlink.Addr{IPNet: &net.IPNet{IP: addr.IP, Mask: addr.Network.Mask}}
+			if addr.Table != 0 || minimal {
+				// keep the prefix route out of the main table, it is added to the network's table below
+				// or at the lowest priority in minimal routes mode
+				nlAddr.Flags = unix.IFA_F_NOPREFIXROUTE
+			}
+			if err := netlink.AddrAdd(l, nlAddr); err != nil {
 				slog.Error("error adding addr", "error", err.Error())
 
 			}
+			if addr.Table != 0 {
+				if err := addTableRoute(l, addr); err != nil {
+					slog.Error("error adding network route", "table", addr.Table, "error", err.Error())
+				}
+			} else if minimal {
+				if err := netlink.RouteReplace(networkRoute(l, addr)); err != nil {
+					slog.Error("error adding network route", "error", err.Error())
+				}
+			}
 		}
 
 	}
@@ -137,20 +167,401 @@ func SetRoutes(addrs []ifaceAddress) {
 			addr.Network.String() == "::/0" {
 			continue
 		}
-		slog.Info("adding route to interface", "route", fmt.Sprintf("%s -> %s", addr.IP.String(), addr.Network.String()))
+		slog.Info("adding route to interface", "route", fmt.Sprintf("%s -> %s", addr.IP.String(), addr.Network.String()), "table", addr.Table)
+		if config.Netclient().MinimalRoutes.Enabled {
+			// the gateway is only reachable through its host route without the route to the network
+			if err := AddHostRoute(addr.IP); err != nil {
+				slog.Error("error adding host route to gateway", "gateway", addr.IP.String(), "error", err.Error())
+			}
+		}
 		if err := netlink.RouteAdd(&netlink.Route{
 			LinkIndex: l.Attrs().Index,
 			Gw:        addr.IP,
 			Dst:       &addr.Network,
+			Table:     addr.Table,
 		}); err != nil {
 			slog.Error("error adding route", "error", err.Error())
 		}
+		if addr.Table != 0 {
+			if err := ensureRouteRule(addr.Table, addr.IP); err != nil {
+				slog.Error("error adding routing rule", "table", addr.Table, "error", err.Error())
+			}
+		}
+
+	}
+}
+
+// RemoveRoutes - removes additional routes from the interface
+func RemoveRoutes(addrs []ifaceAddress) {
+	l, err := netlink.LinkByName(ncutils.GetInterfaceName())
+	if err != nil {
+		slog.Error("failed to get link to interface", "error", err)
+		return
+	}
+	for _, addr := range addrs {
+		if addr.Network.IP == nil {
+			continue
+		}
+		network := addr.Network
+		if err := netlink.RouteDel(&netlink.Route{
+			LinkIndex: l.Attrs().Index,
+			Dst:       &network,
+			Table:     addr.Table,
+		}); err != nil && !errors.Is(err, unix.ESRCH) {
+			slog.Error("error removing route", "route", addr.Network.String(), "error", err.Error())
+		}
+	}
+}
 
+// AddHostRoute - adds the host route to a peer address of a joined network, used in minimal routes mode
+func AddHostRoute(ip net.IP) error {
+	l, err := netlink.LinkByName(ncutils.GetInterfaceName())
+	if err != nil {
+		return err
 	}
+	route, err := hostRoute(l, ip)
+	if err != nil {
+		return err
+	}
+	return netlink.RouteReplace(route)
+}
+
+// RemoveHostRoute - removes the host route to a peer address of a joined network
+func RemoveHostRoute(ip net.IP) error {
+	l, err := netlink.LinkByName(ncutils.GetInterfaceName())
+	if err != nil {
+		return err
+	}
+	route, err := hostRoute(l, ip)
+	if err != nil {
+		return err
+	}
+	if err := netlink.RouteDel(route); err != nil && !errors.Is(err, unix.ESRCH) {
+		return err
+	}
+	return nil
 }
 
 // == private ==
 
+// hostRoute - the route to ip over the link from the address of the host in the network of ip,
+// in the routing table of the network
+func hostRoute(l netlink.Link, ip net.IP) (*netlink.Route, error) {
+	for _, node := range config.GetNodes() {
+		for _, addr := range []ifaceAddress{
+			{IP: node.Address.IP, Network: node.NetworkRange},
+			{IP: node.Address6.IP, Network: node.NetworkRange6},
+		} {
+			if addr.IP == nil || addr.Network.IP == nil || !addr.Network.Contains(ip) {
+				continue
+			}
+			dst := &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}
+			if dst.IP == nil {
+				dst = &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(128, 128)}
+			}
+			return &netlink.Route{
+				LinkIndex: l.Attrs().Index,
+				Dst:       dst,
+				Src:       addr.IP,
+				Scope:     netlink.SCOPE_LINK,
+				Table:     config.GetRouteTable(node.Network),
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not in the range of a joined network", ip)
+}
+
+// RouteRulePriority - priority of the ip rules sending traffic to netmaker routing tables,
+// evaluated before the main table (32766)
+const RouteRulePriority = 5210
+
+// MinimalRoutesMetric - metric of the routes to the network ranges in minimal routes mode, the lowest
+// priority so they never shadow a route of the host; traffic to the peers not learned yet still takes
+// the interface, which is how they are learned
+const MinimalRoutesMetric = 0xffff
+
+// networkRoute - the route to the network of the address over the link, in the address' routing table,
+// at MinimalRoutesMetric in minimal routes mode
+func networkRoute(l netlink.Link, addr ifaceAddress) *netlink.Route {
+	route := &netlink.Route{
+		LinkIndex: l.Attrs().Index,
+		Dst:       &addr.Network,
+		Src:       addr.IP,
+		Scope:     netlink.SCOPE_LINK,
+		Table:     addr.Table,
+	}
+	if config.Netclient().MinimalRoutes.Enabled {
+		route.Priority = MinimalRoutesMetric
+	}
+	return route
+}
+
+// addTableRoute - adds the route to the network of the address to the address' routing table
+func addTableRoute(l netlink.Link, addr ifaceAddress) error {
+	if err := netlink.RouteReplace(networkRoute(l, addr)); err != nil {
+		return err
+	}
+	return ensureRouteRule(addr.Table, addr.IP)
+}
+
+// AppRouteMark - firewall mark of the traffic of the applications selected for application routing
+const AppRouteMark = 0x4e4d
+
+// AppRouteMarkMask - the bits of the firewall mark of application routing, the other bits are left to the
+// egress policies and other tools
+const AppRouteMarkMask = 0xffff
+
+// ensureRouteRule - adds the ip rules looking up the table for the address family of ip, if not present,
+// in include mode of application routing only marked traffic and replies from ip look up the table
+func ensureRouteRule(table int, ip net.IP) error {
+	missing, err := missingRouteRules(table, ip)
+	if err != nil {
+		return err
+	}
+	for _, rule := range missing {
+		if err := netlink.RuleAdd(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingRouteRules - the ip rules looking up the table for the address family of ip which are not present
+func missingRouteRules(table int, ip net.IP) ([]*netlink.Rule, error) {
+	family := netlink.FAMILY_V4
+	if ip.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+	rules, err := netlink.RuleList(family)
+	if err != nil {
+		return nil, err
+	}
+	missing := []*netlink.Rule{}
+	for _, wanted := range routeRules(table, family, ip) {
+		exists := false
+		for _, rule := range rules {
+			if rule.Table == table && rule.Mark == wanted.Mark && rule.Src.String() == wanted.Src.String() {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			missing = append(missing, wanted)
+		}
+	}
+	return missing, nil
+}
+
+// routeRules - the ip rules looking up a netmaker routing table
+func routeRules(table, family int, ip net.IP) []*netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Family = family
+	rule.Table = table
+	rule.Priority = RouteRulePriority
+	if config.Netclient().AppRouting.Mode != config.AppRoutingInclude || !config.Netclient().AppRouting.Enabled() {
+		return []*netlink.Rule{rule}
+	}
+	rule.Mark = AppRouteMark
+	rule.Mask = AppRouteMarkMask
+	replies := netlink.NewRule()
+	replies.Family = family
+	replies.Table = table
+	replies.Priority = RouteRulePriority
+	bits := 32
+	if family == netlink.FAMILY_V6 {
+		bits = 128
+	}
+	replies.Src = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	return []*netlink.Rule{rule, replies}
+}
+
+// removeRouteRules - removes the ip rules of the configured netmaker routing tables
+func removeRouteRules() {
+	for _, table := range config.Netclient().RouteTables {
+		for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+			rules, err := netlink.RuleList(family)
+			if err != nil {
+				slog.Debug("failed to list routing rules", "error", err)
+				continue
+			}
+			for i := range rules {
+				if rules[i].Table != table || rules[i].Priority != RouteRulePriority {
+					continue
+				}
+				if err := netlink.RuleDel(&rules[i]); err != nil && !errors.Is(err, unix.ENOENT) {
+					slog.Debug("failed to remove routing rule", "table", table, "error", err)
+				}
+			}
+		}
+	}
+}
+
+// SetAppRouteBypass - in exclude mode of application routing, adds the ip rules sending marked traffic
+// to the main table ahead of the netmaker routing tables, otherwise removes them
+func SetAppRouteBypass(enabled bool) error {
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rule := netlink.NewRule()
+		rule.Family = family
+		rule.Table = unix.RT_TABLE_MAIN
+		rule.Priority = RouteRulePriority - 1
+		rule.Mark = AppRouteMark
+		rule.Mask = AppRouteMarkMask
+		if err := netlink.RuleDel(rule); err != nil && !errors.Is(err, unix.ENOENT) {
+			slog.Debug("failed to remove application routing rule", "error", err)
+		}
+		if !enabled {
+			continue
+		}
+		if err := netlink.RuleAdd(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EgressPolicyMarkMask - the bits of the firewall mark of egress policies, apart from the bits of
+// application routing
+const EgressPolicyMarkMask = 0xff0000
+
+// EgressPolicyMark - firewall mark of the egress policy at index i of the configured policies
+func EgressPolicyMark(i int) int {
+	return (i + 1) << 16 & EgressPolicyMarkMask
+}
+
+// EgressPolicyRulePriority - priority of the ip rules of egress policies, ahead of the netmaker routing tables
+const EgressPolicyRulePriority = RouteRulePriority - 10
+
+// EgressPolicyRoute - the routing table of an egress policy, routing the destinations over the netmaker
+// interface via the gateway for the traffic with the mark
+type EgressPolicyRoute struct {
+	Mark         int
+	Table        int
+	Gateway      net.IP
+	Destinations []net.IPNet
+}
+
+// egressPolicyTables - the routing tables of the applied egress policies
+var egressPolicyTables []int
+
+// SetEgressPolicyRoutes - brings the ip rules and routes of the egress policies in line with routes, rules
+// and routes already present are kept so the traffic of unchanged policies is not disrupted; nil removes them
+func SetEgressPolicyRoutes(routes []EgressPolicyRoute) error {
+	l, err := netlink.LinkByName(ncutils.GetInterfaceName())
+	if err != nil {
+		if len(routes) == 0 {
+			return nil
+		}
+		return err
+	}
+	wantedRules := make(map[string]*netlink.Rule)
+	tables := []int{}
+	for _, route := range routes {
+		rule := netlink.NewRule()
+		rule.Family = netlink.FAMILY_V4
+		if route.Gateway.To4() == nil {
+			rule.Family = netlink.FAMILY_V6
+		}
+		rule.Table = route.Table
+		rule.Priority = EgressPolicyRulePriority
+		rule.Mark = route.Mark
+		rule.Mask = EgressPolicyMarkMask
+		wantedRules[fmt.Sprintf("%d/%d/%d", rule.Family, rule.Table, rule.Mark)] = rule
+		tables = append(tables, route.Table)
+		if err := setTableRoutes(l, route); err != nil {
+			return err
+		}
+	}
+	for _, table := range egressPolicyTables {
+		if !slices.Contains(tables, table) {
+			flushTable(table)
+		}
+	}
+	egressPolicyTables = tables
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules, err := netlink.RuleList(family)
+		if err != nil {
+			return err
+		}
+		for i := range rules {
+			if rules[i].Priority != EgressPolicyRulePriority {
+				continue
+			}
+			key := fmt.Sprintf("%d/%d/%d", family, rules[i].Table, rules[i].Mark)
+			if _, ok := wantedRules[key]; ok && rules[i].Mask == EgressPolicyMarkMask {
+				delete(wantedRules, key)
+				continue
+			}
+			if err := netlink.RuleDel(&rules[i]); err != nil && !errors.Is(err, unix.ENOENT) {
+				slog.Debug("failed to remove egress policy rule", "table", rules[i].Table, "error", err)
+			}
+		}
+	}
+	for _, rule := range wantedRules {
+		if err := netlink.RuleAdd(rule); err != nil && !errors.Is(err, unix.EEXIST) {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTableRoutes - routes the destinations of the egress policy via its gateway in its routing table,
+// removing the other routes of the netmaker interface from the table
+func setTableRoutes(l netlink.Link, route EgressPolicyRoute) error {
+	present, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{LinkIndex: l.Attrs().Index, Table: route.Table},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[string]bool, len(route.Destinations))
+	for _, dst := range route.Destinations {
+		wanted[dst.String()] = true
+	}
+	for i := range present {
+		if present[i].Dst != nil && wanted[present[i].Dst.String()] && present[i].Gw.Equal(route.Gateway) {
+			delete(wanted, present[i].Dst.String())
+			continue
+		}
+		if err := netlink.RouteDel(&present[i]); err != nil && !errors.Is(err, unix.ESRCH) {
+			slog.Debug("failed to remove route", "table", route.Table, "route", present[i].Dst, "error", err)
+		}
+	}
+	for _, dst := range route.Destinations {
+		dst := dst
+		if !wanted[dst.String()] {
+			continue
+		}
+		if err := netlink.RouteReplace(&netlink.Route{
+			LinkIndex: l.Attrs().Index,
+			Dst:       &dst,
+			Gw:        route.Gateway,
+			Flags:     int(netlink.FLAG_ONLINK),
+			Table:     route.Table,
+		}); err != nil {
+			return fmt.Errorf("failed to add route to %s via %s: %w", dst.String(), route.Gateway, err)
+		}
+	}
+	return nil
+}
+
+// flushTable - removes the routes of the netmaker interface from the routing table
+func flushTable(table int) {
+	l, err := netlink.LinkByName(ncutils.GetInterfaceName())
+	if err != nil {
+		return
+	}
+	routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{LinkIndex: l.Attrs().Index, Table: table},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		slog.Debug("failed to list routes", "table", table, "error", err)
+		return
+	}
+	for i := range routes {
+		if err := netlink.RouteDel(&routes[i]); err != nil && !errors.Is(err, unix.ESRCH) {
+			slog.Debug("failed to remove route", "table", table, "route", routes[i].Dst, "error", err)
+		}
+	}
+}
+
 type netLink struct {
 	attrs *netlink.LinkAttrs
 }
@@ -179,3 +590,9 @@ func DeleteOldInterface(iface string) {
 		logger.Log(0, "error removing interface", iface, err.Error())
 	}
 }
+
+// KernelSupport - reports if kernel wireguard is available and if the tun device for the
+// userspace fallback is available
+func KernelSupport() (kernel, tun bool) {
+	return isKernelWireGuardPresent(), isTunModuleLoaded()
+}
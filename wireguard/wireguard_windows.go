@@ -82,6 +82,24 @@ func SetRoutes(addrs []ifaceAddress) {
 	}
 }
 
+// RemoveRoutes - removes additional routes from the interface
+func RemoveRoutes(addrs []ifaceAddress) {
+	for _, addr := range addrs {
+		if addr.Network.IP == nil {
+			continue
+		}
+		family := "ipv4"
+		if addr.Network.IP.To4() == nil {
+			family = "ipv6"
+		}
+		cmd := fmt.Sprintf("netsh int %s delete route %s interface=%s store=%s",
+			family, addr.Network.String(), ncutils.GetInterfaceName(), "active")
+		if _, err := ncutils.RunCmd(cmd, false); err != nil {
+			slog.Error("failed to remove", "egress range", addr.Network.String())
+		}
+	}
+}
+
 // NCIface.Close - closes the managed WireGuard interface
 func (nc *NCIface) Close() {
 	err := nc.Iface.Close()